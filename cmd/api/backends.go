@@ -0,0 +1,274 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/InfluxCommunity/influxdb3-go/influx"
+	"github.com/auth0/go-auth0/authentication"
+	"github.com/auth0/go-auth0/management"
+	"github.com/rs/zerolog"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/api/middlewares"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/services"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/batch"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/memory"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/postgres"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/spool"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/sqlite"
+)
+
+// Supported STORAGE_BACKEND, METRICS_BACKEND and AUTH_BACKEND values, the
+// cloud backends are used when the variables are empty. METRICS_BACKEND only
+// applies to the cloud storage backend
+const (
+	storageBackendMemory   = "memory"
+	storageBackendSQLite   = "sqlite"
+	metricsBackendPostgres = "postgres"
+	authBackendLocal       = "local"
+)
+
+// Spool defaults, the size limit can be changed with SPOOL_MAX_BYTES
+const (
+	defaultSpoolMaxBytes = 512 << 20
+	spoolReplayInterval  = 5 * time.Second
+	spoolMaxBackoff      = 5 * time.Minute
+)
+
+// repositories groups the storage implementations selected by STORAGE_BACKEND
+type repositories struct {
+	metrics     storage.MetricRepository
+	userDevices storage.UserDeviceRepository
+	alerts      storage.AlertRepository
+	webhooks    storage.WebhookRepository
+	retention   storage.RetentionRepository
+	// spool keeps the failed metric writes, it's nil when spooling is disabled
+	spool *spool.Spool
+	// run starts the backend background workers until the context is done
+	run func(ctx context.Context)
+	// close releases the backend clients once the server is stopped
+	close func()
+}
+
+func newRepositories(ctx context.Context, logger zerolog.Logger) repositories {
+	backend := os.Getenv("STORAGE_BACKEND")
+	switch backend {
+	case storageBackendMemory:
+		logger.Warn().Msg("Using in-memory storage, data is lost when the service stops")
+		return repositories{
+			metrics:     memory.NewMetricRepository(),
+			userDevices: memory.NewUserDeviceRepository(),
+			alerts:      memory.NewAlertRepository(),
+			webhooks:    memory.NewWebhookRepository(),
+			retention:   memory.NewRetentionRepository(),
+			run:         func(ctx context.Context) {},
+			close:       func() {},
+		}
+	case storageBackendSQLite:
+		path := os.Getenv("SQLITE_PATH")
+		if len(path) == 0 {
+			path = "hydroponics.db"
+		}
+		db, err := sqlite.Open(ctx, path)
+		if err != nil {
+			panic(errors.InternalServerErr.WithMsg("failed to open sqlite database").WithErr(err).Error())
+		}
+		logger.Info().Str("path", path).Msg("Using sqlite storage")
+		return repositories{
+			metrics:     sqlite.NewMetricRepository(db),
+			userDevices: sqlite.NewUserDeviceRepository(db),
+			alerts:      sqlite.NewAlertRepository(db),
+			webhooks:    sqlite.NewWebhookRepository(db),
+			retention:   sqlite.NewRetentionRepository(db),
+			run:         func(ctx context.Context) {},
+			close:       func() { db.Close() },
+		}
+	case "":
+	default:
+		panic(errors.InternalServerErr.WithMsg("unknown STORAGE_BACKEND").WithDetails("backend", backend).Error())
+	}
+
+	metrics, closeMetrics := newMetricRepository(ctx, logger)
+	metrics, metricSpool, runSpool, closeSpool := newSpool(metrics, logger)
+	firestoreCli := newFirestoreClient(ctx)
+
+	return repositories{
+		metrics:     metrics,
+		userDevices: storage.NewUserDeviceRepository(firestoreCli),
+		alerts:      storage.NewAlertRepository(firestoreCli),
+		webhooks:    storage.NewWebhookRepository(firestoreCli),
+		retention:   storage.NewRetentionRepository(firestoreCli),
+		spool:       metricSpool,
+		run:         runSpool,
+		close: func() {
+			closeSpool()
+			closeMetrics()
+			firestoreCli.Close()
+		},
+	}
+}
+
+// newMetricRepository builds the cloud metric repository selected by
+// METRICS_BACKEND, defaulting to InfluxDB
+func newMetricRepository(ctx context.Context, logger zerolog.Logger) (storage.MetricRepository, func()) {
+	backend := os.Getenv("METRICS_BACKEND")
+	switch backend {
+	case metricsBackendPostgres:
+		pool, err := postgres.Open(ctx, os.Getenv("POSTGRES_DSN"))
+		if err != nil {
+			panic(errors.InternalServerErr.WithMsg("failed to open postgres database").WithErr(err).Error())
+		}
+		return postgres.NewMetricRepository(pool), pool.Close
+	case "":
+	default:
+		panic(errors.InternalServerErr.WithMsg("unknown METRICS_BACKEND").WithDetails("backend", backend).Error())
+	}
+
+	database := os.Getenv("DATABASE")
+	hostURL := os.Getenv("INFLUXDB_HOST")
+	authToken := os.Getenv("INFLUXDB_TOKEN")
+
+	influxCli, err := influx.New(influx.Configs{
+		HostURL:   hostURL,
+		AuthToken: authToken,
+	})
+	if err != nil {
+		panic(errors.InternalServerErr.WithMsg("failed to create influx client").WithErr(err).Error())
+	}
+
+	logger.Debug().Str("database", database).Str("hostURL", hostURL).Str("authToken", authToken).Msg("Creating repository with the environment variables")
+	return storage.NewRepository(database, influxCli), func() { influxCli.Close() }
+}
+
+// newSpool wraps the metric repository with the on-disk spool at SPOOL_DIR, the
+// repository is returned as is when SPOOL_DIR is empty
+func newSpool(metrics storage.MetricRepository, logger zerolog.Logger) (storage.MetricRepository, *spool.Spool, func(ctx context.Context), func()) {
+	dir := os.Getenv("SPOOL_DIR")
+	if len(dir) == 0 {
+		return metrics, nil, func(ctx context.Context) {}, func() {}
+	}
+
+	maxBytes := int64(defaultSpoolMaxBytes)
+	if value := os.Getenv("SPOOL_MAX_BYTES"); len(value) > 0 {
+		var err error
+		maxBytes, err = strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			panic(errors.InternalServerErr.WithMsg("invalid SPOOL_MAX_BYTES").WithErr(err).Error())
+		}
+	}
+
+	metricSpool, err := spool.Open(dir, maxBytes)
+	if err != nil {
+		panic(errors.InternalServerErr.WithMsg("failed to open metrics spool").WithErr(err).Error())
+	}
+
+	depth := metricSpool.Depth()
+	logger.Info().Str("dir", dir).Int64("maxBytes", maxBytes).Int("batches", depth.Batches).Int64("bytes", depth.Bytes).Msg("Spooling failed metric writes")
+	run := func(ctx context.Context) {
+		metricSpool.Run(ctx, metrics, spoolReplayInterval, spoolMaxBackoff)
+	}
+	return spool.NewMetricRepository(metrics, metricSpool), metricSpool, run, func() { metricSpool.Close() }
+}
+
+// newFirestoreClient connects to the firestore database of PROJECT_ID
+func newFirestoreClient(ctx context.Context) *firestore.Client {
+	firestoreCli, err := firestore.NewClient(ctx, os.Getenv("PROJECT_ID"))
+	if err != nil {
+		panic(errors.InternalServerErr.WithMsg("failed to create firestore client").WithErr(err).Error())
+	}
+	return firestoreCli
+}
+
+// newBatchConfig reads the batching writer limits from BATCH_MAX_POINTS,
+// BATCH_MAX_BYTES, BATCH_MAX_LATENCY and BATCH_BUFFER_BYTES, using the
+// defaults for the empty ones. Every limit must be positive
+func newBatchConfig() batch.Config {
+	config := batch.DefaultConfig
+	for name, value := range map[string]*int{
+		"BATCH_MAX_POINTS":   &config.MaxPoints,
+		"BATCH_MAX_BYTES":    &config.MaxBytes,
+		"BATCH_BUFFER_BYTES": &config.BufferBytes,
+	} {
+		if env := os.Getenv(name); len(env) > 0 {
+			var err error
+			*value, err = strconv.Atoi(env)
+			if err != nil {
+				panic(errors.InternalServerErr.WithMsg("invalid " + name).WithErr(err).Error())
+			}
+			if *value <= 0 {
+				panic(errors.InternalServerErr.WithMsg(name + " must be positive").Error())
+			}
+		}
+	}
+
+	if env := os.Getenv("BATCH_MAX_LATENCY"); len(env) > 0 {
+		var err error
+		config.MaxLatency, err = time.ParseDuration(env)
+		if err != nil {
+			panic(errors.InternalServerErr.WithMsg("invalid BATCH_MAX_LATENCY").WithErr(err).Error())
+		}
+		if config.MaxLatency <= 0 {
+			panic(errors.InternalServerErr.WithMsg("BATCH_MAX_LATENCY must be positive").Error())
+		}
+	}
+	return config
+}
+
+// newAuth builds the user management, the authenticator, the token
+// validation middleware and the token validator selected by AUTH_BACKEND
+func newAuth(ctx context.Context, logger zerolog.Logger) (services.UserService, services.Authenticator, func(next http.Handler) http.Handler, middlewares.TokenValidator) {
+	backend := os.Getenv("AUTH_BACKEND")
+	switch backend {
+	case authBackendLocal:
+		secret := []byte(os.Getenv("LOCAL_AUTH_SECRET"))
+		if len(secret) == 0 {
+			logger.Warn().Msg("LOCAL_AUTH_SECRET is empty, issued tokens are only valid until the service stops")
+			secret = make([]byte, 32)
+			_, err := rand.Read(secret)
+			if err != nil {
+				panic(errors.InternalServerErr.WithMsg("failed to generate local auth secret").WithErr(err).Error())
+			}
+		}
+		localAuth := services.NewLocalAuth(secret)
+		return localAuth, localAuth, middlewares.EnsureValidLocalToken(secret), middlewares.NewLocalTokenValidator(secret)
+	case "":
+	default:
+		panic(errors.InternalServerErr.WithMsg("unknown AUTH_BACKEND").WithDetails("backend", backend).Error())
+	}
+
+	auth0Domain := os.Getenv("AUTH0_DOMAIN")
+	auth0ClientID := os.Getenv("AUTH0_CLIENTID")
+	auth0ClientSecret := os.Getenv("AUTH0_CLIENT_SECRET")
+	authAudience := os.Getenv("AUTH_AUDIENCE")
+	authNonce := os.Getenv("AUTH0_NONCE")
+	env := os.Getenv("ENV")
+
+	authCli, err := authentication.New(
+		ctx,
+		auth0Domain,
+		authentication.WithClientID(auth0ClientID),
+		authentication.WithClientSecret(auth0ClientSecret))
+	if err != nil {
+		panic(errors.InternalServerErr.WithMsg("failed to create auth0 authentication client").WithDetails("err", err.Error()).Error())
+	}
+
+	managementCli, err := management.New(auth0Domain, management.WithClientCredentials(ctx, auth0ClientID, auth0ClientSecret))
+	if err != nil {
+		panic(errors.InternalServerErr.WithMsg("failed to create auth0 management client").WithDetails("err", err.Error()).Error())
+	}
+
+	authService := services.NewAuthService(authCli.OAuth, env, authAudience, authNonce)
+	userService := services.NewUserService(managementCli.User, managementCli.Role)
+	validateToken, err := middlewares.NewAuth0TokenValidator()
+	if err != nil {
+		panic(errors.InternalServerErr.WithMsg("failed to create auth0 token validator").WithErr(err).Error())
+	}
+	return userService, authService, middlewares.EnsureValidToken(validateToken), validateToken
+}
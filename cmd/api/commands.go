@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+
+	"github.com/rs/zerolog"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+// Commands run once and exit, like the jobs triggered by a scheduler with
+// the api image, e.g. a Cloud Run job running "/hydroponics-metrics-collector purge"
+const (
+	// commandPurge deletes the measurements past the retention of their users
+	commandPurge = "purge"
+	// commandMigrate converts the firestore documents written by older
+	// versions, which the repositories read as well until then
+	commandMigrate = "migrate"
+)
+
+func runCommand(ctx context.Context, logger zerolog.Logger, name string) {
+	var err error
+	switch name {
+	case commandPurge:
+		err = purge(ctx, logger)
+	case commandMigrate:
+		err = migrate(ctx, logger)
+	default:
+		panic(errors.InternalServerErr.WithMsg("unknown command").WithDetails("command", name).Error())
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("command", name).Msg("command failed")
+		os.Exit(1)
+	}
+	logger.Info().Str("command", name).Msg("command completed")
+}
+
+// newRetentionDays reads the default retention from RETENTION_DAYS,
+// measurements are kept forever unless a retention is configured
+func newRetentionDays() int {
+	value := os.Getenv("RETENTION_DAYS")
+	if len(value) == 0 {
+		return 0
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		panic(errors.InternalServerErr.WithMsg("invalid RETENTION_DAYS").WithDetails("value", value).Error())
+	}
+	return days
+}
+
+func purge(ctx context.Context, logger zerolog.Logger) error {
+	repositories := newRepositories(ctx, logger)
+	defer repositories.close()
+
+	retentionLogic := logic.NewRetentionLogic(repositories.retention, repositories.userDevices, repositories.metrics, newRetentionDays())
+	return retentionLogic.Purge(ctx)
+}
+
+// migrate converts the user devices to device records first, device owners
+// are indexed from them
+func migrate(ctx context.Context, logger zerolog.Logger) error {
+	if backend := os.Getenv("STORAGE_BACKEND"); len(backend) > 0 {
+		logger.Info().Str("backend", backend).Msg("Nothing to migrate, the schema is migrated when the database is opened")
+		return nil
+	}
+
+	firestoreCli := newFirestoreClient(ctx)
+	defer firestoreCli.Close()
+	err := storage.MigrateUserDevices(ctx, firestoreCli)
+	if err != nil {
+		return err
+	}
+	return storage.MigrateDeviceOwners(ctx, firestoreCli)
+}
@@ -2,38 +2,51 @@ package main
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
-	"cloud.google.com/go/firestore"
-	"github.com/auth0/go-auth0/authentication"
-	"github.com/auth0/go-auth0/management"
 	"github.com/go-chi/httplog"
+	"google.golang.org/grpc"
 
-	"github.com/InfluxCommunity/influxdb3-go/influx"
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/api"
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/api/endpoints"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/coap"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/live"
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/mqtt"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/rpc"
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/services"
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
-	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/batch"
 )
 
 func main() {
-	database := os.Getenv("DATABASE")
-	hostURL := os.Getenv("INFLUXDB_HOST")
-	authToken := os.Getenv("INFLUXDB_TOKEN")
-	auth0Domain := os.Getenv("AUTH0_DOMAIN")
-	auth0ClientID := os.Getenv("AUTH0_CLIENTID")
-	auth0ClientSecret := os.Getenv("AUTH0_CLIENT_SECRET")
-	authAudience := os.Getenv("AUTH_AUDIENCE")
 	authNonce := os.Getenv("AUTH0_NONCE")
-	env := os.Getenv("ENV")
 	roleID := os.Getenv("USER_ROLE_ID")
-	projectID := os.Getenv("PROJECT_ID")
+	smtpHost := os.Getenv("SMTP_HOST")
+	silenceThreshold := 30 * time.Minute
+	if value := os.Getenv("DEVICE_SILENCE_THRESHOLD"); len(value) > 0 {
+		threshold, err := time.ParseDuration(value)
+		if err != nil {
+			panic(errors.InternalServerErr.WithMsg("invalid DEVICE_SILENCE_THRESHOLD").WithErr(err).Error())
+		}
+		silenceThreshold = threshold
+	}
+	retentionDays := newRetentionDays()
+	// retried readings are dropped when seen again during the window
+	dedupWindow := 10 * time.Minute
+	if value := os.Getenv("INGEST_DEDUP_WINDOW"); len(value) > 0 {
+		window, err := time.ParseDuration(value)
+		if err != nil {
+			panic(errors.InternalServerErr.WithMsg("invalid INGEST_DEDUP_WINDOW").WithErr(err).Error())
+		}
+		dedupWindow = window
+	}
 
 	ctx := context.Background()
 	logger := httplog.NewLogger("hydroponics-metrics-collector", httplog.Options{
@@ -44,47 +57,141 @@ func main() {
 		TimeFieldName:   "timestamp",
 	})
 
-	influxCli, err := influx.New(influx.Configs{
-		HostURL:   hostURL,
-		AuthToken: authToken,
-	})
-	if err != nil {
-		panic(errors.InternalServerErr.WithMsg("failed to create influx client").WithErr(err).Error())
+	// one-off commands run as scheduled jobs instead of in every instance
+	if len(os.Args) > 1 {
+		runCommand(ctx, logger, os.Args[1])
+		return
 	}
 
-	metricsRepository := storage.NewRepository(database, influxCli)
-	firestoreCli, err := firestore.NewClient(ctx, projectID)
-	if err != nil {
-		panic(errors.InternalServerErr.WithMsg("failed to create firestore client").WithErr(err).Error())
+	repositories := newRepositories(ctx, logger)
+	userService, authService, authenticate, validateToken := newAuth(ctx, logger)
+
+	webhookSender := services.NewWebhookSender(services.NewWebhookClient(30 * time.Second))
+	webhookLogic := logic.NewWebhookLogic(repositories.webhooks, webhookSender, time.Second)
+	webhookEndpoints := endpoints.NewWebhookEndpoints(webhookLogic)
+
+	eventListeners := []logic.EventListener{webhookLogic}
+	var notificationLogic logic.NotificationLogic
+	if len(smtpHost) > 0 {
+		smtpPort, err := strconv.Atoi(os.Getenv("SMTP_PORT"))
+		if err != nil {
+			panic(errors.InternalServerErr.WithMsg("invalid SMTP_PORT").WithErr(err).Error())
+		}
+		emailSender, err := services.NewSMTPSender(services.SMTPConfig{
+			Host:     smtpHost,
+			Port:     smtpPort,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+			TLS:      os.Getenv("SMTP_TLS"),
+		})
+		if err != nil {
+			panic(errors.InternalServerErr.WithMsg("invalid SMTP_TLS").WithErr(err).Error())
+		}
+		notificationLogic, err = logic.NewNotificationLogic(userService, emailSender)
+		if err != nil {
+			panic(errors.InternalServerErr.WithMsg("failed to create notification logic").WithErr(err).Error())
+		}
+		eventListeners = append(eventListeners, notificationLogic)
 	}
 
-	userDeviceRepository := storage.NewUserDeviceRepository(firestoreCli)
-	logger.Debug().Str("database", database).Str("hostURL", hostURL).Str("authToken", authToken).Msg("Creating repository with the environment variables")
-	metricsLogic := logic.NewMetricLogic(metricsRepository, userDeviceRepository)
-	metricsEndpoints := endpoints.NewMetricsEndpoints(metricsLogic)
-
-	authCli, err := authentication.New(
-		ctx,
-		auth0Domain,
-		authentication.WithClientID(auth0ClientID),
-		authentication.WithClientSecret(auth0ClientSecret))
-	if err != nil {
-		panic(errors.InternalServerErr.WithMsg("failed to create auth0 authentication client").WithDetails("err", err.Error()).Error())
+	alertLogic := logic.NewAlertLogic(repositories.alerts, repositories.userDevices, eventListeners...)
+	alertEndpoints := endpoints.NewAlertEndpoints(alertLogic)
+
+	metricWriter := batch.NewWriter(repositories.metrics, newBatchConfig())
+	hub := live.NewHub()
+	metricsLogic := logic.NewMetricLogic(metricWriter, repositories.userDevices, hub, alertLogic, webhookLogic)
+	if dedupWindow > 0 {
+		metricsLogic = logic.NewDeduplicatedMetricLogic(metricsLogic, dedupWindow)
+	}
+	metricsEndpoints := endpoints.NewMetricsEndpoints(metricsLogic, hub)
+
+	// constrained devices authenticate with a pre-shared token
+	deviceTokenSecret := os.Getenv("DEVICE_TOKEN_SECRET")
+	deviceTokenLogic := logic.NewDeviceTokenLogic(repositories.userDevices, []byte(deviceTokenSecret))
+	deviceTokenEndpoints := endpoints.NewDeviceTokenEndpoints(deviceTokenLogic)
+
+	// devices can also publish their metrics to a broker instead of the api
+	var subscriber *mqtt.Subscriber
+	if brokerURL := os.Getenv("MQTT_BROKER_URL"); len(brokerURL) > 0 {
+		if len(deviceTokenSecret) == 0 {
+			panic(errors.InternalServerErr.WithMsg("DEVICE_TOKEN_SECRET is required by the mqtt subscriber").Error())
+		}
+		config := newMQTTConfig(brokerURL)
+		var err error
+		subscriber, err = mqtt.NewSubscriber(config, metricsLogic, deviceTokenLogic)
+		if err != nil {
+			panic(errors.InternalServerErr.WithMsg("invalid MQTT_TOPIC").WithErr(err).Error())
+		}
+		connectCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		err = subscriber.Connect(connectCtx)
+		cancel()
+		if err != nil {
+			panic(err.Error())
+		}
 	}
 
-	managementCli, err := management.New(auth0Domain, management.WithClientCredentials(ctx, auth0ClientID, auth0ClientSecret))
-	if err != nil {
-		panic(errors.InternalServerErr.WithMsg("failed to create auth0 management client").WithDetails("err", err.Error()).Error())
+	deviceMonitor := logic.NewDeviceMonitor(repositories.userDevices, repositories.metrics, silenceThreshold, eventListeners...)
+	monitorCtx, stopMonitor := context.WithCancel(ctx)
+	go deviceMonitor.Run(monitorCtx, silenceThreshold/6)
+	go repositories.run(monitorCtx)
+	// the writer stops separately so stopping it doesn't cancel an ongoing flush
+	stopWriter := make(chan struct{})
+	go metricWriter.Run(ctx, stopWriter)
+
+	var coapServer *coap.Server
+	if coapAddress := os.Getenv("COAP_ADDRESS"); len(coapAddress) > 0 {
+		if len(deviceTokenSecret) == 0 {
+			panic(errors.InternalServerErr.WithMsg("DEVICE_TOKEN_SECRET is required by the coap server").Error())
+		}
+		// the tokens are sent in clear unless the coap server runs over dtls
+		dtlsConfig := newDTLSConfig()
+		coapServer = coap.NewServer(metricsLogic, deviceTokenLogic)
+		go func() {
+			logger.Info().Str("address", coapAddress).Bool("dtls", dtlsConfig != nil).Msg("CoAP server started listening")
+			var err error
+			if dtlsConfig != nil {
+				err = coapServer.ListenAndServeDTLS(coapAddress, dtlsConfig)
+			} else {
+				err = coapServer.ListenAndServe(coapAddress)
+			}
+			if err != nil {
+				logger.Fatal().Err(err).Msg("coap server failed")
+			}
+		}()
 	}
 
-	authService := services.NewAuthService(authCli.OAuth, env, authAudience, authNonce)
-	userService := services.NewUserService(managementCli.User, managementCli.Role)
+	// gateways can upload the readings of many sensors over grpc
+	var grpcServer *grpc.Server
+	if grpcAddress := os.Getenv("GRPC_ADDRESS"); len(grpcAddress) > 0 {
+		listener, err := net.Listen("tcp", grpcAddress)
+		if err != nil {
+			panic(errors.InternalServerErr.WithMsg("failed to listen GRPC_ADDRESS").WithErr(err).Error())
+		}
+		grpcServer = rpc.NewServer(metricsLogic, validateToken, newGRPCCredentials()...)
+		go func() {
+			logger.Info().Str("address", grpcAddress).Msg("gRPC server started listening")
+			err := grpcServer.Serve(listener)
+			if err != nil {
+				logger.Fatal().Err(err).Msg("grpc server failed")
+			}
+		}()
+	}
 
-	userLogic := logic.NewUserLogic(userService, authService, userDeviceRepository, roleID)
+	userLogic := logic.NewUserLogic(userService, authService, repositories.userDevices, metricWriter, roleID, webhookLogic)
 	userEndpoints := endpoints.NewUserEndpoint(userLogic)
-	r := api.NewRouter(logger, metricsEndpoints, userEndpoints, authNonce)
+
+	retentionLogic := logic.NewRetentionLogic(repositories.retention, repositories.userDevices, metricWriter, retentionDays)
+	retentionEndpoints := endpoints.NewRetentionEndpoints(retentionLogic)
+
+	healthEndpoints := endpoints.NewHealthEndpoints(repositories.spool)
+
+	r := api.NewRouter(logger, authenticate, metricsEndpoints, userEndpoints, alertEndpoints, webhookEndpoints, retentionEndpoints, deviceTokenEndpoints, healthEndpoints, authNonce)
 
 	server := &http.Server{Addr: "0.0.0.0:8080", Handler: r}
+	// Shutdown doesn't cancel the requests in flight, the metric streams only
+	// end once the hub is closed
+	server.RegisterOnShutdown(hub.Close)
 
 	// Server run context
 	serverCtx, serverStopCtx := context.WithCancel(context.Background())
@@ -102,24 +209,43 @@ func main() {
 		shutdownCtx, cancel := context.WithTimeout(serverCtx, 30*time.Second)
 		defer cancel()
 
-		go func() {
-			influxCli.Close()
-			<-shutdownCtx.Done()
-			if shutdownCtx.Err() == context.DeadlineExceeded {
-				logger.Fatal().Msg("graceful shutdown timed out.. forcing exit.")
-			}
-		}()
+		// Trigger graceful shutdown, the buffered metrics are still drained
+		// when it times out
+		err := server.Shutdown(shutdownCtx)
+		if err != nil {
+			logger.Error().Err(err).Msg("graceful shutdown timed out, closing the remaining connections")
+			server.Close()
+		}
 
-		// Trigger graceful shutdown
-		err = server.Shutdown(shutdownCtx)
+		drainCtx, cancelDrain := context.WithTimeout(serverCtx, 30*time.Second)
+		defer cancelDrain()
+
+		// buffered metrics are written once no request can add more of them
+		if subscriber != nil {
+			subscriber.Disconnect()
+		}
+		if coapServer != nil {
+			coapServer.Stop()
+		}
+		if grpcServer != nil {
+			grpcServer.GracefulStop()
+		}
+		stopMonitor()
+		close(stopWriter)
+		err = metricWriter.Flush(drainCtx)
 		if err != nil {
-			logger.Fatal().Err(err)
+			logger.Error().Err(err).Msg("failed to flush buffered metrics")
+		}
+		webhookLogic.Wait(drainCtx)
+		if notificationLogic != nil {
+			notificationLogic.Wait()
 		}
+		repositories.close()
 		serverStopCtx()
 	}()
 
 	// Run the server
-	err = server.ListenAndServe()
+	err := server.ListenAndServe()
 	if err != nil && err != http.ErrServerClosed {
 		logger.Fatal().Err(err)
 	}
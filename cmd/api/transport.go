@@ -0,0 +1,91 @@
+package main
+
+import (
+	"crypto/tls"
+	"os"
+
+	"github.com/pion/dtls/v2"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/mqtt"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+)
+
+// MQTT defaults, the client ID prefix is followed by the hostname
+const (
+	mqttClientPrefix       = "hydroponics-metrics-collector-"
+	defaultMQTTSharedGroup = "hydroponics-metrics-collector"
+)
+
+// newDTLSConfig loads the COAP_DTLS_CERT and COAP_DTLS_KEY PEM files. Plain
+// UDP sends the device tokens in clear, so it's only served when
+// COAP_INSECURE is true, in which case the returned config is nil
+func newDTLSConfig() *dtls.Config {
+	certFile, keyFile := os.Getenv("COAP_DTLS_CERT"), os.Getenv("COAP_DTLS_KEY")
+	if len(certFile) == 0 && len(keyFile) == 0 {
+		if os.Getenv("COAP_INSECURE") != "true" {
+			panic(errors.InternalServerErr.WithMsg("COAP_DTLS_CERT and COAP_DTLS_KEY are required by the coap server unless COAP_INSECURE is true").Error())
+		}
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		panic(errors.InternalServerErr.WithMsg("invalid COAP_DTLS_CERT or COAP_DTLS_KEY").WithErr(err).Error())
+	}
+	return &dtls.Config{
+		Certificates:         []tls.Certificate{cert},
+		ExtendedMasterSecret: dtls.RequireExtendedMasterSecret,
+	}
+}
+
+// newGRPCCredentials loads the GRPC_TLS_CERT and GRPC_TLS_KEY PEM files. The
+// gateways send bearer tokens in the call metadata, so plaintext is only
+// served when GRPC_INSECURE is true, in which case no option is returned
+func newGRPCCredentials() []grpc.ServerOption {
+	certFile, keyFile := os.Getenv("GRPC_TLS_CERT"), os.Getenv("GRPC_TLS_KEY")
+	if len(certFile) == 0 && len(keyFile) == 0 {
+		if os.Getenv("GRPC_INSECURE") != "true" {
+			panic(errors.InternalServerErr.WithMsg("GRPC_TLS_CERT and GRPC_TLS_KEY are required by the grpc server unless GRPC_INSECURE is true").Error())
+		}
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		panic(errors.InternalServerErr.WithMsg("invalid GRPC_TLS_CERT or GRPC_TLS_KEY").WithErr(err).Error())
+	}
+	return []grpc.ServerOption{grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}))}
+}
+
+// newMQTTConfig reads the broker connection from the MQTT_* variables. Every
+// instance connects with its own client ID, derived from the hostname unless
+// MQTT_CLIENT_ID is set, and joins the MQTT_SHARED_GROUP shared subscription
+// so each message is only written by one of them
+func newMQTTConfig(brokerURL string) mqtt.Config {
+	clientID := os.Getenv("MQTT_CLIENT_ID")
+	if len(clientID) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			panic(errors.InternalServerErr.WithMsg("failed to read hostname, MQTT_CLIENT_ID is required").WithErr(err).Error())
+		}
+		clientID = mqttClientPrefix + hostname
+	}
+	sharedGroup := os.Getenv("MQTT_SHARED_GROUP")
+	if len(sharedGroup) == 0 {
+		sharedGroup = defaultMQTTSharedGroup
+	}
+
+	return mqtt.Config{
+		BrokerURL:   brokerURL,
+		ClientID:    clientID,
+		Username:    os.Getenv("MQTT_USERNAME"),
+		Password:    os.Getenv("MQTT_PASSWORD"),
+		Topic:       os.Getenv("MQTT_TOPIC"),
+		SharedGroup: sharedGroup,
+	}
+}
@@ -0,0 +1,113 @@
+package endpoints
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+type AlertEndpoints struct {
+	logic logic.AlertLogic
+}
+
+func NewAlertEndpoints(l logic.AlertLogic) AlertEndpoints {
+	return AlertEndpoints{logic: l}
+}
+
+type AlertRuleResponse struct {
+	models.AlertRule
+}
+
+func (a AlertRuleResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (e AlertEndpoints) CreateRule(w http.ResponseWriter, r *http.Request) {
+	var rule models.AlertRule
+	err := render.Bind(r, &rule)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to decode alert rule")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+	rule.UserID = chi.URLParam(r, "userID")
+	rule.DeviceID = chi.URLParam(r, "deviceID")
+
+	rule, err = e.logic.CreateRule(r.Context(), rule)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create alert rule")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, AlertRuleResponse{rule})
+}
+
+type GetAlertRulesResponse struct {
+	UserID string             `json:"user_id"`
+	Rules  []models.AlertRule `json:"rules"`
+}
+
+func (g GetAlertRulesResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (e AlertEndpoints) GetRules(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	rules, err := e.logic.GetRules(r.Context(), userID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to retrieve alert rules")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	render.Render(w, r, GetAlertRulesResponse{UserID: userID, Rules: rules})
+	render.Status(r, http.StatusOK)
+}
+
+func (e AlertEndpoints) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	err := e.logic.DeleteRule(r.Context(), chi.URLParam(r, "userID"), chi.URLParam(r, "ruleID"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete alert rule")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+type GetAlertEventsResponse struct {
+	UserID string              `json:"user_id"`
+	Events []models.AlertEvent `json:"events"`
+}
+
+func (g GetAlertEventsResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (e AlertEndpoints) GetEvents(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	query, err := parseRangeAndFields(r)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to parse alert events query")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	events, err := e.logic.GetEvents(r.Context(), userID, query.From, query.To)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to retrieve alert events")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	render.Render(w, r, GetAlertEventsResponse{UserID: userID, Events: events})
+	render.Status(r, http.StatusOK)
+}
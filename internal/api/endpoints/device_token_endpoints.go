@@ -0,0 +1,32 @@
+package endpoints
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+)
+
+type DeviceTokenEndpoints struct {
+	logic logic.DeviceTokenLogic
+}
+
+func NewDeviceTokenEndpoints(l logic.DeviceTokenLogic) DeviceTokenEndpoints {
+	return DeviceTokenEndpoints{logic: l}
+}
+
+func (e DeviceTokenEndpoints) IssueToken(w http.ResponseWriter, r *http.Request) {
+	token, err := e.logic.Issue(r.Context(), chi.URLParam(r, "userID"), chi.URLParam(r, "deviceID"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to issue device token")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	render.Render(w, r, token)
+	render.Status(r, http.StatusOK)
+}
@@ -0,0 +1,36 @@
+package endpoints
+
+import (
+	"net/http"
+
+	"github.com/go-chi/render"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/spool"
+)
+
+// Health is the state of the instance, Spool is only set when failed metric
+// writes are spooled
+type Health struct {
+	Status string       `json:"status"`
+	Spool  *spool.Depth `json:"spool,omitempty"`
+}
+
+type HealthEndpoints struct {
+	spool *spool.Spool
+}
+
+// NewHealthEndpoints reports the depth of metricSpool, which may be nil
+func NewHealthEndpoints(metricSpool *spool.Spool) HealthEndpoints {
+	return HealthEndpoints{spool: metricSpool}
+}
+
+func (e HealthEndpoints) Health(w http.ResponseWriter, r *http.Request) {
+	health := Health{Status: "ok"}
+	if e.spool != nil {
+		depth := e.spool.Depth()
+		health.Spool = &depth
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, health)
+}
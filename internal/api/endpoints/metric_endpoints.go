@@ -1,14 +1,22 @@
 package endpoints
 
 import (
+	"errors"
 	"math"
+	"mime"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/render"
-	"github.com/go-playground/validator/v10"
 	"github.com/rs/zerolog/log"
+	"github.com/vmihailenco/msgpack/v5"
 
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/live"
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
 	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
@@ -16,10 +24,11 @@ import (
 
 type MetricsEndpoints struct {
 	logic logic.MetricLogic
+	hub   *live.Hub
 }
 
-func NewMetricsEndpoints(logic logic.MetricLogic) MetricsEndpoints {
-	return MetricsEndpoints{logic: logic}
+func NewMetricsEndpoints(logic logic.MetricLogic, hub *live.Hub) MetricsEndpoints {
+	return MetricsEndpoints{logic: logic, hub: hub}
 }
 
 type RegisterMetricRequest struct {
@@ -27,36 +36,62 @@ type RegisterMetricRequest struct {
 }
 
 func (s *RegisterMetricRequest) Bind(r *http.Request) error {
-	validate := validator.New()
-	err := validate.Struct(s)
-	if err != nil {
-		return localErrs.BadRequestErr.WithErr(err).WithMsg("failed to validate request")
-	}
-
-	for _, v := range s.Metrics {
-		// parse timestamp
-		sec, dec := math.Modf(v.Timestamp)
-		v.Time = time.Unix(int64(sec), int64(dec*1e9))
+	return models.ValidateSensorRequests(s.Metrics)
+}
 
-		// we only store dates from the last 30 days
-		if v.Time.Before(time.Now().AddDate(0, 0, -30)) {
-			return localErrs.BadRequestErr.WithMsg("timestamp before 30 days is not acceptable")
-		}
-	}
+// WriteMetricsResponse lists the readings rejected from a batch written in
+// partial mode, the other readings were written
+type WriteMetricsResponse struct {
+	Status      int                      `json:"status"`
+	Description string                   `json:"description"`
+	Written     int                      `json:"written"`
+	Deferred    bool                     `json:"deferred"`
+	Rejected    []models.RejectedReading `json:"rejected"`
+}
 
+func (WriteMetricsResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusMultiStatus)
 	return nil
 }
 
+// RegisterMetric writes a batch of readings, any invalid reading rejects the
+// whole batch unless the partial query parameter is set
 func (e MetricsEndpoints) RegisterMetric(w http.ResponseWriter, r *http.Request) {
+	if isLineProtocol(r) {
+		e.WriteLines(w, r)
+		return
+	}
+
+	partial := false
+	if value := r.URL.Query().Get("partial"); len(value) > 0 {
+		var err error
+		partial, err = strconv.ParseBool(value)
+		if err != nil {
+			localErrs.RenderErr(w, r, localErrs.BadRequestErr.WithErr(err).WithMsg("invalid partial").WithDetails("value", value))
+			return
+		}
+	}
+
 	var request RegisterMetricRequest
-	err := render.Bind(r, &request)
+	err := decodeMetricRequest(r, &request)
+	if err == nil && !partial {
+		err = request.Bind(r)
+	}
 	if err != nil {
 		log.Warn().Err(err).Msg("failed to decode sensor request")
 		localErrs.RenderErr(w, r, err)
 		return
 	}
+	if partial {
+		e.registerPartially(w, r, request.Metrics)
+		return
+	}
 
 	err = e.logic.WriteSensorMetrics(r.Context(), request.Metrics)
+	if errors.Is(err, localErrs.AcceptedErr) {
+		localErrs.RenderErr(w, r, err)
+		return
+	}
 	if err != nil {
 		log.Error().Err(err).Msg("failed to write sensor metrics")
 		localErrs.RenderErr(w, r, err)
@@ -65,3 +100,244 @@ func (e MetricsEndpoints) RegisterMetric(w http.ResponseWriter, r *http.Request)
 
 	render.Status(r, http.StatusCreated)
 }
+
+// registerPartially writes the valid readings of the sensors owned by their
+// user and lists the rejected ones with their position in metrics
+func (e MetricsEndpoints) registerPartially(w http.ResponseWriter, r *http.Request, metrics []models.SensorRequest) {
+	if len(metrics) == 0 {
+		localErrs.RenderErr(w, r, localErrs.BadRequestErr.WithMsg("no metrics in body"))
+		return
+	}
+
+	rejected := models.ValidateEachSensorRequest(metrics)
+	valid := make([]models.SensorRequest, 0, len(metrics))
+	indexes := make([]int, 0, len(metrics))
+	next := 0
+	for i := range metrics {
+		if next < len(rejected) && rejected[next].Index == i {
+			next++
+			continue
+		}
+		valid = append(valid, metrics[i])
+		indexes = append(indexes, i)
+	}
+
+	written := 0
+	deferred := false
+	if len(valid) > 0 {
+		notOwned, err := e.logic.WriteSensorMetricsPartially(r.Context(), valid)
+		deferred = errors.Is(err, localErrs.AcceptedErr)
+		if err != nil && !deferred {
+			log.Error().Err(err).Msg("failed to write sensor metrics")
+			localErrs.RenderErr(w, r, err)
+			return
+		}
+		for _, reading := range notOwned {
+			reading.Index = indexes[reading.Index]
+			rejected = append(rejected, reading)
+		}
+		written = len(valid) - len(notOwned)
+	}
+
+	if len(rejected) == 0 {
+		if deferred {
+			localErrs.RenderErr(w, r, localErrs.AcceptedErr)
+			return
+		}
+		render.Status(r, http.StatusCreated)
+		return
+	}
+
+	sort.Slice(rejected, func(i, j int) bool {
+		return rejected[i].Index < rejected[j].Index
+	})
+	log.Warn().Int("rejected", len(rejected)).Int("written", written).Msg("partially wrote sensor metrics")
+	render.Render(w, r, WriteMetricsResponse{
+		Status:      http.StatusMultiStatus,
+		Description: "multi-status",
+		Written:     written,
+		Deferred:    deferred,
+		Rejected:    rejected,
+	})
+}
+
+// decodeMetricRequest decodes the body in the format of its Content-Type,
+// json by default
+func decodeMetricRequest(r *http.Request, request *RegisterMetricRequest) error {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	var err error
+	switch mediaType {
+	case "application/cbor":
+		err = cbor.NewDecoder(r.Body).Decode(request)
+	case "application/msgpack", "application/x-msgpack", "application/vnd.msgpack":
+		decoder := msgpack.NewDecoder(r.Body)
+		decoder.SetCustomStructTag("json")
+		err = decoder.Decode(request)
+	default:
+		err = render.DecodeJSON(r.Body, request)
+	}
+	if err != nil {
+		return bodyErr(err)
+	}
+	return nil
+}
+
+// bodyErr keeps the errors of the body reader, like a body too large, and
+// reports any other as a malformed body
+func bodyErr(err error) error {
+	var apiErr *localErrs.Error
+	if errors.As(err, &apiErr) {
+		return err
+	}
+	return localErrs.BadRequestErr.WithMsg("failed to decode body").WithErr(err)
+}
+
+// parseTime accepts both RFC3339 dates and unix timestamps in seconds, the
+// same format used by the devices when registering metrics
+func parseTime(value string) (time.Time, error) {
+	if len(value) == 0 {
+		return time.Time{}, nil
+	}
+
+	if timestamp, err := strconv.ParseFloat(value, 64); err == nil {
+		sec, dec := math.Modf(timestamp)
+		return time.Unix(int64(sec), int64(dec*1e9)), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, localErrs.BadRequestErr.WithErr(err).WithMsg("invalid time").WithDetails("value", value)
+	}
+	return t, nil
+}
+
+// parseWindow accepts go durations (1m, 15m, 1h) and days (1d)
+func parseWindow(value string) (time.Duration, error) {
+	if len(value) == 0 {
+		return 0, nil
+	}
+
+	if days, found := strings.CutSuffix(value, "d"); found {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, localErrs.BadRequestErr.WithErr(err).WithMsg("invalid window").WithDetails("value", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+
+	window, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, localErrs.BadRequestErr.WithErr(err).WithMsg("invalid window").WithDetails("value", value)
+	}
+	return window, nil
+}
+
+// parseRangeAndFields parses the from, to and fields query parameters shared by the read endpoints
+func parseRangeAndFields(r *http.Request) (models.MeasurementQuery, error) {
+	var query models.MeasurementQuery
+	var err error
+	values := r.URL.Query()
+	query.From, err = parseTime(values.Get("from"))
+	if err != nil {
+		return query, err
+	}
+	query.To, err = parseTime(values.Get("to"))
+	if err != nil {
+		return query, err
+	}
+
+	if fields := values.Get("fields"); len(fields) > 0 {
+		query.Fields = strings.Split(fields, ",")
+	}
+	return query, nil
+}
+
+func parseMeasurementQuery(r *http.Request) (models.MeasurementQuery, error) {
+	query, err := parseRangeAndFields(r)
+	if err != nil {
+		return query, err
+	}
+
+	query.SensorID = chi.URLParam(r, "deviceID")
+	if len(query.SensorID) == 0 {
+		return query, localErrs.BadRequestErr.WithMsg("missing device ID")
+	}
+
+	values := r.URL.Query()
+	query.Aggregation = values.Get("aggregation")
+	query.Window, err = parseWindow(values.Get("window"))
+	if err != nil {
+		return query, err
+	}
+
+	return query, nil
+}
+
+// GetMetricsResponse tells the aggregation and window the metrics were
+// downsampled with, they're empty for raw metrics
+type GetMetricsResponse struct {
+	UserID        string               `json:"user_id"`
+	DeviceID      string               `json:"device_id"`
+	Aggregation   string               `json:"aggregation,omitempty"`
+	WindowSeconds int64                `json:"window_seconds,omitempty"`
+	Metrics       []models.Measurement `json:"metrics"`
+}
+
+func (g GetMetricsResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (e MetricsEndpoints) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	query, err := parseMeasurementQuery(r)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to parse metrics query")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	series, err := e.logic.ReadSensorMetrics(r.Context(), userID, query)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read sensor metrics")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	response := GetMetricsResponse{
+		UserID:        userID,
+		DeviceID:      query.SensorID,
+		Aggregation:   series.Aggregation,
+		WindowSeconds: int64(series.Window.Seconds()),
+		Metrics:       series.Measurements,
+	}
+
+	render.Render(w, r, response)
+	render.Status(r, http.StatusOK)
+}
+
+type GetLatestMetricsResponse struct {
+	UserID  string                     `json:"user_id"`
+	Devices []models.LatestMeasurement `json:"devices"`
+}
+
+func (g GetLatestMetricsResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (e MetricsEndpoints) GetLatestMetrics(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	latest, err := e.logic.ReadLatestSensorMetrics(r.Context(), userID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to read latest sensor metrics")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	response := GetLatestMetricsResponse{
+		UserID:  userID,
+		Devices: latest,
+	}
+
+	render.Render(w, r, response)
+	render.Status(r, http.StatusOK)
+}
@@ -0,0 +1,303 @@
+package endpoints
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+const (
+	exportFormatCSV     = "csv"
+	exportFormatNDJSON  = "ndjson"
+	exportFormatArrow   = "arrow"
+	exportFormatParquet = "parquet"
+)
+
+// exportFlushInterval is the amount of measurements written before flushing the response
+const exportFlushInterval = 500
+
+// exportContentTypes maps the supported export formats to their content types
+var exportContentTypes = map[string]string{
+	exportFormatCSV:     "text/csv",
+	exportFormatNDJSON:  "application/x-ndjson",
+	exportFormatArrow:   "application/vnd.apache.arrow.stream",
+	exportFormatParquet: "application/vnd.apache.parquet",
+}
+
+// exportFormats are the formats in the order they're preferred when the
+// Accept header gives them the same quality
+var exportFormats = []string{exportFormatCSV, exportFormatNDJSON, exportFormatArrow, exportFormatParquet}
+
+// measurementEncoder writes measurements in a specific export format
+type measurementEncoder interface {
+	Begin() error
+	Encode(measurement models.Measurement) error
+	Flush() error
+	Close() error
+}
+
+type csvEncoder struct {
+	writer *csv.Writer
+	fields []string
+}
+
+func (c *csvEncoder) Begin() error {
+	return c.writer.Write(append([]string{"time", "sensor_id", "sensor_version", "alias"}, c.fields...))
+}
+
+func (c *csvEncoder) Encode(measurement models.Measurement) error {
+	record := []string{
+		measurement.Time.Format(time.RFC3339Nano),
+		measurement.SensorID,
+		measurement.SensorVersion,
+		measurement.Alias,
+	}
+	for _, field := range c.fields {
+		value, ok := measurement.Fields[field]
+		if !ok {
+			record = append(record, "")
+			continue
+		}
+		record = append(record, strconv.FormatFloat(value, 'f', -1, 64))
+	}
+	return c.writer.Write(record)
+}
+
+func (c *csvEncoder) Flush() error {
+	c.writer.Flush()
+	return c.writer.Error()
+}
+
+func (c *csvEncoder) Close() error {
+	return c.Flush()
+}
+
+type ndjsonEncoder struct {
+	encoder *json.Encoder
+}
+
+func (n *ndjsonEncoder) Begin() error {
+	return nil
+}
+
+func (n *ndjsonEncoder) Encode(measurement models.Measurement) error {
+	return n.encoder.Encode(measurement)
+}
+
+func (n *ndjsonEncoder) Flush() error {
+	return nil
+}
+
+func (n *ndjsonEncoder) Close() error {
+	return nil
+}
+
+func newMeasurementEncoder(format string, w io.Writer, fields []string) measurementEncoder {
+	switch format {
+	case exportFormatNDJSON:
+		return &ndjsonEncoder{encoder: json.NewEncoder(w)}
+	case exportFormatArrow:
+		return newArrowEncoder(w, fields, false)
+	case exportFormatParquet:
+		return newArrowEncoder(w, fields, true)
+	default:
+		return &csvEncoder{writer: csv.NewWriter(w), fields: fields}
+	}
+}
+
+// exportFormat picks the format from the format query parameter, falling back
+// to the accepted format with the highest quality, CSV is used without Accept
+func exportFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); len(format) > 0 {
+		if _, ok := exportContentTypes[format]; !ok {
+			return "", localErrs.BadRequestErr.WithMsg("unsupported export format").WithDetails("format", format)
+		}
+		return format, nil
+	}
+
+	header := r.Header.Get("Accept")
+	if len(strings.TrimSpace(header)) == 0 {
+		return exportFormatCSV, nil
+	}
+	ranges := parseAccept(header)
+	best, bestQuality := "", 0.0
+	for _, format := range exportFormats {
+		// the most specific range matching the format gives its quality
+		quality, specificity := 0.0, -1
+		for _, accepted := range ranges {
+			if matched := accepted.specificity(exportContentTypes[format]); matched > specificity {
+				quality, specificity = accepted.quality, matched
+			}
+		}
+		if quality > bestQuality {
+			best, bestQuality = format, quality
+		}
+	}
+	if len(best) == 0 {
+		return "", localErrs.NotAcceptableErr.WithMsg("unsupported export media type").WithDetails("accept", header)
+	}
+	return best, nil
+}
+
+// mediaRange is an Accept header entry, a quality of 0 refuses the media type
+type mediaRange struct {
+	mediaType string
+	quality   float64
+}
+
+// parseAccept returns the media ranges of the header, the ones with an
+// invalid media type or quality are ignored
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, accept := range strings.Split(header, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			quality, err = strconv.ParseFloat(q, 64)
+			if err != nil || quality < 0 || quality > 1 {
+				continue
+			}
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, quality: quality})
+	}
+	return ranges
+}
+
+// specificity tells how closely the range matches the content type, from 2
+// for the same media type to 0 for */*, or -1 when it doesn't match
+func (m mediaRange) specificity(contentType string) int {
+	switch {
+	case m.mediaType == contentType:
+		return 2
+	case m.mediaType == "*/*":
+		return 0
+	case strings.HasSuffix(m.mediaType, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(m.mediaType, "*")):
+		return 1
+	}
+	return -1
+}
+
+// exportStream delays writing the response until the first measurement is
+// available, so validation errors can still be rendered with their status code
+type exportStream struct {
+	w       http.ResponseWriter
+	encoder measurementEncoder
+	format  string
+	started bool
+	written int
+}
+
+func (s *exportStream) begin() error {
+	s.started = true
+	s.w.Header().Set("Content-Type", exportContentTypes[s.format])
+	s.w.Header().Set("Content-Disposition", `attachment; filename="metrics.`+s.format+`"`)
+	s.w.WriteHeader(http.StatusOK)
+	return s.encoder.Begin()
+}
+
+func (s *exportStream) write(measurement models.Measurement) error {
+	if !s.started {
+		err := s.begin()
+		if err != nil {
+			return err
+		}
+	}
+
+	err := s.encoder.Encode(measurement)
+	if err != nil {
+		return err
+	}
+
+	s.written++
+	if s.written%exportFlushInterval == 0 {
+		return s.flush()
+	}
+	return nil
+}
+
+func (s *exportStream) flush() error {
+	err := s.encoder.Flush()
+	if err != nil {
+		return err
+	}
+	s.flushResponse()
+	return nil
+}
+
+func (s *exportStream) close() error {
+	err := s.encoder.Close()
+	if err != nil {
+		return err
+	}
+	s.flushResponse()
+	return nil
+}
+
+func (s *exportStream) flushResponse() {
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (e MetricsEndpoints) ExportMetrics(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	format, err := exportFormat(r)
+	if err != nil {
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	query, err := parseRangeAndFields(r)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to parse export query")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+	if len(query.Fields) == 0 {
+		query.Fields = models.MeasurementFields
+	}
+
+	var devices []string
+	if value := r.URL.Query().Get("devices"); len(value) > 0 {
+		devices = strings.Split(value, ",")
+	}
+
+	stream := &exportStream{w: w, encoder: newMeasurementEncoder(format, w, query.Fields), format: format}
+	err = e.logic.ExportSensorMetrics(r.Context(), userID, devices, query, stream.write)
+	if err != nil {
+		if !stream.started {
+			log.Error().Err(err).Msg("failed to export sensor metrics")
+			localErrs.RenderErr(w, r, err)
+			return
+		}
+		// the status code was already sent, the client will receive a truncated export
+		log.Error().Err(err).Int("written", stream.written).Msg("export interrupted")
+		return
+	}
+
+	if !stream.started {
+		err = stream.begin()
+		if err != nil {
+			log.Error().Err(err).Msg("failed to write export header")
+			return
+		}
+	}
+	err = stream.close()
+	if err != nil {
+		log.Error().Err(err).Msg("failed to finish export")
+	}
+}
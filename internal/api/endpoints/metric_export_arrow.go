@@ -0,0 +1,125 @@
+package endpoints
+
+import (
+	"io"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet"
+	"github.com/apache/arrow/go/v12/parquet/compress"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+// arrowBatchSize is the amount of rows in each record batch, for parquet
+// exports every batch becomes a row group
+const arrowBatchSize = 10000
+
+// recordWriter is implemented by both the arrow IPC and the parquet writers
+type recordWriter interface {
+	Write(record arrow.Record) error
+	Close() error
+}
+
+// measurementSchema keeps the tag columns and the nanosecond timestamps as
+// they're stored in influx, fields are nullable since they may be missing
+func measurementSchema(fields []string) *arrow.Schema {
+	columns := []arrow.Field{
+		{Name: "time", Type: &arrow.TimestampType{Unit: arrow.Nanosecond, TimeZone: "UTC"}},
+		{Name: "sensor_id", Type: arrow.BinaryTypes.String},
+		{Name: "sensor_version", Type: arrow.BinaryTypes.String},
+		{Name: "alias", Type: arrow.BinaryTypes.String},
+	}
+	for _, field := range fields {
+		columns = append(columns, arrow.Field{Name: field, Type: arrow.PrimitiveTypes.Float64, Nullable: true})
+	}
+	return arrow.NewSchema(columns, nil)
+}
+
+// arrowEncoder accumulates measurements in record batches of arrowBatchSize rows
+type arrowEncoder struct {
+	w         io.Writer
+	parquet   bool
+	fields    []string
+	schema    *arrow.Schema
+	builder   *array.RecordBuilder
+	writer    recordWriter
+	allocator memory.Allocator
+}
+
+func newArrowEncoder(w io.Writer, fields []string, parquet bool) *arrowEncoder {
+	return &arrowEncoder{
+		w:         w,
+		parquet:   parquet,
+		fields:    fields,
+		schema:    measurementSchema(fields),
+		allocator: memory.DefaultAllocator,
+	}
+}
+
+func (a *arrowEncoder) Begin() error {
+	a.builder = array.NewRecordBuilder(a.allocator, a.schema)
+	if !a.parquet {
+		a.writer = ipc.NewWriter(a.w, ipc.WithSchema(a.schema), ipc.WithAllocator(a.allocator))
+		return nil
+	}
+
+	props := parquet.NewWriterProperties(
+		parquet.WithCompression(compress.Codecs.Snappy),
+		parquet.WithAllocator(a.allocator),
+	)
+	writer, err := pqarrow.NewFileWriter(a.schema, a.w, props, pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema()))
+	if err != nil {
+		return err
+	}
+	a.writer = writer
+	return nil
+}
+
+func (a *arrowEncoder) Encode(measurement models.Measurement) error {
+	a.builder.Field(0).(*array.TimestampBuilder).Append(arrow.Timestamp(measurement.Time.UnixNano()))
+	a.builder.Field(1).(*array.StringBuilder).Append(measurement.SensorID)
+	a.builder.Field(2).(*array.StringBuilder).Append(measurement.SensorVersion)
+	a.builder.Field(3).(*array.StringBuilder).Append(measurement.Alias)
+	for i, field := range a.fields {
+		builder := a.builder.Field(4 + i).(*array.Float64Builder)
+		value, ok := measurement.Fields[field]
+		if !ok {
+			builder.AppendNull()
+			continue
+		}
+		builder.Append(value)
+	}
+
+	if a.builder.Field(0).Len() >= arrowBatchSize {
+		return a.writeBatch()
+	}
+	return nil
+}
+
+func (a *arrowEncoder) writeBatch() error {
+	if a.builder.Field(0).Len() == 0 {
+		return nil
+	}
+
+	record := a.builder.NewRecord()
+	defer record.Release()
+	return a.writer.Write(record)
+}
+
+// Flush doesn't write partial batches, so parquet row groups keep their size
+func (a *arrowEncoder) Flush() error {
+	return nil
+}
+
+func (a *arrowEncoder) Close() error {
+	defer a.builder.Release()
+	err := a.writeBatch()
+	if err != nil {
+		return err
+	}
+	return a.writer.Close()
+}
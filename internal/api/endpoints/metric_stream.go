@@ -0,0 +1,66 @@
+package endpoints
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/rs/zerolog/log"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+)
+
+// heartbeatInterval keeps idle connections open through proxies and load balancers
+const heartbeatInterval = 15 * time.Second
+
+// StreamMetrics pushes the accepted metrics of the user through server-sent
+// events, the device query parameter limits the stream to a single device
+func (e MetricsEndpoints) StreamMetrics(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		localErrs.RenderErr(w, r, localErrs.InternalServerErr.WithMsg("streaming unsupported"))
+		return
+	}
+
+	userID := chi.URLParam(r, "userID")
+	subscription := e.hub.Subscribe(userID, r.URL.Query().Get("device"))
+	defer e.hub.Unsubscribe(subscription)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Debug().Str("userID", userID).Int64("dropped", subscription.Dropped()).Msg("metrics stream closed")
+			return
+		case <-heartbeat.C:
+			_, err := fmt.Fprint(w, ": heartbeat\n\n")
+			if err != nil {
+				return
+			}
+		case metric, ok := <-subscription.Events():
+			// the hub is closed when the service shuts down
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(metric)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to encode streamed metric")
+				continue
+			}
+			_, err = fmt.Fprintf(w, "event: metric\ndata: %s\n\n", data)
+			if err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,222 @@
+package endpoints
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/go-chi/render"
+	"github.com/influxdata/line-protocol/v2/lineprotocol"
+	"github.com/rs/zerolog/log"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+// lineMeasurement is the only measurement accepted in line protocol
+const lineMeasurement = "metrics"
+
+// linePrecisions maps the precision query parameter to the timestamp precision,
+// timestamps are in nanoseconds by default like in InfluxDB
+var linePrecisions = map[string]lineprotocol.Precision{
+	"":   lineprotocol.Nanosecond,
+	"ns": lineprotocol.Nanosecond,
+	"us": lineprotocol.Microsecond,
+	"ms": lineprotocol.Millisecond,
+	"s":  lineprotocol.Second,
+}
+
+// LineError describes why a line couldn't be ingested, lines start at one
+type LineError struct {
+	Line  int64  `json:"line"`
+	Error string `json:"error"`
+}
+
+// WriteLinesErrorResponse lists every line rejected from a line protocol body
+type WriteLinesErrorResponse struct {
+	Status      int         `json:"status"`
+	Description string      `json:"description"`
+	Errors      []LineError `json:"errors"`
+}
+
+func (WriteLinesErrorResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	render.Status(r, http.StatusBadRequest)
+	return nil
+}
+
+// isLineProtocol tells if the request body is line protocol instead of json
+func isLineProtocol(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "text/plain"
+}
+
+// WriteLines ingests metrics in InfluxDB line protocol, as emitted by Telegraf:
+//
+//	metrics,sensor_id=..,user_id=..,alias=..,sensor_version=.. ph=6.2,ec=1.8 1700000000000000000
+//
+// Unknown tags and fields are ignored. Nothing is written when any line is
+// invalid, the response lists the error of each rejected line.
+func (e MetricsEndpoints) WriteLines(w http.ResponseWriter, r *http.Request) {
+	precision, ok := linePrecisions[r.URL.Query().Get("precision")]
+	if !ok {
+		localErrs.RenderErr(w, r, localErrs.BadRequestErr.WithMsg("invalid precision").WithDetails("precision", r.URL.Query().Get("precision")))
+		return
+	}
+
+	metrics, lineErrs, err := parseLines(r.Body, precision, time.Now())
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to read line protocol body")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+	if len(lineErrs) > 0 {
+		log.Warn().Int("lines", len(lineErrs)).Msg("rejected line protocol body")
+		render.Render(w, r, WriteLinesErrorResponse{
+			Status:      localErrs.BadRequestErr.StatusCode,
+			Description: localErrs.BadRequestErr.StatusDescription,
+			Errors:      lineErrs,
+		})
+		return
+	}
+	if len(metrics) == 0 {
+		localErrs.RenderErr(w, r, localErrs.BadRequestErr.WithMsg("no metrics in body"))
+		return
+	}
+
+	err = e.logic.WriteSensorMetrics(r.Context(), metrics)
+	if errors.Is(err, localErrs.AcceptedErr) {
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+	if err != nil {
+		log.Error().Err(err).Msg("failed to write sensor metrics")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+}
+
+// parseLines decodes every line of body, lines without timestamp are
+// registered at now. Only reading the body fails the whole parsing.
+func parseLines(body io.Reader, precision lineprotocol.Precision, now time.Time) ([]models.SensorRequest, []LineError, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, nil, bodyErr(err)
+	}
+
+	metrics := make([]models.SensorRequest, 0)
+	lineErrs := make([]LineError, 0)
+	// line protocol doesn't allow new lines inside values, so lines are
+	// decoded one by one to report their position
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+
+		decoder := lineprotocol.NewDecoderWithBytes(line)
+		decoder.Next()
+		metric, err := parseLine(decoder, precision, now)
+		if err != nil {
+			lineErrs = append(lineErrs, LineError{Line: int64(i + 1), Error: describeLineErr(err)})
+			continue
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, lineErrs, nil
+}
+
+func parseLine(decoder *lineprotocol.Decoder, precision lineprotocol.Precision, now time.Time) (models.SensorRequest, error) {
+	var metric models.SensorRequest
+	metric.ClearFields()
+	measurement, err := decoder.Measurement()
+	if err != nil {
+		return metric, err
+	}
+	if string(measurement) != lineMeasurement {
+		return metric, fmt.Errorf("unknown measurement %q, expected %q", measurement, lineMeasurement)
+	}
+
+	for {
+		key, value, err := decoder.NextTag()
+		if err != nil {
+			return metric, err
+		}
+		if key == nil {
+			break
+		}
+		switch string(key) {
+		case "sensor_id":
+			metric.SensorID = string(value)
+		case "user_id":
+			metric.UserID = string(value)
+		case "alias":
+			metric.Alias = string(value)
+		case "sensor_version":
+			metric.SensorVersion = string(value)
+		}
+	}
+
+	for {
+		key, value, err := decoder.NextField()
+		if err != nil {
+			return metric, err
+		}
+		if key == nil {
+			break
+		}
+		var number float64
+		switch value.Kind() {
+		case lineprotocol.Float:
+			number = value.FloatV()
+		case lineprotocol.Int:
+			number = float64(value.IntV())
+		case lineprotocol.Uint:
+			number = float64(value.UintV())
+		default:
+			if slices.Contains(models.MeasurementFields, string(key)) {
+				return metric, fmt.Errorf("field %q must be numeric", key)
+			}
+			continue
+		}
+		metric.SetField(string(key), number)
+	}
+
+	timestamp, err := decoder.Time(precision, now)
+	if err != nil {
+		return metric, err
+	}
+	metric.Timestamp = float64(timestamp.UnixNano()) / float64(time.Second)
+
+	metrics := []models.SensorRequest{metric}
+	err = models.ValidateSensorRequests(metrics)
+	if err != nil {
+		return metric, err
+	}
+	// the float timestamp loses precision, the decoded time is kept instead
+	metric.Time = timestamp
+	return metric, nil
+}
+
+// describeLineErr keeps the cause of validation errors, which isn't part of
+// the localErrs message, and the column of syntax errors
+func describeLineErr(err error) string {
+	var decodeErr *lineprotocol.DecodeError
+	if errors.As(err, &decodeErr) {
+		return fmt.Sprintf("column %d: %s", decodeErr.Column, decodeErr.Err)
+	}
+	var apiErr *localErrs.Error
+	if errors.As(err, &apiErr) {
+		if apiErr.Err != nil {
+			return apiErr.Msg + ": " + apiErr.Err.Error()
+		}
+		return apiErr.Msg
+	}
+	return err.Error()
+}
@@ -0,0 +1,67 @@
+package endpoints
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+type RetentionEndpoints struct {
+	logic logic.RetentionLogic
+}
+
+func NewRetentionEndpoints(l logic.RetentionLogic) RetentionEndpoints {
+	return RetentionEndpoints{logic: l}
+}
+
+func (e RetentionEndpoints) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := e.logic.GetPolicy(r.Context(), chi.URLParam(r, "userID"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to retrieve retention policy")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	render.Render(w, r, policy)
+	render.Status(r, http.StatusOK)
+}
+
+func (e RetentionEndpoints) SetPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy models.RetentionPolicy
+	err := render.Bind(r, &policy)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to decode retention policy")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+	policy.UserID = chi.URLParam(r, "userID")
+
+	err = e.logic.SetPolicy(r.Context(), policy)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to set retention policy")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	render.Render(w, r, policy)
+	render.Status(r, http.StatusOK)
+}
+
+// Report is a dry run of the purge, listing what would be deleted
+func (e RetentionEndpoints) Report(w http.ResponseWriter, r *http.Request) {
+	report, err := e.logic.Report(r.Context(), chi.URLParam(r, "userID"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to build retention report")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	render.Render(w, r, report)
+	render.Status(r, http.StatusOK)
+}
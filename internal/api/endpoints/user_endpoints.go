@@ -3,6 +3,7 @@ package endpoints
 import (
 	"encoding/base64"
 	"net/http"
+	"strconv"
 	"strings"
 
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
@@ -79,6 +80,7 @@ func (e UserEndpoints) SignIn(w http.ResponseWriter, r *http.Request) {
 type AddDeviceRequest struct {
 	Device string `json:"device" validate:"required"`
 	UserID string `validate:"required"`
+	models.DeviceMetadata
 }
 
 func (a *AddDeviceRequest) Bind(r *http.Request) error {
@@ -100,7 +102,7 @@ func (e UserEndpoints) AddDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = e.logic.AddDevice(r.Context(), userID, request.Device)
+	err = e.logic.AddDevice(r.Context(), userID, models.Device{ID: request.Device, DeviceMetadata: request.DeviceMetadata})
 	if err != nil {
 		log.Error().Err(err).Msg("failed to add new device")
 		errors.RenderErr(w, r, err)
@@ -111,8 +113,8 @@ func (e UserEndpoints) AddDevice(w http.ResponseWriter, r *http.Request) {
 }
 
 type GetDevicesResponse struct {
-	UserID  string   `json:"user_id"`
-	Devices []string `json:"devices"`
+	UserID  string          `json:"user_id"`
+	Devices []models.Device `json:"devices"`
 }
 
 func (g GetDevicesResponse) Render(w http.ResponseWriter, r *http.Request) error {
@@ -141,3 +143,48 @@ func (e UserEndpoints) GetDevices(w http.ResponseWriter, r *http.Request) {
 	render.Render(w, r, response)
 	render.Status(r, http.StatusOK)
 }
+
+func (e UserEndpoints) UpdateDevice(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	deviceID := chi.URLParam(r, "deviceID")
+	var update models.DeviceUpdate
+	err := render.Bind(r, &update)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to decode device update")
+		errors.RenderErr(w, r, err)
+		return
+	}
+
+	device, err := e.logic.UpdateDevice(r.Context(), userID, deviceID, update)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to update device")
+		errors.RenderErr(w, r, err)
+		return
+	}
+
+	render.Render(w, r, device)
+	render.Status(r, http.StatusOK)
+}
+
+func (e UserEndpoints) RemoveDevice(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	deviceID := chi.URLParam(r, "deviceID")
+	purge := false
+	if value := r.URL.Query().Get("purge"); len(value) > 0 {
+		var err error
+		purge, err = strconv.ParseBool(value)
+		if err != nil {
+			errors.RenderErr(w, r, errors.BadRequestErr.WithErr(err).WithMsg("invalid purge").WithDetails("value", value))
+			return
+		}
+	}
+
+	err := e.logic.RemoveDevice(r.Context(), userID, deviceID, purge)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to remove device")
+		errors.RenderErr(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
@@ -0,0 +1,105 @@
+package endpoints
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/render"
+	"github.com/rs/zerolog/log"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+type WebhookEndpoints struct {
+	logic logic.WebhookLogic
+}
+
+func NewWebhookEndpoints(l logic.WebhookLogic) WebhookEndpoints {
+	return WebhookEndpoints{logic: l}
+}
+
+type WebhookResponse struct {
+	models.Webhook
+}
+
+func (w WebhookResponse) Render(rw http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (e WebhookEndpoints) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var webhook models.Webhook
+	err := render.Bind(r, &webhook)
+	if err != nil {
+		log.Warn().Err(err).Msg("failed to decode webhook")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+	webhook.UserID = chi.URLParam(r, "userID")
+
+	webhook, err = e.logic.CreateWebhook(r.Context(), webhook)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to create webhook")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.Render(w, r, WebhookResponse{webhook})
+}
+
+type GetWebhooksResponse struct {
+	UserID   string           `json:"user_id"`
+	Webhooks []models.Webhook `json:"webhooks"`
+}
+
+func (g GetWebhooksResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (e WebhookEndpoints) GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	userID := chi.URLParam(r, "userID")
+	webhooks, err := e.logic.GetWebhooks(r.Context(), userID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to retrieve webhooks")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	render.Render(w, r, GetWebhooksResponse{UserID: userID, Webhooks: webhooks})
+	render.Status(r, http.StatusOK)
+}
+
+func (e WebhookEndpoints) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	err := e.logic.DeleteWebhook(r.Context(), chi.URLParam(r, "userID"), chi.URLParam(r, "webhookID"))
+	if err != nil {
+		log.Error().Err(err).Msg("failed to delete webhook")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	render.Status(r, http.StatusNoContent)
+}
+
+type GetWebhookDeliveriesResponse struct {
+	WebhookID  string                   `json:"webhook_id"`
+	Deliveries []models.WebhookDelivery `json:"deliveries"`
+}
+
+func (g GetWebhookDeliveriesResponse) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+func (e WebhookEndpoints) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	webhookID := chi.URLParam(r, "webhookID")
+	deliveries, err := e.logic.GetDeliveries(r.Context(), chi.URLParam(r, "userID"), webhookID)
+	if err != nil {
+		log.Error().Err(err).Msg("failed to retrieve webhook deliveries")
+		localErrs.RenderErr(w, r, err)
+		return
+	}
+
+	render.Render(w, r, GetWebhookDeliveriesResponse{WebhookID: webhookID, Deliveries: deliveries})
+	render.Status(r, http.StatusOK)
+}
@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+// writeExportReadings ingests two readings of sensor, the first one with an
+// alias that needs escaping, and returns their times
+func writeExportReadings(t *testing.T, server *httptest.Server, userID string, authorization map[string]string) []time.Time {
+	now := time.Now().Truncate(time.Second)
+	times := []time.Time{now.Add(-2 * time.Second), now.Add(-time.Second)}
+	response := doRequest(t, http.MethodPost, server.URL+"/metrics", authorization, map[string]any{
+		"metrics": []map[string]any{
+			{
+				"sensor_id":      "sensor",
+				"user_id":        userID,
+				"sensor_version": "v1",
+				"alias":          `reservoir, "north"`,
+				"ph":             6.2,
+				"ec":             1.6,
+				"timestamp":      float64(times[0].Unix()),
+			},
+			{
+				"sensor_id":      "sensor",
+				"user_id":        userID,
+				"sensor_version": "v1",
+				"alias":          "reservoir",
+				"ph":             6.4,
+				"ec":             1.8,
+				"timestamp":      float64(times[1].Unix()),
+			},
+		},
+	})
+	assert.Less(t, response.StatusCode, 300)
+	return times
+}
+
+func TestOfflineExportCSV(t *testing.T) {
+	server := newOfflineServer(t)
+	userID, authorization := signUp(t, server, "sensor")
+	times := writeExportReadings(t, server, userID, authorization)
+
+	url := fmt.Sprintf("%s/users/%s/metrics/export?fields=ph,ec", server.URL, userID)
+	for _, accept := range []string{"", "text/csv", "application/json;q=0.9, */*;q=0.1", "application/x-ndjson;q=0.5, text/csv", "text/*, */*;q=0.2"} {
+		headers := map[string]string{"Authorization": authorization["Authorization"], "Accept": accept}
+		response := doRequest(t, http.MethodGet, url, headers, nil)
+		assert.Equal(t, http.StatusOK, response.StatusCode, accept)
+		assert.Equal(t, "text/csv", response.Header.Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="metrics.csv"`, response.Header.Get("Content-Disposition"))
+
+		records, err := csv.NewReader(response.Body).ReadAll()
+		assert.Nil(t, err)
+		if !assert.Len(t, records, 3) {
+			continue
+		}
+		assert.Equal(t, []string{"time", "sensor_id", "sensor_version", "alias", "ph", "ec"}, records[0])
+		assert.Equal(t, []string{"sensor", "v1", `reservoir, "north"`, "6.2", "1.6"}, records[1][1:])
+		assert.Equal(t, []string{"sensor", "v1", "reservoir", "6.4", "1.8"}, records[2][1:])
+		for i, record := range records[1:] {
+			at, err := time.Parse(time.RFC3339Nano, record[0])
+			assert.Nil(t, err)
+			assert.True(t, times[i].Equal(at))
+		}
+	}
+
+	// the alias is quoted and its quotes doubled
+	response := doRequest(t, http.MethodGet, url+"&format=csv", authorization, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	scanner := bufio.NewScanner(response.Body)
+	assert.True(t, scanner.Scan())
+	assert.Equal(t, "time,sensor_id,sensor_version,alias,ph,ec", scanner.Text())
+	assert.True(t, scanner.Scan())
+	assert.Contains(t, scanner.Text(), `,sensor,v1,"reservoir, ""north""",6.2,1.6`)
+}
+
+func TestOfflineExportNDJSON(t *testing.T) {
+	server := newOfflineServer(t)
+	userID, authorization := signUp(t, server, "sensor")
+	times := writeExportReadings(t, server, userID, authorization)
+
+	url := fmt.Sprintf("%s/users/%s/metrics/export?fields=ph,ec", server.URL, userID)
+	responses := []*http.Response{
+		doRequest(t, http.MethodGet, url+"&format=ndjson", authorization, nil),
+		doRequest(t, http.MethodGet, url, map[string]string{"Authorization": authorization["Authorization"], "Accept": "application/x-ndjson"}, nil),
+		doRequest(t, http.MethodGet, url, map[string]string{"Authorization": authorization["Authorization"], "Accept": "text/csv;q=0.1, application/x-ndjson"}, nil),
+		// csv is refused, so the wildcard picks the next preferred format
+		doRequest(t, http.MethodGet, url, map[string]string{"Authorization": authorization["Authorization"], "Accept": "text/csv;q=0, */*"}, nil),
+	}
+	for _, response := range responses {
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "application/x-ndjson", response.Header.Get("Content-Type"))
+
+		var measurements []models.Measurement
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			var measurement models.Measurement
+			assert.Nil(t, json.Unmarshal(scanner.Bytes(), &measurement))
+			measurements = append(measurements, measurement)
+		}
+		if assert.Len(t, measurements, 2) {
+			assert.Equal(t, `reservoir, "north"`, measurements[0].Alias)
+			assert.Equal(t, map[string]float64{"ph": 6.2, "ec": 1.6}, measurements[0].Fields)
+			assert.True(t, times[0].Equal(measurements[0].Time))
+			assert.Equal(t, map[string]float64{"ph": 6.4, "ec": 1.8}, measurements[1].Fields)
+			assert.True(t, times[1].Equal(measurements[1].Time))
+		}
+	}
+}
+
+func TestOfflineExportErrors(t *testing.T) {
+	server := newOfflineServer(t)
+	userID, authorization := signUp(t, server, "sensor")
+
+	url := fmt.Sprintf("%s/users/%s/metrics/export", server.URL, userID)
+	var tests = []struct {
+		name       string
+		url        string
+		accept     string
+		statusCode int
+	}{
+		{name: "unsupported accept header", url: url, accept: "application/xml", statusCode: http.StatusNotAcceptable},
+		{name: "refused csv", url: url, accept: "text/csv;q=0, application/json", statusCode: http.StatusNotAcceptable},
+		{name: "unsupported format parameter", url: url + "?format=xml", statusCode: http.StatusBadRequest},
+		{name: "invalid time range", url: url + "?from=yesterday", statusCode: http.StatusBadRequest},
+		{name: "device owned by someone else", url: url + "?devices=unknown", statusCode: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			headers := map[string]string{"Authorization": authorization["Authorization"], "Accept": tt.accept}
+			response := doRequest(t, http.MethodGet, tt.url, headers, nil)
+			assert.Equal(t, tt.statusCode, response.StatusCode)
+			assert.NotEqual(t, "text/csv", response.Header.Get("Content-Type"))
+		})
+	}
+}
+
+// assertColumnarExport checks the schema and values of the record read from an arrow or parquet export
+func assertColumnarExport(t *testing.T, record arrow.Record, times []time.Time) {
+	schema := record.Schema()
+	names := make([]string, len(schema.Fields()))
+	for i, field := range schema.Fields() {
+		names[i] = field.Name
+	}
+	assert.Equal(t, []string{"time", "sensor_id", "sensor_version", "alias", "ph", "ec"}, names)
+	assert.Equal(t, &arrow.TimestampType{Unit: arrow.Nanosecond, TimeZone: "UTC"}, schema.Field(0).Type)
+	assert.Equal(t, arrow.BinaryTypes.String, schema.Field(1).Type)
+	assert.Equal(t, arrow.PrimitiveTypes.Float64, schema.Field(4).Type)
+	assert.True(t, schema.Field(4).Nullable)
+	if !assert.Equal(t, int64(2), record.NumRows()) {
+		return
+	}
+
+	timestamps := record.Column(0).(*array.Timestamp)
+	sensorIDs := record.Column(1).(*array.String)
+	aliases := record.Column(3).(*array.String)
+	ph := record.Column(4).(*array.Float64)
+	ec := record.Column(5).(*array.Float64)
+	for i := range times {
+		assert.Equal(t, times[i].UnixNano(), int64(timestamps.Value(i)))
+		assert.Equal(t, "sensor", sensorIDs.Value(i))
+	}
+	assert.Equal(t, `reservoir, "north"`, aliases.Value(0))
+	assert.Equal(t, "reservoir", aliases.Value(1))
+	assert.Equal(t, []float64{6.2, 6.4}, ph.Float64Values())
+	assert.Equal(t, []float64{1.6, 1.8}, ec.Float64Values())
+}
+
+func TestOfflineExportArrow(t *testing.T) {
+	server := newOfflineServer(t)
+	userID, authorization := signUp(t, server, "sensor")
+	times := writeExportReadings(t, server, userID, authorization)
+
+	url := fmt.Sprintf("%s/users/%s/metrics/export?fields=ph,ec&format=arrow", server.URL, userID)
+	response := doRequest(t, http.MethodGet, url, authorization, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/vnd.apache.arrow.stream", response.Header.Get("Content-Type"))
+
+	reader, err := ipc.NewReader(response.Body)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer reader.Release()
+	assert.True(t, reader.Next())
+	assertColumnarExport(t, reader.Record(), times)
+	assert.False(t, reader.Next())
+	assert.Nil(t, reader.Err())
+}
+
+func TestOfflineExportParquet(t *testing.T) {
+	server := newOfflineServer(t)
+	userID, authorization := signUp(t, server, "sensor")
+	times := writeExportReadings(t, server, userID, authorization)
+
+	url := fmt.Sprintf("%s/users/%s/metrics/export?fields=ph,ec", server.URL, userID)
+	headers := map[string]string{"Authorization": authorization["Authorization"], "Accept": "application/vnd.apache.parquet"}
+	response := doRequest(t, http.MethodGet, url, headers, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "application/vnd.apache.parquet", response.Header.Get("Content-Type"))
+
+	body, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+	table, err := pqarrow.ReadTable(context.Background(), bytes.NewReader(body), nil, pqarrow.ArrowReadProperties{}, memory.DefaultAllocator)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer table.Release()
+
+	reader := array.NewTableReader(table, -1)
+	defer reader.Release()
+	assert.True(t, reader.Next())
+	assertColumnarExport(t, reader.Record(), times)
+}
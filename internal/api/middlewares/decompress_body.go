@@ -0,0 +1,107 @@
+package middlewares
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+)
+
+// DecompressBody decodes gzip and deflate request bodies and caps the decoded
+// body at maxBytes, reading past it fails with errors.RequestEntityTooLargeErr
+func DecompressBody(maxBytes int64) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+			if (encoding == "" || encoding == "identity") && r.ContentLength > maxBytes {
+				errors.RenderErr(w, r, tooLarge(maxBytes))
+				return
+			}
+
+			reader, err := decompress(encoding, r.Body)
+			if err != nil {
+				errors.RenderErr(w, r, err)
+				return
+			}
+
+			r.Body = &limitedBody{reader: reader, body: r.Body, remaining: maxBytes, maxBytes: maxBytes}
+			r.Header.Del("Content-Encoding")
+			r.ContentLength = -1
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func tooLarge(maxBytes int64) error {
+	return errors.RequestEntityTooLargeErr.WithMsg(fmt.Sprintf("decoded body exceeds %d bytes", maxBytes))
+}
+
+// decompress wraps body with the reader of the content encoding. Deflate
+// should be zlib wrapped but some clients send raw deflate, both are accepted.
+func decompress(encoding string, body io.Reader) (io.Reader, error) {
+	switch encoding {
+	case "", "identity":
+		return body, nil
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(body)
+		if err != nil {
+			return nil, errors.BadRequestErr.WithMsg("invalid gzip body").WithErr(err)
+		}
+		return reader, nil
+	case "deflate":
+		buffered := bufio.NewReader(body)
+		header, _ := buffered.Peek(2)
+		if len(header) == 2 && header[0]&0x0f == 8 && (uint16(header[0])<<8|uint16(header[1]))%31 == 0 {
+			reader, err := zlib.NewReader(buffered)
+			if err != nil {
+				return nil, errors.BadRequestErr.WithMsg("invalid deflate body").WithErr(err)
+			}
+			return reader, nil
+		}
+		return flate.NewReader(buffered), nil
+	default:
+		return nil, errors.UnsupportedMediaTypeErr.WithMsg("unsupported content encoding").WithDetails("encoding", encoding)
+	}
+}
+
+// limitedBody reads the decoded body up to remaining bytes
+type limitedBody struct {
+	reader    io.Reader
+	body      io.ReadCloser
+	remaining int64
+	maxBytes  int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.remaining < 0 {
+		return 0, tooLarge(b.maxBytes)
+	}
+	// one extra byte tells a body of exactly remaining bytes from a bigger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.reader.Read(p)
+	if int64(n) > b.remaining {
+		n = int(b.remaining)
+		b.remaining = -1
+		return n, tooLarge(b.maxBytes)
+	}
+	b.remaining -= int64(n)
+	if err != nil && err != io.EOF && b.reader != io.Reader(b.body) {
+		return n, errors.BadRequestErr.WithMsg("invalid compressed body").WithErr(err)
+	}
+	return n, err
+}
+
+func (b *limitedBody) Close() error {
+	if closer, ok := b.reader.(io.Closer); ok && b.reader != io.Reader(b.body) {
+		closer.Close()
+	}
+	return b.body.Close()
+}
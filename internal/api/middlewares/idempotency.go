@@ -0,0 +1,199 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/go-chi/chi/v5/middleware"
+)
+
+// IdempotencyKeyHeader lets clients retry a request without applying it twice
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader flags the responses replayed from a previous request
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKeyLength bounds the keys kept in memory
+const maxIdempotencyKeyLength = 255
+
+// idempotentResponse is the outcome of the first request sent with a key,
+// done is closed once the response is known
+type idempotentResponse struct {
+	fingerprint [sha256.Size]byte
+	expires     time.Time
+	done        chan struct{}
+	completed   bool
+	status      int
+	header      http.Header
+	body        []byte
+}
+
+type idempotencyEntry struct {
+	key     string
+	expires time.Time
+}
+
+// idempotencyStore keeps up to capacity responses for ttl, the oldest
+// responses are dropped first
+type idempotencyStore struct {
+	mu        sync.Mutex
+	capacity  int
+	ttl       time.Duration
+	responses map[string]*idempotentResponse
+	order     []idempotencyEntry
+}
+
+func newIdempotencyStore(capacity int, ttl time.Duration) *idempotencyStore {
+	return &idempotencyStore{
+		capacity:  capacity,
+		ttl:       ttl,
+		responses: make(map[string]*idempotentResponse),
+	}
+}
+
+// reserve returns the response of key, the caller owns it and must complete
+// or release it when it was just created
+func (s *idempotencyStore) reserve(key string, fingerprint [sha256.Size]byte, now time.Time) (*idempotentResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(s.order) > 0 && (!s.order[0].expires.After(now) || len(s.order) >= s.capacity) {
+		s.evict(s.order[0])
+		s.order = s.order[1:]
+	}
+
+	if response, ok := s.responses[key]; ok {
+		return response, false
+	}
+	response := &idempotentResponse{fingerprint: fingerprint, expires: now.Add(s.ttl), done: make(chan struct{})}
+	s.responses[key] = response
+	s.order = append(s.order, idempotencyEntry{key: key, expires: response.expires})
+	return response, true
+}
+
+// evict drops the response of entry unless key was reserved again since
+func (s *idempotencyStore) evict(entry idempotencyEntry) {
+	if response, ok := s.responses[entry.key]; ok && response.expires.Equal(entry.expires) {
+		delete(s.responses, entry.key)
+	}
+}
+
+func (s *idempotencyStore) complete(response *idempotentResponse, status int, header http.Header, body []byte) {
+	s.mu.Lock()
+	response.completed = true
+	response.status = status
+	response.header = header
+	response.body = body
+	s.mu.Unlock()
+	close(response.done)
+}
+
+// release forgets key so the request can be retried
+func (s *idempotencyStore) release(key string, response *idempotentResponse) {
+	s.mu.Lock()
+	if s.responses[key] == response {
+		delete(s.responses, key)
+	}
+	s.mu.Unlock()
+	close(response.done)
+}
+
+// Idempotent replays the response of the first request sent with the same
+// Idempotency-Key by the same user for ttl, up to capacity keys are kept in
+// the memory of the instance so retries must reach the same instance to be
+// replayed. Retries wait for the first request to complete, server errors
+// aren't kept so the request can be retried, and reusing a key with another
+// request fails with errors.UnprocessableEntityErr.
+func Idempotent(capacity int, ttl time.Duration) func(next http.Handler) http.Handler {
+	store := newIdempotencyStore(capacity, ttl)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if len(key) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLength {
+				errors.RenderErr(w, r, errors.BadRequestErr.WithMsg("idempotency key too long"))
+				return
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				errors.RenderErr(w, r, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			fingerprint := sha256.Sum256(append([]byte(r.Method+" "+r.URL.RequestURI()+"\n"), body...))
+			// keys are scoped by user so they can't collide between accounts
+			if token, ok := r.Context().Value(jwtmiddleware.ContextKey{}).(*validator.ValidatedClaims); ok {
+				key = token.RegisteredClaims.Issuer + " " + key
+			}
+
+			for {
+				response, owned := store.reserve(key, fingerprint, time.Now())
+				if owned {
+					serveAndKeep(store, key, response, next, w, r)
+					return
+				}
+				if response.fingerprint != fingerprint {
+					errors.RenderErr(w, r, errors.UnprocessableEntityErr.WithMsg("idempotency key reused with another request"))
+					return
+				}
+
+				select {
+				case <-response.done:
+				case <-r.Context().Done():
+					return
+				}
+				if response.completed {
+					replay(w, response)
+					return
+				}
+			}
+		})
+	}
+}
+
+// serveAndKeep serves the first request of a key and keeps its response
+func serveAndKeep(store *idempotencyStore, key string, response *idempotentResponse, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	var body bytes.Buffer
+	writer := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+	writer.Tee(&body)
+	served := false
+	defer func() {
+		// the handler panicked, the request can be retried
+		if !served {
+			store.release(key, response)
+		}
+	}()
+	next.ServeHTTP(writer, r)
+	served = true
+
+	status := writer.Status()
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if status >= http.StatusInternalServerError {
+		store.release(key, response)
+		return
+	}
+	store.complete(response, status, w.Header().Clone(), body.Bytes())
+}
+
+func replay(w http.ResponseWriter, response *idempotentResponse) {
+	for name, values := range response.header {
+		w.Header()[name] = values
+	}
+	w.Header().Set(IdempotentReplayedHeader, "true")
+	w.WriteHeader(response.status)
+	w.Write(response.body)
+}
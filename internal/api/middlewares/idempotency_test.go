@@ -0,0 +1,91 @@
+package middlewares
+
+import (
+	"crypto/sha256"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIdempotencyStore(t *testing.T) {
+	now := time.Now()
+	store := newIdempotencyStore(2, time.Minute)
+	fingerprint := sha256.Sum256([]byte("request"))
+
+	response, owned := store.reserve("key1", fingerprint, now)
+	assert.True(t, owned)
+	store.complete(response, http.StatusCreated, nil, nil)
+	replayed, owned := store.reserve("key1", fingerprint, now.Add(30*time.Second))
+	assert.False(t, owned)
+	assert.Equal(t, http.StatusCreated, replayed.status)
+
+	// responses are dropped after the ttl
+	response, owned = store.reserve("key1", fingerprint, now.Add(time.Minute))
+	assert.True(t, owned)
+	store.release("key1", response)
+	_, owned = store.reserve("key1", fingerprint, now.Add(time.Minute))
+	assert.True(t, owned)
+
+	// and when more keys than the capacity are kept
+	_, owned = store.reserve("key2", fingerprint, now.Add(time.Minute))
+	assert.True(t, owned)
+	_, owned = store.reserve("key3", fingerprint, now.Add(time.Minute))
+	assert.True(t, owned)
+	_, owned = store.reserve("key1", fingerprint, now.Add(time.Minute))
+	assert.True(t, owned)
+	assert.LessOrEqual(t, len(store.responses), 2)
+}
+
+func TestIdempotentConcurrentRetries(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	handler := Idempotent(10, time.Minute)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		if calls.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	serve := func() *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/metrics", strings.NewReader("{}"))
+		request.Header.Set(IdempotencyKeyHeader, "key")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	// the first request fails with a server error, one of the retries waiting
+	// for it is served and the others replay its response
+	var wg sync.WaitGroup
+	recorders := make([]*httptest.ResponseRecorder, 3)
+	for i := range recorders {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			recorders[i] = serve()
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	assert.Equal(t, int32(2), calls.Load())
+	statuses := make([]int, 0, len(recorders))
+	replays := 0
+	for _, recorder := range recorders {
+		statuses = append(statuses, recorder.Code)
+		if recorder.Header().Get(IdempotentReplayedHeader) == "true" {
+			replays++
+		}
+	}
+	assert.ElementsMatch(t, []int{http.StatusServiceUnavailable, http.StatusCreated, http.StatusCreated}, statuses)
+	assert.Equal(t, 1, replays)
+}
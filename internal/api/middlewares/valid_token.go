@@ -2,9 +2,11 @@ package middlewares
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
@@ -14,48 +16,105 @@ import (
 	"github.com/auth0/go-jwt-middleware/v2/validator"
 	"github.com/go-chi/chi/v5"
 	"github.com/rs/zerolog/log"
+	"gopkg.in/square/go-jose.v2"
+	"gopkg.in/square/go-jose.v2/jwt"
 )
 
+// TokenValidator parses an access token into its *validator.ValidatedClaims
+type TokenValidator func(ctx context.Context, token string) (interface{}, error)
+
+// NewAuth0TokenValidator checks RS256 JWTs issued by the AUTH0_DOMAIN tenant
+// for the AUTH0_AUDIENCE
+func NewAuth0TokenValidator() (TokenValidator, error) {
+	issuerURL, err := url.Parse("https://" + os.Getenv("AUTH0_DOMAIN") + "/")
+	if err != nil {
+		return nil, err
+	}
+
+	provider := jwks.NewCachingProvider(issuerURL, 5*time.Minute)
+
+	jwtValidator, err := validator.New(
+		provider.KeyFunc,
+		validator.RS256,
+		issuerURL.String(),
+		[]string{os.Getenv("AUTH0_AUDIENCE")},
+		validator.WithCustomClaims(
+			func() validator.CustomClaims {
+				return &CustomClaims{}
+			},
+		),
+		validator.WithAllowedClockSkew(time.Minute),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return jwtValidator.ValidateToken, nil
+}
+
 // EnsureValidToken is a middleware that will check the validity of our JWT.
-func EnsureValidToken(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		issuerURL, err := url.Parse("https://" + os.Getenv("AUTH0_DOMAIN") + "/")
+// The validator is built once, so the signing keys it caches are shared by
+// every request
+func EnsureValidToken(validateToken TokenValidator) func(next http.Handler) http.Handler {
+	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Warn().Err(err).Msg("Encountered error while validating JWT")
+		errors.RenderErr(w, r, errors.UnauthorizedErr)
+	}
+
+	middleware := jwtmiddleware.New(jwtmiddleware.ValidateToken(validateToken), jwtmiddleware.WithErrorHandler(errorHandler))
+	return func(next http.Handler) http.Handler {
+		checkJWT := middleware.CheckJWT(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Header.Set("Authorization", r.Header.Get("X-Endpoint-API-UserInfo"))
+			checkJWT.ServeHTTP(w, r)
+		})
+	}
+}
+
+// NewLocalTokenValidator checks HS256 JWTs signed with secret, as issued by
+// services.LocalAuth when running offline.
+func NewLocalTokenValidator(secret []byte) TokenValidator {
+	return func(ctx context.Context, token string) (interface{}, error) {
+		parsed, err := jwt.ParseSigned(token)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to parse the issuer url")
+			return nil, err
+		}
+		if len(parsed.Headers) == 0 || parsed.Headers[0].Algorithm != string(jose.HS256) {
+			return nil, fmt.Errorf("unexpected signing algorithm")
 		}
 
-		r.Header.Set("Authorization", r.Header.Get("X-Endpoint-API-UserInfo"))
-
-		provider := jwks.NewCachingProvider(issuerURL, 5*time.Minute)
-
-		jwtValidator, err := validator.New(
-			provider.KeyFunc,
-			validator.RS256,
-			issuerURL.String(),
-			[]string{os.Getenv("AUTH0_AUDIENCE")},
-			validator.WithCustomClaims(
-				func() validator.CustomClaims {
-					return &CustomClaims{}
-				},
-			),
-			validator.WithAllowedClockSkew(time.Minute),
-		)
+		var registered jwt.Claims
+		custom := &CustomClaims{}
+		err = parsed.Claims(secret, &registered, custom)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to set up the jwt validator")
+			return nil, err
 		}
-
-		errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
-			log.Warn().Err(err).Msg("Encountered error while validating JWT")
-			errors.RenderErr(w, r, errors.UnauthorizedErr)
+		err = registered.ValidateWithLeeway(jwt.Expected{Time: time.Now()}, time.Minute)
+		if err != nil {
+			return nil, err
 		}
 
-		middleware := jwtmiddleware.New(
-			jwtValidator.ValidateToken,
-			jwtmiddleware.WithErrorHandler(errorHandler),
-		)
+		return &validator.ValidatedClaims{
+			CustomClaims: custom,
+			RegisteredClaims: validator.RegisteredClaims{
+				Issuer:   registered.Issuer,
+				Subject:  registered.Subject,
+				Expiry:   registered.Expiry.Time().Unix(),
+				IssuedAt: registered.IssuedAt.Time().Unix(),
+			},
+		}, nil
+	}
+}
 
-		middleware.CheckJWT(next).ServeHTTP(w, r)
-	})
+// EnsureValidLocalToken is a middleware that checks the tokens issued by
+// services.LocalAuth.
+func EnsureValidLocalToken(secret []byte) func(next http.Handler) http.Handler {
+	errorHandler := func(w http.ResponseWriter, r *http.Request, err error) {
+		log.Warn().Err(err).Msg("Encountered error while validating local JWT")
+		errors.RenderErr(w, r, errors.UnauthorizedErr)
+	}
+
+	middleware := jwtmiddleware.New(jwtmiddleware.ValidateToken(NewLocalTokenValidator(secret)), jwtmiddleware.WithErrorHandler(errorHandler))
+	return middleware.CheckJWT
 }
 
 // CustomClaims contains custom data we want from the token.
@@ -70,16 +129,16 @@ func (c CustomClaims) Validate(ctx context.Context) error {
 	return nil
 }
 
-// HasScope checks whether our claims have a specific scope.
+// HasScope checks whether our claims have every space separated expected scope.
 func (c CustomClaims) HasScope(expectedScope string) bool {
 	result := strings.Split(c.Scope, " ")
-	for i := range result {
-		if result[i] == expectedScope {
-			return true
+	for _, scope := range strings.Split(expectedScope, " ") {
+		if !slices.Contains(result, scope) {
+			return false
 		}
 	}
 
-	return false
+	return true
 }
 
 func HasScope(scopes string) func(next http.Handler) http.Handler {
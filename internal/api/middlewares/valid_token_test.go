@@ -0,0 +1,80 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	jwtmiddleware "github.com/auth0/go-jwt-middleware/v2"
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomClaimsHasScope(t *testing.T) {
+	var tests = []struct {
+		name          string
+		givenScope    string
+		expectedScope string
+		want          bool
+	}{
+		{name: "single scope", givenScope: "write:metrics", expectedScope: "write:metrics", want: true},
+		{name: "scope among others", givenScope: "read:metrics write:metrics", expectedScope: "write:metrics", want: true},
+		{name: "missing scope", givenScope: "read:metrics", expectedScope: "write:metrics", want: false},
+		{name: "every expected scope", givenScope: "read:device write:device", expectedScope: "write:device read:device", want: true},
+		{name: "one of the expected scopes is missing", givenScope: "write:device", expectedScope: "write:device read:device", want: false},
+		{name: "scopes are matched as a whole", givenScope: "write:metrics:all", expectedScope: "write:metrics", want: false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, CustomClaims{Scope: tt.givenScope}.HasScope(tt.expectedScope))
+		})
+	}
+}
+
+func TestHasScope(t *testing.T) {
+	handler := HasScope("write:device read:device")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for scope, want := range map[string]int{
+		"write:device read:device": http.StatusNoContent,
+		"write:device":             http.StatusForbidden,
+		"read:metrics":             http.StatusForbidden,
+	} {
+		claims := &validator.ValidatedClaims{CustomClaims: &CustomClaims{Scope: scope}}
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request = request.WithContext(context.WithValue(request.Context(), jwtmiddleware.ContextKey{}, claims))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, want, recorder.Code, scope)
+	}
+}
+
+func TestEnsureValidToken(t *testing.T) {
+	validateToken := func(ctx context.Context, token string) (interface{}, error) {
+		if token != "valid" {
+			return nil, fmt.Errorf("invalid token")
+		}
+		return &validator.ValidatedClaims{CustomClaims: &CustomClaims{Scope: "write:metrics"}}, nil
+	}
+	handler := EnsureValidToken(validateToken)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	// the token is forwarded by the gateway in X-Endpoint-API-UserInfo
+	for userInfo, want := range map[string]int{
+		"Bearer valid":   http.StatusNoContent,
+		"Bearer invalid": http.StatusUnauthorized,
+		"":               http.StatusUnauthorized,
+	} {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Authorization", "Bearer valid")
+		request.Header.Set("X-Endpoint-API-UserInfo", userInfo)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, want, recorder.Code, userInfo)
+	}
+}
@@ -1,6 +1,9 @@
 package api
 
 import (
+	"net/http"
+	"time"
+
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/api/endpoints"
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/api/middlewares"
 	"github.com/go-chi/chi/v5"
@@ -9,31 +12,89 @@ import (
 	"github.com/rs/zerolog"
 )
 
-func NewRouter(logger zerolog.Logger, metricsEndpoints endpoints.MetricsEndpoints, userEndpoints endpoints.UserEndpoints, nonce string) chi.Router {
+// maxIngestBodyBytes caps the decoded size of the metric bodies, compressed
+// gateway batches included
+const maxIngestBodyBytes = 1 << 20
+
+// idempotencyKeys and idempotencyTTL bound the responses kept for the retries
+// of the metric writes. Responses are kept in the memory of each instance,
+// a few MB at most as write responses are small, and the oldest keys are
+// dropped first: past 10000 keyed writes a day per instance, around one every
+// 9 seconds, keys live less than the TTL. Retries reaching another instance or
+// sent after their key was dropped are applied again, which only rewrites the
+// same points since readings are identified by sensor and timestamp.
+const (
+	idempotencyKeys = 10000
+	idempotencyTTL  = 24 * time.Hour
+)
+
+// NewRouter builds the api routes, private endpoints are protected by the
+// authenticate middleware
+func NewRouter(logger zerolog.Logger, authenticate func(next http.Handler) http.Handler, metricsEndpoints endpoints.MetricsEndpoints, userEndpoints endpoints.UserEndpoints, alertEndpoints endpoints.AlertEndpoints, webhookEndpoints endpoints.WebhookEndpoints, retentionEndpoints endpoints.RetentionEndpoints, deviceTokenEndpoints endpoints.DeviceTokenEndpoints, healthEndpoints endpoints.HealthEndpoints, nonce string) chi.Router {
 	mux := chi.NewRouter()
 	mux.Use(httplog.RequestLogger(logger))
 	mux.Use(render.SetContentType(render.ContentTypeJSON))
 
 	// public endpoints
+	mux.Get("/health", healthEndpoints.Health)
 	mux.Post("/users", userEndpoints.CreateAccount)
 	mux.Post("/signin", userEndpoints.SignIn)
 
 	// private endpoints for iot device
 	mux.Group(func(r chi.Router) {
-		r.Use(middlewares.EnsureValidToken)
+		r.Use(authenticate)
 		r.Use(middlewares.HasScope("write:metrics"))
+		r.Use(middlewares.DecompressBody(maxIngestBodyBytes))
+		r.Use(middlewares.Idempotent(idempotencyKeys, idempotencyTTL))
 
 		r.Post("/metrics", metricsEndpoints.RegisterMetric)
+		r.Post("/write", metricsEndpoints.WriteLines)
 	})
 
 	// private endpoints for binding user to device
 	mux.Group(func(r chi.Router) {
-		r.Use(middlewares.EnsureValidToken)
+		r.Use(authenticate)
 		r.Use(middlewares.HasScope("write:device read:device"))
 		r.Use(middlewares.UserMatches)
 
 		r.Post("/users/{userID}/devices", userEndpoints.AddDevice)
 		r.Get("/users/{userID}/devices", userEndpoints.GetDevices)
+		r.Patch("/users/{userID}/devices/{deviceID}", userEndpoints.UpdateDevice)
+		r.Delete("/users/{userID}/devices/{deviceID}", userEndpoints.RemoveDevice)
+		r.Post("/users/{userID}/devices/{deviceID}/token", deviceTokenEndpoints.IssueToken)
+
+		r.Post("/users/{userID}/devices/{deviceID}/alerts/rules", alertEndpoints.CreateRule)
+		r.Get("/users/{userID}/alerts/rules", alertEndpoints.GetRules)
+		r.Delete("/users/{userID}/alerts/rules/{ruleID}", alertEndpoints.DeleteRule)
+		r.Get("/users/{userID}/alerts", alertEndpoints.GetEvents)
+
+		r.Get("/users/{userID}/retention", retentionEndpoints.GetPolicy)
+		r.Put("/users/{userID}/retention", retentionEndpoints.SetPolicy)
+		r.Get("/users/{userID}/retention/report", retentionEndpoints.Report)
+	})
+
+	// private endpoints for reading user device metrics
+	mux.Group(func(r chi.Router) {
+		r.Use(authenticate)
+		r.Use(middlewares.HasScope("read:metrics"))
+		r.Use(middlewares.UserMatches)
+
+		r.Get("/users/{userID}/devices/{deviceID}/metrics", metricsEndpoints.GetMetrics)
+		r.Get("/users/{userID}/metrics/latest", metricsEndpoints.GetLatestMetrics)
+		r.Get("/users/{userID}/metrics/export", metricsEndpoints.ExportMetrics)
+		r.Get("/users/{userID}/metrics/stream", metricsEndpoints.StreamMetrics)
+	})
+
+	// private endpoints for managing user webhooks
+	mux.Group(func(r chi.Router) {
+		r.Use(authenticate)
+		r.Use(middlewares.HasScope("write:webhooks"))
+		r.Use(middlewares.UserMatches)
+
+		r.Post("/users/{userID}/webhooks", webhookEndpoints.CreateWebhook)
+		r.Get("/users/{userID}/webhooks", webhookEndpoints.GetWebhooks)
+		r.Delete("/users/{userID}/webhooks/{webhookID}", webhookEndpoints.DeleteWebhook)
+		r.Get("/users/{userID}/webhooks/{webhookID}/deliveries", webhookEndpoints.GetDeliveries)
 	})
 
 	return mux
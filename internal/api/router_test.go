@@ -0,0 +1,472 @@
+package api
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/api/endpoints"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/api/middlewares"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/live"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/services"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/memory"
+)
+
+// newOfflineServer builds the whole api on top of the in-memory storage and
+// the local authentication, without any cloud dependency
+func newOfflineServer(t *testing.T) *httptest.Server {
+	secret := []byte("test-secret")
+	localAuth := services.NewLocalAuth(secret)
+	metricRepository := memory.NewMetricRepository()
+	userDeviceRepository := memory.NewUserDeviceRepository()
+
+	hub := live.NewHub()
+	metricLogic := logic.NewDeduplicatedMetricLogic(logic.NewMetricLogic(metricRepository, userDeviceRepository, hub), time.Minute)
+	userLogic := logic.NewUserLogic(localAuth, localAuth, userDeviceRepository, metricRepository, "roleID")
+	alertLogic := logic.NewAlertLogic(memory.NewAlertRepository(), userDeviceRepository)
+	webhookLogic := logic.NewWebhookLogic(memory.NewWebhookRepository(), services.NewWebhookSender(http.DefaultClient), 0)
+	retentionLogic := logic.NewRetentionLogic(memory.NewRetentionRepository(), userDeviceRepository, metricRepository, 0)
+
+	router := NewRouter(
+		zerolog.Nop(),
+		middlewares.EnsureValidLocalToken(secret),
+		endpoints.NewMetricsEndpoints(metricLogic, hub),
+		endpoints.NewUserEndpoint(userLogic),
+		endpoints.NewAlertEndpoints(alertLogic),
+		endpoints.NewWebhookEndpoints(webhookLogic),
+		endpoints.NewRetentionEndpoints(retentionLogic),
+		endpoints.NewDeviceTokenEndpoints(logic.NewDeviceTokenLogic(userDeviceRepository, secret)),
+		endpoints.NewHealthEndpoints(nil),
+		"",
+	)
+	server := httptest.NewUnstartedServer(router)
+	// as in the service, shutting down ends the metric streams
+	server.Config.RegisterOnShutdown(hub.Close)
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func doRequest(t *testing.T, method, url string, headers map[string]string, body any) *http.Response {
+	var payload bytes.Buffer
+	if body != nil {
+		err := json.NewEncoder(&payload).Encode(body)
+		assert.Nil(t, err)
+	}
+
+	request, err := http.NewRequest(method, url, &payload)
+	assert.Nil(t, err)
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	t.Cleanup(func() { response.Body.Close() })
+	return response
+}
+
+// signUp creates an account with a bound device and returns its user id and
+// the authorization headers of the session
+func signUp(t *testing.T, server *httptest.Server, deviceID string) (string, map[string]string) {
+	response := doRequest(t, http.MethodPost, server.URL+"/users", nil, map[string]string{
+		"name":     "Random User",
+		"email":    "random@test.com",
+		"password": "UltraSecr3tPassword!",
+	})
+	assert.Less(t, response.StatusCode, 300)
+
+	basic := base64.StdEncoding.EncodeToString([]byte("random@test.com:UltraSecr3tPassword!"))
+	response = doRequest(t, http.MethodPost, server.URL+"/signin", map[string]string{"X-Apigateway-Api-Userinfo": "Basic " + basic}, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var login endpoints.LoginResponse
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&login))
+	authorization := map[string]string{"Authorization": "Bearer " + login.AccessToken}
+	userID := tokenIssuer(t, login.AccessToken)
+
+	response = doRequest(t, http.MethodPost, fmt.Sprintf("%s/users/%s/devices", server.URL, userID), authorization, map[string]string{"device": deviceID})
+	assert.Less(t, response.StatusCode, 300)
+	return userID, authorization
+}
+
+func TestOfflineIngestAndRead(t *testing.T) {
+	server := newOfflineServer(t)
+	userID, authorization := signUp(t, server, "sensor")
+
+	response := doRequest(t, http.MethodGet, server.URL+"/users/unknown/devices", authorization, nil)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+
+	now := time.Now()
+	response = doRequest(t, http.MethodPost, server.URL+"/metrics", authorization, map[string]any{
+		"metrics": []map[string]any{{
+			"sensor_id":      "sensor",
+			"user_id":        userID,
+			"sensor_version": "v1",
+			"alias":          "reservoir",
+			"ph":             6.2,
+			"timestamp":      float64(now.Unix()),
+		}},
+	})
+	assert.Less(t, response.StatusCode, 300)
+
+	response = doRequest(t, http.MethodGet, fmt.Sprintf("%s/users/%s/devices/sensor/metrics?fields=ph", server.URL, userID), authorization, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var metrics endpoints.GetMetricsResponse
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&metrics))
+	if assert.Len(t, metrics.Metrics, 1) {
+		assert.Equal(t, 6.2, metrics.Metrics[0].Fields["ph"])
+		assert.Equal(t, now.Unix(), metrics.Metrics[0].Time.Unix())
+	}
+
+	response = doRequest(t, http.MethodPatch, fmt.Sprintf("%s/users/%s/devices/sensor", server.URL, userID), authorization, map[string]any{"name": "lettuce", "probes": []string{"ph"}})
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	response = doRequest(t, http.MethodGet, fmt.Sprintf("%s/users/%s/devices", server.URL, userID), authorization, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var devices endpoints.GetDevicesResponse
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&devices))
+	if assert.Len(t, devices.Devices, 1) {
+		assert.Equal(t, "lettuce", devices.Devices[0].Name)
+		assert.Equal(t, []string{"ph"}, devices.Devices[0].Probes)
+		assert.False(t, devices.Devices[0].CreatedAt.IsZero())
+	}
+
+	response = doRequest(t, http.MethodPost, fmt.Sprintf("%s/users/%s/devices/sensor/token", server.URL, userID), authorization, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var token models.DeviceToken
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&token))
+	assert.NotEmpty(t, token.Token)
+	response = doRequest(t, http.MethodPost, fmt.Sprintf("%s/users/%s/devices/unknown/token", server.URL, userID), authorization, nil)
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+
+	response = doRequest(t, http.MethodGet, fmt.Sprintf("%s/users/%s/devices", server.URL, userID), nil, nil)
+	assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+}
+
+// tokenIssuer reads the user id carried by the token issuer claim
+func tokenIssuer(t *testing.T, token string) string {
+	var claims struct {
+		Issuer string `json:"iss"`
+	}
+	parts := bytes.Split([]byte(token), []byte("."))
+	payload, err := base64.RawURLEncoding.DecodeString(string(parts[1]))
+	assert.Nil(t, err)
+	assert.Nil(t, json.Unmarshal(payload, &claims))
+	return claims.Issuer
+}
+
+func TestOfflineWriteLines(t *testing.T) {
+	server := newOfflineServer(t)
+	userID, authorization := signUp(t, server, "sensor")
+
+	now := time.Now()
+	lines := fmt.Sprintf("metrics,sensor_id=sensor,user_id=%s,alias=reservoir,sensor_version=v1,host=telegraf ph=6.2,ec=1.8 %d\n", userID, now.UnixMilli())
+	response := doLines(t, server.URL+"/write?precision=ms", authorization, lines)
+	assert.Less(t, response.StatusCode, 300)
+
+	// line protocol is also accepted by the json ingest endpoint
+	lines = fmt.Sprintf("# comment\n\nmetrics,sensor_id=sensor,user_id=%s,alias=reservoir,sensor_version=v1 tds=420i %d\n", userID, now.Add(-time.Second).UnixNano())
+	response = doLines(t, server.URL+"/metrics", authorization, lines)
+	assert.Less(t, response.StatusCode, 300)
+
+	response = doRequest(t, http.MethodGet, fmt.Sprintf("%s/users/%s/devices/sensor/metrics?fields=ph,tds", server.URL, userID), authorization, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var metrics endpoints.GetMetricsResponse
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&metrics))
+	if assert.Len(t, metrics.Metrics, 2) {
+		assert.Equal(t, 420.0, metrics.Metrics[0].Fields["tds"])
+		assert.Equal(t, 6.2, metrics.Metrics[1].Fields["ph"])
+		assert.Equal(t, now.UnixMilli(), metrics.Metrics[1].Time.UnixMilli())
+	}
+
+	lines = fmt.Sprintf("metrics,sensor_id=sensor,user_id=%s,alias=reservoir,sensor_version=v1 ph=6.2 %d\n"+
+		"metrics,sensor_id=sensor,alias=reservoir,sensor_version=v1 ph=6.2 %d\n"+
+		"metrics,sensor_id=sensor ph=\"acid\"\n"+
+		"metrics ph=\n", userID, now.Unix(), now.Unix())
+	response = doLines(t, server.URL+"/write?precision=s", authorization, lines)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+	var rejected endpoints.WriteLinesErrorResponse
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&rejected))
+	if assert.Len(t, rejected.Errors, 3) {
+		assert.Equal(t, int64(2), rejected.Errors[0].Line)
+		assert.Contains(t, rejected.Errors[0].Error, "UserID")
+		assert.Equal(t, int64(3), rejected.Errors[1].Line)
+		assert.Contains(t, rejected.Errors[1].Error, "numeric")
+		assert.Equal(t, int64(4), rejected.Errors[2].Line)
+	}
+
+	lines = fmt.Sprintf("metrics,sensor_id=unknown,user_id=%s,alias=reservoir,sensor_version=v1 ph=6.2\n", userID)
+	response = doLines(t, server.URL+"/write", authorization, lines)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+
+	response = doLines(t, server.URL+"/write?precision=h", authorization, lines)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
+
+func doLines(t *testing.T, url string, headers map[string]string, lines string) *http.Response {
+	request, err := http.NewRequest(http.MethodPost, url, strings.NewReader(lines))
+	assert.Nil(t, err)
+	request.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	t.Cleanup(func() { response.Body.Close() })
+	return response
+}
+
+func TestOfflineEncodedBodies(t *testing.T) {
+	server := newOfflineServer(t)
+	userID, authorization := signUp(t, server, "sensor")
+
+	now := time.Now()
+	reading := func(offset time.Duration) map[string]any {
+		return map[string]any{
+			"sensor_id":      "sensor",
+			"user_id":        userID,
+			"sensor_version": "v1",
+			"alias":          "reservoir",
+			"ph":             6.2,
+			"timestamp":      now.Add(-offset).Unix(),
+		}
+	}
+	cborBody, err := cbor.Marshal(map[string]any{"metrics": []map[string]any{reading(0)}})
+	assert.Nil(t, err)
+	msgpackBody, err := msgpack.Marshal(map[string]any{"metrics": []map[string]any{reading(time.Second)}})
+	assert.Nil(t, err)
+	jsonBody, err := json.Marshal(map[string]any{"metrics": []map[string]any{reading(2 * time.Second), reading(3 * time.Second)}})
+	assert.Nil(t, err)
+
+	var gzipped bytes.Buffer
+	gzipWriter := gzip.NewWriter(&gzipped)
+	_, err = gzipWriter.Write(jsonBody)
+	assert.Nil(t, err)
+	assert.Nil(t, gzipWriter.Close())
+
+	var deflated bytes.Buffer
+	flateWriter, err := flate.NewWriter(&deflated, flate.BestCompression)
+	assert.Nil(t, err)
+	_, err = flateWriter.Write(msgpackBody)
+	assert.Nil(t, err)
+	assert.Nil(t, flateWriter.Close())
+
+	var zlibbed bytes.Buffer
+	zlibWriter := zlib.NewWriter(&zlibbed)
+	_, err = zlibWriter.Write(cborBody)
+	assert.Nil(t, err)
+	assert.Nil(t, zlibWriter.Close())
+
+	// a compressed body far smaller than the limit once decoded
+	var bomb bytes.Buffer
+	gzipWriter = gzip.NewWriter(&bomb)
+	_, err = gzipWriter.Write(bytes.Repeat([]byte(" "), maxIngestBodyBytes+1))
+	assert.Nil(t, err)
+	assert.Nil(t, gzipWriter.Close())
+
+	var tests = []struct {
+		name        string
+		contentType string
+		encoding    string
+		body        []byte
+		wantStatus  int
+	}{
+		{name: "cbor", contentType: "application/cbor", body: cborBody, wantStatus: http.StatusCreated},
+		{name: "msgpack", contentType: "application/msgpack", body: msgpackBody, wantStatus: http.StatusCreated},
+		{name: "gzip json", contentType: "application/json", encoding: "gzip", body: gzipped.Bytes(), wantStatus: http.StatusCreated},
+		{name: "raw deflate msgpack", contentType: "application/x-msgpack", encoding: "deflate", body: deflated.Bytes(), wantStatus: http.StatusCreated},
+		{name: "zlib deflate cbor", contentType: "application/cbor", encoding: "deflate", body: zlibbed.Bytes(), wantStatus: http.StatusCreated},
+		{name: "invalid cbor", contentType: "application/cbor", body: []byte{0xff, 0x00}, wantStatus: http.StatusBadRequest},
+		{name: "msgpack without metrics", contentType: "application/msgpack", body: []byte{0x80}, wantStatus: http.StatusBadRequest},
+		{name: "invalid gzip", contentType: "application/json", encoding: "gzip", body: jsonBody, wantStatus: http.StatusBadRequest},
+		{name: "unknown encoding", contentType: "application/json", encoding: "br", body: jsonBody, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "decoded body too large", contentType: "application/json", encoding: "gzip", body: bomb.Bytes(), wantStatus: http.StatusRequestEntityTooLarge},
+		{name: "body too large", contentType: "application/json", body: bytes.Repeat([]byte(" "), maxIngestBodyBytes+1), wantStatus: http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			response := doEncoded(t, server.URL+"/metrics", authorization, tt.contentType, tt.encoding, tt.body)
+			if tt.wantStatus == http.StatusCreated {
+				assert.Less(t, response.StatusCode, 300)
+				return
+			}
+			assert.Equal(t, tt.wantStatus, response.StatusCode)
+		})
+	}
+
+	response := doRequest(t, http.MethodGet, fmt.Sprintf("%s/users/%s/devices/sensor/metrics?fields=ph", server.URL, userID), authorization, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var metrics endpoints.GetMetricsResponse
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&metrics))
+	assert.Len(t, metrics.Metrics, 4)
+}
+
+func doEncoded(t *testing.T, url string, headers map[string]string, contentType, encoding string, body []byte) *http.Response {
+	request, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	assert.Nil(t, err)
+	request.Header.Set("Content-Type", contentType)
+	if len(encoding) > 0 {
+		request.Header.Set("Content-Encoding", encoding)
+	}
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	assert.Nil(t, err)
+	t.Cleanup(func() { response.Body.Close() })
+	return response
+}
+
+func TestOfflineIdempotency(t *testing.T) {
+	server := newOfflineServer(t)
+	userID, authorization := signUp(t, server, "sensor")
+
+	body := func(sensorID string) map[string]any {
+		return map[string]any{"metrics": []map[string]any{{
+			"sensor_id":      sensorID,
+			"user_id":        userID,
+			"sensor_version": "v1",
+			"alias":          "reservoir",
+			"ph":             6.2,
+			"timestamp":      float64(time.Now().Unix()),
+		}}}
+	}
+	withKey := func(key string) map[string]string {
+		return map[string]string{"Authorization": authorization["Authorization"], middlewares.IdempotencyKeyHeader: key}
+	}
+
+	written := body("sensor")
+	response := doRequest(t, http.MethodPost, server.URL+"/metrics", withKey("write-1"), written)
+	assert.Less(t, response.StatusCode, 300)
+	assert.Empty(t, response.Header.Get(middlewares.IdempotentReplayedHeader))
+
+	response = doRequest(t, http.MethodPost, server.URL+"/metrics", withKey("write-1"), written)
+	assert.Less(t, response.StatusCode, 300)
+	assert.Equal(t, "true", response.Header.Get(middlewares.IdempotentReplayedHeader))
+
+	// errors are replayed too, even once the request would succeed
+	rejected := body("unknown")
+	response = doRequest(t, http.MethodPost, server.URL+"/metrics", withKey("write-2"), rejected)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	response = doRequest(t, http.MethodPost, server.URL+"/users/"+userID+"/devices", authorization, map[string]string{"device": "unknown"})
+	assert.Less(t, response.StatusCode, 300)
+	response = doRequest(t, http.MethodPost, server.URL+"/metrics", withKey("write-2"), rejected)
+	assert.Equal(t, http.StatusForbidden, response.StatusCode)
+	assert.Equal(t, "true", response.Header.Get(middlewares.IdempotentReplayedHeader))
+
+	response = doRequest(t, http.MethodPost, server.URL+"/metrics", withKey("write-1"), body("unknown"))
+	assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+
+	response = doRequest(t, http.MethodPost, server.URL+"/metrics", withKey(strings.Repeat("k", 256)), written)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	// readings retried without a key are deduplicated
+	response = doRequest(t, http.MethodPost, server.URL+"/metrics", authorization, written)
+	assert.Less(t, response.StatusCode, 300)
+	response = doRequest(t, http.MethodGet, fmt.Sprintf("%s/users/%s/devices/sensor/metrics?fields=ph", server.URL, userID), authorization, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var metrics endpoints.GetMetricsResponse
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&metrics))
+	assert.Len(t, metrics.Metrics, 1)
+}
+
+func TestOfflinePartialWrite(t *testing.T) {
+	server := newOfflineServer(t)
+	userID, authorization := signUp(t, server, "sensor")
+
+	now := time.Now()
+	reading := func(sensorID string, at time.Time) map[string]any {
+		return map[string]any{
+			"sensor_id":      sensorID,
+			"user_id":        userID,
+			"sensor_version": "v1",
+			"alias":          "reservoir",
+			"ph":             6.2,
+			"timestamp":      float64(at.Unix()),
+		}
+	}
+	batch := map[string]any{"metrics": []map[string]any{
+		reading("sensor", now),
+		reading("unknown", now),
+		reading("sensor", now.AddDate(0, 0, -31)),
+		{"sensor_id": "sensor", "ph": 6.2},
+		reading("sensor", now.Add(-time.Minute)),
+	}}
+
+	// without the partial mode the whole batch is rejected
+	response := doRequest(t, http.MethodPost, server.URL+"/metrics", authorization, batch)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	response = doRequest(t, http.MethodPost, server.URL+"/metrics?partial=true", authorization, batch)
+	assert.Equal(t, http.StatusMultiStatus, response.StatusCode)
+	var partial endpoints.WriteMetricsResponse
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&partial))
+	assert.Equal(t, 2, partial.Written)
+	if assert.Len(t, partial.Rejected, 3) {
+		assert.Equal(t, 1, partial.Rejected[0].Index)
+		assert.Equal(t, http.StatusForbidden, partial.Rejected[0].Status)
+		assert.Equal(t, 2, partial.Rejected[1].Index)
+		assert.Contains(t, partial.Rejected[1].Reason, "30 days")
+		assert.Equal(t, 3, partial.Rejected[2].Index)
+		assert.Contains(t, partial.Rejected[2].Reason, "UserID")
+	}
+
+	response = doRequest(t, http.MethodGet, fmt.Sprintf("%s/users/%s/devices/sensor/metrics?fields=ph", server.URL, userID), authorization, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var metrics endpoints.GetMetricsResponse
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&metrics))
+	assert.Len(t, metrics.Metrics, 2)
+
+	response = doRequest(t, http.MethodPost, server.URL+"/metrics?partial=true", authorization, map[string]any{"metrics": []map[string]any{reading("sensor", now.Add(-2*time.Minute))}})
+	assert.Less(t, response.StatusCode, 300)
+
+	response = doRequest(t, http.MethodPost, server.URL+"/metrics?partial=maybe", authorization, batch)
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+}
+
+func TestOfflineHealth(t *testing.T) {
+	server := newOfflineServer(t)
+
+	response := doRequest(t, http.MethodGet, server.URL+"/health", nil, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	var health endpoints.Health
+	assert.Nil(t, json.NewDecoder(response.Body).Decode(&health))
+	assert.Equal(t, "ok", health.Status)
+	assert.Nil(t, health.Spool)
+}
+
+func TestOfflineShutdownEndsStreams(t *testing.T) {
+	server := newOfflineServer(t)
+	userID, authorization := signUp(t, server, "sensor")
+
+	response := doRequest(t, http.MethodGet, server.URL+"/users/"+userID+"/metrics/stream", authorization, nil)
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, server.Config.Shutdown(ctx))
+	_, err := io.ReadAll(response.Body)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,216 @@
+// Package coap ingests the sensor metrics of constrained devices over CoAP
+package coap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/pion/dtls/v2"
+	coapDTLS "github.com/plgd-dev/go-coap/v3/dtls"
+	dtlsServer "github.com/plgd-dev/go-coap/v3/dtls/server"
+	"github.com/plgd-dev/go-coap/v3/message"
+	"github.com/plgd-dev/go-coap/v3/message/codes"
+	"github.com/plgd-dev/go-coap/v3/mux"
+	coapNet "github.com/plgd-dev/go-coap/v3/net"
+	"github.com/plgd-dev/go-coap/v3/options"
+	"github.com/plgd-dev/go-coap/v3/udp"
+	udpServer "github.com/plgd-dev/go-coap/v3/udp/server"
+	"github.com/rs/zerolog/log"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+// handleTimeout bounds how long a request can take to be written
+const handleTimeout = 30 * time.Second
+
+// tokenQuery is the URI query carrying the device token, as in /metrics?token=...
+const tokenQuery = "token="
+
+// statusCodes maps the localErrs status codes to CoAP response codes, any
+// other error is answered with 5.00
+var statusCodes = map[int]codes.Code{
+	http.StatusBadRequest:         codes.BadRequest,
+	http.StatusUnauthorized:       codes.Unauthorized,
+	http.StatusForbidden:          codes.Forbidden,
+	http.StatusNotFound:           codes.NotFound,
+	http.StatusServiceUnavailable: codes.ServiceUnavailable,
+}
+
+// request is either a single sensor request or a batch of them, the token can
+// be sent in the payload or as the token URI query. Single requests are decoded
+// on their own so the fields they carry are kept
+type request struct {
+	Token   string                 `json:"token"`
+	Metrics []models.SensorRequest `json:"metrics"`
+}
+
+// Server accepts confirmable POSTs to /metrics with CBOR or JSON payloads,
+// devices authenticate with the token issued by the DeviceTokenLogic.
+// Tokens are sent in clear over plain UDP, which must only be served on
+// trusted networks, ListenAndServeDTLS encrypts them
+type Server struct {
+	metricLogic logic.MetricLogic
+	tokens      logic.DeviceTokenLogic
+	server      *udpServer.Server
+	dtlsServer  *dtlsServer.Server
+}
+
+func NewServer(metricLogic logic.MetricLogic, tokens logic.DeviceTokenLogic) *Server {
+	s := &Server{metricLogic: metricLogic, tokens: tokens}
+	router := mux.NewRouter()
+	router.DefaultHandleFunc(func(w mux.ResponseWriter, r *mux.Message) {
+		s.respond(w, localErrs.NotFoundErr.WithMsg("unknown path"))
+	})
+	router.HandleFunc("/metrics", s.registerMetric)
+	onErr := options.WithErrors(func(err error) {
+		log.Warn().Err(err).Msg("coap server error")
+	})
+	s.server = udp.NewServer(options.WithMux(router), onErr)
+	s.dtlsServer = coapDTLS.NewServer(options.WithMux(router), onErr)
+	return s
+}
+
+// ListenAndServe blocks serving plain UDP on the address until Stop is called
+func (s *Server) ListenAndServe(address string) error {
+	listener, err := coapNet.NewListenUDP("udp", address)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to listen coap address").WithDetails("address", address).WithErr(err)
+	}
+	defer listener.Close()
+	return s.Serve(listener)
+}
+
+// ListenAndServeDTLS blocks serving DTLS on the address until Stop is called
+func (s *Server) ListenAndServeDTLS(address string, config *dtls.Config) error {
+	listener, err := coapNet.NewDTLSListener("udp", address, config)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to listen coap address").WithDetails("address", address).WithErr(err)
+	}
+	defer listener.Close()
+	return s.ServeDTLS(listener)
+}
+
+func (s *Server) Serve(listener *coapNet.UDPConn) error {
+	return s.server.Serve(listener)
+}
+
+func (s *Server) ServeDTLS(listener *coapNet.DTLSListener) error {
+	return s.dtlsServer.Serve(listener)
+}
+
+func (s *Server) Stop() {
+	s.server.Stop()
+	s.dtlsServer.Stop()
+}
+
+func (s *Server) registerMetric(w mux.ResponseWriter, r *mux.Message) {
+	if r.Code() != codes.POST {
+		err := w.SetResponse(codes.MethodNotAllowed, message.TextPlain, nil)
+		if err != nil {
+			log.Warn().Err(err).Msg("failed to set coap response")
+		}
+		return
+	}
+
+	format, err := r.ContentFormat()
+	if err != nil {
+		// devices omitting the content format are assumed to send json
+		format = message.AppJSON
+	}
+	body, err := r.ReadBody()
+	if err != nil {
+		s.respond(w, localErrs.BadRequestErr.WithMsg("failed to read payload").WithErr(err))
+		return
+	}
+	queries, _ := r.Queries()
+
+	ctx, cancel := context.WithTimeout(r.Context(), handleTimeout)
+	defer cancel()
+	s.respond(w, s.handle(ctx, format, queries, body))
+}
+
+// handle writes the metrics of a request, the ownership of the sensors is
+// checked by the metric logic once the token proved the device identity
+func (s *Server) handle(ctx context.Context, format message.MediaType, queries []string, body []byte) error {
+	var unmarshal func(data []byte, v any) error
+	switch format {
+	case message.AppCBOR:
+		unmarshal = cbor.Unmarshal
+	case message.AppJSON:
+		unmarshal = json.Unmarshal
+	default:
+		return localErrs.BadRequestErr.WithMsg("unsupported content format").WithDetails("format", format.String())
+	}
+
+	var req request
+	err := unmarshal(body, &req)
+	metrics := req.Metrics
+	if err == nil && metrics == nil {
+		metrics = make([]models.SensorRequest, 1)
+		err = unmarshal(body, &metrics[0])
+	}
+	if err != nil {
+		return localErrs.BadRequestErr.WithMsg("failed to decode payload").WithErr(err)
+	}
+
+	err = models.ValidateSensorRequests(metrics)
+	if err != nil {
+		return err
+	}
+
+	token := req.Token
+	for _, query := range queries {
+		if value, ok := strings.CutPrefix(query, tokenQuery); ok && len(token) == 0 {
+			token = value
+		}
+	}
+	for _, metric := range metrics {
+		err = s.tokens.Verify(ctx, metric.SensorID, token)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = s.metricLogic.WriteSensorMetrics(ctx, metrics)
+	if err != nil && !errors.Is(err, localErrs.AcceptedErr) {
+		return err
+	}
+	return nil
+}
+
+// respond answers 2.01 once the metrics are written or deferred, as CoAP has
+// no accepted code, errors carry their description as diagnostic payload
+func (s *Server) respond(w mux.ResponseWriter, err error) {
+	code := responseCode(err)
+	var payload io.ReadSeeker
+	if err != nil {
+		log.Warn().Err(err).Str("code", code.String()).Msg("coap request failed")
+		payload = strings.NewReader(err.Error())
+	}
+
+	setErr := w.SetResponse(code, message.TextPlain, payload)
+	if setErr != nil {
+		log.Warn().Err(setErr).Msg("failed to set coap response")
+	}
+}
+
+func responseCode(err error) codes.Code {
+	if err == nil {
+		return codes.Created
+	}
+	var apiErr *localErrs.Error
+	if errors.As(err, &apiErr) {
+		if code, ok := statusCodes[apiErr.StatusCode]; ok {
+			return code
+		}
+	}
+	return codes.InternalServerError
+}
@@ -0,0 +1,220 @@
+package coap
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/pion/dtls/v2"
+	coapDTLS "github.com/plgd-dev/go-coap/v3/dtls"
+	"github.com/plgd-dev/go-coap/v3/message"
+	"github.com/plgd-dev/go-coap/v3/message/codes"
+	coapNet "github.com/plgd-dev/go-coap/v3/net"
+	"github.com/plgd-dev/go-coap/v3/udp"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+func TestHandle(t *testing.T) {
+	timestamp := float64(time.Now().Unix())
+	reading := map[string]any{"sensor_id": "sensor1", "user_id": "user1", "sensor_version": "v1", "alias": "reservoir", "ph": 6.2, "timestamp": timestamp}
+	withToken := map[string]any{"token": "secret"}
+	for key, value := range reading {
+		withToken[key] = value
+	}
+	cborReading, err := cbor.Marshal(withToken)
+	assert.Nil(t, err)
+
+	var tests = []struct {
+		name         string
+		givenFormat  message.MediaType
+		givenQueries []string
+		givenBody    []byte
+		setup        func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic)
+		assert       func(t *testing.T, err error)
+	}{
+		{
+			name:        "cbor reading with token in the payload",
+			givenFormat: message.AppCBOR,
+			givenBody:   cborReading,
+			setup: func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {
+				tokens.EXPECT().Verify(gomock.Any(), "sensor1", "secret").Return(nil)
+				metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []models.SensorRequest) error {
+					if assert.Len(t, metrics, 1) {
+						assert.Equal(t, "user1", metrics[0].UserID)
+						assert.Equal(t, 6.2, metrics[0].PH)
+						_, ok := metrics[0].Field("ec")
+						assert.False(t, ok)
+						assert.Equal(t, int64(timestamp), metrics[0].Time.Unix())
+					}
+					return nil
+				})
+			},
+			assert: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:         "json batch with token in the uri query",
+			givenFormat:  message.AppJSON,
+			givenQueries: []string{"token=secret"},
+			givenBody:    []byte(fmt.Sprintf(`{"metrics":[{"sensor_id":"sensor1","user_id":"user1","sensor_version":"v1","alias":"reservoir","timestamp":%f}]}`, timestamp)),
+			setup: func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {
+				tokens.EXPECT().Verify(gomock.Any(), "sensor1", "secret").Return(nil)
+				metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Len(1)).Return(localErrs.AcceptedErr)
+			},
+			assert: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:        "invalid token",
+			givenFormat: message.AppCBOR,
+			givenBody:   cborReading,
+			setup: func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {
+				tokens.EXPECT().Verify(gomock.Any(), "sensor1", "secret").Return(localErrs.UnauthorizedErr)
+			},
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.UnauthorizedErr)
+			},
+		},
+		{
+			name:        "missing required fields",
+			givenFormat: message.AppJSON,
+			givenBody:   []byte(`{"token":"secret","ph":6.2}`),
+			setup:       func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {},
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+		{
+			name:        "unsupported content format",
+			givenFormat: message.AppXML,
+			givenBody:   []byte(`<ph>6.2</ph>`),
+			setup:       func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {},
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+		{
+			name:        "sensor not owned by the user",
+			givenFormat: message.AppCBOR,
+			givenBody:   cborReading,
+			setup: func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {
+				tokens.EXPECT().Verify(gomock.Any(), "sensor1", "secret").Return(nil)
+				metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).Return(localErrs.ForbiddenErr)
+			},
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ForbiddenErr)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			metricLogic := logic.NewMockMetricLogic(ctrl)
+			tokens := logic.NewMockDeviceTokenLogic(ctrl)
+			tt.setup(metricLogic, tokens)
+
+			err := NewServer(metricLogic, tokens).handle(context.Background(), tt.givenFormat, tt.givenQueries, tt.givenBody)
+			tt.assert(t, err)
+		})
+	}
+}
+
+func TestResponseCode(t *testing.T) {
+	assert.Equal(t, codes.Created, responseCode(nil))
+	assert.Equal(t, codes.BadRequest, responseCode(localErrs.BadRequestErr))
+	assert.Equal(t, codes.Unauthorized, responseCode(localErrs.UnauthorizedErr))
+	assert.Equal(t, codes.Forbidden, responseCode(localErrs.ForbiddenErr))
+	assert.Equal(t, codes.InternalServerError, responseCode(localErrs.InternalServerErr))
+	assert.Equal(t, codes.InternalServerError, responseCode(context.DeadlineExceeded))
+}
+
+func TestServer(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	metricLogic := logic.NewMockMetricLogic(ctrl)
+	metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Len(1)).Return(nil)
+	tokens := logic.NewMockDeviceTokenLogic(ctrl)
+	tokens.EXPECT().Verify(gomock.Any(), "sensor1", "secret").Return(nil)
+	tokens.EXPECT().Verify(gomock.Any(), "sensor1", "wrong").Return(localErrs.UnauthorizedErr)
+
+	listener, err := coapNet.NewListenUDP("udp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	server := NewServer(metricLogic, tokens)
+	go server.Serve(listener)
+	defer server.Stop()
+
+	conn, err := udp.Dial(listener.LocalAddr().String())
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	payload, err := cbor.Marshal(map[string]any{"sensor_id": "sensor1", "user_id": "user1", "sensor_version": "v1", "alias": "reservoir", "ec": 1.8, "timestamp": time.Now().Unix()})
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := conn.Post(ctx, "/metrics", message.AppCBOR, bytes.NewReader(payload), message.Option{ID: message.URIQuery, Value: []byte("token=secret")})
+	assert.Nil(t, err)
+	assert.Equal(t, codes.Created, response.Code())
+
+	response, err = conn.Post(ctx, "/metrics", message.AppCBOR, bytes.NewReader(payload), message.Option{ID: message.URIQuery, Value: []byte("token=wrong")})
+	assert.Nil(t, err)
+	assert.Equal(t, codes.Unauthorized, response.Code())
+
+	response, err = conn.Get(ctx, "/metrics")
+	assert.Nil(t, err)
+	assert.Equal(t, codes.MethodNotAllowed, response.Code())
+
+	response, err = conn.Post(ctx, "/unknown", message.AppCBOR, bytes.NewReader(payload))
+	assert.Nil(t, err)
+	assert.Equal(t, codes.NotFound, response.Code())
+}
+
+func TestServerDTLS(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	metricLogic := logic.NewMockMetricLogic(ctrl)
+	metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Len(1)).Return(nil)
+	tokens := logic.NewMockDeviceTokenLogic(ctrl)
+	tokens.EXPECT().Verify(gomock.Any(), "sensor1", "secret").Return(nil)
+
+	config := &dtls.Config{
+		PSK: func([]byte) ([]byte, error) {
+			return []byte{0x01, 0x02, 0x03}, nil
+		},
+		PSKIdentityHint: []byte("hydroponics"),
+		CipherSuites:    []dtls.CipherSuiteID{dtls.TLS_PSK_WITH_AES_128_CCM_8},
+	}
+	listener, err := coapNet.NewDTLSListener("udp", "127.0.0.1:0", config)
+	assert.Nil(t, err)
+	server := NewServer(metricLogic, tokens)
+	go server.ServeDTLS(listener)
+	defer server.Stop()
+
+	conn, err := coapDTLS.Dial(listener.Addr().String(), config)
+	assert.Nil(t, err)
+	defer conn.Close()
+
+	payload, err := cbor.Marshal(map[string]any{"sensor_id": "sensor1", "user_id": "user1", "sensor_version": "v1", "alias": "reservoir", "token": "secret", "timestamp": time.Now().Unix()})
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	response, err := conn.Post(ctx, "/metrics", message.AppCBOR, bytes.NewReader(payload))
+	assert.Nil(t, err)
+	assert.Equal(t, codes.Created, response.Code())
+}
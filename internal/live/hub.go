@@ -0,0 +1,123 @@
+// Package live fans out accepted sensor metrics to the subscribers connected to the service
+package live
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+// subscriptionBuffer is the amount of metrics buffered per subscriber before dropping new ones
+const subscriptionBuffer = 64
+
+// Subscription receives the metrics of a user, optionally filtered by device
+type Subscription struct {
+	userID   string
+	deviceID string
+	events   chan models.SensorRequest
+	dropped  atomic.Int64
+}
+
+// Events returns the channel with the metrics received by the subscription, it's
+// closed when the subscription is canceled
+func (s *Subscription) Events() <-chan models.SensorRequest {
+	return s.events
+}
+
+// Dropped returns the amount of metrics discarded because the subscriber was too slow
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Hub keeps the subscriptions of each user and publishes metrics to them
+type Hub struct {
+	mu            sync.RWMutex
+	subscriptions map[string]map[*Subscription]struct{}
+	closed        bool
+}
+
+func NewHub() *Hub {
+	return &Hub{subscriptions: make(map[string]map[*Subscription]struct{})}
+}
+
+// Subscribe registers a subscription for the user metrics, an empty deviceID
+// subscribes to every user device. Subscriptions to a closed hub are closed
+func (h *Hub) Subscribe(userID, deviceID string) *Subscription {
+	subscription := &Subscription{
+		userID:   userID,
+		deviceID: deviceID,
+		events:   make(chan models.SensorRequest, subscriptionBuffer),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(subscription.events)
+		return subscription
+	}
+	if _, ok := h.subscriptions[userID]; !ok {
+		h.subscriptions[userID] = make(map[*Subscription]struct{})
+	}
+	h.subscriptions[userID][subscription] = struct{}{}
+	return subscription
+}
+
+// Unsubscribe removes the subscription and closes its events channel
+func (h *Hub) Unsubscribe(subscription *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subscriptions, ok := h.subscriptions[subscription.userID]
+	if !ok {
+		return
+	}
+	if _, ok := subscriptions[subscription]; !ok {
+		return
+	}
+
+	delete(subscriptions, subscription)
+	if len(subscriptions) == 0 {
+		delete(h.subscriptions, subscription.userID)
+	}
+	close(subscription.events)
+}
+
+// Close closes the events channel of every subscription, so the streams end
+// when the service shuts down
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, subscriptions := range h.subscriptions {
+		for subscription := range subscriptions {
+			close(subscription.events)
+		}
+	}
+	h.subscriptions = make(map[string]map[*Subscription]struct{})
+}
+
+// Publish sends the metrics to the matching subscriptions without blocking,
+// metrics are dropped for subscribers with a full buffer
+func (h *Hub) Publish(metrics ...models.SensorRequest) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, metric := range metrics {
+		for subscription := range h.subscriptions[metric.UserID] {
+			if len(subscription.deviceID) > 0 && subscription.deviceID != metric.SensorID {
+				continue
+			}
+
+			select {
+			case subscription.events <- metric:
+			default:
+				subscription.dropped.Add(1)
+			}
+		}
+	}
+}
+
+// OnSensorMetrics publishes the metrics accepted by the metric logic
+func (h *Hub) OnSensorMetrics(_ context.Context, metrics []models.SensorRequest) {
+	h.Publish(metrics...)
+}
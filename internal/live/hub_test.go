@@ -0,0 +1,97 @@
+package live
+
+import (
+	"testing"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublish(t *testing.T) {
+	var tests = []struct {
+		name          string
+		givenDeviceID string
+		givenMetrics  []models.SensorRequest
+		assert        func(t *testing.T, subscription *Subscription)
+	}{
+		{
+			name: "subscription without device receives every user metric",
+			givenMetrics: []models.SensorRequest{
+				{UserID: "user1", SensorID: "device1"},
+				{UserID: "user1", SensorID: "device2"},
+				{UserID: "user2", SensorID: "device3"},
+			},
+			assert: func(t *testing.T, subscription *Subscription) {
+				assert.Len(t, subscription.Events(), 2)
+				assert.Equal(t, "device1", (<-subscription.Events()).SensorID)
+				assert.Equal(t, "device2", (<-subscription.Events()).SensorID)
+			},
+		},
+		{
+			name:          "subscription with device only receives its metrics",
+			givenDeviceID: "device2",
+			givenMetrics: []models.SensorRequest{
+				{UserID: "user1", SensorID: "device1"},
+				{UserID: "user1", SensorID: "device2"},
+			},
+			assert: func(t *testing.T, subscription *Subscription) {
+				assert.Len(t, subscription.Events(), 1)
+				assert.Equal(t, "device2", (<-subscription.Events()).SensorID)
+			},
+		},
+		{
+			name:         "metrics are dropped when the buffer is full",
+			givenMetrics: make([]models.SensorRequest, subscriptionBuffer+3),
+			assert: func(t *testing.T, subscription *Subscription) {
+				assert.Len(t, subscription.Events(), subscriptionBuffer)
+				assert.Equal(t, int64(3), subscription.Dropped())
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.givenMetrics {
+				if len(tt.givenMetrics[i].UserID) == 0 {
+					tt.givenMetrics[i].UserID = "user1"
+				}
+			}
+
+			hub := NewHub()
+			subscription := hub.Subscribe("user1", tt.givenDeviceID)
+			hub.Publish(tt.givenMetrics...)
+			tt.assert(t, subscription)
+		})
+	}
+}
+
+func TestUnsubscribe(t *testing.T) {
+	hub := NewHub()
+	subscription := hub.Subscribe("user1", "")
+	hub.Unsubscribe(subscription)
+
+	_, open := <-subscription.Events()
+	assert.False(t, open)
+	assert.Empty(t, hub.subscriptions)
+
+	// publishing after unsubscribing shouldn't panic
+	hub.Publish(models.SensorRequest{UserID: "user1"})
+	hub.Unsubscribe(subscription)
+}
+
+func TestClose(t *testing.T) {
+	hub := NewHub()
+	subscription := hub.Subscribe("user1", "")
+	hub.Close()
+
+	_, open := <-subscription.Events()
+	assert.False(t, open)
+	assert.Empty(t, hub.subscriptions)
+
+	// the streams started while shutting down end right away
+	_, open = <-hub.Subscribe("user1", "").Events()
+	assert.False(t, open)
+
+	hub.Publish(models.SensorRequest{UserID: "user1"})
+	hub.Unsubscribe(subscription)
+}
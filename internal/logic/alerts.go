@@ -0,0 +1,214 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+// defaultAlertEventsRange is used when the caller doesn't provide the beginning of the range
+const defaultAlertEventsRange = 7 * 24 * time.Hour
+
+// AlertLogic contain alert rules correlated logic, rules are evaluated as a
+// MetricListener every time sensor metrics are written
+//
+//go:generate mockgen -destination alerts_mock.go -package logic github.com/WendelHime/hydroponics-metrics-collector/internal/logic AlertLogic
+type AlertLogic interface {
+	MetricListener
+	CreateRule(ctx context.Context, rule models.AlertRule) (models.AlertRule, error)
+	GetRules(ctx context.Context, userID string) ([]models.AlertRule, error)
+	DeleteRule(ctx context.Context, userID, ruleID string) error
+	GetEvents(ctx context.Context, userID string, from, to time.Time) ([]models.AlertEvent, error)
+}
+
+type alertLogic struct {
+	alertRepository      storage.AlertRepository
+	userDeviceRepository storage.UserDeviceRepository
+	listeners            []EventListener
+}
+
+// NewAlertLogic builds the alert logic, listeners are notified when rules start firing or are resolved
+func NewAlertLogic(alertRepository storage.AlertRepository, userDeviceRepository storage.UserDeviceRepository, listeners ...EventListener) AlertLogic {
+	return &alertLogic{alertRepository: alertRepository, userDeviceRepository: userDeviceRepository, listeners: listeners}
+}
+
+func (l *alertLogic) CreateRule(ctx context.Context, rule models.AlertRule) (models.AlertRule, error) {
+	if !slices.Contains(models.MeasurementFields, rule.Field) {
+		return models.AlertRule{}, localErrs.BadRequestErr.WithMsg("unknown field").WithDetails("field", rule.Field)
+	}
+
+	devices, err := l.userDeviceRepository.GetDevicesFromUser(ctx, rule.UserID)
+	if err != nil {
+		return models.AlertRule{}, err
+	}
+
+	// rules can only be created for the user devices
+	if !slices.Contains(models.DeviceIDs(devices), rule.DeviceID) {
+		return models.AlertRule{}, localErrs.ForbiddenErr
+	}
+
+	rule.ID = uuid.NewString()
+	rule.Status = models.AlertStatusInactive
+	rule.BreachedSince = time.Time{}
+	err = l.alertRepository.CreateRule(ctx, rule)
+	if err != nil {
+		return models.AlertRule{}, err
+	}
+	return rule, nil
+}
+
+func (l *alertLogic) GetRules(ctx context.Context, userID string) ([]models.AlertRule, error) {
+	return l.alertRepository.GetRules(ctx, userID)
+}
+
+func (l *alertLogic) DeleteRule(ctx context.Context, userID, ruleID string) error {
+	return l.alertRepository.DeleteRule(ctx, userID, ruleID)
+}
+
+func (l *alertLogic) GetEvents(ctx context.Context, userID string, from, to time.Time) ([]models.AlertEvent, error) {
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.Add(-defaultAlertEventsRange)
+	}
+	if !from.Before(to) {
+		return nil, localErrs.BadRequestErr.WithMsg("from must be before to")
+	}
+
+	return l.alertRepository.GetEvents(ctx, userID, from, to)
+}
+
+// OnSensorMetrics evaluates the user alert rules against the written metrics,
+// failures are only logged since the metrics were already persisted
+func (l *alertLogic) OnSensorMetrics(ctx context.Context, metrics []models.SensorRequest) {
+	metricsByUser := make(map[string][]models.SensorRequest)
+	for _, metric := range metrics {
+		metricsByUser[metric.UserID] = append(metricsByUser[metric.UserID], metric)
+	}
+
+	for userID, userMetrics := range metricsByUser {
+		err := l.evaluate(ctx, userID, userMetrics)
+		if err != nil {
+			log.Error().Err(err).Str("userID", userID).Msg("failed to evaluate alert rules")
+		}
+	}
+}
+
+func (l *alertLogic) evaluate(ctx context.Context, userID string, metrics []models.SensorRequest) error {
+	rules, err := l.alertRepository.GetRules(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if len(rules) == 0 {
+		return nil
+	}
+
+	// readings are evaluated in the order they were collected
+	sort.SliceStable(metrics, func(i, j int) bool {
+		return metrics[i].Time.Before(metrics[j].Time)
+	})
+
+	for _, rule := range rules {
+		ruleMetrics := make([]models.SensorRequest, 0, len(metrics))
+		for _, metric := range metrics {
+			if _, ok := metric.Field(rule.Field); ok && metric.SensorID == rule.DeviceID {
+				ruleMetrics = append(ruleMetrics, metric)
+			}
+		}
+		if len(ruleMetrics) == 0 {
+			continue
+		}
+
+		// the stored state is updated in a transaction, so concurrent writes
+		// of the same device don't raise the same event twice
+		events, err := l.alertRepository.EvaluateRule(ctx, userID, rule.ID, func(rule *models.AlertRule) ([]models.AlertEvent, bool) {
+			events := make([]models.AlertEvent, 0)
+			changed := false
+			for _, metric := range ruleMetrics {
+				event, stateChanged := transition(rule, metric)
+				changed = changed || stateChanged
+				if event != nil {
+					events = append(events, *event)
+				}
+			}
+			return events, changed
+		})
+		if errors.Is(err, localErrs.NotFoundErr) {
+			// the rule was deleted in the meantime
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, event := range events {
+			eventType := models.EventAlertFiring
+			if event.Status == models.AlertStatusResolved {
+				eventType = models.EventAlertResolved
+			}
+			for _, listener := range l.listeners {
+				listener.OnEvent(ctx, newEvent(eventType, userID, event))
+			}
+		}
+	}
+	return nil
+}
+
+// transition updates the rule state with the metric, returning an event when
+// the rule starts firing or is resolved and whether the state has changed
+func transition(rule *models.AlertRule, metric models.SensorRequest) (*models.AlertEvent, bool) {
+	value, ok := metric.Field(rule.Field)
+	if !ok {
+		return nil, false
+	}
+
+	newEvent := func(status string) *models.AlertEvent {
+		return &models.AlertEvent{
+			ID:        uuid.NewString(),
+			RuleID:    rule.ID,
+			DeviceID:  rule.DeviceID,
+			Field:     rule.Field,
+			Operator:  rule.Operator,
+			Threshold: rule.Threshold,
+			Value:     value,
+			Status:    status,
+			Time:      metric.Time,
+		}
+	}
+
+	if !rule.Breached(value) {
+		if rule.BreachedSince.IsZero() && rule.Status != models.AlertStatusFiring {
+			return nil, false
+		}
+
+		rule.BreachedSince = time.Time{}
+		if rule.Status != models.AlertStatusFiring {
+			return nil, true
+		}
+		rule.Status = models.AlertStatusInactive
+		return newEvent(models.AlertStatusResolved), true
+	}
+
+	changed := false
+	if rule.BreachedSince.IsZero() {
+		rule.BreachedSince = metric.Time
+		changed = true
+	}
+
+	duration := time.Duration(rule.ForSeconds) * time.Second
+	if rule.Status != models.AlertStatusFiring && metric.Time.Sub(rule.BreachedSince) >= duration {
+		rule.Status = models.AlertStatusFiring
+		return newEvent(models.AlertStatusFiring), true
+	}
+	return nil, changed
+}
@@ -0,0 +1,108 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/WendelHime/hydroponics-metrics-collector/internal/logic (interfaces: AlertLogic)
+
+// Package logic is a generated GoMock package.
+package logic
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	models "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockAlertLogic is a mock of AlertLogic interface.
+type MockAlertLogic struct {
+	ctrl     *gomock.Controller
+	recorder *MockAlertLogicMockRecorder
+}
+
+// MockAlertLogicMockRecorder is the mock recorder for MockAlertLogic.
+type MockAlertLogicMockRecorder struct {
+	mock *MockAlertLogic
+}
+
+// NewMockAlertLogic creates a new mock instance.
+func NewMockAlertLogic(ctrl *gomock.Controller) *MockAlertLogic {
+	mock := &MockAlertLogic{ctrl: ctrl}
+	mock.recorder = &MockAlertLogicMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockAlertLogic) EXPECT() *MockAlertLogicMockRecorder {
+	return m.recorder
+}
+
+// CreateRule mocks base method.
+func (m *MockAlertLogic) CreateRule(arg0 context.Context, arg1 models.AlertRule) (models.AlertRule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRule", arg0, arg1)
+	ret0, _ := ret[0].(models.AlertRule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateRule indicates an expected call of CreateRule.
+func (mr *MockAlertLogicMockRecorder) CreateRule(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRule", reflect.TypeOf((*MockAlertLogic)(nil).CreateRule), arg0, arg1)
+}
+
+// DeleteRule mocks base method.
+func (m *MockAlertLogic) DeleteRule(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRule", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteRule indicates an expected call of DeleteRule.
+func (mr *MockAlertLogicMockRecorder) DeleteRule(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRule", reflect.TypeOf((*MockAlertLogic)(nil).DeleteRule), arg0, arg1, arg2)
+}
+
+// GetEvents mocks base method.
+func (m *MockAlertLogic) GetEvents(arg0 context.Context, arg1 string, arg2, arg3 time.Time) ([]models.AlertEvent, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetEvents", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].([]models.AlertEvent)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetEvents indicates an expected call of GetEvents.
+func (mr *MockAlertLogicMockRecorder) GetEvents(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetEvents", reflect.TypeOf((*MockAlertLogic)(nil).GetEvents), arg0, arg1, arg2, arg3)
+}
+
+// GetRules mocks base method.
+func (m *MockAlertLogic) GetRules(arg0 context.Context, arg1 string) ([]models.AlertRule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRules", arg0, arg1)
+	ret0, _ := ret[0].([]models.AlertRule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRules indicates an expected call of GetRules.
+func (mr *MockAlertLogicMockRecorder) GetRules(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRules", reflect.TypeOf((*MockAlertLogic)(nil).GetRules), arg0, arg1)
+}
+
+// OnSensorMetrics mocks base method.
+func (m *MockAlertLogic) OnSensorMetrics(arg0 context.Context, arg1 []models.SensorRequest) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnSensorMetrics", arg0, arg1)
+}
+
+// OnSensorMetrics indicates an expected call of OnSensorMetrics.
+func (mr *MockAlertLogicMockRecorder) OnSensorMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnSensorMetrics", reflect.TypeOf((*MockAlertLogic)(nil).OnSensorMetrics), arg0, arg1)
+}
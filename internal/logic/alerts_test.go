@@ -0,0 +1,217 @@
+package logic
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+)
+
+func TestCreateRule(t *testing.T) {
+	userID := uuid.NewString()
+	device1 := uuid.NewString()
+	var tests = []struct {
+		name      string
+		setup     func(ctrl *gomock.Controller) AlertLogic
+		givenRule models.AlertRule
+		assert    func(t *testing.T, rule models.AlertRule, err error)
+	}{
+		{
+			name: "create rule with success",
+			setup: func(ctrl *gomock.Controller) AlertLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}}, nil).Times(1)
+				alertRepository := storage.NewMockAlertRepository(ctrl)
+				alertRepository.EXPECT().CreateRule(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				return NewAlertLogic(alertRepository, userDeviceRepository)
+			},
+			givenRule: models.AlertRule{UserID: userID, DeviceID: device1, Field: "ph", Operator: models.OperatorGreaterThan, Threshold: 6.5},
+			assert: func(t *testing.T, rule models.AlertRule, err error) {
+				assert.Nil(t, err)
+				assert.NotEmpty(t, rule.ID)
+				assert.Equal(t, models.AlertStatusInactive, rule.Status)
+			},
+		},
+		{
+			name: "unknown field should return a bad request",
+			setup: func(ctrl *gomock.Controller) AlertLogic {
+				return NewAlertLogic(nil, nil)
+			},
+			givenRule: models.AlertRule{UserID: userID, DeviceID: device1, Field: "co2", Operator: models.OperatorGreaterThan},
+			assert: func(t *testing.T, rule models.AlertRule, err error) {
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, localErrs.BadRequestErr)
+				}
+			},
+		},
+		{
+			name: "provided device isn't correlated to the user",
+			setup: func(ctrl *gomock.Controller) AlertLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}}, nil).Times(1)
+				return NewAlertLogic(nil, userDeviceRepository)
+			},
+			givenRule: models.AlertRule{UserID: userID, DeviceID: uuid.NewString(), Field: "ph", Operator: models.OperatorGreaterThan},
+			assert: func(t *testing.T, rule models.AlertRule, err error) {
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, localErrs.ForbiddenErr)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			logic := tt.setup(ctrl)
+			rule, err := logic.CreateRule(context.Background(), tt.givenRule)
+			tt.assert(t, rule, err)
+		})
+	}
+}
+
+func TestTransition(t *testing.T) {
+	now := time.Now()
+	var tests = []struct {
+		name          string
+		givenRule     models.AlertRule
+		givenMetric   models.SensorRequest
+		expectedEvent string
+		expectedRule  models.AlertRule
+		changed       bool
+	}{
+		{
+			name:         "value within threshold keeps the rule inactive",
+			givenRule:    models.AlertRule{Field: "ph", Operator: models.OperatorGreaterThan, Threshold: 6.5, Status: models.AlertStatusInactive},
+			givenMetric:  models.SensorRequest{PH: 6.0, Time: now},
+			expectedRule: models.AlertRule{Field: "ph", Operator: models.OperatorGreaterThan, Threshold: 6.5, Status: models.AlertStatusInactive},
+		},
+		{
+			name:          "breaching rule without duration fires immediately",
+			givenRule:     models.AlertRule{Field: "ph", Operator: models.OperatorLessThan, Threshold: 5.5, Status: models.AlertStatusInactive},
+			givenMetric:   models.SensorRequest{PH: 5.0, Time: now},
+			expectedEvent: models.AlertStatusFiring,
+			expectedRule:  models.AlertRule{Field: "ph", Operator: models.OperatorLessThan, Threshold: 5.5, Status: models.AlertStatusFiring, BreachedSince: now},
+			changed:       true,
+		},
+		{
+			name:         "breaching rule with duration starts pending",
+			givenRule:    models.AlertRule{Field: "water_temperature", Operator: models.OperatorGreaterThan, Threshold: 24, ForSeconds: 600, Status: models.AlertStatusInactive},
+			givenMetric:  models.SensorRequest{WaterTemperature: 25, Time: now},
+			expectedRule: models.AlertRule{Field: "water_temperature", Operator: models.OperatorGreaterThan, Threshold: 24, ForSeconds: 600, Status: models.AlertStatusInactive, BreachedSince: now},
+			changed:      true,
+		},
+		{
+			name:          "breaching rule fires after the duration",
+			givenRule:     models.AlertRule{Field: "water_temperature", Operator: models.OperatorGreaterThan, Threshold: 24, ForSeconds: 600, Status: models.AlertStatusInactive, BreachedSince: now.Add(-10 * time.Minute)},
+			givenMetric:   models.SensorRequest{WaterTemperature: 25, Time: now},
+			expectedEvent: models.AlertStatusFiring,
+			expectedRule:  models.AlertRule{Field: "water_temperature", Operator: models.OperatorGreaterThan, Threshold: 24, ForSeconds: 600, Status: models.AlertStatusFiring, BreachedSince: now.Add(-10 * time.Minute)},
+			changed:       true,
+		},
+		{
+			name:         "firing rule still breached doesn't fire again",
+			givenRule:    models.AlertRule{Field: "ec", Operator: models.OperatorGreaterOrEqual, Threshold: 2000, Status: models.AlertStatusFiring, BreachedSince: now.Add(-time.Hour)},
+			givenMetric:  models.SensorRequest{EC: 2000, Time: now},
+			expectedRule: models.AlertRule{Field: "ec", Operator: models.OperatorGreaterOrEqual, Threshold: 2000, Status: models.AlertStatusFiring, BreachedSince: now.Add(-time.Hour)},
+		},
+		{
+			name:          "firing rule within threshold is resolved",
+			givenRule:     models.AlertRule{Field: "ec", Operator: models.OperatorGreaterOrEqual, Threshold: 2000, Status: models.AlertStatusFiring, BreachedSince: now.Add(-time.Hour)},
+			givenMetric:   models.SensorRequest{EC: 1500, Time: now},
+			expectedEvent: models.AlertStatusResolved,
+			expectedRule:  models.AlertRule{Field: "ec", Operator: models.OperatorGreaterOrEqual, Threshold: 2000, Status: models.AlertStatusInactive},
+			changed:       true,
+		},
+		{
+			name:         "pending rule within threshold is reset without event",
+			givenRule:    models.AlertRule{Field: "tds", Operator: models.OperatorLessOrEqual, Threshold: 500, ForSeconds: 600, Status: models.AlertStatusInactive, BreachedSince: now.Add(-time.Minute)},
+			givenMetric:  models.SensorRequest{TDS: 700, Time: now},
+			expectedRule: models.AlertRule{Field: "tds", Operator: models.OperatorLessOrEqual, Threshold: 500, ForSeconds: 600, Status: models.AlertStatusInactive},
+			changed:      true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			rule := tt.givenRule
+			event, changed := transition(&rule, tt.givenMetric)
+			assert.Equal(t, tt.expectedRule, rule)
+			assert.Equal(t, tt.changed, changed)
+			if len(tt.expectedEvent) == 0 {
+				assert.Nil(t, event)
+				return
+			}
+			if assert.NotNil(t, event) {
+				assert.Equal(t, tt.expectedEvent, event.Status)
+				assert.Equal(t, tt.givenMetric.Time, event.Time)
+			}
+		})
+	}
+}
+
+func TestAlertOnSensorMetrics(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userID := uuid.NewString()
+	device1 := uuid.NewString()
+	device2 := uuid.NewString()
+	now := time.Now()
+	rule := models.AlertRule{ID: uuid.NewString(), UserID: userID, DeviceID: device1, Field: "ph", Operator: models.OperatorGreaterThan, Threshold: 6.5, Status: models.AlertStatusInactive}
+
+	alertRepository := storage.NewMockAlertRepository(ctrl)
+	alertRepository.EXPECT().GetRules(gomock.Any(), userID).Return([]models.AlertRule{rule}, nil).Times(1)
+	alertRepository.EXPECT().EvaluateRule(gomock.Any(), userID, rule.ID, gomock.Any()).DoAndReturn(func(_ context.Context, _, _ string, evaluate storage.RuleEvaluation) ([]models.AlertEvent, error) {
+		stored := rule
+		events, changed := evaluate(&stored)
+		assert.True(t, changed)
+		assert.Equal(t, models.AlertStatusInactive, stored.Status)
+		assert.True(t, stored.BreachedSince.IsZero())
+		if assert.Len(t, events, 2) {
+			assert.Equal(t, models.AlertStatusFiring, events[0].Status)
+			assert.Equal(t, 7.0, events[0].Value)
+			assert.Equal(t, models.AlertStatusResolved, events[1].Status)
+		}
+		return events, nil
+	}).Times(1)
+
+	logic := NewAlertLogic(alertRepository, nil)
+	// metrics are evaluated by time, not by the order they were sent
+	logic.OnSensorMetrics(context.Background(), []models.SensorRequest{
+		{UserID: userID, SensorID: device1, PH: 6.0, Time: now},
+		{UserID: userID, SensorID: device2, PH: 9.0, Time: now.Add(-2 * time.Minute)},
+		{UserID: userID, SensorID: device1, PH: 7.0, Time: now.Add(-time.Minute)},
+	})
+}
+
+func TestAlertIgnoresMissingFields(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userID := uuid.NewString()
+	device := uuid.NewString()
+	rule := models.AlertRule{ID: uuid.NewString(), UserID: userID, DeviceID: device, Field: "ph", Operator: models.OperatorLessThan, Threshold: 5.5, Status: models.AlertStatusInactive}
+
+	// the reading doesn't carry the ph, which must not be read as 0
+	var metric models.SensorRequest
+	err := json.Unmarshal([]byte(`{"sensor_id": "`+device+`", "user_id": "`+userID+`", "tds": 420}`), &metric)
+	assert.Nil(t, err)
+	_, ok := metric.Field("ph")
+	assert.False(t, ok)
+
+	alertRepository := storage.NewMockAlertRepository(ctrl)
+	alertRepository.EXPECT().GetRules(gomock.Any(), userID).Return([]models.AlertRule{rule}, nil).Times(1)
+	alertRepository.EXPECT().EvaluateRule(gomock.Any(), gomock.Any(), gomock.Any(), gomock.Any()).Times(0)
+
+	NewAlertLogic(alertRepository, nil).OnSensorMetrics(context.Background(), []models.SensorRequest{metric})
+}
@@ -0,0 +1,201 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+// maxDedupReadings caps the readings remembered by the deduplication, the
+// oldest readings are forgotten first
+const maxDedupReadings = 100000
+
+// readingKey identifies a reading, a sensor has a single reading per timestamp
+type readingKey struct {
+	userID    string
+	sensorID  string
+	timestamp int64
+}
+
+// claimedReading is a reading being written or written during the window,
+// done is closed once the write is durable or failed
+type claimedReading struct {
+	expires time.Time
+	done    chan struct{}
+	failed  bool
+}
+
+type seenReading struct {
+	key     readingKey
+	expires time.Time
+}
+
+// duplicate is a reading at index claimed by another write
+type duplicate struct {
+	index int
+	claim *claimedReading
+}
+
+type deduplicatedMetricLogic struct {
+	MetricLogic
+	window   time.Duration
+	capacity int
+
+	mu    sync.Mutex
+	seen  map[readingKey]*claimedReading
+	order []seenReading
+}
+
+// NewDeduplicatedMetricLogic drops the readings already written with the same
+// sensor and timestamp during the last window, like the retries of devices
+// which didn't get the response of a write. A reading is only dropped once its
+// first write is durable, written or spooled: retries sent while it's being
+// written wait for it, and readings are forgotten when their write fails so
+// they can be retried.
+//
+// Readings are remembered in the memory of the instance, up to
+// maxDedupReadings, so retries reaching another instance or sent after the
+// oldest readings are forgotten are written again. Writes are idempotent in
+// the metric store, this only saves the writes.
+func NewDeduplicatedMetricLogic(next MetricLogic, window time.Duration) MetricLogic {
+	return &deduplicatedMetricLogic{
+		MetricLogic: next,
+		window:      window,
+		capacity:    maxDedupReadings,
+		seen:        make(map[readingKey]*claimedReading),
+	}
+}
+
+func (l *deduplicatedMetricLogic) WriteSensorMetrics(ctx context.Context, metrics []models.SensorRequest) error {
+	fresh, keys, claims, _, duplicates := l.claim(metrics, time.Now())
+	var err error
+	if len(fresh) > 0 {
+		err = l.MetricLogic.WriteSensorMetrics(ctx, fresh)
+		durable := err == nil || errors.Is(err, localErrs.AcceptedErr)
+		failed := make([]bool, len(claims))
+		for i := range failed {
+			failed[i] = !durable
+		}
+		l.settle(keys, claims, failed)
+		if !durable {
+			return err
+		}
+	}
+
+	for _, duplicate := range duplicates {
+		waitErr := wait(ctx, duplicate.claim)
+		if waitErr != nil {
+			return waitErr
+		}
+	}
+	return err
+}
+
+// WriteSensorMetricsPartially drops the duplicated readings, which aren't
+// rejected, and forgets the rejected ones
+func (l *deduplicatedMetricLogic) WriteSensorMetricsPartially(ctx context.Context, metrics []models.SensorRequest) ([]models.RejectedReading, error) {
+	fresh, keys, claims, indexes, duplicates := l.claim(metrics, time.Now())
+	rejected := []models.RejectedReading{}
+	var err error
+	if len(fresh) > 0 {
+		rejected, err = l.MetricLogic.WriteSensorMetricsPartially(ctx, fresh)
+		failed := make([]bool, len(claims))
+		if err != nil && !errors.Is(err, localErrs.AcceptedErr) {
+			for i := range failed {
+				failed[i] = true
+			}
+			l.settle(keys, claims, failed)
+			return rejected, err
+		}
+		for i := range rejected {
+			failed[rejected[i].Index] = true
+			rejected[i].Index = indexes[rejected[i].Index]
+		}
+		l.settle(keys, claims, failed)
+	}
+
+	for _, duplicate := range duplicates {
+		waitErr := wait(ctx, duplicate.claim)
+		if waitErr != nil {
+			rejected = append(rejected, models.NewRejectedReading(duplicate.index, waitErr))
+		}
+	}
+	sort.Slice(rejected, func(i, j int) bool { return rejected[i].Index < rejected[j].Index })
+	return rejected, err
+}
+
+// wait returns once the write of claim is durable, it fails when the write
+// failed so the reading is retried
+func wait(ctx context.Context, claim *claimedReading) error {
+	select {
+	case <-claim.done:
+	case <-ctx.Done():
+		return localErrs.ServiceUnavailableErr.WithMsg("reading is still being written").WithErr(ctx.Err())
+	}
+	if claim.failed {
+		return localErrs.ServiceUnavailableErr.WithMsg("another write of the reading failed")
+	}
+	return nil
+}
+
+// claim returns the readings not seen during the window, with their keys,
+// claims and positions in metrics, and remembers them. The readings claimed by
+// other writes are returned as duplicates
+func (l *deduplicatedMetricLogic) claim(metrics []models.SensorRequest, now time.Time) ([]models.SensorRequest, []readingKey, []*claimedReading, []int, []duplicate) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for len(l.order) > 0 && (!l.order[0].expires.After(now) || len(l.order)+len(metrics) > l.capacity) {
+		if claim, ok := l.seen[l.order[0].key]; ok && claim.expires.Equal(l.order[0].expires) {
+			delete(l.seen, l.order[0].key)
+		}
+		l.order = l.order[1:]
+	}
+
+	fresh := make([]models.SensorRequest, 0, len(metrics))
+	keys := make([]readingKey, 0, len(metrics))
+	claims := make([]*claimedReading, 0, len(metrics))
+	indexes := make([]int, 0, len(metrics))
+	var duplicates []duplicate
+	expires := now.Add(l.window)
+	for i, metric := range metrics {
+		key := readingKey{userID: metric.UserID, sensorID: metric.SensorID, timestamp: metric.Time.UnixNano()}
+		if claim, ok := l.seen[key]; ok {
+			duplicates = append(duplicates, duplicate{index: i, claim: claim})
+			continue
+		}
+		claim := &claimedReading{expires: expires, done: make(chan struct{})}
+		l.seen[key] = claim
+		l.order = append(l.order, seenReading{key: key, expires: expires})
+		fresh = append(fresh, metric)
+		keys = append(keys, key)
+		claims = append(claims, claim)
+		indexes = append(indexes, i)
+	}
+	if len(duplicates) > 0 {
+		log.Info().Int("duplicates", len(duplicates)).Msg("dropped duplicated sensor metrics")
+	}
+	return fresh, keys, claims, indexes, duplicates
+}
+
+// settle records the outcome of the writes of claims, the failed readings are
+// forgotten
+func (l *deduplicatedMetricLogic) settle(keys []readingKey, claims []*claimedReading, failed []bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for i, claim := range claims {
+		claim.failed = failed[i]
+		if claim.failed && l.seen[keys[i]] == claim {
+			delete(l.seen, keys[i])
+		}
+		close(claim.done)
+	}
+}
@@ -0,0 +1,146 @@
+package logic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+func TestDeduplicatedWriteSensorMetrics(t *testing.T) {
+	now := time.Now()
+	reading := func(sensorID string, offset time.Duration) models.SensorRequest {
+		return models.SensorRequest{SensorID: sensorID, UserID: "user1", Time: now.Add(-offset)}
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	next := NewMockMetricLogic(ctrl)
+	logic := NewDeduplicatedMetricLogic(next, time.Minute)
+	ctx := context.Background()
+
+	// readings repeated inside a batch are written once
+	next.EXPECT().WriteSensorMetrics(ctx, []models.SensorRequest{reading("sensor1", 0), reading("sensor2", 0)}).Return(nil)
+	assert.Nil(t, logic.WriteSensorMetrics(ctx, []models.SensorRequest{reading("sensor1", 0), reading("sensor2", 0), reading("sensor1", 0)}))
+
+	// retries only write the new readings
+	next.EXPECT().WriteSensorMetrics(ctx, []models.SensorRequest{reading("sensor1", time.Second)}).Return(localErrs.AcceptedErr)
+	assert.ErrorIs(t, logic.WriteSensorMetrics(ctx, []models.SensorRequest{reading("sensor1", 0), reading("sensor1", time.Second)}), localErrs.AcceptedErr)
+
+	// deferred writes are remembered too, a batch of duplicates isn't written
+	assert.Nil(t, logic.WriteSensorMetrics(ctx, []models.SensorRequest{reading("sensor1", time.Second), reading("sensor2", 0)}))
+
+	// failed writes can be retried
+	next.EXPECT().WriteSensorMetrics(ctx, []models.SensorRequest{reading("sensor3", 0)}).Return(localErrs.ForbiddenErr)
+	assert.ErrorIs(t, logic.WriteSensorMetrics(ctx, []models.SensorRequest{reading("sensor3", 0)}), localErrs.ForbiddenErr)
+	next.EXPECT().WriteSensorMetrics(ctx, []models.SensorRequest{reading("sensor3", 0)}).Return(nil)
+	assert.Nil(t, logic.WriteSensorMetrics(ctx, []models.SensorRequest{reading("sensor3", 0)}))
+}
+
+func TestDeduplicatedWriteSensorMetricsPartially(t *testing.T) {
+	now := time.Now()
+	reading := func(sensorID string) models.SensorRequest {
+		return models.SensorRequest{SensorID: sensorID, UserID: "user1", Time: now}
+	}
+
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+	next := NewMockMetricLogic(ctrl)
+	logic := NewDeduplicatedMetricLogic(next, time.Minute)
+	ctx := context.Background()
+
+	next.EXPECT().WriteSensorMetrics(ctx, []models.SensorRequest{reading("sensor1")}).Return(nil)
+	assert.Nil(t, logic.WriteSensorMetrics(ctx, []models.SensorRequest{reading("sensor1")}))
+
+	// rejected readings are reported at their position in the batch
+	next.EXPECT().WriteSensorMetricsPartially(ctx, []models.SensorRequest{reading("sensor2"), reading("sensor3")}).
+		Return([]models.RejectedReading{{Index: 1, Status: 403}}, nil)
+	rejected, err := logic.WriteSensorMetricsPartially(ctx, []models.SensorRequest{reading("sensor1"), reading("sensor2"), reading("sensor3")})
+	assert.Nil(t, err)
+	assert.Equal(t, []models.RejectedReading{{Index: 2, Status: 403}}, rejected)
+
+	// and can be retried
+	next.EXPECT().WriteSensorMetricsPartially(ctx, []models.SensorRequest{reading("sensor3")}).Return([]models.RejectedReading{}, nil)
+	rejected, err = logic.WriteSensorMetricsPartially(ctx, []models.SensorRequest{reading("sensor2"), reading("sensor3")})
+	assert.Nil(t, err)
+	assert.Empty(t, rejected)
+}
+
+func TestDeduplicatedWriteSensorMetricsInFlight(t *testing.T) {
+	reading := models.SensorRequest{SensorID: "sensor1", UserID: "user1", Time: time.Now()}
+	var tests = []struct {
+		name    string
+		err     error
+		wantErr error
+	}{
+		{name: "retries wait for the durable write", err: nil, wantErr: nil},
+		{name: "retries wait for the deferred write", err: localErrs.AcceptedErr, wantErr: nil},
+		{name: "retries fail with the write", err: localErrs.InternalServerErr, wantErr: localErrs.ServiceUnavailableErr},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+			next := NewMockMetricLogic(ctrl)
+			logic := NewDeduplicatedMetricLogic(next, time.Minute)
+			ctx := context.Background()
+
+			writing := make(chan struct{})
+			written := make(chan struct{})
+			next.EXPECT().WriteSensorMetrics(ctx, []models.SensorRequest{reading}).DoAndReturn(func(ctx context.Context, metrics []models.SensorRequest) error {
+				close(writing)
+				<-written
+				return tt.err
+			})
+			go logic.WriteSensorMetrics(ctx, []models.SensorRequest{reading})
+			<-writing
+
+			retried := make(chan error)
+			go func() {
+				retried <- logic.WriteSensorMetrics(ctx, []models.SensorRequest{reading})
+			}()
+			select {
+			case <-retried:
+				t.Fatal("retry didn't wait for the write")
+			case <-time.After(10 * time.Millisecond):
+			}
+			close(written)
+			err := <-retried
+			if tt.wantErr == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeduplicationWindow(t *testing.T) {
+	now := time.Now()
+	l := NewDeduplicatedMetricLogic(nil, time.Minute).(*deduplicatedMetricLogic)
+	l.capacity = 2
+	reading := models.SensorRequest{SensorID: "sensor1", UserID: "user1", Time: now}
+
+	fresh, _, _, _, _ := l.claim([]models.SensorRequest{reading}, now)
+	assert.Len(t, fresh, 1)
+	fresh, _, _, _, _ = l.claim([]models.SensorRequest{reading}, now.Add(30*time.Second))
+	assert.Len(t, fresh, 0)
+	// readings are forgotten after the window
+	fresh, _, _, _, _ = l.claim([]models.SensorRequest{reading}, now.Add(time.Minute))
+	assert.Len(t, fresh, 1)
+
+	// and when more readings than the capacity are seen
+	other := models.SensorRequest{SensorID: "sensor2", UserID: "user1", Time: now}
+	another := models.SensorRequest{SensorID: "sensor3", UserID: "user1", Time: now}
+	fresh, _, _, _, _ = l.claim([]models.SensorRequest{other, another}, now.Add(time.Minute))
+	assert.Len(t, fresh, 2)
+	fresh, _, _, _, _ = l.claim([]models.SensorRequest{reading}, now.Add(time.Minute))
+	assert.Len(t, fresh, 1)
+	assert.LessOrEqual(t, len(l.order), 2)
+}
@@ -0,0 +1,92 @@
+package logic
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+// DeviceTokenLogic issues the pre-shared tokens of the devices. Tokens are
+// derived from the owner, the device and a nonce stored with the ownership,
+// so issuing a token revokes the previous one and unbinding the device revokes
+// them all. Rotating the secret revokes every token.
+// Tokens are bearer credentials, the protocols carrying them must be encrypted
+//
+//go:generate mockgen -destination device_tokens_mock.go -package logic github.com/WendelHime/hydroponics-metrics-collector/internal/logic DeviceTokenLogic
+type DeviceTokenLogic interface {
+	// Issue returns a new token for a device bound to the user
+	Issue(ctx context.Context, userID string, deviceID string) (models.DeviceToken, error)
+	// Verify fails with UnauthorizedErr when the token isn't the last one
+	// issued for the device by its current owner
+	Verify(ctx context.Context, deviceID string, token string) error
+}
+
+// nonceBytes is the size of the random nonce tokens are derived from
+const nonceBytes = 16
+
+type deviceTokenLogic struct {
+	userDeviceRepository storage.UserDeviceRepository
+	secret               []byte
+}
+
+// NewDeviceTokenLogic signs the tokens with secret, tokens are disabled when
+// the secret is empty
+func NewDeviceTokenLogic(userDeviceRepository storage.UserDeviceRepository, secret []byte) DeviceTokenLogic {
+	return &deviceTokenLogic{userDeviceRepository: userDeviceRepository, secret: secret}
+}
+
+func (l *deviceTokenLogic) sign(userID string, deviceID string, nonce string) string {
+	mac := hmac.New(sha256.New, l.secret)
+	// the separator keeps the fields from being shifted into each other
+	for _, field := range []string{userID, deviceID, nonce} {
+		mac.Write([]byte(field))
+		mac.Write([]byte{0})
+	}
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func (l *deviceTokenLogic) Issue(ctx context.Context, userID string, deviceID string) (models.DeviceToken, error) {
+	if len(l.secret) == 0 {
+		return models.DeviceToken{}, localErrs.ServiceUnavailableErr.WithMsg("device tokens are disabled")
+	}
+
+	random := make([]byte, nonceBytes)
+	_, err := rand.Read(random)
+	if err != nil {
+		return models.DeviceToken{}, localErrs.InternalServerErr.WithMsg("failed to generate device token nonce").WithErr(err)
+	}
+	nonce := base64.RawURLEncoding.EncodeToString(random)
+
+	err = l.userDeviceRepository.SetDeviceTokenNonce(ctx, userID, deviceID, nonce)
+	if err != nil {
+		return models.DeviceToken{}, err
+	}
+
+	return models.DeviceToken{DeviceID: deviceID, Token: l.sign(userID, deviceID, nonce)}, nil
+}
+
+func (l *deviceTokenLogic) Verify(ctx context.Context, deviceID string, token string) error {
+	invalid := localErrs.UnauthorizedErr.WithMsg("invalid device token").WithDetails("device", deviceID)
+	if len(l.secret) == 0 || len(token) == 0 {
+		return invalid
+	}
+
+	owner, nonce, err := l.userDeviceRepository.GetDeviceTokenNonce(ctx, deviceID)
+	if errors.Is(err, localErrs.NotFoundErr) {
+		return invalid
+	}
+	if err != nil {
+		return err
+	}
+	if len(nonce) == 0 || !hmac.Equal([]byte(token), []byte(l.sign(owner, deviceID, nonce))) {
+		return invalid
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/WendelHime/hydroponics-metrics-collector/internal/logic (interfaces: DeviceTokenLogic)
+
+// Package logic is a generated GoMock package.
+package logic
+
+import (
+	context "context"
+	reflect "reflect"
+
+	models "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockDeviceTokenLogic is a mock of DeviceTokenLogic interface.
+type MockDeviceTokenLogic struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeviceTokenLogicMockRecorder
+}
+
+// MockDeviceTokenLogicMockRecorder is the mock recorder for MockDeviceTokenLogic.
+type MockDeviceTokenLogicMockRecorder struct {
+	mock *MockDeviceTokenLogic
+}
+
+// NewMockDeviceTokenLogic creates a new mock instance.
+func NewMockDeviceTokenLogic(ctrl *gomock.Controller) *MockDeviceTokenLogic {
+	mock := &MockDeviceTokenLogic{ctrl: ctrl}
+	mock.recorder = &MockDeviceTokenLogicMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeviceTokenLogic) EXPECT() *MockDeviceTokenLogicMockRecorder {
+	return m.recorder
+}
+
+// Issue mocks base method.
+func (m *MockDeviceTokenLogic) Issue(arg0 context.Context, arg1, arg2 string) (models.DeviceToken, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Issue", arg0, arg1, arg2)
+	ret0, _ := ret[0].(models.DeviceToken)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Issue indicates an expected call of Issue.
+func (mr *MockDeviceTokenLogicMockRecorder) Issue(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Issue", reflect.TypeOf((*MockDeviceTokenLogic)(nil).Issue), arg0, arg1, arg2)
+}
+
+// Verify mocks base method.
+func (m *MockDeviceTokenLogic) Verify(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Verify", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Verify indicates an expected call of Verify.
+func (mr *MockDeviceTokenLogicMockRecorder) Verify(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Verify", reflect.TypeOf((*MockDeviceTokenLogic)(nil).Verify), arg0, arg1, arg2)
+}
@@ -0,0 +1,108 @@
+package logic
+
+import (
+	"context"
+	"testing"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+)
+
+func TestIssueDeviceToken(t *testing.T) {
+	userID := uuid.NewString()
+	var tests = []struct {
+		name   string
+		secret []byte
+		setup  func(repository *storage.MockUserDeviceRepository)
+		assert func(t *testing.T, token models.DeviceToken, err error)
+	}{
+		{
+			name:   "token is issued for devices bound to the user",
+			secret: []byte("secret"),
+			setup: func(repository *storage.MockUserDeviceRepository) {
+				repository.EXPECT().SetDeviceTokenNonce(gomock.Any(), userID, "device1", gomock.Any()).Return(nil)
+			},
+			assert: func(t *testing.T, token models.DeviceToken, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "device1", token.DeviceID)
+				assert.NotEmpty(t, token.Token)
+			},
+		},
+		{
+			name:   "device bound to another user",
+			secret: []byte("secret"),
+			setup: func(repository *storage.MockUserDeviceRepository) {
+				repository.EXPECT().SetDeviceTokenNonce(gomock.Any(), userID, "device1", gomock.Any()).Return(localErrs.NotFoundErr)
+			},
+			assert: func(t *testing.T, token models.DeviceToken, err error) {
+				assert.ErrorIs(t, err, localErrs.NotFoundErr)
+			},
+		},
+		{
+			name:  "tokens are disabled without secret",
+			setup: func(repository *storage.MockUserDeviceRepository) {},
+			assert: func(t *testing.T, token models.DeviceToken, err error) {
+				assert.ErrorIs(t, err, localErrs.ServiceUnavailableErr)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repository := storage.NewMockUserDeviceRepository(ctrl)
+			tt.setup(repository)
+			token, err := NewDeviceTokenLogic(repository, tt.secret).Issue(context.Background(), userID, "device1")
+			tt.assert(t, token, err)
+		})
+	}
+}
+
+func TestVerifyDeviceToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	userID := uuid.NewString()
+	nonces := make(map[string]string)
+	repository := storage.NewMockUserDeviceRepository(ctrl)
+	repository.EXPECT().SetDeviceTokenNonce(gomock.Any(), userID, "device1", gomock.Any()).DoAndReturn(func(_ context.Context, _ string, deviceID string, nonce string) error {
+		nonces[deviceID] = nonce
+		return nil
+	}).AnyTimes()
+	owner := userID
+	repository.EXPECT().GetDeviceTokenNonce(gomock.Any(), "device1").DoAndReturn(func(_ context.Context, deviceID string) (string, string, error) {
+		return owner, nonces[deviceID], nil
+	}).AnyTimes()
+	repository.EXPECT().GetDeviceTokenNonce(gomock.Any(), "device2").Return("", "", localErrs.NotFoundErr).AnyTimes()
+	tokens := NewDeviceTokenLogic(repository, []byte("secret"))
+	token, err := tokens.Issue(ctx, userID, "device1")
+	assert.Nil(t, err)
+
+	assert.Nil(t, tokens.Verify(ctx, "device1", token.Token))
+	assert.ErrorIs(t, tokens.Verify(ctx, "device2", token.Token), localErrs.UnauthorizedErr)
+	assert.ErrorIs(t, tokens.Verify(ctx, "device1", ""), localErrs.UnauthorizedErr)
+	assert.ErrorIs(t, NewDeviceTokenLogic(repository, []byte("rotated")).Verify(ctx, "device1", token.Token), localErrs.UnauthorizedErr)
+	assert.ErrorIs(t, NewDeviceTokenLogic(repository, nil).Verify(ctx, "device1", token.Token), localErrs.UnauthorizedErr)
+
+	// issuing a new token revokes the previous one
+	renewed, err := tokens.Issue(ctx, userID, "device1")
+	assert.Nil(t, err)
+	assert.ErrorIs(t, tokens.Verify(ctx, "device1", token.Token), localErrs.UnauthorizedErr)
+	assert.Nil(t, tokens.Verify(ctx, "device1", renewed.Token))
+
+	// tokens don't survive the device being claimed by another user
+	owner = uuid.NewString()
+	assert.ErrorIs(t, tokens.Verify(ctx, "device1", renewed.Token), localErrs.UnauthorizedErr)
+
+	// devices unbound since or never issued a token are rejected
+	delete(nonces, "device1")
+	owner = userID
+	assert.ErrorIs(t, tokens.Verify(ctx, "device1", renewed.Token), localErrs.UnauthorizedErr)
+}
@@ -0,0 +1,118 @@
+package logic
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+// DeviceMonitor periodically looks for devices that stopped registering
+// metrics, every device is reported once until it registers metrics again.
+// Silences are claimed in the storage, so instances sharing it don't report
+// the same one twice
+type DeviceMonitor interface {
+	// Check publishes a device.silent event for every device newly silent
+	Check(ctx context.Context) error
+	// Run checks devices every interval until the context is done
+	Run(ctx context.Context, interval time.Duration)
+}
+
+type deviceMonitor struct {
+	userDeviceRepository storage.UserDeviceRepository
+	metricRepository     storage.MetricRepository
+	threshold            time.Duration
+	listeners            []EventListener
+
+	mu sync.Mutex
+	// notified caches the silences already claimed, so they aren't claimed
+	// again on every check
+	notified map[string]time.Time
+}
+
+func NewDeviceMonitor(userDeviceRepository storage.UserDeviceRepository, metricRepository storage.MetricRepository, threshold time.Duration, listeners ...EventListener) DeviceMonitor {
+	return &deviceMonitor{
+		userDeviceRepository: userDeviceRepository,
+		metricRepository:     metricRepository,
+		threshold:            threshold,
+		listeners:            listeners,
+		notified:             make(map[string]time.Time),
+	}
+}
+
+func (m *deviceMonitor) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := m.Check(ctx)
+			if err != nil {
+				log.Error().Err(err).Msg("failed to check silent devices")
+			}
+		}
+	}
+}
+
+func (m *deviceMonitor) Check(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return storage.EachUserDevices(ctx, m.userDeviceRepository, func(userDevices []storage.UserDevices) error {
+		return m.checkPage(ctx, userDevices)
+	})
+}
+
+// checkPage reads the latest measurements of a page of users at once
+func (m *deviceMonitor) checkPage(ctx context.Context, userDevices []storage.UserDevices) error {
+	owners := make(map[string]string)
+	devices := make([]string, 0)
+	for _, userDevice := range userDevices {
+		for _, device := range models.DeviceIDs(userDevice.Devices) {
+			owners[device] = userDevice.UserID
+			devices = append(devices, device)
+		}
+	}
+	if len(devices) == 0 {
+		return nil
+	}
+
+	measurements, err := m.metricRepository.ReadLatestMeasurements(ctx, devices...)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, measurement := range measurements {
+		if now.Sub(measurement.Time) < m.threshold {
+			delete(m.notified, measurement.SensorID)
+			continue
+		}
+		// the device is still silent since the last notification
+		if lastSeen, ok := m.notified[measurement.SensorID]; ok && lastSeen.Equal(measurement.Time) {
+			continue
+		}
+
+		claimed, err := m.userDeviceRepository.ClaimSilenceNotification(ctx, measurement.SensorID, measurement.Time)
+		if err != nil {
+			return err
+		}
+		m.notified[measurement.SensorID] = measurement.Time
+		if !claimed {
+			continue
+		}
+
+		device := models.SilentDevice{DeviceID: measurement.SensorID, Alias: measurement.Alias, LastSeen: measurement.Time}
+		event := newEvent(models.EventDeviceSilent, owners[measurement.SensorID], device)
+		for _, listener := range m.listeners {
+			listener.OnEvent(ctx, event)
+		}
+	}
+
+	return nil
+}
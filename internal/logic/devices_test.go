@@ -0,0 +1,49 @@
+package logic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+)
+
+func TestDeviceMonitorCheck(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userID := uuid.NewString()
+	silentSince := time.Now().Add(-time.Hour)
+	userDevices := []storage.UserDevices{{UserID: userID, Devices: []models.Device{{ID: "silent"}, {ID: "active"}}}, {UserID: uuid.NewString()}}
+
+	userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+	userDeviceRepository.EXPECT().ListUserDevices(gomock.Any(), "", storage.UserDevicesPageSize).Return(userDevices, nil).Times(3)
+	metricRepository := storage.NewMockMetricRepository(ctrl)
+	metricRepository.EXPECT().ReadLatestMeasurements(gomock.Any(), "silent", "active").Return([]models.Measurement{
+		{SensorID: "silent", Alias: "reservoir", Time: silentSince},
+		{SensorID: "active", Time: time.Now()},
+	}, nil).Times(3)
+	// the silence is only claimed by the first instance checking it
+	gomock.InOrder(
+		userDeviceRepository.EXPECT().ClaimSilenceNotification(gomock.Any(), "silent", silentSince).Return(true, nil),
+		userDeviceRepository.EXPECT().ClaimSilenceNotification(gomock.Any(), "silent", silentSince).Return(false, nil),
+	)
+	listener := NewMockEventListener(ctrl)
+	listener.EXPECT().OnEvent(gomock.Any(), gomock.Any()).Do(func(_ context.Context, event models.Event) {
+		assert.Equal(t, models.EventDeviceSilent, event.Type)
+		assert.Equal(t, userID, event.UserID)
+		assert.Equal(t, models.SilentDevice{DeviceID: "silent", Alias: "reservoir", LastSeen: silentSince}, event.Data)
+	}).Times(1)
+
+	monitor := NewDeviceMonitor(userDeviceRepository, metricRepository, 30*time.Minute, listener)
+	// the second check must not claim the same silence again
+	assert.Nil(t, monitor.Check(context.Background()))
+	assert.Nil(t, monitor.Check(context.Background()))
+
+	other := NewDeviceMonitor(userDeviceRepository, metricRepository, 30*time.Minute, listener)
+	assert.Nil(t, other.Check(context.Background()))
+}
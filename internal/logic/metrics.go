@@ -2,45 +2,307 @@ package logic
 
 import (
 	"context"
+	"errors"
 	"slices"
+	"time"
 
 	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
 )
 
+// MetricLogic contain sensor metrics correlated logic
+//
+//go:generate mockgen -destination metrics_mock.go -package logic github.com/WendelHime/hydroponics-metrics-collector/internal/logic MetricLogic,MetricListener
 type MetricLogic interface {
 	WriteSensorMetrics(ctx context.Context, metrics []models.SensorRequest) error
+	WriteSensorMetricsPartially(ctx context.Context, metrics []models.SensorRequest) ([]models.RejectedReading, error)
+	// ReadSensorMetrics downsamples the raw reads exceeding maxReadPoints with
+	// a window picked from the range, instead of truncating them
+	ReadSensorMetrics(ctx context.Context, userID string, query models.MeasurementQuery) (models.MeasurementSeries, error)
+	ReadLatestSensorMetrics(ctx context.Context, userID string) ([]models.LatestMeasurement, error)
+	ExportSensorMetrics(ctx context.Context, userID string, devices []string, query models.MeasurementQuery, handle func(models.Measurement) error) error
+}
+
+// defaultReadRange is used when the caller doesn't provide the beginning of the range
+const defaultReadRange = 24 * time.Hour
+
+// maxReadPoints caps the amount of measurements returned by a single read
+const maxReadPoints = 1000
+
+// aggregationWindows are the supported window sizes, sorted from the smallest to the largest
+var aggregationWindows = []time.Duration{
+	time.Minute,
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	6 * time.Hour,
+	24 * time.Hour,
+}
+
+// maxReadRange is the range from which even the largest window exceeds
+// maxReadPoints, windows are aligned so a range may span one more of them
+var maxReadRange = maxReadPoints * aggregationWindows[len(aggregationWindows)-1]
+
+// pickWindow returns the smallest window that keeps the range under maxReadPoints
+func pickWindow(from, to time.Time) time.Duration {
+	interval := to.Sub(from)
+	for _, window := range aggregationWindows {
+		if interval/window < maxReadPoints {
+			return window
+		}
+	}
+	return aggregationWindows[len(aggregationWindows)-1]
+}
+
+func resolveAggregation(query *models.MeasurementQuery) error {
+	if len(query.Aggregation) == 0 && query.Window == 0 {
+		return nil
+	}
+
+	if len(query.Aggregation) == 0 {
+		query.Aggregation = models.AggregationMean
+	}
+	if !slices.Contains(models.Aggregations, query.Aggregation) {
+		return localErrs.BadRequestErr.WithMsg("unknown aggregation").WithDetails("aggregation", query.Aggregation)
+	}
+
+	if query.Window == 0 {
+		query.Window = pickWindow(query.From, query.To)
+		return nil
+	}
+	if !slices.Contains(aggregationWindows, query.Window) {
+		return localErrs.BadRequestErr.WithMsg("unsupported window").WithDetails("window", query.Window.String())
+	}
+	// windows too small for the range are widened to stay under maxReadPoints
+	query.Window = max(query.Window, pickWindow(query.From, query.To))
+	return nil
+}
+
+// MetricListener is notified with the sensor metrics after they're persisted
+type MetricListener interface {
+	OnSensorMetrics(ctx context.Context, metrics []models.SensorRequest)
 }
 
 type metricLogic struct {
 	metricRepository     storage.MetricRepository
 	userDeviceRepository storage.UserDeviceRepository
+	listeners            []MetricListener
 }
 
-func NewMetricLogic(repository storage.MetricRepository, userDeviceRepository storage.UserDeviceRepository) MetricLogic {
-	return &metricLogic{metricRepository: repository, userDeviceRepository: userDeviceRepository}
+func NewMetricLogic(repository storage.MetricRepository, userDeviceRepository storage.UserDeviceRepository, listeners ...MetricListener) MetricLogic {
+	return &metricLogic{metricRepository: repository, userDeviceRepository: userDeviceRepository, listeners: listeners}
 }
 
 func (l *metricLogic) WriteSensorMetrics(ctx context.Context, m []models.SensorRequest) error {
-	// caching inmem user devices
-	userDevices := make(map[string][]string)
+	// caching inmem device owners
+	owners := make(map[string]string)
 	for _, request := range m {
-		if _, ok := userDevices[request.UserID]; !ok {
-			devices, err := l.userDeviceRepository.GetDevicesFromUser(ctx, m[0].UserID)
-			if err != nil {
-				return err
-			}
-			userDevices[request.UserID] = devices
+		err := l.checkOwner(ctx, owners, request)
+		if err != nil {
+			return err
 		}
-		devices := userDevices[request.UserID]
+	}
 
-		// checking if sensor ID is correlated to user devices
-		if !slices.Contains(devices, request.SensorID) {
+	// if everything succeed, write measurement
+	return l.write(ctx, m)
+}
+
+// WriteSensorMetricsPartially writes the metrics of the sensors owned by their
+// user and returns the rejected ones, nothing is written when it fails
+func (l *metricLogic) WriteSensorMetricsPartially(ctx context.Context, m []models.SensorRequest) ([]models.RejectedReading, error) {
+	owners := make(map[string]string)
+	owned := make([]models.SensorRequest, 0, len(m))
+	rejected := make([]models.RejectedReading, 0)
+	for i, request := range m {
+		err := l.checkOwner(ctx, owners, request)
+		if errors.Is(err, localErrs.ForbiddenErr) {
+			rejected = append(rejected, models.RejectedReading{Index: i, Status: localErrs.ForbiddenErr.StatusCode, Reason: "sensor isn't owned by the user"})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		owned = append(owned, request)
+	}
+	if len(owned) == 0 {
+		return rejected, nil
+	}
+
+	err := l.write(ctx, owned)
+	if err != nil && !errors.Is(err, localErrs.AcceptedErr) {
+		return nil, err
+	}
+	return rejected, err
+}
+
+// checkOwner fails with ForbiddenErr when the sensor isn't owned by the user
+// of the request, owners caches the owner of each sensor
+func (l *metricLogic) checkOwner(ctx context.Context, owners map[string]string, request models.SensorRequest) error {
+	owner, ok := owners[request.SensorID]
+	if !ok {
+		var err error
+		owner, err = l.userDeviceRepository.GetDeviceOwner(ctx, request.SensorID)
+		if errors.Is(err, localErrs.NotFoundErr) {
 			return localErrs.ForbiddenErr
 		}
+		if err != nil {
+			return err
+		}
+		owners[request.SensorID] = owner
 	}
 
-	// if everything succeed, write measurement
-	return l.metricRepository.WriteMeasurement(ctx, m...)
+	// checking if sensor ID is owned by the user
+	if owner != request.UserID {
+		return localErrs.ForbiddenErr
+	}
+	return nil
+}
+
+// write persists the metrics and notifies the listeners, deferred writes are
+// still notified as the metrics will be persisted
+func (l *metricLogic) write(ctx context.Context, m []models.SensorRequest) error {
+	err := l.metricRepository.WriteMeasurement(ctx, m...)
+	if err != nil && !errors.Is(err, localErrs.AcceptedErr) {
+		return err
+	}
+
+	for _, listener := range l.listeners {
+		listener.OnSensorMetrics(ctx, m)
+	}
+	return err
+}
+
+// resolveRangeAndFields fills the query defaults and validates the requested range and fields
+func resolveRangeAndFields(query *models.MeasurementQuery) error {
+	if query.To.IsZero() {
+		query.To = time.Now()
+	}
+	if query.From.IsZero() {
+		query.From = query.To.Add(-defaultReadRange)
+	}
+	if !query.From.Before(query.To) {
+		return localErrs.BadRequestErr.WithMsg("from must be before to")
+	}
+
+	if len(query.Fields) == 0 {
+		query.Fields = models.MeasurementFields
+	}
+	for _, field := range query.Fields {
+		if !slices.Contains(models.MeasurementFields, field) {
+			return localErrs.BadRequestErr.WithMsg("unknown field").WithDetails("field", field)
+		}
+	}
+	return nil
+}
+
+func (l *metricLogic) ReadSensorMetrics(ctx context.Context, userID string, query models.MeasurementQuery) (models.MeasurementSeries, error) {
+	err := resolveRangeAndFields(&query)
+	if err != nil {
+		return models.MeasurementSeries{}, err
+	}
+	// longer ranges would be cut by the limit even with the largest window
+	if query.To.Sub(query.From) >= maxReadRange {
+		return models.MeasurementSeries{}, localErrs.BadRequestErr.WithMsg("range too long, use the export instead").WithDetails("max_range", maxReadRange.String())
+	}
+
+	err = resolveAggregation(&query)
+	if err != nil {
+		return models.MeasurementSeries{}, err
+	}
+
+	devices, err := l.userDeviceRepository.GetDevicesFromUser(ctx, userID)
+	if err != nil {
+		return models.MeasurementSeries{}, err
+	}
+
+	// users can only read metrics from their own devices
+	if !slices.Contains(models.DeviceIDs(devices), query.SensorID) {
+		return models.MeasurementSeries{}, localErrs.ForbiddenErr
+	}
+
+	if len(query.Aggregation) == 0 {
+		// one more point tells if the raw measurements exceed the cap
+		query.Limit = maxReadPoints + 1
+		measurements, err := l.metricRepository.ReadMeasurements(ctx, query)
+		if err != nil || len(measurements) <= maxReadPoints {
+			return models.MeasurementSeries{Measurements: measurements}, err
+		}
+
+		query.Aggregation = models.AggregationMean
+		query.Window = pickWindow(query.From, query.To)
+	}
+
+	query.Limit = maxReadPoints
+	measurements, err := l.metricRepository.ReadMeasurements(ctx, query)
+	if err != nil {
+		return models.MeasurementSeries{}, err
+	}
+	return models.MeasurementSeries{Aggregation: query.Aggregation, Window: query.Window, Measurements: measurements}, nil
+}
+
+func (l *metricLogic) ReadLatestSensorMetrics(ctx context.Context, userID string) ([]models.LatestMeasurement, error) {
+	userDevices, err := l.userDeviceRepository.GetDevicesFromUser(ctx, userID)
+	if errors.Is(err, localErrs.NotFoundErr) || (err == nil && len(userDevices) == 0) {
+		return []models.LatestMeasurement{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	devices := models.DeviceIDs(userDevices)
+	measurements, err := l.metricRepository.ReadLatestMeasurements(ctx, devices...)
+	if err != nil {
+		return nil, err
+	}
+
+	measurementsByDevice := make(map[string]models.Measurement, len(measurements))
+	for _, measurement := range measurements {
+		measurementsByDevice[measurement.SensorID] = measurement
+	}
+
+	// devices without metrics are still listed so the user can spot them
+	now := time.Now()
+	latest := make([]models.LatestMeasurement, len(devices))
+	for i, device := range devices {
+		latest[i] = models.LatestMeasurement{DeviceID: device}
+		if measurement, ok := measurementsByDevice[device]; ok {
+			latest[i].Measurement = &measurement
+			latest[i].AgeSeconds = now.Sub(measurement.Time).Seconds()
+		}
+	}
+	return latest, nil
+}
+
+// ExportSensorMetrics streams the raw measurements of the given devices, one
+// device after the other, when no devices are given every user device is exported
+func (l *metricLogic) ExportSensorMetrics(ctx context.Context, userID string, devices []string, query models.MeasurementQuery, handle func(models.Measurement) error) error {
+	err := resolveRangeAndFields(&query)
+	if err != nil {
+		return err
+	}
+
+	deviceRecords, err := l.userDeviceRepository.GetDevicesFromUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	userDevices := models.DeviceIDs(deviceRecords)
+	if len(devices) == 0 {
+		devices = userDevices
+	}
+	for _, device := range devices {
+		if !slices.Contains(userDevices, device) {
+			return localErrs.ForbiddenErr
+		}
+	}
+
+	for _, device := range devices {
+		query.SensorID = device
+		err = l.metricRepository.StreamMeasurements(ctx, query, handle)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,144 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/WendelHime/hydroponics-metrics-collector/internal/logic (interfaces: MetricLogic,MetricListener)
+
+// Package logic is a generated GoMock package.
+package logic
+
+import (
+	context "context"
+	reflect "reflect"
+
+	models "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockMetricLogic is a mock of MetricLogic interface.
+type MockMetricLogic struct {
+	ctrl     *gomock.Controller
+	recorder *MockMetricLogicMockRecorder
+}
+
+// MockMetricLogicMockRecorder is the mock recorder for MockMetricLogic.
+type MockMetricLogicMockRecorder struct {
+	mock *MockMetricLogic
+}
+
+// NewMockMetricLogic creates a new mock instance.
+func NewMockMetricLogic(ctrl *gomock.Controller) *MockMetricLogic {
+	mock := &MockMetricLogic{ctrl: ctrl}
+	mock.recorder = &MockMetricLogicMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMetricLogic) EXPECT() *MockMetricLogicMockRecorder {
+	return m.recorder
+}
+
+// ExportSensorMetrics mocks base method.
+func (m *MockMetricLogic) ExportSensorMetrics(arg0 context.Context, arg1 string, arg2 []string, arg3 models.MeasurementQuery, arg4 func(models.Measurement) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ExportSensorMetrics", arg0, arg1, arg2, arg3, arg4)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ExportSensorMetrics indicates an expected call of ExportSensorMetrics.
+func (mr *MockMetricLogicMockRecorder) ExportSensorMetrics(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ExportSensorMetrics", reflect.TypeOf((*MockMetricLogic)(nil).ExportSensorMetrics), arg0, arg1, arg2, arg3, arg4)
+}
+
+// ReadLatestSensorMetrics mocks base method.
+func (m *MockMetricLogic) ReadLatestSensorMetrics(arg0 context.Context, arg1 string) ([]models.LatestMeasurement, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadLatestSensorMetrics", arg0, arg1)
+	ret0, _ := ret[0].([]models.LatestMeasurement)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadLatestSensorMetrics indicates an expected call of ReadLatestSensorMetrics.
+func (mr *MockMetricLogicMockRecorder) ReadLatestSensorMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadLatestSensorMetrics", reflect.TypeOf((*MockMetricLogic)(nil).ReadLatestSensorMetrics), arg0, arg1)
+}
+
+// ReadSensorMetrics mocks base method.
+func (m *MockMetricLogic) ReadSensorMetrics(arg0 context.Context, arg1 string, arg2 models.MeasurementQuery) (models.MeasurementSeries, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadSensorMetrics", arg0, arg1, arg2)
+	ret0, _ := ret[0].(models.MeasurementSeries)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadSensorMetrics indicates an expected call of ReadSensorMetrics.
+func (mr *MockMetricLogicMockRecorder) ReadSensorMetrics(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadSensorMetrics", reflect.TypeOf((*MockMetricLogic)(nil).ReadSensorMetrics), arg0, arg1, arg2)
+}
+
+// WriteSensorMetrics mocks base method.
+func (m *MockMetricLogic) WriteSensorMetrics(arg0 context.Context, arg1 []models.SensorRequest) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteSensorMetrics", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// WriteSensorMetrics indicates an expected call of WriteSensorMetrics.
+func (mr *MockMetricLogicMockRecorder) WriteSensorMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteSensorMetrics", reflect.TypeOf((*MockMetricLogic)(nil).WriteSensorMetrics), arg0, arg1)
+}
+
+// WriteSensorMetricsPartially mocks base method.
+func (m *MockMetricLogic) WriteSensorMetricsPartially(arg0 context.Context, arg1 []models.SensorRequest) ([]models.RejectedReading, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "WriteSensorMetricsPartially", arg0, arg1)
+	ret0, _ := ret[0].([]models.RejectedReading)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// WriteSensorMetricsPartially indicates an expected call of WriteSensorMetricsPartially.
+func (mr *MockMetricLogicMockRecorder) WriteSensorMetricsPartially(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "WriteSensorMetricsPartially", reflect.TypeOf((*MockMetricLogic)(nil).WriteSensorMetricsPartially), arg0, arg1)
+}
+
+// MockMetricListener is a mock of MetricListener interface.
+type MockMetricListener struct {
+	ctrl     *gomock.Controller
+	recorder *MockMetricListenerMockRecorder
+}
+
+// MockMetricListenerMockRecorder is the mock recorder for MockMetricListener.
+type MockMetricListenerMockRecorder struct {
+	mock *MockMetricListener
+}
+
+// NewMockMetricListener creates a new mock instance.
+func NewMockMetricListener(ctrl *gomock.Controller) *MockMetricListener {
+	mock := &MockMetricListener{ctrl: ctrl}
+	mock.recorder = &MockMetricListenerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockMetricListener) EXPECT() *MockMetricListenerMockRecorder {
+	return m.recorder
+}
+
+// OnSensorMetrics mocks base method.
+func (m *MockMetricListener) OnSensorMetrics(arg0 context.Context, arg1 []models.SensorRequest) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnSensorMetrics", arg0, arg1)
+}
+
+// OnSensorMetrics indicates an expected call of OnSensorMetrics.
+func (mr *MockMetricListenerMockRecorder) OnSensorMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnSensorMetrics", reflect.TypeOf((*MockMetricListener)(nil).OnSensorMetrics), arg0, arg1)
+}
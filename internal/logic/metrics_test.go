@@ -3,6 +3,7 @@ package logic
 import (
 	"context"
 	"testing"
+	"time"
 
 	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
@@ -26,7 +27,7 @@ func TestWriteSensorMetrics(t *testing.T) {
 			name: "write metric with success",
 			setup: func(ctrl *gomock.Controller) MetricLogic {
 				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
-				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]string{device1, device2}, nil).Times(1)
+				userDeviceRepository.EXPECT().GetDeviceOwner(gomock.Any(), device1).Return(userID, nil).Times(1)
 				metricRepository := storage.NewMockMetricRepository(ctrl)
 				metricRepository.EXPECT().WriteMeasurement(gomock.Any(), []models.SensorRequest{
 					{SensorID: device1, UserID: userID},
@@ -39,24 +40,90 @@ func TestWriteSensorMetrics(t *testing.T) {
 			},
 		},
 		{
-			name: "user doesn't have any devices",
+			name: "device owners are looked up once per device",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDeviceOwner(gomock.Any(), device1).Return(userID, nil).Times(1)
+				userDeviceRepository.EXPECT().GetDeviceOwner(gomock.Any(), device2).Return(userID, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().WriteMeasurement(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				return NewMetricLogic(metricRepository, userDeviceRepository)
+			},
+			givenMetrics: []models.SensorRequest{{SensorID: device1, UserID: userID}, {SensorID: device2, UserID: userID}, {SensorID: device1, UserID: userID}},
+			assert: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name: "listeners are notified after writing metrics",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDeviceOwner(gomock.Any(), device1).Return(userID, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().WriteMeasurement(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+				listener := NewMockMetricListener(ctrl)
+				listener.EXPECT().OnSensorMetrics(gomock.Any(), []models.SensorRequest{{SensorID: device1, UserID: userID}}).Times(1)
+				return NewMetricLogic(metricRepository, userDeviceRepository, listener)
+			},
+			givenMetrics: []models.SensorRequest{{SensorID: device1, UserID: userID}},
+			assert: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name: "listeners aren't notified when writing fails",
 			setup: func(ctrl *gomock.Controller) MetricLogic {
 				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
-				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]string{}, localErrs.NotFoundErr).Times(1)
+				userDeviceRepository.EXPECT().GetDeviceOwner(gomock.Any(), device1).Return(userID, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().WriteMeasurement(gomock.Any(), gomock.Any()).Return(localErrs.InternalServerErr).Times(1)
+				listener := NewMockMetricListener(ctrl)
+				return NewMetricLogic(metricRepository, userDeviceRepository, listener)
+			},
+			givenMetrics: []models.SensorRequest{{SensorID: device1, UserID: userID}},
+			assert: func(t *testing.T, err error) {
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, localErrs.InternalServerErr)
+				}
+			},
+		},
+		{
+			name: "listeners are notified when writing is deferred",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDeviceOwner(gomock.Any(), device1).Return(userID, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().WriteMeasurement(gomock.Any(), gomock.Any()).Return(localErrs.AcceptedErr).Times(1)
+				listener := NewMockMetricListener(ctrl)
+				listener.EXPECT().OnSensorMetrics(gomock.Any(), []models.SensorRequest{{SensorID: device1, UserID: userID}}).Times(1)
+				return NewMetricLogic(metricRepository, userDeviceRepository, listener)
+			},
+			givenMetrics: []models.SensorRequest{{SensorID: device1, UserID: userID}},
+			assert: func(t *testing.T, err error) {
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, localErrs.AcceptedErr)
+				}
+			},
+		},
+		{
+			name: "device without owner",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDeviceOwner(gomock.Any(), device1).Return("", localErrs.NotFoundErr).Times(1)
 				return NewMetricLogic(nil, userDeviceRepository)
 			},
 			givenMetrics: []models.SensorRequest{{SensorID: device1, UserID: userID}},
 			assert: func(t *testing.T, err error) {
 				if assert.Error(t, err) {
-					assert.ErrorIs(t, err, localErrs.NotFoundErr)
+					assert.ErrorIs(t, err, localErrs.ForbiddenErr)
 				}
 			},
 		},
 		{
-			name: "provided device isn't correlated to the user",
+			name: "provided device is owned by another user",
 			setup: func(ctrl *gomock.Controller) MetricLogic {
 				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
-				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]string{device1}, nil).Times(1)
+				userDeviceRepository.EXPECT().GetDeviceOwner(gomock.Any(), device2).Return(uuid.NewString(), nil).Times(1)
 				return NewMetricLogic(nil, userDeviceRepository)
 			},
 			givenMetrics: []models.SensorRequest{{SensorID: device2, UserID: userID}},
@@ -79,3 +146,501 @@ func TestWriteSensorMetrics(t *testing.T) {
 		})
 	}
 }
+
+func TestWriteSensorMetricsPartially(t *testing.T) {
+	userID := uuid.NewString()
+	device1 := uuid.NewString()
+	device2 := uuid.NewString()
+	var tests = []struct {
+		name         string
+		setup        func(ctrl *gomock.Controller) MetricLogic
+		givenMetrics []models.SensorRequest
+		assert       func(t *testing.T, rejected []models.RejectedReading, err error)
+	}{
+		{
+			name: "metrics of sensors not owned by the user are rejected",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDeviceOwner(gomock.Any(), device1).Return(userID, nil).Times(1)
+				userDeviceRepository.EXPECT().GetDeviceOwner(gomock.Any(), device2).Return("", localErrs.NotFoundErr).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().WriteMeasurement(gomock.Any(), []models.SensorRequest{
+					{SensorID: device1, UserID: userID},
+					{SensorID: device1, UserID: userID},
+				}).Return(localErrs.AcceptedErr).Times(1)
+				listener := NewMockMetricListener(ctrl)
+				listener.EXPECT().OnSensorMetrics(gomock.Any(), gomock.Len(2)).Times(1)
+				return NewMetricLogic(metricRepository, userDeviceRepository, listener)
+			},
+			givenMetrics: []models.SensorRequest{{SensorID: device1, UserID: userID}, {SensorID: device2, UserID: userID}, {SensorID: device1, UserID: userID}},
+			assert: func(t *testing.T, rejected []models.RejectedReading, err error) {
+				assert.ErrorIs(t, err, localErrs.AcceptedErr)
+				if assert.Len(t, rejected, 1) {
+					assert.Equal(t, 1, rejected[0].Index)
+					assert.Equal(t, localErrs.ForbiddenErr.StatusCode, rejected[0].Status)
+				}
+			},
+		},
+		{
+			name: "nothing is written when every metric is rejected",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDeviceOwner(gomock.Any(), device2).Return(uuid.NewString(), nil).Times(1)
+				return NewMetricLogic(nil, userDeviceRepository)
+			},
+			givenMetrics: []models.SensorRequest{{SensorID: device2, UserID: userID}},
+			assert: func(t *testing.T, rejected []models.RejectedReading, err error) {
+				assert.Nil(t, err)
+				assert.Len(t, rejected, 1)
+			},
+		},
+		{
+			name: "failing to look up an owner fails the whole batch",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDeviceOwner(gomock.Any(), device1).Return("", localErrs.InternalServerErr).Times(1)
+				return NewMetricLogic(nil, userDeviceRepository)
+			},
+			givenMetrics: []models.SensorRequest{{SensorID: device1, UserID: userID}},
+			assert: func(t *testing.T, rejected []models.RejectedReading, err error) {
+				assert.ErrorIs(t, err, localErrs.InternalServerErr)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			logic := tt.setup(ctrl)
+			rejected, err := logic.WriteSensorMetricsPartially(context.Background(), tt.givenMetrics)
+			tt.assert(t, rejected, err)
+		})
+	}
+}
+
+func TestReadSensorMetrics(t *testing.T) {
+	userID := uuid.NewString()
+	device1 := uuid.NewString()
+	device2 := uuid.NewString()
+	to := time.Now()
+	from := to.Add(-time.Hour)
+	measurements := []models.Measurement{
+		{SensorID: device1, Time: from, Fields: map[string]float64{"ph": 6.1}},
+	}
+	var tests = []struct {
+		name       string
+		setup      func(ctrl *gomock.Controller) MetricLogic
+		givenQuery models.MeasurementQuery
+		assert     func(t *testing.T, series models.MeasurementSeries, err error)
+	}{
+		{
+			name: "read metrics with success",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}, {ID: device2}}, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().ReadMeasurements(gomock.Any(), models.MeasurementQuery{
+					SensorID: device1,
+					From:     from,
+					To:       to,
+					Fields:   []string{"ph"},
+					Limit:    maxReadPoints + 1,
+				}).Return(measurements, nil).Times(1)
+				return NewMetricLogic(metricRepository, userDeviceRepository)
+			},
+			givenQuery: models.MeasurementQuery{SensorID: device1, From: from, To: to, Fields: []string{"ph"}},
+			assert: func(t *testing.T, series models.MeasurementSeries, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, measurements, series.Measurements)
+			},
+		},
+		{
+			name: "all fields and last day are used by default",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}}, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().ReadMeasurements(gomock.Any(), models.MeasurementQuery{
+					SensorID: device1,
+					From:     to.Add(-24 * time.Hour),
+					To:       to,
+					Fields:   models.MeasurementFields,
+					Limit:    maxReadPoints + 1,
+				}).Return(measurements, nil).Times(1)
+				return NewMetricLogic(metricRepository, userDeviceRepository)
+			},
+			givenQuery: models.MeasurementQuery{SensorID: device1, To: to},
+			assert: func(t *testing.T, series models.MeasurementSeries, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, measurements, series.Measurements)
+			},
+		},
+		{
+			name: "window is picked from the range when only the aggregation is given",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}}, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().ReadMeasurements(gomock.Any(), models.MeasurementQuery{
+					SensorID:    device1,
+					From:        to.AddDate(0, 0, -30),
+					To:          to,
+					Fields:      []string{"ph"},
+					Aggregation: models.AggregationMax,
+					Window:      time.Hour,
+					Limit:       maxReadPoints,
+				}).Return(measurements, nil).Times(1)
+				return NewMetricLogic(metricRepository, userDeviceRepository)
+			},
+			givenQuery: models.MeasurementQuery{SensorID: device1, From: to.AddDate(0, 0, -30), To: to, Fields: []string{"ph"}, Aggregation: models.AggregationMax},
+			assert: func(t *testing.T, series models.MeasurementSeries, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, measurements, series.Measurements)
+			},
+		},
+		{
+			name: "mean is used when only the window is given",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}}, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().ReadMeasurements(gomock.Any(), models.MeasurementQuery{
+					SensorID:    device1,
+					From:        from,
+					To:          to,
+					Fields:      []string{"ph"},
+					Aggregation: models.AggregationMean,
+					Window:      15 * time.Minute,
+					Limit:       maxReadPoints,
+				}).Return(measurements, nil).Times(1)
+				return NewMetricLogic(metricRepository, userDeviceRepository)
+			},
+			givenQuery: models.MeasurementQuery{SensorID: device1, From: from, To: to, Fields: []string{"ph"}, Window: 15 * time.Minute},
+			assert: func(t *testing.T, series models.MeasurementSeries, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, measurements, series.Measurements)
+			},
+		},
+		{
+			name: "unknown aggregation should return a bad request",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				return NewMetricLogic(nil, nil)
+			},
+			givenQuery: models.MeasurementQuery{SensorID: device1, From: from, To: to, Aggregation: "median"},
+			assert: func(t *testing.T, series models.MeasurementSeries, err error) {
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, localErrs.BadRequestErr)
+				}
+			},
+		},
+		{
+			name: "window exceeding the points cap is widened",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}}, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().ReadMeasurements(gomock.Any(), models.MeasurementQuery{
+					SensorID:    device1,
+					From:        to.AddDate(0, 0, -30),
+					To:          to,
+					Fields:      models.MeasurementFields,
+					Aggregation: models.AggregationMean,
+					Window:      time.Hour,
+					Limit:       maxReadPoints,
+				}).Return(measurements, nil).Times(1)
+				return NewMetricLogic(metricRepository, userDeviceRepository)
+			},
+			givenQuery: models.MeasurementQuery{SensorID: device1, From: to.AddDate(0, 0, -30), To: to, Window: time.Minute},
+			assert: func(t *testing.T, series models.MeasurementSeries, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, time.Hour, series.Window)
+			},
+		},
+		{
+			name: "raw reads exceeding the points cap are downsampled",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}}, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				raw := models.MeasurementQuery{SensorID: device1, From: to.Add(-24 * time.Hour), To: to, Fields: []string{"ph"}, Limit: maxReadPoints + 1}
+				downsampled := raw
+				downsampled.Aggregation = models.AggregationMean
+				downsampled.Window = 5 * time.Minute
+				downsampled.Limit = maxReadPoints
+				gomock.InOrder(
+					metricRepository.EXPECT().ReadMeasurements(gomock.Any(), raw).Return(make([]models.Measurement, maxReadPoints+1), nil).Times(1),
+					metricRepository.EXPECT().ReadMeasurements(gomock.Any(), downsampled).Return(measurements, nil).Times(1),
+				)
+				return NewMetricLogic(metricRepository, userDeviceRepository)
+			},
+			givenQuery: models.MeasurementQuery{SensorID: device1, From: to.Add(-24 * time.Hour), To: to, Fields: []string{"ph"}},
+			assert: func(t *testing.T, series models.MeasurementSeries, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, models.MeasurementSeries{Aggregation: models.AggregationMean, Window: 5 * time.Minute, Measurements: measurements}, series)
+			},
+		},
+		{
+			name: "unknown fields should return a bad request",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				return NewMetricLogic(nil, nil)
+			},
+			givenQuery: models.MeasurementQuery{SensorID: device1, From: from, To: to, Fields: []string{"co2"}},
+			assert: func(t *testing.T, series models.MeasurementSeries, err error) {
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, localErrs.BadRequestErr)
+				}
+			},
+		},
+		{
+			name: "ranges longer than the largest window can downsample should return a bad request",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				return NewMetricLogic(nil, nil)
+			},
+			givenQuery: models.MeasurementQuery{SensorID: device1, From: to.Add(-maxReadRange), To: to, Aggregation: models.AggregationMean},
+			assert: func(t *testing.T, series models.MeasurementSeries, err error) {
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, localErrs.BadRequestErr)
+				}
+			},
+		},
+		{
+			name: "inverted range should return a bad request",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				return NewMetricLogic(nil, nil)
+			},
+			givenQuery: models.MeasurementQuery{SensorID: device1, From: to, To: from},
+			assert: func(t *testing.T, series models.MeasurementSeries, err error) {
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, localErrs.BadRequestErr)
+				}
+			},
+		},
+		{
+			name: "provided device isn't correlated to the user",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}}, nil).Times(1)
+				return NewMetricLogic(nil, userDeviceRepository)
+			},
+			givenQuery: models.MeasurementQuery{SensorID: device2, From: from, To: to},
+			assert: func(t *testing.T, series models.MeasurementSeries, err error) {
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, localErrs.ForbiddenErr)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			logic := tt.setup(ctrl)
+			series, err := logic.ReadSensorMetrics(context.Background(), userID, tt.givenQuery)
+			tt.assert(t, series, err)
+		})
+	}
+}
+
+func TestPickWindow(t *testing.T) {
+	to := time.Now()
+	var tests = []struct {
+		name           string
+		givenFrom      time.Time
+		expectedWindow time.Duration
+	}{
+		{name: "last hour", givenFrom: to.Add(-time.Hour), expectedWindow: time.Minute},
+		{name: "last day", givenFrom: to.Add(-24 * time.Hour), expectedWindow: 5 * time.Minute},
+		{name: "last week", givenFrom: to.AddDate(0, 0, -7), expectedWindow: 15 * time.Minute},
+		{name: "last year", givenFrom: to.AddDate(-1, 0, 0), expectedWindow: 24 * time.Hour},
+		{name: "longest readable range", givenFrom: to.Add(-maxReadRange + time.Hour), expectedWindow: 24 * time.Hour},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expectedWindow, pickWindow(tt.givenFrom, to))
+		})
+	}
+}
+
+func TestReadLatestSensorMetrics(t *testing.T) {
+	userID := uuid.NewString()
+	device1 := uuid.NewString()
+	device2 := uuid.NewString()
+	measurement := models.Measurement{SensorID: device1, Time: time.Now().Add(-time.Minute), Fields: map[string]float64{"ph": 6.1}}
+	var tests = []struct {
+		name   string
+		setup  func(ctrl *gomock.Controller) MetricLogic
+		assert func(t *testing.T, latest []models.LatestMeasurement, err error)
+	}{
+		{
+			name: "devices without metrics are listed without measurement",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}, {ID: device2}}, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().ReadLatestMeasurements(gomock.Any(), device1, device2).Return([]models.Measurement{measurement}, nil).Times(1)
+				return NewMetricLogic(metricRepository, userDeviceRepository)
+			},
+			assert: func(t *testing.T, latest []models.LatestMeasurement, err error) {
+				assert.Nil(t, err)
+				if assert.Len(t, latest, 2) {
+					assert.Equal(t, device1, latest[0].DeviceID)
+					assert.Equal(t, &measurement, latest[0].Measurement)
+					assert.GreaterOrEqual(t, latest[0].AgeSeconds, 60.0)
+					assert.Equal(t, models.LatestMeasurement{DeviceID: device2}, latest[1])
+				}
+			},
+		},
+		{
+			name: "user doesn't have any devices",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return(nil, localErrs.NotFoundErr).Times(1)
+				return NewMetricLogic(nil, userDeviceRepository)
+			},
+			assert: func(t *testing.T, latest []models.LatestMeasurement, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []models.LatestMeasurement{}, latest)
+			},
+		},
+		{
+			name: "user with an empty device list",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{}, nil).Times(1)
+				return NewMetricLogic(nil, userDeviceRepository)
+			},
+			assert: func(t *testing.T, latest []models.LatestMeasurement, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []models.LatestMeasurement{}, latest)
+			},
+		},
+		{
+			name: "failing to read devices should return the error",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return(nil, localErrs.InternalServerErr).Times(1)
+				return NewMetricLogic(nil, userDeviceRepository)
+			},
+			assert: func(t *testing.T, latest []models.LatestMeasurement, err error) {
+				assert.ErrorIs(t, err, localErrs.InternalServerErr)
+			},
+		},
+		{
+			name: "failing to read metrics should return the error",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}}, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().ReadLatestMeasurements(gomock.Any(), device1).Return(nil, localErrs.InternalServerErr).Times(1)
+				return NewMetricLogic(metricRepository, userDeviceRepository)
+			},
+			assert: func(t *testing.T, latest []models.LatestMeasurement, err error) {
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, localErrs.InternalServerErr)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			logic := tt.setup(ctrl)
+			latest, err := logic.ReadLatestSensorMetrics(context.Background(), userID)
+			tt.assert(t, latest, err)
+		})
+	}
+}
+
+func TestExportSensorMetrics(t *testing.T) {
+	userID := uuid.NewString()
+	device1 := uuid.NewString()
+	device2 := uuid.NewString()
+	to := time.Now()
+	from := to.Add(-time.Hour)
+	var tests = []struct {
+		name         string
+		setup        func(ctrl *gomock.Controller) MetricLogic
+		givenDevices []string
+		assert       func(t *testing.T, exported []models.Measurement, err error)
+	}{
+		{
+			name: "every user device is exported when no device is given",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}, {ID: device2}}, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				for _, device := range []string{device1, device2} {
+					device := device
+					metricRepository.EXPECT().StreamMeasurements(gomock.Any(), models.MeasurementQuery{
+						SensorID: device,
+						From:     from,
+						To:       to,
+						Fields:   models.MeasurementFields,
+					}, gomock.Any()).DoAndReturn(func(_ context.Context, _ models.MeasurementQuery, handle func(models.Measurement) error) error {
+						return handle(models.Measurement{SensorID: device})
+					}).Times(1)
+				}
+				return NewMetricLogic(metricRepository, userDeviceRepository)
+			},
+			assert: func(t *testing.T, exported []models.Measurement, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []models.Measurement{{SensorID: device1}, {SensorID: device2}}, exported)
+			},
+		},
+		{
+			name: "only the given devices are exported",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}, {ID: device2}}, nil).Times(1)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().StreamMeasurements(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, query models.MeasurementQuery, handle func(models.Measurement) error) error {
+					return handle(models.Measurement{SensorID: query.SensorID})
+				}).Times(1)
+				return NewMetricLogic(metricRepository, userDeviceRepository)
+			},
+			givenDevices: []string{device2},
+			assert: func(t *testing.T, exported []models.Measurement, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []models.Measurement{{SensorID: device2}}, exported)
+			},
+		},
+		{
+			name: "provided device isn't correlated to the user",
+			setup: func(ctrl *gomock.Controller) MetricLogic {
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: device1}}, nil).Times(1)
+				return NewMetricLogic(nil, userDeviceRepository)
+			},
+			givenDevices: []string{device1, device2},
+			assert: func(t *testing.T, exported []models.Measurement, err error) {
+				assert.Empty(t, exported)
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, localErrs.ForbiddenErr)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			logic := tt.setup(ctrl)
+			exported := make([]models.Measurement, 0)
+			err := logic.ExportSensorMetrics(context.Background(), userID, tt.givenDevices, models.MeasurementQuery{From: from, To: to}, func(m models.Measurement) error {
+				exported = append(exported, m)
+				return nil
+			})
+			tt.assert(t, exported, err)
+		})
+	}
+}
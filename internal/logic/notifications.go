@@ -0,0 +1,150 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmlTemplate "html/template"
+	"sync"
+	textTemplate "text/template"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/services"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+// emailTimeout limits how long sending a single email may take
+const emailTimeout = 30 * time.Second
+
+//go:embed templates
+var emailTemplates embed.FS
+
+// emailTemplateNames maps the notified event types to their template files
+var emailTemplateNames = map[string]string{
+	models.EventAlertFiring:   "alert_firing",
+	models.EventAlertResolved: "alert_resolved",
+	models.EventDeviceSilent:  "device_silent",
+}
+
+// emailTemplateData is the data available when rendering email templates
+type emailTemplateData struct {
+	User   models.User
+	Event  models.Event
+	Alert  models.AlertEvent
+	Device models.SilentDevice
+}
+
+type emailTemplate struct {
+	text *textTemplate.Template
+	html *htmlTemplate.Template
+}
+
+// NotificationLogic sends emails to users when their alerts change or their
+// devices go silent
+//
+//go:generate mockgen -destination notifications_mock.go -package logic github.com/WendelHime/hydroponics-metrics-collector/internal/logic NotificationLogic
+type NotificationLogic interface {
+	EventListener
+	// Wait blocks until the pending emails are sent
+	Wait()
+}
+
+type notificationLogic struct {
+	userService services.UserService
+	sender      services.EmailSender
+	templates   map[string]emailTemplate
+	pending     sync.WaitGroup
+}
+
+func NewNotificationLogic(userService services.UserService, sender services.EmailSender) (NotificationLogic, error) {
+	templates := make(map[string]emailTemplate, len(emailTemplateNames))
+	for eventType, name := range emailTemplateNames {
+		text, err := textTemplate.ParseFS(emailTemplates, fmt.Sprintf("templates/%s.txt.tmpl", name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s text template: %w", name, err)
+		}
+		html, err := htmlTemplate.ParseFS(emailTemplates, fmt.Sprintf("templates/%s.html.tmpl", name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s html template: %w", name, err)
+		}
+		templates[eventType] = emailTemplate{text: text, html: html}
+	}
+
+	return &notificationLogic{userService: userService, sender: sender, templates: templates}, nil
+}
+
+func (l *notificationLogic) OnEvent(ctx context.Context, event models.Event) {
+	template, ok := l.templates[event.Type]
+	if !ok {
+		return
+	}
+
+	data := emailTemplateData{Event: event}
+	switch value := event.Data.(type) {
+	case models.AlertEvent:
+		data.Alert = value
+	case models.SilentDevice:
+		data.Device = value
+	default:
+		log.Error().Str("event", event.Type).Msg("unexpected event data for email notification")
+		return
+	}
+
+	// emails outlive the request that produced the event
+	l.pending.Add(1)
+	go func() {
+		defer l.pending.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), emailTimeout)
+		defer cancel()
+
+		err := l.notify(ctx, template, data)
+		if err != nil {
+			log.Error().Err(err).Str("userID", event.UserID).Str("event", event.Type).Msg("failed to send email notification")
+		}
+	}()
+}
+
+func (l *notificationLogic) notify(ctx context.Context, template emailTemplate, data emailTemplateData) error {
+	user, err := l.userService.GetUserByID(ctx, data.Event.UserID)
+	if err != nil {
+		return err
+	}
+	data.User = user
+
+	message, err := renderEmail(template, data)
+	if err != nil {
+		return err
+	}
+
+	return l.sender.Send(ctx, message)
+}
+
+func renderEmail(template emailTemplate, data emailTemplateData) (services.EmailMessage, error) {
+	var subject, text, html bytes.Buffer
+	err := template.text.ExecuteTemplate(&subject, "subject", data)
+	if err != nil {
+		return services.EmailMessage{}, fmt.Errorf("failed to render subject: %w", err)
+	}
+	err = template.text.Execute(&text, data)
+	if err != nil {
+		return services.EmailMessage{}, fmt.Errorf("failed to render text body: %w", err)
+	}
+	err = template.html.Execute(&html, data)
+	if err != nil {
+		return services.EmailMessage{}, fmt.Errorf("failed to render html body: %w", err)
+	}
+
+	return services.EmailMessage{
+		To:      data.User.Email,
+		Subject: subject.String(),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+func (l *notificationLogic) Wait() {
+	l.pending.Wait()
+}
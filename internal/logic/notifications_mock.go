@@ -0,0 +1,60 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/WendelHime/hydroponics-metrics-collector/internal/logic (interfaces: NotificationLogic)
+
+// Package logic is a generated GoMock package.
+package logic
+
+import (
+	context "context"
+	reflect "reflect"
+
+	models "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockNotificationLogic is a mock of NotificationLogic interface.
+type MockNotificationLogic struct {
+	ctrl     *gomock.Controller
+	recorder *MockNotificationLogicMockRecorder
+}
+
+// MockNotificationLogicMockRecorder is the mock recorder for MockNotificationLogic.
+type MockNotificationLogicMockRecorder struct {
+	mock *MockNotificationLogic
+}
+
+// NewMockNotificationLogic creates a new mock instance.
+func NewMockNotificationLogic(ctrl *gomock.Controller) *MockNotificationLogic {
+	mock := &MockNotificationLogic{ctrl: ctrl}
+	mock.recorder = &MockNotificationLogicMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockNotificationLogic) EXPECT() *MockNotificationLogicMockRecorder {
+	return m.recorder
+}
+
+// OnEvent mocks base method.
+func (m *MockNotificationLogic) OnEvent(arg0 context.Context, arg1 models.Event) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnEvent", arg0, arg1)
+}
+
+// OnEvent indicates an expected call of OnEvent.
+func (mr *MockNotificationLogicMockRecorder) OnEvent(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnEvent", reflect.TypeOf((*MockNotificationLogic)(nil).OnEvent), arg0, arg1)
+}
+
+// Wait mocks base method.
+func (m *MockNotificationLogic) Wait() {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Wait")
+}
+
+// Wait indicates an expected call of Wait.
+func (mr *MockNotificationLogicMockRecorder) Wait() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Wait", reflect.TypeOf((*MockNotificationLogic)(nil).Wait))
+}
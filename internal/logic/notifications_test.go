@@ -0,0 +1,92 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/services"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+)
+
+func TestNotificationOnEvent(t *testing.T) {
+	userID := uuid.NewString()
+	user := models.User{ID: userID, Name: "Random User", Email: "random@test.com"}
+	alert := models.AlertEvent{ID: uuid.NewString(), DeviceID: "device-1", Field: "ph", Operator: models.OperatorGreaterThan, Threshold: 7.5, Value: 8.1, Time: time.Now()}
+	var tests = []struct {
+		name  string
+		event models.Event
+		setup func(ctrl *gomock.Controller) NotificationLogic
+	}{
+		{
+			name:  "alert firing email is sent to the user",
+			event: newEvent(models.EventAlertFiring, userID, alert),
+			setup: func(ctrl *gomock.Controller) NotificationLogic {
+				userService := services.NewMockUserService(ctrl)
+				userService.EXPECT().GetUserByID(gomock.Any(), userID).Return(user, nil).Times(1)
+				sender := services.NewMockEmailSender(ctrl)
+				sender.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, message services.EmailMessage) error {
+					assert.Equal(t, user.Email, message.To)
+					assert.Equal(t, "Alert firing: ph on device-1", message.Subject)
+					assert.Contains(t, message.Text, "reached 8.1")
+					assert.Contains(t, message.HTML, "<strong>8.1</strong>")
+					return nil
+				}).Times(1)
+				logic, err := NewNotificationLogic(userService, sender)
+				assert.Nil(t, err)
+				return logic
+			},
+		},
+		{
+			name:  "device silent email is sent to the user",
+			event: newEvent(models.EventDeviceSilent, userID, models.SilentDevice{DeviceID: "device-1", LastSeen: time.Now().Add(-time.Hour)}),
+			setup: func(ctrl *gomock.Controller) NotificationLogic {
+				userService := services.NewMockUserService(ctrl)
+				userService.EXPECT().GetUserByID(gomock.Any(), userID).Return(user, nil).Times(1)
+				sender := services.NewMockEmailSender(ctrl)
+				sender.EXPECT().Send(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, message services.EmailMessage) error {
+					assert.Equal(t, "Device device-1 went silent", message.Subject)
+					return nil
+				}).Times(1)
+				logic, err := NewNotificationLogic(userService, sender)
+				assert.Nil(t, err)
+				return logic
+			},
+		},
+		{
+			name:  "events without template are ignored",
+			event: newEvent(models.EventDeviceAdded, userID, map[string]string{"device_id": "device-1"}),
+			setup: func(ctrl *gomock.Controller) NotificationLogic {
+				logic, err := NewNotificationLogic(services.NewMockUserService(ctrl), services.NewMockEmailSender(ctrl))
+				assert.Nil(t, err)
+				return logic
+			},
+		},
+		{
+			name:  "email is not sent when the user can't be retrieved",
+			event: newEvent(models.EventAlertResolved, userID, alert),
+			setup: func(ctrl *gomock.Controller) NotificationLogic {
+				userService := services.NewMockUserService(ctrl)
+				userService.EXPECT().GetUserByID(gomock.Any(), userID).Return(models.User{}, errors.New("random error")).Times(1)
+				logic, err := NewNotificationLogic(userService, services.NewMockEmailSender(ctrl))
+				assert.Nil(t, err)
+				return logic
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			logic := tt.setup(ctrl)
+			logic.OnEvent(context.Background(), tt.event)
+			logic.Wait()
+		})
+	}
+}
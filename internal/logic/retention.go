@@ -0,0 +1,136 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+// RetentionLogic enforces how long the user measurements are kept, users
+// without a policy of their own follow the default one
+//
+//go:generate mockgen -destination retention_mock.go -package logic github.com/WendelHime/hydroponics-metrics-collector/internal/logic RetentionLogic
+type RetentionLogic interface {
+	GetPolicy(ctx context.Context, userID string) (models.RetentionPolicy, error)
+	// SetPolicy returns NotImplementedErr when the metric store can't delete
+	// measurements, as the policy would never be enforced
+	SetPolicy(ctx context.Context, policy models.RetentionPolicy) error
+	// Report counts the measurements a purge would delete, without deleting
+	// them. NotImplementedErr is returned like for Purge
+	Report(ctx context.Context, userID string) (models.RetentionReport, error)
+	// Purge deletes the expired measurements of every user device
+	Purge(ctx context.Context) error
+}
+
+type retentionLogic struct {
+	retentionRepository  storage.RetentionRepository
+	userDeviceRepository storage.UserDeviceRepository
+	metricRepository     storage.MetricRepository
+	defaultDays          int
+}
+
+func NewRetentionLogic(retentionRepository storage.RetentionRepository, userDeviceRepository storage.UserDeviceRepository, metricRepository storage.MetricRepository, defaultDays int) RetentionLogic {
+	return &retentionLogic{
+		retentionRepository:  retentionRepository,
+		userDeviceRepository: userDeviceRepository,
+		metricRepository:     metricRepository,
+		defaultDays:          defaultDays,
+	}
+}
+
+func (l *retentionLogic) GetPolicy(ctx context.Context, userID string) (models.RetentionPolicy, error) {
+	policy, err := l.retentionRepository.GetRetentionPolicy(ctx, userID)
+	if errors.Is(err, localErrs.NotFoundErr) {
+		return models.RetentionPolicy{UserID: userID, Days: l.defaultDays}, nil
+	}
+	return policy, err
+}
+
+func (l *retentionLogic) SetPolicy(ctx context.Context, policy models.RetentionPolicy) error {
+	if !l.metricRepository.SupportsDeletes() {
+		return localErrs.NotImplementedErr.WithMsg("the metric store doesn't support purging measurements")
+	}
+	return l.retentionRepository.SetRetentionPolicy(ctx, policy)
+}
+
+func (l *retentionLogic) Report(ctx context.Context, userID string) (models.RetentionReport, error) {
+	if !l.metricRepository.SupportsDeletes() {
+		return models.RetentionReport{}, localErrs.NotImplementedErr.WithMsg("the metric store doesn't support purging measurements")
+	}
+
+	policy, err := l.GetPolicy(ctx, userID)
+	if err != nil {
+		return models.RetentionReport{}, err
+	}
+
+	report := models.RetentionReport{
+		UserID:  userID,
+		Days:    policy.Days,
+		Cutoff:  policy.Cutoff(time.Now()),
+		Devices: make([]models.DevicePurge, 0),
+	}
+	if report.Cutoff.IsZero() {
+		return report, nil
+	}
+
+	devices, err := l.userDeviceRepository.GetDevicesFromUser(ctx, userID)
+	if err != nil {
+		if errors.Is(err, localErrs.NotFoundErr) {
+			return report, nil
+		}
+		return models.RetentionReport{}, err
+	}
+
+	for _, device := range devices {
+		points, err := l.metricRepository.CountMeasurements(ctx, models.MeasurementQuery{SensorID: device.ID, From: purgeFrom, To: report.Cutoff})
+		if err != nil {
+			return models.RetentionReport{}, err
+		}
+		report.Devices = append(report.Devices, models.DevicePurge{DeviceID: device.ID, Points: points})
+		report.Points += points
+	}
+	return report, nil
+}
+
+// Purge keeps going when the measurements of a user can't be purged, the
+// failures are returned once every user was handled
+func (l *retentionLogic) Purge(ctx context.Context) error {
+	if !l.metricRepository.SupportsDeletes() {
+		return localErrs.NotImplementedErr.WithMsg("the metric store doesn't support purging measurements")
+	}
+
+	var errs []error
+	now := time.Now()
+	err := storage.EachUserDevices(ctx, l.userDeviceRepository, func(userDevices []storage.UserDevices) error {
+		for _, userDevice := range userDevices {
+			policy, err := l.GetPolicy(ctx, userDevice.UserID)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			cutoff := policy.Cutoff(now)
+			if cutoff.IsZero() {
+				continue
+			}
+
+			for _, device := range userDevice.Devices {
+				err = l.metricRepository.DeleteMeasurements(ctx, models.MeasurementQuery{SensorID: device.ID, From: purgeFrom, To: cutoff})
+				if err != nil {
+					errs = append(errs, err)
+				}
+			}
+			log.Info().Str("userID", userDevice.UserID).Int("devices", len(userDevice.Devices)).Time("cutoff", cutoff).Msg("purged expired measurements")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,94 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/WendelHime/hydroponics-metrics-collector/internal/logic (interfaces: RetentionLogic)
+
+// Package logic is a generated GoMock package.
+package logic
+
+import (
+	context "context"
+	reflect "reflect"
+
+	models "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockRetentionLogic is a mock of RetentionLogic interface.
+type MockRetentionLogic struct {
+	ctrl     *gomock.Controller
+	recorder *MockRetentionLogicMockRecorder
+}
+
+// MockRetentionLogicMockRecorder is the mock recorder for MockRetentionLogic.
+type MockRetentionLogicMockRecorder struct {
+	mock *MockRetentionLogic
+}
+
+// NewMockRetentionLogic creates a new mock instance.
+func NewMockRetentionLogic(ctrl *gomock.Controller) *MockRetentionLogic {
+	mock := &MockRetentionLogic{ctrl: ctrl}
+	mock.recorder = &MockRetentionLogicMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRetentionLogic) EXPECT() *MockRetentionLogicMockRecorder {
+	return m.recorder
+}
+
+// GetPolicy mocks base method.
+func (m *MockRetentionLogic) GetPolicy(arg0 context.Context, arg1 string) (models.RetentionPolicy, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPolicy", arg0, arg1)
+	ret0, _ := ret[0].(models.RetentionPolicy)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetPolicy indicates an expected call of GetPolicy.
+func (mr *MockRetentionLogicMockRecorder) GetPolicy(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPolicy", reflect.TypeOf((*MockRetentionLogic)(nil).GetPolicy), arg0, arg1)
+}
+
+// Purge mocks base method.
+func (m *MockRetentionLogic) Purge(arg0 context.Context) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Purge", arg0)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Purge indicates an expected call of Purge.
+func (mr *MockRetentionLogicMockRecorder) Purge(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Purge", reflect.TypeOf((*MockRetentionLogic)(nil).Purge), arg0)
+}
+
+// Report mocks base method.
+func (m *MockRetentionLogic) Report(arg0 context.Context, arg1 string) (models.RetentionReport, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Report", arg0, arg1)
+	ret0, _ := ret[0].(models.RetentionReport)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Report indicates an expected call of Report.
+func (mr *MockRetentionLogicMockRecorder) Report(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Report", reflect.TypeOf((*MockRetentionLogic)(nil).Report), arg0, arg1)
+}
+
+// SetPolicy mocks base method.
+func (m *MockRetentionLogic) SetPolicy(arg0 context.Context, arg1 models.RetentionPolicy) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetPolicy", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetPolicy indicates an expected call of SetPolicy.
+func (mr *MockRetentionLogicMockRecorder) SetPolicy(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetPolicy", reflect.TypeOf((*MockRetentionLogic)(nil).SetPolicy), arg0, arg1)
+}
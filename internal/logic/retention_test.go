@@ -0,0 +1,241 @@
+package logic
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+)
+
+func TestGetPolicy(t *testing.T) {
+	userID := uuid.NewString()
+	var tests = []struct {
+		name   string
+		setup  func(repository *storage.MockRetentionRepository)
+		assert func(t *testing.T, policy models.RetentionPolicy, err error)
+	}{
+		{
+			name: "user policy is returned",
+			setup: func(repository *storage.MockRetentionRepository) {
+				repository.EXPECT().GetRetentionPolicy(gomock.Any(), userID).Return(models.RetentionPolicy{UserID: userID, Days: 30}, nil)
+			},
+			assert: func(t *testing.T, policy models.RetentionPolicy, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 30, policy.Days)
+			},
+		},
+		{
+			name: "users without policy follow the default one",
+			setup: func(repository *storage.MockRetentionRepository) {
+				repository.EXPECT().GetRetentionPolicy(gomock.Any(), userID).Return(models.RetentionPolicy{}, localErrs.NotFoundErr)
+			},
+			assert: func(t *testing.T, policy models.RetentionPolicy, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, models.RetentionPolicy{UserID: userID, Days: 365}, policy)
+			},
+		},
+		{
+			name: "failed to retrieve policy",
+			setup: func(repository *storage.MockRetentionRepository) {
+				repository.EXPECT().GetRetentionPolicy(gomock.Any(), userID).Return(models.RetentionPolicy{}, localErrs.InternalServerErr)
+			},
+			assert: func(t *testing.T, policy models.RetentionPolicy, err error) {
+				assert.ErrorIs(t, err, localErrs.InternalServerErr)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			repository := storage.NewMockRetentionRepository(ctrl)
+			tt.setup(repository)
+			policy, err := NewRetentionLogic(repository, nil, nil, 365).GetPolicy(context.Background(), userID)
+			tt.assert(t, policy, err)
+		})
+	}
+}
+
+func TestSetPolicy(t *testing.T) {
+	policy := models.RetentionPolicy{UserID: uuid.NewString(), Days: 30}
+	var tests = []struct {
+		name   string
+		setup  func(ctrl *gomock.Controller) RetentionLogic
+		assert func(t *testing.T, err error)
+	}{
+		{
+			name: "policy is saved",
+			setup: func(ctrl *gomock.Controller) RetentionLogic {
+				retentionRepository := storage.NewMockRetentionRepository(ctrl)
+				retentionRepository.EXPECT().SetRetentionPolicy(gomock.Any(), policy).Return(nil)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().SupportsDeletes().Return(true)
+				return NewRetentionLogic(retentionRepository, nil, metricRepository, 0)
+			},
+			assert: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name: "policies aren't saved when the metric store can't purge",
+			setup: func(ctrl *gomock.Controller) RetentionLogic {
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().SupportsDeletes().Return(false)
+				return NewRetentionLogic(storage.NewMockRetentionRepository(ctrl), nil, metricRepository, 0)
+			},
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.NotImplementedErr)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			err := tt.setup(ctrl).SetPolicy(context.Background(), policy)
+			tt.assert(t, err)
+		})
+	}
+}
+
+func TestRetentionReport(t *testing.T) {
+	userID := uuid.NewString()
+	var tests = []struct {
+		name   string
+		setup  func(ctrl *gomock.Controller) RetentionLogic
+		assert func(t *testing.T, report models.RetentionReport, err error)
+	}{
+		{
+			name: "expired measurements are counted per device",
+			setup: func(ctrl *gomock.Controller) RetentionLogic {
+				retentionRepository := storage.NewMockRetentionRepository(ctrl)
+				retentionRepository.EXPECT().GetRetentionPolicy(gomock.Any(), userID).Return(models.RetentionPolicy{UserID: userID, Days: 30}, nil)
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{{ID: "device1"}, {ID: "device2"}}, nil)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().SupportsDeletes().Return(true)
+				metricRepository.EXPECT().CountMeasurements(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, query models.MeasurementQuery) (int64, error) {
+					assert.Equal(t, purgeFrom, query.From)
+					assert.WithinDuration(t, time.Now().AddDate(0, 0, -30), query.To, time.Minute)
+					if query.SensorID == "device1" {
+						return 3, nil
+					}
+					return 4, nil
+				}).Times(2)
+				return NewRetentionLogic(retentionRepository, userDeviceRepository, metricRepository, 0)
+			},
+			assert: func(t *testing.T, report models.RetentionReport, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 30, report.Days)
+				assert.Equal(t, int64(7), report.Points)
+				assert.Equal(t, []models.DevicePurge{{DeviceID: "device1", Points: 3}, {DeviceID: "device2", Points: 4}}, report.Devices)
+			},
+		},
+		{
+			name: "nothing expires when measurements are kept forever",
+			setup: func(ctrl *gomock.Controller) RetentionLogic {
+				retentionRepository := storage.NewMockRetentionRepository(ctrl)
+				retentionRepository.EXPECT().GetRetentionPolicy(gomock.Any(), userID).Return(models.RetentionPolicy{}, localErrs.NotFoundErr)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().SupportsDeletes().Return(true)
+				return NewRetentionLogic(retentionRepository, nil, metricRepository, 0)
+			},
+			assert: func(t *testing.T, report models.RetentionReport, err error) {
+				assert.Nil(t, err)
+				assert.True(t, report.Cutoff.IsZero())
+				assert.Empty(t, report.Devices)
+			},
+		},
+		{
+			name: "the metric store can't purge",
+			setup: func(ctrl *gomock.Controller) RetentionLogic {
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().SupportsDeletes().Return(false)
+				return NewRetentionLogic(nil, nil, metricRepository, 90)
+			},
+			assert: func(t *testing.T, report models.RetentionReport, err error) {
+				assert.ErrorIs(t, err, localErrs.NotImplementedErr)
+			},
+		},
+		{
+			name: "users without devices have nothing to purge",
+			setup: func(ctrl *gomock.Controller) RetentionLogic {
+				retentionRepository := storage.NewMockRetentionRepository(ctrl)
+				retentionRepository.EXPECT().GetRetentionPolicy(gomock.Any(), userID).Return(models.RetentionPolicy{}, localErrs.NotFoundErr)
+				userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+				userDeviceRepository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return(nil, localErrs.NotFoundErr)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().SupportsDeletes().Return(true)
+				return NewRetentionLogic(retentionRepository, userDeviceRepository, metricRepository, 90)
+			},
+			assert: func(t *testing.T, report models.RetentionReport, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, 90, report.Days)
+				assert.Empty(t, report.Devices)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			report, err := tt.setup(ctrl).Report(context.Background(), userID)
+			tt.assert(t, report, err)
+		})
+	}
+}
+
+func TestPurge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	expiring := uuid.NewString()
+	keeping := uuid.NewString()
+	failing := uuid.NewString()
+	userDeviceRepository := storage.NewMockUserDeviceRepository(ctrl)
+	userDeviceRepository.EXPECT().ListUserDevices(gomock.Any(), "", storage.UserDevicesPageSize).Return([]storage.UserDevices{
+		{UserID: failing, Devices: []models.Device{{ID: "device0"}}},
+		{UserID: expiring, Devices: []models.Device{{ID: "device1"}, {ID: "device2"}}},
+		{UserID: keeping, Devices: []models.Device{{ID: "device3"}}},
+	}, nil)
+	retentionRepository := storage.NewMockRetentionRepository(ctrl)
+	retentionRepository.EXPECT().GetRetentionPolicy(gomock.Any(), failing).Return(models.RetentionPolicy{}, localErrs.InternalServerErr)
+	retentionRepository.EXPECT().GetRetentionPolicy(gomock.Any(), expiring).Return(models.RetentionPolicy{UserID: expiring, Days: 7}, nil)
+	retentionRepository.EXPECT().GetRetentionPolicy(gomock.Any(), keeping).Return(models.RetentionPolicy{}, localErrs.NotFoundErr)
+	metricRepository := storage.NewMockMetricRepository(ctrl)
+	metricRepository.EXPECT().SupportsDeletes().Return(true)
+	deleted := make([]string, 0)
+	metricRepository.EXPECT().DeleteMeasurements(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, query models.MeasurementQuery) error {
+		assert.Equal(t, purgeFrom, query.From)
+		assert.WithinDuration(t, time.Now().AddDate(0, 0, -7), query.To, time.Minute)
+		deleted = append(deleted, query.SensorID)
+		return nil
+	}).Times(2)
+
+	// users are still purged after a failure
+	err := NewRetentionLogic(retentionRepository, userDeviceRepository, metricRepository, 0).Purge(context.Background())
+	assert.ErrorIs(t, err, localErrs.InternalServerErr)
+	assert.Equal(t, []string{"device1", "device2"}, deleted)
+}
+
+func TestPurgeUnsupported(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	metricRepository := storage.NewMockMetricRepository(ctrl)
+	metricRepository.EXPECT().SupportsDeletes().Return(false)
+	err := NewRetentionLogic(nil, nil, metricRepository, 0).Purge(context.Background())
+	assert.ErrorIs(t, err, localErrs.NotImplementedErr)
+}
@@ -2,7 +2,8 @@ package logic
 
 import (
 	"context"
-	"errors"
+	"math"
+	"time"
 
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/services"
 	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
@@ -16,16 +17,25 @@ import (
 type UserLogic interface {
 	CreateAccount(ctx context.Context, account models.User) error
 	Login(ctx context.Context, credentials models.Credentials) (models.Token, error)
-	AddDevice(ctx context.Context, userID string, newDevice string) error
-	GetDevices(ctx context.Context, userID string) ([]string, error)
+	AddDevice(ctx context.Context, userID string, newDevice models.Device) error
+	GetDevices(ctx context.Context, userID string) ([]models.Device, error)
+	// UpdateDevice edits the metadata of a device bound to the user
+	UpdateDevice(ctx context.Context, userID string, deviceID string, update models.DeviceUpdate) (models.Device, error)
+	// RemoveDevice unbinds the device from the user, deleting its stored
+	// metrics first when purge is set. The device stays bound when the purge
+	// fails, or with NotImplementedErr when the metric store can't delete
+	// measurements
+	RemoveDevice(ctx context.Context, userID string, deviceID string, purge bool) error
 }
 
-func NewUserLogic(userService services.UserService, authService services.Authenticator, deviceRepo storage.UserDeviceRepository, roleID string) UserLogic {
+func NewUserLogic(userService services.UserService, authService services.Authenticator, deviceRepo storage.UserDeviceRepository, metricRepo storage.MetricRepository, roleID string, listeners ...EventListener) UserLogic {
 	return &userLogic{
 		userService:          userService,
 		authService:          authService,
 		userDeviceRepository: deviceRepo,
+		metricRepository:     metricRepo,
 		roleID:               roleID,
+		listeners:            listeners,
 	}
 }
 
@@ -33,7 +43,15 @@ type userLogic struct {
 	userService          services.UserService
 	authService          services.Authenticator
 	userDeviceRepository storage.UserDeviceRepository
+	metricRepository     storage.MetricRepository
 	roleID               string
+	listeners            []EventListener
+}
+
+func (l *userLogic) publish(ctx context.Context, event models.Event) {
+	for _, listener := range l.listeners {
+		listener.OnEvent(ctx, event)
+	}
 }
 
 func (l *userLogic) CreateAccount(ctx context.Context, account models.User) error {
@@ -52,6 +70,7 @@ func (l *userLogic) CreateAccount(ctx context.Context, account models.User) erro
 		return err
 	}
 
+	l.publish(ctx, newEvent(models.EventAccountCreated, user.ID, map[string]string{"name": user.Name, "email": user.Email}))
 	return nil
 }
 
@@ -79,30 +98,69 @@ func (l *userLogic) Login(ctx context.Context, credentials models.Credentials) (
 	return token, nil
 }
 
-func (l *userLogic) AddDevice(ctx context.Context, userID string, newDevice string) error {
-	var localErr *localErrs.Error
-	currentDevices, err := l.userDeviceRepository.GetDevicesFromUser(ctx, userID)
+func (l *userLogic) AddDevice(ctx context.Context, userID string, newDevice models.Device) error {
+	newDevice.CreatedAt = time.Now().UTC()
+	err := l.userDeviceRepository.AddDeviceToUser(ctx, userID, newDevice)
 	if err != nil {
-		if errors.As(err, &localErr) {
-			if localErr.StatusCode == 404 {
-				err = l.userDeviceRepository.CreateUserDevice(ctx, userID, newDevice)
-				if err != nil {
-					return err
-				}
-			}
-		}
 		return err
 	}
 
-	err = l.userDeviceRepository.AddDeviceToUser(ctx, userID, newDevice, currentDevices)
-	return err
+	l.publish(ctx, newEvent(models.EventDeviceAdded, userID, map[string]string{"device_id": newDevice.ID}))
+	return nil
 }
 
-func (l *userLogic) GetDevices(ctx context.Context, userID string) ([]string, error) {
+func (l *userLogic) GetDevices(ctx context.Context, userID string) ([]models.Device, error) {
 	currentDevices, err := l.userDeviceRepository.GetDevicesFromUser(ctx, userID)
 	if err != nil {
-		return []string{}, err
+		return []models.Device{}, err
 	}
 
 	return currentDevices, nil
 }
+
+func (l *userLogic) UpdateDevice(ctx context.Context, userID string, deviceID string, update models.DeviceUpdate) (models.Device, error) {
+	device, err := l.userDeviceRepository.UpdateDevice(ctx, userID, deviceID, update)
+	if err != nil {
+		return models.Device{}, err
+	}
+
+	l.publish(ctx, newEvent(models.EventDeviceUpdated, userID, device))
+	return device, nil
+}
+
+// purgeFrom and purgeTo cover every timestamp that can be stored
+var (
+	purgeFrom = time.Unix(0, 0)
+	purgeTo   = time.Unix(0, math.MaxInt64)
+)
+
+func (l *userLogic) RemoveDevice(ctx context.Context, userID string, deviceID string, purge bool) error {
+	owner, err := l.userDeviceRepository.GetDeviceOwner(ctx, deviceID)
+	if err != nil {
+		return err
+	}
+	if owner != userID {
+		return localErrs.NotFoundErr.WithMsg("device not bound to the user").WithDetails("device", deviceID)
+	}
+
+	if purge && !l.metricRepository.SupportsDeletes() {
+		return localErrs.NotImplementedErr.WithMsg("the metric store doesn't support purging measurements")
+	}
+
+	// the device stays bound until its measurements are purged, so a failed
+	// purge can be retried by its owner
+	if purge {
+		err = l.metricRepository.DeleteMeasurements(ctx, models.MeasurementQuery{SensorID: deviceID, From: purgeFrom, To: purgeTo})
+		if err != nil {
+			return err
+		}
+	}
+
+	err = l.userDeviceRepository.RemoveDeviceFromUser(ctx, userID, deviceID)
+	if err != nil {
+		return err
+	}
+
+	l.publish(ctx, newEvent(models.EventDeviceRemoved, userID, map[string]any{"device_id": deviceID, "purged": purge}))
+	return nil
+}
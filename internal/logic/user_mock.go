@@ -36,7 +36,7 @@ func (m *MockUserLogic) EXPECT() *MockUserLogicMockRecorder {
 }
 
 // AddDevice mocks base method.
-func (m *MockUserLogic) AddDevice(arg0 context.Context, arg1, arg2 string) error {
+func (m *MockUserLogic) AddDevice(arg0 context.Context, arg1 string, arg2 models.Device) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "AddDevice", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
@@ -64,10 +64,10 @@ func (mr *MockUserLogicMockRecorder) CreateAccount(arg0, arg1 interface{}) *gomo
 }
 
 // GetDevices mocks base method.
-func (m *MockUserLogic) GetDevices(arg0 context.Context, arg1 string) ([]string, error) {
+func (m *MockUserLogic) GetDevices(arg0 context.Context, arg1 string) ([]models.Device, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetDevices", arg0, arg1)
-	ret0, _ := ret[0].([]string)
+	ret0, _ := ret[0].([]models.Device)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -92,3 +92,32 @@ func (mr *MockUserLogicMockRecorder) Login(arg0, arg1 interface{}) *gomock.Call
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Login", reflect.TypeOf((*MockUserLogic)(nil).Login), arg0, arg1)
 }
+
+// RemoveDevice mocks base method.
+func (m *MockUserLogic) RemoveDevice(arg0 context.Context, arg1, arg2 string, arg3 bool) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveDevice", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveDevice indicates an expected call of RemoveDevice.
+func (mr *MockUserLogicMockRecorder) RemoveDevice(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveDevice", reflect.TypeOf((*MockUserLogic)(nil).RemoveDevice), arg0, arg1, arg2, arg3)
+}
+
+// UpdateDevice mocks base method.
+func (m *MockUserLogic) UpdateDevice(arg0 context.Context, arg1, arg2 string, arg3 models.DeviceUpdate) (models.Device, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateDevice", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(models.Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateDevice indicates an expected call of UpdateDevice.
+func (mr *MockUserLogicMockRecorder) UpdateDevice(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateDevice", reflect.TypeOf((*MockUserLogic)(nil).UpdateDevice), arg0, arg1, arg2, arg3)
+}
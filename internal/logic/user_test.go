@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/services"
 	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
@@ -43,7 +44,7 @@ func TestCreateAccount(t *testing.T) {
 				userService.EXPECT().GetUser(gomock.Any(), baseAccount.Email).Return(baseAccountWithID, nil).Times(1)
 				userService.EXPECT().AssignRoleToUser(gomock.Any(), roleID, baseAccountWithID.ID).Return(nil).Times(1)
 				authService := services.NewMockAuthenticator(ctrl)
-				return NewUserLogic(userService, authService, nil, roleID)
+				return NewUserLogic(userService, authService, nil, nil, roleID)
 			},
 			givenAccount: baseAccount,
 			assert: func(t *testing.T, err error) {
@@ -57,7 +58,7 @@ func TestCreateAccount(t *testing.T) {
 				userService := services.NewMockUserService(ctrl)
 				userService.EXPECT().CreateAccount(gomock.Any(), baseAccount).Return(errors.New("random error")).Times(1)
 				authService := services.NewMockAuthenticator(ctrl)
-				return NewUserLogic(userService, authService, nil, roleID)
+				return NewUserLogic(userService, authService, nil, nil, roleID)
 			},
 			givenAccount: baseAccount,
 			assert: func(t *testing.T, err error) {
@@ -72,7 +73,7 @@ func TestCreateAccount(t *testing.T) {
 				userService.EXPECT().CreateAccount(gomock.Any(), baseAccount).Return(nil).Times(1)
 				userService.EXPECT().GetUser(gomock.Any(), baseAccount.Email).Return(baseAccountWithID, errors.New("random error")).Times(1)
 				authService := services.NewMockAuthenticator(ctrl)
-				return NewUserLogic(userService, authService, nil, roleID)
+				return NewUserLogic(userService, authService, nil, nil, roleID)
 			},
 			givenAccount: baseAccount,
 			assert: func(t *testing.T, err error) {
@@ -88,7 +89,7 @@ func TestCreateAccount(t *testing.T) {
 				userService.EXPECT().GetUser(gomock.Any(), baseAccount.Email).Return(baseAccountWithID, nil).Times(1)
 				userService.EXPECT().AssignRoleToUser(gomock.Any(), roleID, baseAccountWithID.ID).Return(errors.New("random error")).Times(1)
 				authService := services.NewMockAuthenticator(ctrl)
-				return NewUserLogic(userService, authService, nil, roleID)
+				return NewUserLogic(userService, authService, nil, nil, roleID)
 			},
 			givenAccount: baseAccount,
 			assert: func(t *testing.T, err error) {
@@ -148,7 +149,7 @@ func TestLogin(t *testing.T) {
 				userService.EXPECT().GetRolePermissions(gomock.Any(), baseAccount.Role).Return(scope, nil).Times(1)
 				authService := services.NewMockAuthenticator(ctrl)
 				authService.EXPECT().SignIn(gomock.Any(), credentialsWithScope).Return(baseToken, nil).Times(1)
-				return NewUserLogic(userService, authService, nil, roleID)
+				return NewUserLogic(userService, authService, nil, nil, roleID)
 			},
 			givenCredentials: basicCredentials,
 			assert: func(t *testing.T, token models.Token, err error) {
@@ -163,7 +164,7 @@ func TestLogin(t *testing.T) {
 				userService := services.NewMockUserService(ctrl)
 				userService.EXPECT().GetUser(gomock.Any(), basicCredentials.Email).Return(accountWithoutEmailVerified, nil).Times(1)
 				authService := services.NewMockAuthenticator(ctrl)
-				return NewUserLogic(userService, authService, nil, roleID)
+				return NewUserLogic(userService, authService, nil, nil, roleID)
 			},
 			givenCredentials: basicCredentials,
 			assert: func(t *testing.T, token models.Token, err error) {
@@ -179,7 +180,7 @@ func TestLogin(t *testing.T) {
 				userService := services.NewMockUserService(ctrl)
 				userService.EXPECT().GetUser(gomock.Any(), basicCredentials.Email).Return(baseAccount, errors.New("random error")).Times(1)
 				authService := services.NewMockAuthenticator(ctrl)
-				return NewUserLogic(userService, authService, nil, roleID)
+				return NewUserLogic(userService, authService, nil, nil, roleID)
 			},
 			givenCredentials: basicCredentials,
 			assert: func(t *testing.T, token models.Token, err error) {
@@ -195,7 +196,7 @@ func TestLogin(t *testing.T) {
 				userService.EXPECT().GetUser(gomock.Any(), basicCredentials.Email).Return(baseAccount, nil).Times(1)
 				userService.EXPECT().GetRolePermissions(gomock.Any(), baseAccount.Role).Return("", errors.New("random error")).Times(1)
 				authService := services.NewMockAuthenticator(ctrl)
-				return NewUserLogic(userService, authService, nil, roleID)
+				return NewUserLogic(userService, authService, nil, nil, roleID)
 			},
 			givenCredentials: basicCredentials,
 			assert: func(t *testing.T, token models.Token, err error) {
@@ -212,7 +213,7 @@ func TestLogin(t *testing.T) {
 				userService.EXPECT().GetRolePermissions(gomock.Any(), baseAccount.Role).Return(scope, nil).Times(1)
 				authService := services.NewMockAuthenticator(ctrl)
 				authService.EXPECT().SignIn(gomock.Any(), credentialsWithScope).Return(models.Token{}, errors.New("random error")).Times(1)
-				return NewUserLogic(userService, authService, nil, roleID)
+				return NewUserLogic(userService, authService, nil, nil, roleID)
 			},
 			givenCredentials: basicCredentials,
 			assert: func(t *testing.T, token models.Token, err error) {
@@ -237,36 +238,32 @@ func TestLogin(t *testing.T) {
 func TestAddDevice(t *testing.T) {
 	userID := uuid.NewString()
 	deviceID := uuid.NewString()
+	device := models.Device{ID: deviceID, DeviceMetadata: models.DeviceMetadata{Name: "lettuce", SystemType: models.SystemNFT}}
+	// the device is created now
+	created := func(t *testing.T, given models.Device) {
+		assert.Equal(t, device.DeviceMetadata, given.DeviceMetadata)
+		assert.Equal(t, deviceID, given.ID)
+		assert.WithinDuration(t, time.Now(), given.CreatedAt, time.Minute)
+	}
 	var tests = []struct {
 		name        string
 		setup       func(ctrl *gomock.Controller) UserLogic
 		givenUserID string
-		givenDevice string
+		givenDevice models.Device
 		assert      func(t *testing.T, err error)
 	}{
-		{
-			name: "failed to retrieve user devices",
-			setup: func(ctrl *gomock.Controller) UserLogic {
-				repository := storage.NewMockUserDeviceRepository(ctrl)
-				repository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return(make([]string, 0), errors.New("random error"))
-				return NewUserLogic(nil, nil, repository, "")
-			},
-			givenUserID: userID,
-			givenDevice: deviceID,
-			assert: func(t *testing.T, err error) {
-				assert.NotNil(t, err)
-			},
-		},
 		{
 			name: "add new user device with success",
 			setup: func(ctrl *gomock.Controller) UserLogic {
 				repository := storage.NewMockUserDeviceRepository(ctrl)
-				repository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return(make([]string, 0), localErrs.NotFoundErr)
-				repository.EXPECT().CreateUserDevice(gomock.Any(), userID, deviceID).Return(nil)
-				return NewUserLogic(nil, nil, repository, "")
+				repository.EXPECT().AddDeviceToUser(gomock.Any(), userID, gomock.Any()).DoAndReturn(func(_ context.Context, _ string, given models.Device) error {
+					created(t, given)
+					return nil
+				})
+				return NewUserLogic(nil, nil, repository, nil, "")
 			},
 			givenUserID: userID,
-			givenDevice: deviceID,
+			givenDevice: device,
 			assert: func(t *testing.T, err error) {
 				assert.Nil(t, err)
 			},
@@ -275,29 +272,28 @@ func TestAddDevice(t *testing.T) {
 			name: "failed to add new user device",
 			setup: func(ctrl *gomock.Controller) UserLogic {
 				repository := storage.NewMockUserDeviceRepository(ctrl)
-				repository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return(make([]string, 0), localErrs.NotFoundErr)
-				repository.EXPECT().CreateUserDevice(gomock.Any(), userID, deviceID).Return(errors.New("random error"))
-				return NewUserLogic(nil, nil, repository, "")
+				repository.EXPECT().AddDeviceToUser(gomock.Any(), userID, gomock.Any()).Return(errors.New("random error"))
+				return NewUserLogic(nil, nil, repository, nil, "")
 			},
 			givenUserID: userID,
-			givenDevice: deviceID,
+			givenDevice: device,
 			assert: func(t *testing.T, err error) {
 				assert.NotNil(t, err)
 			},
 		},
 		{
-			name: "append new user device with success",
+			name: "device owned by another user can't be claimed",
 			setup: func(ctrl *gomock.Controller) UserLogic {
-				oldDevices := []string{"old_device"}
 				repository := storage.NewMockUserDeviceRepository(ctrl)
-				repository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return(oldDevices, nil)
-				repository.EXPECT().AddDeviceToUser(gomock.Any(), userID, deviceID, oldDevices).Return(nil)
-				return NewUserLogic(nil, nil, repository, "")
+				repository.EXPECT().AddDeviceToUser(gomock.Any(), userID, gomock.Any()).Return(localErrs.AlreadyExistsErr)
+				return NewUserLogic(nil, nil, repository, nil, "")
 			},
 			givenUserID: userID,
-			givenDevice: deviceID,
+			givenDevice: device,
 			assert: func(t *testing.T, err error) {
-				assert.Nil(t, err)
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, localErrs.AlreadyExistsErr)
+				}
 			},
 		},
 	}
@@ -314,24 +310,43 @@ func TestAddDevice(t *testing.T) {
 	}
 }
 
+func TestAddDevicePublishesEvent(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userID := uuid.NewString()
+	deviceID := uuid.NewString()
+	repository := storage.NewMockUserDeviceRepository(ctrl)
+	repository.EXPECT().AddDeviceToUser(gomock.Any(), userID, gomock.Any()).Return(nil)
+	listener := NewMockEventListener(ctrl)
+	listener.EXPECT().OnEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, event models.Event) {
+		assert.Equal(t, models.EventDeviceAdded, event.Type)
+		assert.Equal(t, userID, event.UserID)
+		assert.Equal(t, map[string]string{"device_id": deviceID}, event.Data)
+	}).Times(1)
+
+	err := NewUserLogic(nil, nil, repository, nil, "", listener).AddDevice(context.Background(), userID, models.Device{ID: deviceID})
+	assert.Nil(t, err)
+}
+
 func TestGetDevices(t *testing.T) {
 	userID := uuid.NewString()
 	var tests = []struct {
 		name        string
 		setup       func(ctrl *gomock.Controller) UserLogic
 		givenUserID string
-		assert      func(t *testing.T, devices []string, err error)
+		assert      func(t *testing.T, devices []models.Device, err error)
 	}{
 		{
 			name: "get devices with success",
 			setup: func(ctrl *gomock.Controller) UserLogic {
-				oldDevices := []string{"old_device"}
+				oldDevices := []models.Device{{ID: "old_device"}}
 				repository := storage.NewMockUserDeviceRepository(ctrl)
 				repository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return(oldDevices, nil)
-				return NewUserLogic(nil, nil, repository, "")
+				return NewUserLogic(nil, nil, repository, nil, "")
 			},
 			givenUserID: userID,
-			assert: func(t *testing.T, devices []string, err error) {
+			assert: func(t *testing.T, devices []models.Device, err error) {
 				assert.Len(t, devices, 1)
 				assert.Nil(t, err)
 			},
@@ -340,11 +355,11 @@ func TestGetDevices(t *testing.T) {
 			name: "failed to retrieve devices",
 			setup: func(ctrl *gomock.Controller) UserLogic {
 				repository := storage.NewMockUserDeviceRepository(ctrl)
-				repository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]string{}, errors.New("random error"))
-				return NewUserLogic(nil, nil, repository, "")
+				repository.EXPECT().GetDevicesFromUser(gomock.Any(), userID).Return([]models.Device{}, errors.New("random error"))
+				return NewUserLogic(nil, nil, repository, nil, "")
 			},
 			givenUserID: userID,
-			assert: func(t *testing.T, devices []string, err error) {
+			assert: func(t *testing.T, devices []models.Device, err error) {
 				assert.Len(t, devices, 0)
 				assert.NotNil(t, err)
 			},
@@ -362,3 +377,179 @@ func TestGetDevices(t *testing.T) {
 		})
 	}
 }
+
+func TestUpdateDevice(t *testing.T) {
+	userID := uuid.NewString()
+	deviceID := uuid.NewString()
+	name := "lettuce"
+	update := models.DeviceUpdate{Name: &name}
+	var tests = []struct {
+		name   string
+		setup  func(ctrl *gomock.Controller) UserLogic
+		assert func(t *testing.T, device models.Device, err error)
+	}{
+		{
+			name: "update device with success",
+			setup: func(ctrl *gomock.Controller) UserLogic {
+				repository := storage.NewMockUserDeviceRepository(ctrl)
+				repository.EXPECT().UpdateDevice(gomock.Any(), userID, deviceID, update).Return(models.Device{ID: deviceID, DeviceMetadata: models.DeviceMetadata{Name: name}}, nil)
+				listener := NewMockEventListener(ctrl)
+				listener.EXPECT().OnEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, event models.Event) {
+					assert.Equal(t, models.EventDeviceUpdated, event.Type)
+					assert.Equal(t, models.Device{ID: deviceID, DeviceMetadata: models.DeviceMetadata{Name: name}}, event.Data)
+				}).Times(1)
+				return NewUserLogic(nil, nil, repository, nil, "", listener)
+			},
+			assert: func(t *testing.T, device models.Device, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, name, device.Name)
+			},
+		},
+		{
+			name: "device not bound to the user",
+			setup: func(ctrl *gomock.Controller) UserLogic {
+				repository := storage.NewMockUserDeviceRepository(ctrl)
+				repository.EXPECT().UpdateDevice(gomock.Any(), userID, deviceID, update).Return(models.Device{}, localErrs.NotFoundErr)
+				return NewUserLogic(nil, nil, repository, nil, "", NewMockEventListener(ctrl))
+			},
+			assert: func(t *testing.T, device models.Device, err error) {
+				assert.ErrorIs(t, err, localErrs.NotFoundErr)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			logic := tt.setup(ctrl)
+			device, err := logic.UpdateDevice(context.Background(), userID, deviceID, update)
+			tt.assert(t, device, err)
+		})
+	}
+}
+
+func TestRemoveDevice(t *testing.T) {
+	userID := uuid.NewString()
+	deviceID := uuid.NewString()
+	var tests = []struct {
+		name       string
+		setup      func(ctrl *gomock.Controller) UserLogic
+		givenPurge bool
+		assert     func(t *testing.T, err error)
+	}{
+		{
+			name: "remove device keeping its metrics",
+			setup: func(ctrl *gomock.Controller) UserLogic {
+				repository := storage.NewMockUserDeviceRepository(ctrl)
+				repository.EXPECT().GetDeviceOwner(gomock.Any(), deviceID).Return(userID, nil)
+				repository.EXPECT().RemoveDeviceFromUser(gomock.Any(), userID, deviceID).Return(nil)
+				listener := NewMockEventListener(ctrl)
+				listener.EXPECT().OnEvent(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, event models.Event) {
+					assert.Equal(t, models.EventDeviceRemoved, event.Type)
+					assert.Equal(t, map[string]any{"device_id": deviceID, "purged": false}, event.Data)
+				}).Times(1)
+				return NewUserLogic(nil, nil, repository, storage.NewMockMetricRepository(ctrl), "", listener)
+			},
+			assert: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name: "remove device purging its metrics",
+			setup: func(ctrl *gomock.Controller) UserLogic {
+				repository := storage.NewMockUserDeviceRepository(ctrl)
+				repository.EXPECT().GetDeviceOwner(gomock.Any(), deviceID).Return(userID, nil)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().SupportsDeletes().Return(true)
+				gomock.InOrder(
+					metricRepository.EXPECT().DeleteMeasurements(gomock.Any(), models.MeasurementQuery{SensorID: deviceID, From: purgeFrom, To: purgeTo}).Return(nil),
+					repository.EXPECT().RemoveDeviceFromUser(gomock.Any(), userID, deviceID).Return(nil),
+				)
+				return NewUserLogic(nil, nil, repository, metricRepository, "")
+			},
+			givenPurge: true,
+			assert: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name: "device stays bound when the purge fails",
+			setup: func(ctrl *gomock.Controller) UserLogic {
+				repository := storage.NewMockUserDeviceRepository(ctrl)
+				repository.EXPECT().GetDeviceOwner(gomock.Any(), deviceID).Return(userID, nil)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().SupportsDeletes().Return(true)
+				metricRepository.EXPECT().DeleteMeasurements(gomock.Any(), gomock.Any()).Return(localErrs.InternalServerErr)
+				return NewUserLogic(nil, nil, repository, metricRepository, "")
+			},
+			givenPurge: true,
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.InternalServerErr)
+			},
+		},
+		{
+			name: "device stays bound when the metric store can't purge",
+			setup: func(ctrl *gomock.Controller) UserLogic {
+				repository := storage.NewMockUserDeviceRepository(ctrl)
+				repository.EXPECT().GetDeviceOwner(gomock.Any(), deviceID).Return(userID, nil)
+				metricRepository := storage.NewMockMetricRepository(ctrl)
+				metricRepository.EXPECT().SupportsDeletes().Return(false)
+				return NewUserLogic(nil, nil, repository, metricRepository, "")
+			},
+			givenPurge: true,
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.NotImplementedErr)
+			},
+		},
+		{
+			name: "device owned by another user",
+			setup: func(ctrl *gomock.Controller) UserLogic {
+				repository := storage.NewMockUserDeviceRepository(ctrl)
+				repository.EXPECT().GetDeviceOwner(gomock.Any(), deviceID).Return(uuid.NewString(), nil)
+				return NewUserLogic(nil, nil, repository, nil, "")
+			},
+			givenPurge: true,
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.NotFoundErr)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			logic := tt.setup(ctrl)
+			err := logic.RemoveDevice(context.Background(), userID, deviceID, tt.givenPurge)
+			tt.assert(t, err)
+		})
+	}
+}
+
+func TestRemoveDeviceRetriesFailedPurge(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userID := uuid.NewString()
+	deviceID := uuid.NewString()
+	query := models.MeasurementQuery{SensorID: deviceID, From: purgeFrom, To: purgeTo}
+	repository := storage.NewMockUserDeviceRepository(ctrl)
+	repository.EXPECT().GetDeviceOwner(gomock.Any(), deviceID).Return(userID, nil).Times(2)
+	metricRepository := storage.NewMockMetricRepository(ctrl)
+	metricRepository.EXPECT().SupportsDeletes().Return(true).Times(2)
+	gomock.InOrder(
+		metricRepository.EXPECT().DeleteMeasurements(gomock.Any(), query).Return(localErrs.ServiceUnavailableErr),
+		metricRepository.EXPECT().DeleteMeasurements(gomock.Any(), query).Return(nil),
+		repository.EXPECT().RemoveDeviceFromUser(gomock.Any(), userID, deviceID).Return(nil),
+	)
+	logic := NewUserLogic(nil, nil, repository, metricRepository, "")
+
+	err := logic.RemoveDevice(context.Background(), userID, deviceID, true)
+	assert.ErrorIs(t, err, localErrs.ServiceUnavailableErr)
+	// the device is still owned by the user, so the purge can be retried
+	err = logic.RemoveDevice(context.Background(), userID, deviceID, true)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,279 @@
+package logic
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/services"
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+const (
+	// webhookAttempts is the amount of times an event is sent before giving up
+	webhookAttempts = 5
+	// webhookTimeout limits how long a single attempt may take
+	webhookTimeout = 10 * time.Second
+	// maxWebhookFailures is the amount of consecutive failed deliveries before disabling the webhook
+	maxWebhookFailures = 10
+)
+
+// EventListener is notified with the domain events produced by the logic layer
+type EventListener interface {
+	OnEvent(ctx context.Context, event models.Event)
+}
+
+// newEvent builds a domain event happening now
+func newEvent(eventType, userID string, data any) models.Event {
+	return models.Event{
+		ID:     uuid.NewString(),
+		Type:   eventType,
+		UserID: userID,
+		Time:   time.Now().UTC(),
+		Data:   data,
+	}
+}
+
+// WebhookLogic contain webhook correlated logic, events are delivered
+// asynchronously to the enabled user webhooks subscribed to them
+//
+//go:generate mockgen -destination webhooks_mock.go -package logic github.com/WendelHime/hydroponics-metrics-collector/internal/logic WebhookLogic,EventListener
+type WebhookLogic interface {
+	MetricListener
+	EventListener
+	CreateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error)
+	GetWebhooks(ctx context.Context, userID string) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, userID, webhookID string) error
+	GetDeliveries(ctx context.Context, userID, webhookID string) ([]models.WebhookDelivery, error)
+	// Wait blocks until the pending deliveries are finished, the failed ones
+	// aren't retried anymore once ctx is done
+	Wait(ctx context.Context)
+}
+
+type webhookLogic struct {
+	webhookRepository storage.WebhookRepository
+	sender            services.WebhookSender
+	backoff           time.Duration
+	pending           sync.WaitGroup
+	// ctx is canceled to stop the retries
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewWebhookLogic builds the webhook logic, backoff is the delay before the
+// first retry and it doubles after every failed attempt
+func NewWebhookLogic(webhookRepository storage.WebhookRepository, sender services.WebhookSender, backoff time.Duration) WebhookLogic {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &webhookLogic{webhookRepository: webhookRepository, sender: sender, backoff: backoff, ctx: ctx, cancel: cancel}
+}
+
+func generateSecret() (string, error) {
+	secret := make([]byte, 32)
+	_, err := rand.Read(secret)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(secret), nil
+}
+
+func (l *webhookLogic) CreateWebhook(ctx context.Context, webhook models.Webhook) (models.Webhook, error) {
+	err := l.sender.Check(ctx, webhook.URL)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	secret, err := generateSecret()
+	if err != nil {
+		return models.Webhook{}, localErrs.InternalServerErr.WithMsg("failed to generate webhook secret").WithErr(err)
+	}
+
+	webhook.ID = uuid.NewString()
+	webhook.Secret = secret
+	webhook.Enabled = true
+	webhook.ConsecutiveFailures = 0
+	webhook.CreatedAt = time.Now().UTC()
+	err = l.webhookRepository.CreateWebhook(ctx, webhook)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	// the secret is only returned when the webhook is created
+	return webhook, nil
+}
+
+func (l *webhookLogic) GetWebhooks(ctx context.Context, userID string) ([]models.Webhook, error) {
+	webhooks, err := l.webhookRepository.GetWebhooksFromUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range webhooks {
+		webhooks[i].Secret = ""
+	}
+	return webhooks, nil
+}
+
+// getUserWebhook returns the webhook, making sure it belongs to the user
+func (l *webhookLogic) getUserWebhook(ctx context.Context, userID, webhookID string) (models.Webhook, error) {
+	webhook, err := l.webhookRepository.GetWebhook(ctx, webhookID)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	if webhook.UserID != userID {
+		return models.Webhook{}, localErrs.NotFoundErr.WithMsg("webhook not found")
+	}
+	return webhook, nil
+}
+
+func (l *webhookLogic) DeleteWebhook(ctx context.Context, userID, webhookID string) error {
+	_, err := l.getUserWebhook(ctx, userID, webhookID)
+	if err != nil {
+		return err
+	}
+
+	return l.webhookRepository.DeleteWebhook(ctx, webhookID)
+}
+
+func (l *webhookLogic) GetDeliveries(ctx context.Context, userID, webhookID string) ([]models.WebhookDelivery, error) {
+	_, err := l.getUserWebhook(ctx, userID, webhookID)
+	if err != nil {
+		return nil, err
+	}
+
+	return l.webhookRepository.GetDeliveries(ctx, webhookID)
+}
+
+// OnSensorMetrics publishes a metrics accepted event per user
+func (l *webhookLogic) OnSensorMetrics(ctx context.Context, metrics []models.SensorRequest) {
+	metricsByUser := make(map[string][]models.SensorRequest)
+	for _, metric := range metrics {
+		metricsByUser[metric.UserID] = append(metricsByUser[metric.UserID], metric)
+	}
+
+	for userID, userMetrics := range metricsByUser {
+		l.OnEvent(ctx, newEvent(models.EventMetricsAccepted, userID, userMetrics))
+	}
+}
+
+func (l *webhookLogic) OnEvent(ctx context.Context, event models.Event) {
+	webhooks, err := l.webhookRepository.GetWebhooksFromUser(ctx, event.UserID)
+	if err != nil {
+		log.Error().Err(err).Str("userID", event.UserID).Msg("failed to retrieve webhooks")
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Error().Err(err).Str("event", event.Type).Msg("failed to encode event")
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Enabled || !slices.Contains(webhook.Events, event.Type) {
+			continue
+		}
+
+		// deliveries outlive the request that produced the event
+		l.pending.Add(1)
+		go func(webhook models.Webhook) {
+			defer l.pending.Done()
+			l.deliver(l.ctx, webhook, event, payload)
+		}(webhook)
+	}
+}
+
+func (l *webhookLogic) Wait(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		l.pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		l.cancel()
+		<-done
+	}
+}
+
+// deliver sends the payload with exponential backoff until ctx is done,
+// recording the delivery and disabling the webhook after too many
+// consecutive failures
+func (l *webhookLogic) deliver(ctx context.Context, webhook models.Webhook, event models.Event, payload []byte) {
+	delivery := models.WebhookDelivery{
+		ID:        uuid.NewString(),
+		WebhookID: webhook.ID,
+		EventID:   event.ID,
+		EventType: event.Type,
+	}
+
+	backoff := l.backoff
+	for delivery.Attempts < webhookAttempts {
+		if delivery.Attempts > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			backoff *= 2
+		}
+		delivery.Attempts++
+
+		attemptCtx, cancel := context.WithTimeout(ctx, webhookTimeout)
+		statusCode, err := l.sender.Send(attemptCtx, webhook.URL, webhook.Secret, payload)
+		cancel()
+		delivery.StatusCode = statusCode
+		if err == nil {
+			delivery.Success = true
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+	}
+	delivery.Time = time.Now().UTC()
+
+	// the outcome is recorded even when the retries were stopped
+	ctx = context.WithoutCancel(ctx)
+	err := l.webhookRepository.AddDelivery(ctx, delivery)
+	if err != nil {
+		log.Error().Err(err).Str("webhookID", webhook.ID).Msg("failed to record webhook delivery")
+	}
+
+	if delivery.Success {
+		if webhook.ConsecutiveFailures > 0 {
+			err = l.webhookRepository.ResetFailures(ctx, webhook.ID)
+			if err != nil {
+				log.Error().Err(err).Str("webhookID", webhook.ID).Msg("failed to reset webhook failures")
+			}
+		}
+		return
+	}
+
+	failures, err := l.webhookRepository.IncrementFailures(ctx, webhook.ID)
+	if err != nil {
+		log.Error().Err(err).Str("webhookID", webhook.ID).Msg("failed to increment webhook failures")
+		return
+	}
+	if failures >= maxWebhookFailures {
+		log.Warn().Str("webhookID", webhook.ID).Int("failures", failures).Msg("disabling webhook after consecutive failures")
+		err = l.webhookRepository.DisableWebhook(ctx, webhook.ID)
+		if err != nil {
+			log.Error().Err(err).Str("webhookID", webhook.ID).Msg("failed to disable webhook")
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: github.com/WendelHime/hydroponics-metrics-collector/internal/logic (interfaces: WebhookLogic,EventListener)
+
+// Package logic is a generated GoMock package.
+package logic
+
+import (
+	context "context"
+	reflect "reflect"
+
+	models "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	gomock "go.uber.org/mock/gomock"
+)
+
+// MockWebhookLogic is a mock of WebhookLogic interface.
+type MockWebhookLogic struct {
+	ctrl     *gomock.Controller
+	recorder *MockWebhookLogicMockRecorder
+}
+
+// MockWebhookLogicMockRecorder is the mock recorder for MockWebhookLogic.
+type MockWebhookLogicMockRecorder struct {
+	mock *MockWebhookLogic
+}
+
+// NewMockWebhookLogic creates a new mock instance.
+func NewMockWebhookLogic(ctrl *gomock.Controller) *MockWebhookLogic {
+	mock := &MockWebhookLogic{ctrl: ctrl}
+	mock.recorder = &MockWebhookLogicMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockWebhookLogic) EXPECT() *MockWebhookLogicMockRecorder {
+	return m.recorder
+}
+
+// CreateWebhook mocks base method.
+func (m *MockWebhookLogic) CreateWebhook(arg0 context.Context, arg1 models.Webhook) (models.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateWebhook", arg0, arg1)
+	ret0, _ := ret[0].(models.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateWebhook indicates an expected call of CreateWebhook.
+func (mr *MockWebhookLogicMockRecorder) CreateWebhook(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateWebhook", reflect.TypeOf((*MockWebhookLogic)(nil).CreateWebhook), arg0, arg1)
+}
+
+// DeleteWebhook mocks base method.
+func (m *MockWebhookLogic) DeleteWebhook(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteWebhook", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteWebhook indicates an expected call of DeleteWebhook.
+func (mr *MockWebhookLogicMockRecorder) DeleteWebhook(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteWebhook", reflect.TypeOf((*MockWebhookLogic)(nil).DeleteWebhook), arg0, arg1, arg2)
+}
+
+// GetDeliveries mocks base method.
+func (m *MockWebhookLogic) GetDeliveries(arg0 context.Context, arg1, arg2 string) ([]models.WebhookDelivery, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeliveries", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]models.WebhookDelivery)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeliveries indicates an expected call of GetDeliveries.
+func (mr *MockWebhookLogicMockRecorder) GetDeliveries(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeliveries", reflect.TypeOf((*MockWebhookLogic)(nil).GetDeliveries), arg0, arg1, arg2)
+}
+
+// GetWebhooks mocks base method.
+func (m *MockWebhookLogic) GetWebhooks(arg0 context.Context, arg1 string) ([]models.Webhook, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetWebhooks", arg0, arg1)
+	ret0, _ := ret[0].([]models.Webhook)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetWebhooks indicates an expected call of GetWebhooks.
+func (mr *MockWebhookLogicMockRecorder) GetWebhooks(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetWebhooks", reflect.TypeOf((*MockWebhookLogic)(nil).GetWebhooks), arg0, arg1)
+}
+
+// OnEvent mocks base method.
+func (m *MockWebhookLogic) OnEvent(arg0 context.Context, arg1 models.Event) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnEvent", arg0, arg1)
+}
+
+// OnEvent indicates an expected call of OnEvent.
+func (mr *MockWebhookLogicMockRecorder) OnEvent(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnEvent", reflect.TypeOf((*MockWebhookLogic)(nil).OnEvent), arg0, arg1)
+}
+
+// OnSensorMetrics mocks base method.
+func (m *MockWebhookLogic) OnSensorMetrics(arg0 context.Context, arg1 []models.SensorRequest) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnSensorMetrics", arg0, arg1)
+}
+
+// OnSensorMetrics indicates an expected call of OnSensorMetrics.
+func (mr *MockWebhookLogicMockRecorder) OnSensorMetrics(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnSensorMetrics", reflect.TypeOf((*MockWebhookLogic)(nil).OnSensorMetrics), arg0, arg1)
+}
+
+// Wait mocks base method.
+func (m *MockWebhookLogic) Wait(arg0 context.Context) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Wait", arg0)
+}
+
+// Wait indicates an expected call of Wait.
+func (mr *MockWebhookLogicMockRecorder) Wait(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Wait", reflect.TypeOf((*MockWebhookLogic)(nil).Wait), arg0)
+}
+
+// MockEventListener is a mock of EventListener interface.
+type MockEventListener struct {
+	ctrl     *gomock.Controller
+	recorder *MockEventListenerMockRecorder
+}
+
+// MockEventListenerMockRecorder is the mock recorder for MockEventListener.
+type MockEventListenerMockRecorder struct {
+	mock *MockEventListener
+}
+
+// NewMockEventListener creates a new mock instance.
+func NewMockEventListener(ctrl *gomock.Controller) *MockEventListener {
+	mock := &MockEventListener{ctrl: ctrl}
+	mock.recorder = &MockEventListenerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockEventListener) EXPECT() *MockEventListenerMockRecorder {
+	return m.recorder
+}
+
+// OnEvent mocks base method.
+func (m *MockEventListener) OnEvent(arg0 context.Context, arg1 models.Event) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "OnEvent", arg0, arg1)
+}
+
+// OnEvent indicates an expected call of OnEvent.
+func (mr *MockEventListenerMockRecorder) OnEvent(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "OnEvent", reflect.TypeOf((*MockEventListener)(nil).OnEvent), arg0, arg1)
+}
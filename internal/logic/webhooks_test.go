@@ -0,0 +1,195 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/services"
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+)
+
+func TestCreateWebhook(t *testing.T) {
+	var tests = []struct {
+		name   string
+		setup  func(webhookRepository *storage.MockWebhookRepository, sender *services.MockWebhookSender)
+		assert func(t *testing.T, webhook models.Webhook, err error)
+	}{
+		{
+			name: "create webhook with success",
+			setup: func(webhookRepository *storage.MockWebhookRepository, sender *services.MockWebhookSender) {
+				sender.EXPECT().Check(gomock.Any(), "https://example.com/hook").Return(nil).Times(1)
+				webhookRepository.EXPECT().CreateWebhook(gomock.Any(), gomock.Any()).Return(nil).Times(1)
+			},
+			assert: func(t *testing.T, webhook models.Webhook, err error) {
+				assert.Nil(t, err)
+				assert.NotEmpty(t, webhook.ID)
+				assert.Len(t, webhook.Secret, 64)
+				assert.True(t, webhook.Enabled)
+			},
+		},
+		{
+			name: "webhooks to internal addresses are rejected",
+			setup: func(webhookRepository *storage.MockWebhookRepository, sender *services.MockWebhookSender) {
+				sender.EXPECT().Check(gomock.Any(), "https://example.com/hook").Return(localErrs.BadRequestErr).Times(1)
+			},
+			assert: func(t *testing.T, webhook models.Webhook, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			webhookRepository := storage.NewMockWebhookRepository(ctrl)
+			sender := services.NewMockWebhookSender(ctrl)
+			tt.setup(webhookRepository, sender)
+
+			webhook, err := NewWebhookLogic(webhookRepository, sender, 0).CreateWebhook(context.Background(), models.Webhook{
+				UserID: uuid.NewString(),
+				URL:    "https://example.com/hook",
+				Events: []string{models.EventDeviceAdded},
+			})
+			tt.assert(t, webhook, err)
+		})
+	}
+}
+
+func TestWebhookOnEvent(t *testing.T) {
+	userID := uuid.NewString()
+	subscribed := models.Webhook{ID: uuid.NewString(), UserID: userID, URL: "https://example.com/1", Secret: "secret", Events: []string{models.EventDeviceAdded}, Enabled: true}
+	unsubscribed := models.Webhook{ID: uuid.NewString(), UserID: userID, URL: "https://example.com/2", Events: []string{models.EventMetricsAccepted}, Enabled: true}
+	disabled := models.Webhook{ID: uuid.NewString(), UserID: userID, URL: "https://example.com/3", Events: []string{models.EventDeviceAdded}}
+	failing := models.Webhook{ID: uuid.NewString(), UserID: userID, URL: "https://example.com/4", Events: []string{models.EventDeviceAdded}, Enabled: true, ConsecutiveFailures: maxWebhookFailures - 1}
+	var tests = []struct {
+		name  string
+		setup func(ctrl *gomock.Controller) WebhookLogic
+	}{
+		{
+			name: "only enabled webhooks subscribed to the event are delivered",
+			setup: func(ctrl *gomock.Controller) WebhookLogic {
+				webhookRepository := storage.NewMockWebhookRepository(ctrl)
+				webhookRepository.EXPECT().GetWebhooksFromUser(gomock.Any(), userID).Return([]models.Webhook{subscribed, unsubscribed, disabled}, nil).Times(1)
+				webhookRepository.EXPECT().AddDelivery(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, delivery models.WebhookDelivery) error {
+					assert.Equal(t, subscribed.ID, delivery.WebhookID)
+					assert.True(t, delivery.Success)
+					assert.Equal(t, 1, delivery.Attempts)
+					return nil
+				}).Times(1)
+				sender := services.NewMockWebhookSender(ctrl)
+				sender.EXPECT().Send(gomock.Any(), subscribed.URL, subscribed.Secret, gomock.Any()).Return(http.StatusOK, nil).Times(1)
+				return NewWebhookLogic(webhookRepository, sender, 0)
+			},
+		},
+		{
+			name: "failed attempts are retried",
+			setup: func(ctrl *gomock.Controller) WebhookLogic {
+				webhookRepository := storage.NewMockWebhookRepository(ctrl)
+				webhookRepository.EXPECT().GetWebhooksFromUser(gomock.Any(), userID).Return([]models.Webhook{subscribed}, nil).Times(1)
+				webhookRepository.EXPECT().AddDelivery(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, delivery models.WebhookDelivery) error {
+					assert.True(t, delivery.Success)
+					assert.Equal(t, 3, delivery.Attempts)
+					return nil
+				}).Times(1)
+				sender := services.NewMockWebhookSender(ctrl)
+				gomock.InOrder(
+					sender.EXPECT().Send(gomock.Any(), subscribed.URL, subscribed.Secret, gomock.Any()).Return(http.StatusBadGateway, errors.New("bad gateway")).Times(2),
+					sender.EXPECT().Send(gomock.Any(), subscribed.URL, subscribed.Secret, gomock.Any()).Return(http.StatusOK, nil).Times(1),
+				)
+				return NewWebhookLogic(webhookRepository, sender, 0)
+			},
+		},
+		{
+			name: "webhook is disabled after too many consecutive failures",
+			setup: func(ctrl *gomock.Controller) WebhookLogic {
+				webhookRepository := storage.NewMockWebhookRepository(ctrl)
+				webhookRepository.EXPECT().GetWebhooksFromUser(gomock.Any(), userID).Return([]models.Webhook{failing}, nil).Times(1)
+				webhookRepository.EXPECT().AddDelivery(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, delivery models.WebhookDelivery) error {
+					assert.False(t, delivery.Success)
+					assert.Equal(t, webhookAttempts, delivery.Attempts)
+					assert.Equal(t, "connection refused", delivery.Error)
+					return nil
+				}).Times(1)
+				webhookRepository.EXPECT().IncrementFailures(gomock.Any(), failing.ID).Return(maxWebhookFailures, nil).Times(1)
+				webhookRepository.EXPECT().DisableWebhook(gomock.Any(), failing.ID).Return(nil).Times(1)
+				sender := services.NewMockWebhookSender(ctrl)
+				sender.EXPECT().Send(gomock.Any(), failing.URL, gomock.Any(), gomock.Any()).Return(0, errors.New("connection refused")).Times(webhookAttempts)
+				return NewWebhookLogic(webhookRepository, sender, 0)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			logic := tt.setup(ctrl)
+			logic.OnEvent(context.Background(), newEvent(models.EventDeviceAdded, userID, nil))
+			logic.Wait(context.Background())
+		})
+	}
+}
+
+func TestWebhookWaitStopsRetries(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	userID := uuid.NewString()
+	webhook := models.Webhook{ID: uuid.NewString(), UserID: userID, URL: "https://example.com/1", Events: []string{models.EventDeviceAdded}, Enabled: true}
+	webhookRepository := storage.NewMockWebhookRepository(ctrl)
+	webhookRepository.EXPECT().GetWebhooksFromUser(gomock.Any(), userID).Return([]models.Webhook{webhook}, nil).Times(1)
+	attempted := make(chan struct{})
+	sender := services.NewMockWebhookSender(ctrl)
+	sender.EXPECT().Send(gomock.Any(), webhook.URL, gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _, _ string, _ []byte) (int, error) {
+		close(attempted)
+		return 0, errors.New("connection refused")
+	}).Times(1)
+	// the outcome is still recorded once the retries are stopped
+	webhookRepository.EXPECT().AddDelivery(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, delivery models.WebhookDelivery) error {
+		assert.Nil(t, ctx.Err())
+		assert.False(t, delivery.Success)
+		assert.Equal(t, 1, delivery.Attempts)
+		return nil
+	}).Times(1)
+	webhookRepository.EXPECT().IncrementFailures(gomock.Any(), webhook.ID).Return(1, nil).Times(1)
+
+	logic := NewWebhookLogic(webhookRepository, sender, time.Hour)
+	logic.OnEvent(context.Background(), newEvent(models.EventDeviceAdded, userID, nil))
+	<-attempted
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	done := make(chan struct{})
+	go func() {
+		logic.Wait(ctx)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("retries weren't stopped")
+	}
+}
+
+func TestGetDeliveriesFromAnotherUser(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	webhookID := uuid.NewString()
+	webhookRepository := storage.NewMockWebhookRepository(ctrl)
+	webhookRepository.EXPECT().GetWebhook(gomock.Any(), webhookID).Return(models.Webhook{ID: webhookID, UserID: uuid.NewString()}, nil).Times(1)
+
+	_, err := NewWebhookLogic(webhookRepository, nil, 0).GetDeliveries(context.Background(), uuid.NewString(), webhookID)
+	assert.Error(t, err)
+}
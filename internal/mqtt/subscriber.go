@@ -0,0 +1,224 @@
+// Package mqtt ingests the sensor metrics published by the devices to an MQTT broker
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+	"github.com/rs/zerolog/log"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/batch"
+)
+
+// qos is the quality of service of the subscription, messages are delivered
+// at least once so the broker keeps them while the subscriber is away
+const qos = 1
+
+// handleTimeout bounds how long a message can take to be written
+const handleTimeout = 30 * time.Second
+
+// Config holds the broker connection and the topic pattern the devices
+// publish to. The broker ACLs are expected to only allow each device to
+// publish to its own topic, the payloads must still carry the device token.
+type Config struct {
+	// BrokerURL like tcp://localhost:1883 or ssl://broker:8883
+	BrokerURL string
+	// ClientID must be unique per instance, the broker disconnects the
+	// clients connecting with an ID already in use
+	ClientID string
+	Username string
+	Password string
+	// Topic must contain the {userID} and {sensorID} placeholders as whole
+	// levels, DefaultTopic is used when empty
+	Topic string
+	// SharedGroup subscribes through a shared subscription, so the messages are
+	// split between the service instances instead of written by each of them
+	SharedGroup string
+}
+
+// Subscriber writes the metrics received from the broker through the metric
+// logic, once the token of the device publishing them is verified. Many
+// messages are written at once and acknowledged in the order they arrived
+type Subscriber struct {
+	logic    logic.MetricLogic
+	tokens   logic.DeviceTokenLogic
+	topic    topicPattern
+	filter   string
+	client   paho.Client
+	pipeline *batch.Pipeline
+}
+
+func NewSubscriber(config Config, metricLogic logic.MetricLogic, tokens logic.DeviceTokenLogic) (*Subscriber, error) {
+	if len(config.Topic) == 0 {
+		config.Topic = DefaultTopic
+	}
+	topic, err := parseTopicPattern(config.Topic)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Subscriber{
+		logic:    metricLogic,
+		tokens:   tokens,
+		topic:    topic,
+		filter:   topic.filter(),
+		pipeline: batch.NewPipeline(batch.DefaultInFlight),
+	}
+	if len(config.SharedGroup) > 0 {
+		s.filter = "$share/" + config.SharedGroup + "/" + s.filter
+	}
+
+	// sessions are kept by the broker, so the messages published while the
+	// subscriber is reconnecting are still delivered, as the ones that weren't
+	// acknowledged
+	options := paho.NewClientOptions().
+		AddBroker(config.BrokerURL).
+		SetClientID(config.ClientID).
+		SetUsername(config.Username).
+		SetPassword(config.Password).
+		SetCleanSession(false).
+		SetAutoAckDisabled(true).
+		// the messages are handed to the pipeline one at a time, it writes
+		// them concurrently
+		SetOrderMatters(true).
+		SetAutoReconnect(true).
+		SetOnConnectHandler(s.subscribe).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			log.Warn().Err(err).Msg("lost connection to mqtt broker")
+		})
+	s.client = paho.NewClient(options)
+	return s, nil
+}
+
+// Connect connects to the broker, the subscription is renewed on every reconnection
+func (s *Subscriber) Connect(ctx context.Context) error {
+	token := s.client.Connect()
+	select {
+	case <-ctx.Done():
+		return localErrs.ServiceUnavailableErr.WithMsg("timed out connecting to mqtt broker").WithErr(ctx.Err())
+	case <-token.Done():
+	}
+	if token.Error() != nil {
+		return localErrs.ServiceUnavailableErr.WithMsg("failed to connect to mqtt broker").WithErr(token.Error())
+	}
+	return nil
+}
+
+// Disconnect closes the connection and waits for the messages being written,
+// the ones written after the connection is closed aren't acknowledged so the
+// broker delivers them again
+func (s *Subscriber) Disconnect() {
+	s.client.Disconnect(uint(handleTimeout.Milliseconds()))
+	s.pipeline.Wait()
+}
+
+func (s *Subscriber) subscribe(client paho.Client) {
+	// the handler blocks the delivery of the next messages only while the
+	// pipeline is full
+	token := client.Subscribe(s.filter, qos, func(_ paho.Client, message paho.Message) {
+		s.pipeline.Go(func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), handleTimeout)
+			defer cancel()
+			return s.handle(ctx, message.Topic(), message.Payload())
+		}, func(err error) {
+			if err != nil {
+				log.Error().Err(err).Str("topic", message.Topic()).Msg("failed to handle mqtt message")
+			}
+			if !redeliver(err) {
+				message.Ack()
+			}
+		})
+	})
+	token.Wait()
+	if token.Error() != nil {
+		log.Error().Err(token.Error()).Str("filter", s.filter).Msg("failed to subscribe to mqtt topic")
+		return
+	}
+	log.Info().Str("filter", s.filter).Msg("subscribed to mqtt topic")
+}
+
+// redeliver tells if a message failing with err is left unacknowledged, so
+// the broker delivers it again, unlike the messages rejected by the client
+// errors that would fail the same way
+func redeliver(err error) bool {
+	if err == nil {
+		return false
+	}
+	var apiErr *localErrs.Error
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	return apiErr.StatusCode >= http.StatusInternalServerError || apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// handle writes the metrics of a message, the payload is either a single
+// sensor request or the same body accepted by the http api, along with the
+// token of the device. The user and sensor IDs default to the ones in the
+// topic and must match them.
+func (s *Subscriber) handle(ctx context.Context, topic string, payload []byte) error {
+	userID, sensorID, ok := s.topic.match(topic)
+	if !ok {
+		return localErrs.BadRequestErr.WithMsg("topic doesn't match the pattern").WithDetails("topic", topic)
+	}
+
+	metrics, token, err := decodePayload(payload)
+	if err != nil {
+		return err
+	}
+
+	for i := range metrics {
+		metric := &metrics[i]
+		if len(metric.UserID) == 0 {
+			metric.UserID = userID
+		}
+		if len(metric.SensorID) == 0 {
+			metric.SensorID = sensorID
+		}
+		if metric.UserID != userID || metric.SensorID != sensorID {
+			return localErrs.ForbiddenErr.WithMsg("metric doesn't belong to the topic").WithDetails("topic", topic)
+		}
+	}
+
+	err = models.ValidateSensorRequests(metrics)
+	if err != nil {
+		return err
+	}
+
+	// every metric was published by the sensor of the topic
+	err = s.tokens.Verify(ctx, sensorID, token)
+	if err != nil {
+		return err
+	}
+
+	err = s.logic.WriteSensorMetrics(ctx, metrics)
+	if err != nil && !errors.Is(err, localErrs.AcceptedErr) {
+		return err
+	}
+	return nil
+}
+
+// decodePayload returns the metrics and the device token of a payload, single
+// requests are decoded on their own so the fields they carry are kept
+func decodePayload(payload []byte) ([]models.SensorRequest, string, error) {
+	var request struct {
+		Token   string                 `json:"token"`
+		Metrics []models.SensorRequest `json:"metrics"`
+	}
+	err := json.Unmarshal(payload, &request)
+	metrics := request.Metrics
+	if err == nil && metrics == nil {
+		metrics = make([]models.SensorRequest, 1)
+		err = json.Unmarshal(payload, &metrics[0])
+	}
+	if err != nil {
+		return nil, "", localErrs.BadRequestErr.WithMsg("failed to decode payload").WithErr(err)
+	}
+	return metrics, request.Token, nil
+}
@@ -0,0 +1,313 @@
+package mqtt
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	mqttserver "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+func TestHandle(t *testing.T) {
+	timestamp := float64(time.Now().Unix())
+	var tests = []struct {
+		name         string
+		givenTopic   string
+		givenPayload string
+		setup        func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic)
+		assert       func(t *testing.T, err error)
+	}{
+		{
+			name:         "single metric takes the ids from the topic",
+			givenTopic:   "hydro/user1/sensor1/metrics",
+			givenPayload: fmt.Sprintf(`{"token":"secret","sensor_version":"v1","alias":"reservoir","ph":6.2,"timestamp":%f}`, timestamp),
+			setup: func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {
+				tokens.EXPECT().Verify(gomock.Any(), "sensor1", "secret").Return(nil)
+				metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []models.SensorRequest) error {
+					if assert.Len(t, metrics, 1) {
+						assert.Equal(t, "user1", metrics[0].UserID)
+						assert.Equal(t, "sensor1", metrics[0].SensorID)
+						assert.Equal(t, 6.2, metrics[0].PH)
+						_, ok := metrics[0].Field("ec")
+						assert.False(t, ok)
+						assert.Equal(t, int64(timestamp), metrics[0].Time.Unix())
+					}
+					return nil
+				})
+			},
+			assert: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:         "batch of metrics",
+			givenTopic:   "hydro/user1/sensor1/metrics",
+			givenPayload: fmt.Sprintf(`{"token":"secret","metrics":[{"sensor_version":"v1","alias":"reservoir","timestamp":%f},{"sensor_id":"sensor1","sensor_version":"v1","alias":"reservoir","timestamp":%f}]}`, timestamp, timestamp),
+			setup: func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {
+				tokens.EXPECT().Verify(gomock.Any(), "sensor1", "secret").Return(nil)
+				metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Len(2)).Return(localErrs.AcceptedErr)
+			},
+			assert: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:         "metric from another sensor",
+			givenTopic:   "hydro/user1/sensor1/metrics",
+			givenPayload: fmt.Sprintf(`{"sensor_id":"sensor2","sensor_version":"v1","alias":"reservoir","timestamp":%f}`, timestamp),
+			setup:        func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {},
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ForbiddenErr)
+			},
+		},
+		{
+			name:         "invalid payload",
+			givenTopic:   "hydro/user1/sensor1/metrics",
+			givenPayload: `ph=6.2`,
+			setup:        func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {},
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+		{
+			name:         "missing required fields",
+			givenTopic:   "hydro/user1/sensor1/metrics",
+			givenPayload: `{"ph":6.2}`,
+			setup:        func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {},
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+		{
+			name:         "unexpected topic",
+			givenTopic:   "hydro/user1/sensor1",
+			givenPayload: `{}`,
+			setup:        func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {},
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+		{
+			name:         "sensor not owned by the user",
+			givenTopic:   "hydro/user1/sensor1/metrics",
+			givenPayload: fmt.Sprintf(`{"token":"secret","sensor_version":"v1","alias":"reservoir","timestamp":%f}`, timestamp),
+			setup: func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {
+				tokens.EXPECT().Verify(gomock.Any(), "sensor1", "secret").Return(nil)
+				metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).Return(localErrs.ForbiddenErr)
+			},
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.ForbiddenErr)
+			},
+		},
+		{
+			name:         "invalid device token",
+			givenTopic:   "hydro/user1/sensor1/metrics",
+			givenPayload: fmt.Sprintf(`{"token":"wrong","sensor_version":"v1","alias":"reservoir","timestamp":%f}`, timestamp),
+			setup: func(metricLogic *logic.MockMetricLogic, tokens *logic.MockDeviceTokenLogic) {
+				tokens.EXPECT().Verify(gomock.Any(), "sensor1", "wrong").Return(localErrs.UnauthorizedErr)
+			},
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.UnauthorizedErr)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			metricLogic := logic.NewMockMetricLogic(ctrl)
+			tokens := logic.NewMockDeviceTokenLogic(ctrl)
+			tt.setup(metricLogic, tokens)
+			subscriber, err := NewSubscriber(Config{}, metricLogic, tokens)
+			assert.Nil(t, err)
+
+			err = subscriber.handle(context.Background(), tt.givenTopic, []byte(tt.givenPayload))
+			tt.assert(t, err)
+		})
+	}
+}
+
+// newBroker starts an embedded broker accepting any client
+func newBroker(t *testing.T) (*mqttserver.Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	address := listener.Addr().String()
+	assert.Nil(t, listener.Close())
+
+	broker := mqttserver.New(&mqttserver.Options{
+		InlineClient: true,
+		Logger:       slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+	assert.Nil(t, broker.AddHook(new(auth.AllowHook), nil))
+	assert.Nil(t, broker.AddListener(listeners.NewTCP("tcp", address, nil)))
+	assert.Nil(t, broker.Serve())
+	t.Cleanup(func() { broker.Close() })
+	return broker, "tcp://" + address
+}
+
+func TestSubscriber(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	broker, brokerURL := newBroker(t)
+	received := make(chan []models.SensorRequest, 1)
+	metricLogic := logic.NewMockMetricLogic(ctrl)
+	metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []models.SensorRequest) error {
+		received <- metrics
+		return nil
+	})
+
+	tokens := logic.NewMockDeviceTokenLogic(ctrl)
+	tokens.EXPECT().Verify(gomock.Any(), "sensor1", "secret").Return(nil)
+
+	subscriber, err := NewSubscriber(Config{BrokerURL: brokerURL, ClientID: "collector"}, metricLogic, tokens)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, subscriber.Connect(ctx))
+	defer subscriber.Disconnect()
+
+	// the subscription is made once connected
+	assert.Eventually(t, func() bool {
+		return len(broker.Topics.Subscribers("hydro/user1/sensor1/metrics").Subscriptions) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	payload := fmt.Sprintf(`{"token":"secret","sensor_version":"v1","alias":"reservoir","ec":1.8,"timestamp":%d}`, time.Now().Unix())
+	assert.Nil(t, broker.Publish("hydro/user1/sensor1/metrics", []byte(payload), false, qos))
+
+	select {
+	case metrics := <-received:
+		if assert.Len(t, metrics, 1) {
+			assert.Equal(t, "sensor1", metrics[0].SensorID)
+			assert.Equal(t, 1.8, metrics[0].EC)
+		}
+	case <-ctx.Done():
+		t.Fatal("metric wasn't received")
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	assert.False(t, redeliver(nil))
+	assert.False(t, redeliver(localErrs.BadRequestErr))
+	assert.False(t, redeliver(localErrs.UnauthorizedErr))
+	assert.True(t, redeliver(localErrs.InternalServerErr))
+	assert.True(t, redeliver(localErrs.ServiceUnavailableErr))
+	assert.True(t, redeliver(context.DeadlineExceeded))
+}
+
+func TestSubscriberAcknowledgement(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	broker, brokerURL := newBroker(t)
+	handled := make(chan struct{}, 2)
+	metricLogic := logic.NewMockMetricLogic(ctrl)
+	metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ []models.SensorRequest) error {
+		handled <- struct{}{}
+		return localErrs.InternalServerErr
+	})
+	tokens := logic.NewMockDeviceTokenLogic(ctrl)
+	tokens.EXPECT().Verify(gomock.Any(), "sensor1", "secret").Return(nil)
+	tokens.EXPECT().Verify(gomock.Any(), "sensor1", "wrong").DoAndReturn(func(_ context.Context, _ string, _ string) error {
+		handled <- struct{}{}
+		return localErrs.UnauthorizedErr
+	})
+
+	subscriber, err := NewSubscriber(Config{BrokerURL: brokerURL, ClientID: "collector"}, metricLogic, tokens)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, subscriber.Connect(ctx))
+	defer subscriber.Disconnect()
+	assert.Eventually(t, func() bool {
+		return len(broker.Topics.Subscribers("hydro/user1/sensor1/metrics").Subscriptions) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// the failed write is left for the broker to deliver again while the
+	// message with an invalid token is dropped
+	for _, token := range []string{"secret", "wrong"} {
+		payload := fmt.Sprintf(`{"token":%q,"sensor_version":"v1","alias":"reservoir","timestamp":%d}`, token, time.Now().Unix())
+		assert.Nil(t, broker.Publish("hydro/user1/sensor1/metrics", []byte(payload), false, qos))
+		select {
+		case <-handled:
+		case <-ctx.Done():
+			t.Fatal("message wasn't handled")
+		}
+	}
+
+	client, ok := broker.Clients.Get("collector")
+	if assert.True(t, ok) {
+		assert.Eventually(t, func() bool {
+			return client.State.Inflight.Len() == 1
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+}
+
+func TestSubscriberBlockedWrite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	broker, brokerURL := newBroker(t)
+	release := make(chan struct{})
+	written := make(chan float64, 2)
+	metricLogic := logic.NewMockMetricLogic(ctrl)
+	metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []models.SensorRequest) error {
+		// the first write waits for a flush until the second one is written
+		if metrics[0].PH == 1 {
+			<-release
+		}
+		written <- metrics[0].PH
+		return nil
+	}).Times(2)
+	tokens := logic.NewMockDeviceTokenLogic(ctrl)
+	tokens.EXPECT().Verify(gomock.Any(), "sensor1", "secret").Return(nil).Times(2)
+
+	subscriber, err := NewSubscriber(Config{BrokerURL: brokerURL, ClientID: "collector"}, metricLogic, tokens)
+	assert.Nil(t, err)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	assert.Nil(t, subscriber.Connect(ctx))
+	defer subscriber.Disconnect()
+	assert.Eventually(t, func() bool {
+		return len(broker.Topics.Subscribers("hydro/user1/sensor1/metrics").Subscriptions) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	for _, ph := range []float64{1, 2} {
+		payload := fmt.Sprintf(`{"token":"secret","sensor_version":"v1","alias":"reservoir","ph":%v,"timestamp":%d}`, ph, time.Now().Unix())
+		assert.Nil(t, broker.Publish("hydro/user1/sensor1/metrics", []byte(payload), false, qos))
+	}
+
+	for _, expected := range []float64{2, 1} {
+		select {
+		case ph := <-written:
+			assert.Equal(t, expected, ph)
+		case <-ctx.Done():
+			t.Fatal("message wasn't written")
+		}
+		if expected == 2 {
+			close(release)
+		}
+	}
+
+	// both messages are acknowledged once written
+	client, ok := broker.Clients.Get("collector")
+	if assert.True(t, ok) {
+		assert.Eventually(t, func() bool {
+			return client.State.Inflight.Len() == 0
+		}, 5*time.Second, 10*time.Millisecond)
+	}
+}
@@ -0,0 +1,71 @@
+package mqtt
+
+import (
+	"strings"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+)
+
+// Placeholders locating the user and sensor IDs in the topic pattern
+const (
+	userPlaceholder   = "{userID}"
+	sensorPlaceholder = "{sensorID}"
+)
+
+// DefaultTopic is the topic pattern used when none is configured
+const DefaultTopic = "hydro/" + userPlaceholder + "/" + sensorPlaceholder + "/metrics"
+
+// topicPattern keeps the levels of a topic pattern and where the placeholders are
+type topicPattern struct {
+	levels []string
+	user   int
+	sensor int
+}
+
+// parseTopicPattern accepts patterns where both placeholders are whole levels,
+// wildcards aren't allowed as they would be ambiguous with the placeholders
+func parseTopicPattern(pattern string) (topicPattern, error) {
+	p := topicPattern{levels: strings.Split(pattern, "/"), user: -1, sensor: -1}
+	for i, level := range p.levels {
+		switch {
+		case level == userPlaceholder && p.user < 0:
+			p.user = i
+		case level == sensorPlaceholder && p.sensor < 0:
+			p.sensor = i
+		case strings.ContainsAny(level, "+#{}"):
+			return topicPattern{}, localErrs.BadRequestErr.WithMsg("invalid topic pattern level").WithDetails("level", level)
+		}
+	}
+	if p.user < 0 || p.sensor < 0 {
+		return topicPattern{}, localErrs.BadRequestErr.WithMsg("topic pattern must contain "+userPlaceholder+" and "+sensorPlaceholder).WithDetails("topic", pattern)
+	}
+	return p, nil
+}
+
+// filter returns the subscription filter, with single level wildcards in
+// place of the placeholders
+func (p topicPattern) filter() string {
+	levels := make([]string, len(p.levels))
+	copy(levels, p.levels)
+	levels[p.user] = "+"
+	levels[p.sensor] = "+"
+	return strings.Join(levels, "/")
+}
+
+// match extracts the user and sensor IDs from a topic matching the pattern
+func (p topicPattern) match(topic string) (userID, sensorID string, ok bool) {
+	levels := strings.Split(topic, "/")
+	if len(levels) != len(p.levels) {
+		return "", "", false
+	}
+	for i, level := range levels {
+		if i != p.user && i != p.sensor && level != p.levels[i] {
+			return "", "", false
+		}
+	}
+	userID, sensorID = levels[p.user], levels[p.sensor]
+	if len(userID) == 0 || len(sensorID) == 0 {
+		return "", "", false
+	}
+	return userID, sensorID, true
+}
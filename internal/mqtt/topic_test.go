@@ -0,0 +1,91 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+)
+
+func TestParseTopicPattern(t *testing.T) {
+	var tests = []struct {
+		name         string
+		givenPattern string
+		assert       func(t *testing.T, pattern topicPattern, err error)
+	}{
+		{
+			name:         "default pattern",
+			givenPattern: DefaultTopic,
+			assert: func(t *testing.T, pattern topicPattern, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "hydro/+/+/metrics", pattern.filter())
+			},
+		},
+		{
+			name:         "placeholders in any order",
+			givenPattern: "farm/{sensorID}/readings/{userID}",
+			assert: func(t *testing.T, pattern topicPattern, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, "farm/+/readings/+", pattern.filter())
+				assert.Equal(t, 3, pattern.user)
+				assert.Equal(t, 1, pattern.sensor)
+			},
+		},
+		{
+			name:         "missing placeholder",
+			givenPattern: "hydro/{userID}/metrics",
+			assert: func(t *testing.T, pattern topicPattern, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+		{
+			name:         "placeholder inside a level",
+			givenPattern: "hydro/user-{userID}/{sensorID}",
+			assert: func(t *testing.T, pattern topicPattern, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+		{
+			name:         "wildcards aren't allowed",
+			givenPattern: "hydro/{userID}/{sensorID}/#",
+			assert: func(t *testing.T, pattern topicPattern, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			pattern, err := parseTopicPattern(tt.givenPattern)
+			tt.assert(t, pattern, err)
+		})
+	}
+}
+
+func TestMatch(t *testing.T) {
+	pattern, err := parseTopicPattern(DefaultTopic)
+	assert.Nil(t, err)
+
+	var tests = []struct {
+		name         string
+		givenTopic   string
+		wantUserID   string
+		wantSensorID string
+		wantOK       bool
+	}{
+		{name: "matching topic", givenTopic: "hydro/user1/sensor1/metrics", wantUserID: "user1", wantSensorID: "sensor1", wantOK: true},
+		{name: "different level", givenTopic: "hydro/user1/sensor1/status"},
+		{name: "missing level", givenTopic: "hydro/user1/metrics"},
+		{name: "empty id", givenTopic: "hydro//sensor1/metrics"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			userID, sensorID, ok := pattern.match(tt.givenTopic)
+			assert.Equal(t, tt.wantOK, ok)
+			assert.Equal(t, tt.wantUserID, userID)
+			assert.Equal(t, tt.wantSensorID, sensorID)
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package rpc
+
+import (
+	"context"
+	"strings"
+
+	"github.com/auth0/go-jwt-middleware/v2/validator"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/api/middlewares"
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+)
+
+// writeScope is required to call the ingest service, as for POST /metrics
+const writeScope = "write:metrics"
+
+type claimsKey struct{}
+
+// claimsFromContext returns the claims of the caller authenticated by the interceptors
+func claimsFromContext(ctx context.Context) *middlewares.CustomClaims {
+	claims, _ := ctx.Value(claimsKey{}).(*middlewares.CustomClaims)
+	return claims
+}
+
+// authenticate validates the bearer token of the authorization metadata and
+// checks its scopes like middlewares.HasScope
+func authenticate(ctx context.Context, validateToken middlewares.TokenValidator, scopes string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	authorization := md.Get("authorization")
+	if len(authorization) == 0 {
+		return ctx, localErrs.UnauthorizedErr.WithMsg("missing authorization metadata")
+	}
+	token, ok := strings.CutPrefix(authorization[0], "Bearer ")
+	if !ok {
+		return ctx, localErrs.UnauthorizedErr.WithMsg("authorization isn't a bearer token")
+	}
+
+	validated, err := validateToken(ctx, token)
+	if err != nil {
+		log.Warn().Err(err).Msg("Encountered error while validating grpc JWT")
+		return ctx, localErrs.UnauthorizedErr
+	}
+	validatedClaims, ok := validated.(*validator.ValidatedClaims)
+	if !ok {
+		return ctx, localErrs.UnauthorizedErr
+	}
+	claims, ok := validatedClaims.CustomClaims.(*middlewares.CustomClaims)
+	if !ok || !claims.HasScope(scopes) {
+		return ctx, localErrs.ForbiddenErr
+	}
+	return context.WithValue(ctx, claimsKey{}, claims), nil
+}
+
+func unaryAuth(validateToken middlewares.TokenValidator) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, validateToken, writeScope)
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// authenticatedStream carries the context with the caller claims
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s authenticatedStream) Context() context.Context {
+	return s.ctx
+}
+
+func streamAuth(validateToken middlewares.TokenValidator) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(stream.Context(), validateToken, writeScope)
+		if err != nil {
+			return toStatus(err)
+		}
+		return handler(srv, authenticatedStream{ServerStream: stream, ctx: ctx})
+	}
+}
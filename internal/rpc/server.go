@@ -0,0 +1,168 @@
+// Package rpc ingests the sensor readings of gateways over gRPC
+package rpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/api/middlewares"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/rpc/ingestpb"
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/batch"
+)
+
+// statusCodes maps the localErrs status codes to gRPC codes, any other error
+// is answered with Internal
+var statusCodes = map[int]codes.Code{
+	http.StatusBadRequest:         codes.InvalidArgument,
+	http.StatusUnauthorized:       codes.Unauthenticated,
+	http.StatusForbidden:          codes.PermissionDenied,
+	http.StatusNotFound:           codes.NotFound,
+	http.StatusConflict:           codes.AlreadyExists,
+	http.StatusServiceUnavailable: codes.Unavailable,
+}
+
+// toStatus converts the localErrs errors to gRPC status errors
+func toStatus(err error) error {
+	var apiErr *localErrs.Error
+	if errors.As(err, &apiErr) {
+		code, ok := statusCodes[apiErr.StatusCode]
+		if !ok {
+			code = codes.Internal
+		}
+		return status.Error(code, apiErr.Error())
+	}
+	return status.Error(codes.Internal, localErrs.InternalServerErr.Error())
+}
+
+type ingestServer struct {
+	ingestpb.UnimplementedIngestServiceServer
+	logic logic.MetricLogic
+}
+
+// NewServer builds a gRPC server with the ingest service, calls are
+// authenticated with the tokens accepted by validateToken. The options, such
+// as the transport credentials, are added to the server
+func NewServer(metricLogic logic.MetricLogic, validateToken middlewares.TokenValidator, options ...grpc.ServerOption) *grpc.Server {
+	options = append([]grpc.ServerOption{
+		grpc.UnaryInterceptor(unaryAuth(validateToken)),
+		grpc.StreamInterceptor(streamAuth(validateToken)),
+	}, options...)
+	server := grpc.NewServer(options...)
+	ingestpb.RegisterIngestServiceServer(server, &ingestServer{logic: metricLogic})
+	return server
+}
+
+func (s *ingestServer) Write(ctx context.Context, request *ingestpb.WriteRequest) (*ingestpb.WriteResponse, error) {
+	response := &ingestpb.WriteResponse{}
+	err := s.write(ctx, request, response)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return response, nil
+}
+
+// StreamWrite writes many requests of the stream at once, so each one doesn't
+// wait for its own flush. The requests are counted in order and the stream is
+// aborted on the first failed one
+func (s *ingestServer) StreamWrite(stream ingestpb.IngestService_StreamWriteServer) error {
+	pipeline := batch.NewPipeline(batch.DefaultInFlight)
+	response := &ingestpb.WriteResponse{}
+	var mu sync.Mutex
+	var failed error
+	failure := func() error {
+		mu.Lock()
+		defer mu.Unlock()
+		return failed
+	}
+
+	for failure() == nil {
+		request, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			pipeline.Wait()
+			return err
+		}
+
+		written := &ingestpb.WriteResponse{}
+		pipeline.Go(func() error {
+			return s.write(stream.Context(), request, written)
+		}, func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if failed != nil {
+				return
+			}
+			if err != nil {
+				failed = err
+				return
+			}
+			response.Written += written.Written
+			response.Deferred = response.Deferred || written.Deferred
+		})
+	}
+
+	pipeline.Wait()
+	if failed != nil {
+		return toStatus(failed)
+	}
+	return stream.SendAndClose(response)
+}
+
+// write registers the readings of a request and adds them to the response
+func (s *ingestServer) write(ctx context.Context, request *ingestpb.WriteRequest, response *ingestpb.WriteResponse) error {
+	claims := claimsFromContext(ctx)
+	metrics := make([]models.SensorRequest, 0, len(request.GetReadings()))
+	for _, reading := range request.GetReadings() {
+		metric := toSensorRequest(reading)
+		if len(metric.UserID) == 0 && claims != nil {
+			metric.UserID = claims.Issuer
+		}
+		metrics = append(metrics, metric)
+	}
+
+	err := models.ValidateSensorRequests(metrics)
+	if err != nil {
+		return err
+	}
+
+	err = s.logic.WriteSensorMetrics(ctx, metrics)
+	if errors.Is(err, localErrs.AcceptedErr) {
+		response.Deferred = true
+	} else if err != nil {
+		log.Error().Err(err).Msg("failed to write sensor metrics")
+		return err
+	}
+	response.Written += int64(len(metrics))
+	return nil
+}
+
+// toSensorRequest maps a reading, proto3 doubles can't tell a missing field
+// from 0 so every field is taken as carried
+func toSensorRequest(reading *ingestpb.SensorReading) models.SensorRequest {
+	return models.SensorRequest{
+		SensorID:         reading.GetSensorId(),
+		UserID:           reading.GetUserId(),
+		SensorVersion:    reading.GetSensorVersion(),
+		Alias:            reading.GetAlias(),
+		Temperature:      reading.GetTemperature(),
+		Humidity:         reading.GetHumidity(),
+		PH:               reading.GetPh(),
+		TDS:              reading.GetTds(),
+		EC:               reading.GetEc(),
+		WaterTemperature: reading.GetWaterTemperature(),
+		Timestamp:        reading.GetTimestamp(),
+	}
+}
@@ -0,0 +1,285 @@
+package rpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/api/middlewares"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/logic"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/rpc/ingestpb"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/services"
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+// newClient serves the ingest service in memory and returns a plaintext
+// client to it with tokens for a user with and without the write scope
+func newClient(t *testing.T, metricLogic logic.MetricLogic) (ingestpb.IngestServiceClient, string, string) {
+	listener, writer, reader := serve(t, metricLogic)
+	return dial(t, listener, insecure.NewCredentials()), writer, reader
+}
+
+// serve starts the ingest service in memory with the options and returns its
+// listener with tokens for a user with and without the write scope
+func serve(t *testing.T, metricLogic logic.MetricLogic, options ...grpc.ServerOption) (*bufconn.Listener, string, string) {
+	secret := []byte("test-secret")
+	localAuth := services.NewLocalAuth(secret)
+	ctx := context.Background()
+	assert.Nil(t, localAuth.CreateAccount(ctx, models.User{Email: "random@test.com", Password: "UltraSecr3tPassword!"}))
+	writer, err := localAuth.SignIn(ctx, models.Credentials{Email: "random@test.com", Password: "UltraSecr3tPassword!", Scope: services.LocalScopes})
+	assert.Nil(t, err)
+	reader, err := localAuth.SignIn(ctx, models.Credentials{Email: "random@test.com", Password: "UltraSecr3tPassword!", Scope: "read:metrics"})
+	assert.Nil(t, err)
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := NewServer(metricLogic, middlewares.NewLocalTokenValidator(secret), options...)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return listener, writer.AccessToken, reader.AccessToken
+}
+
+// dial connects a client to the in-memory server with the transport credentials
+func dial(t *testing.T, listener *bufconn.Listener, transportCredentials credentials.TransportCredentials) ingestpb.IngestServiceClient {
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(transportCredentials),
+	)
+	assert.Nil(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return ingestpb.NewIngestServiceClient(conn)
+}
+
+// newTestCertificate returns a self-signed certificate for host and a pool
+// trusting it
+func newTestCertificate(t *testing.T, host string) (tls.Certificate, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: host},
+		DNSNames:     []string{host},
+		NotBefore:    time.Now().Add(-time.Minute),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, roots
+}
+
+func withToken(token string) context.Context {
+	return metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer "+token)
+}
+
+func reading(sensorID string) *ingestpb.SensorReading {
+	return &ingestpb.SensorReading{
+		SensorId:      sensorID,
+		SensorVersion: "v1",
+		Alias:         "reservoir",
+		Ph:            6.2,
+		Timestamp:     float64(time.Now().Unix()),
+	}
+}
+
+func TestWrite(t *testing.T) {
+	var tests = []struct {
+		name      string
+		token     func(writer, reader string) string
+		readings  []*ingestpb.SensorReading
+		setup     func(metricLogic *logic.MockMetricLogic)
+		wantCode  codes.Code
+		wantReply *ingestpb.WriteResponse
+	}{
+		{
+			name:     "readings take the user of the token",
+			token:    func(writer, reader string) string { return writer },
+			readings: []*ingestpb.SensorReading{reading("sensor1"), reading("sensor2")},
+			setup: func(metricLogic *logic.MockMetricLogic) {
+				metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, metrics []models.SensorRequest) error {
+					if assert.Len(t, metrics, 2) {
+						assert.NotEmpty(t, metrics[0].UserID)
+						assert.Equal(t, 6.2, metrics[1].PH)
+						assert.False(t, metrics[1].Time.IsZero())
+					}
+					return nil
+				})
+			},
+			wantCode:  codes.OK,
+			wantReply: &ingestpb.WriteResponse{Written: 2},
+		},
+		{
+			name:     "deferred readings",
+			token:    func(writer, reader string) string { return writer },
+			readings: []*ingestpb.SensorReading{reading("sensor1")},
+			setup: func(metricLogic *logic.MockMetricLogic) {
+				metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).Return(localErrs.AcceptedErr)
+			},
+			wantCode:  codes.OK,
+			wantReply: &ingestpb.WriteResponse{Written: 1, Deferred: true},
+		},
+		{
+			name:     "sensor not owned by the user",
+			token:    func(writer, reader string) string { return writer },
+			readings: []*ingestpb.SensorReading{reading("sensor1")},
+			setup: func(metricLogic *logic.MockMetricLogic) {
+				metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).Return(localErrs.ForbiddenErr)
+			},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "invalid reading",
+			token:    func(writer, reader string) string { return writer },
+			readings: []*ingestpb.SensorReading{{SensorId: "sensor1"}},
+			setup:    func(metricLogic *logic.MockMetricLogic) {},
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "token without write scope",
+			token:    func(writer, reader string) string { return reader },
+			readings: []*ingestpb.SensorReading{reading("sensor1")},
+			setup:    func(metricLogic *logic.MockMetricLogic) {},
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name:     "invalid token",
+			token:    func(writer, reader string) string { return "invalid" },
+			readings: []*ingestpb.SensorReading{reading("sensor1")},
+			setup:    func(metricLogic *logic.MockMetricLogic) {},
+			wantCode: codes.Unauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			metricLogic := logic.NewMockMetricLogic(ctrl)
+			tt.setup(metricLogic)
+			client, writer, reader := newClient(t, metricLogic)
+
+			reply, err := client.Write(withToken(tt.token(writer, reader)), &ingestpb.WriteRequest{Readings: tt.readings})
+			assert.Equal(t, tt.wantCode, status.Code(err))
+			if tt.wantReply != nil {
+				assert.Equal(t, tt.wantReply.Written, reply.GetWritten())
+				assert.Equal(t, tt.wantReply.Deferred, reply.GetDeferred())
+			}
+		})
+	}
+}
+
+func TestStreamWrite(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	metricLogic := logic.NewMockMetricLogic(ctrl)
+	metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).Return(nil).Times(3)
+	client, writer, reader := newClient(t, metricLogic)
+
+	stream, err := client.StreamWrite(withToken(writer))
+	assert.Nil(t, err)
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, stream.Send(&ingestpb.WriteRequest{Readings: []*ingestpb.SensorReading{reading("sensor1"), reading("sensor2")}}))
+	}
+	reply, err := stream.CloseAndRecv()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), reply.GetWritten())
+
+	// the stream is aborted on the first rejected request
+	metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).Return(localErrs.ForbiddenErr)
+	stream, err = client.StreamWrite(withToken(writer))
+	assert.Nil(t, err)
+	assert.Nil(t, stream.Send(&ingestpb.WriteRequest{Readings: []*ingestpb.SensorReading{reading("sensor3")}}))
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	stream, err = client.StreamWrite(withToken(reader))
+	assert.Nil(t, err)
+	_, err = stream.CloseAndRecv()
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestStreamWriteThroughput(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// every write waits for a flush, like the batch writer does
+	const requests = 100
+	const flushLatency = 20 * time.Millisecond
+	metricLogic := logic.NewMockMetricLogic(ctrl)
+	metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).DoAndReturn(func(_ context.Context, _ []models.SensorRequest) error {
+		time.Sleep(flushLatency)
+		return nil
+	}).Times(requests)
+	client, writer, _ := newClient(t, metricLogic)
+
+	start := time.Now()
+	stream, err := client.StreamWrite(withToken(writer))
+	assert.Nil(t, err)
+	for i := 0; i < requests; i++ {
+		assert.Nil(t, stream.Send(&ingestpb.WriteRequest{Readings: []*ingestpb.SensorReading{reading("sensor1")}}))
+	}
+	reply, err := stream.CloseAndRecv()
+	assert.Nil(t, err)
+	assert.Equal(t, int64(requests), reply.GetWritten())
+	assert.Less(t, time.Since(start), requests*flushLatency/4)
+}
+
+func TestTLSCredentials(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	metricLogic := logic.NewMockMetricLogic(ctrl)
+	metricLogic.EXPECT().WriteSensorMetrics(gomock.Any(), gomock.Any()).Return(nil)
+	cert, roots := newTestCertificate(t, "bufnet")
+	listener, writer, _ := serve(t, metricLogic, grpc.Creds(credentials.NewTLS(&tls.Config{Certificates: []tls.Certificate{cert}})))
+
+	client := dial(t, listener, credentials.NewTLS(&tls.Config{RootCAs: roots, ServerName: "bufnet"}))
+	reply, err := client.Write(withToken(writer), &ingestpb.WriteRequest{Readings: []*ingestpb.SensorReading{reading("sensor1")}})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), reply.GetWritten())
+
+	// plaintext clients can't reach a server with credentials
+	client = dial(t, listener, insecure.NewCredentials())
+	_, err = client.Write(withToken(writer), &ingestpb.WriteRequest{Readings: []*ingestpb.SensorReading{reading("sensor1")}})
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+func TestToStatus(t *testing.T) {
+	assert.Equal(t, codes.InvalidArgument, status.Code(toStatus(localErrs.BadRequestErr)))
+	assert.Equal(t, codes.NotFound, status.Code(toStatus(localErrs.NotFoundErr)))
+	assert.Equal(t, codes.Unavailable, status.Code(toStatus(localErrs.ServiceUnavailableErr)))
+	assert.Equal(t, codes.Internal, status.Code(toStatus(localErrs.InternalServerErr)))
+	assert.Equal(t, codes.Internal, status.Code(toStatus(context.Canceled)))
+}
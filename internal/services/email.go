@@ -0,0 +1,187 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+// SMTP TLS modes, TLS connects with implicit TLS (usually port 465) while
+// StartTLS upgrades a plain connection (usually port 587)
+const (
+	SMTPTLSNone     = "none"
+	SMTPTLSStartTLS = "starttls"
+	SMTPTLS         = "tls"
+)
+
+// SMTPConfig holds the settings used to connect to the SMTP server
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	TLS      string
+}
+
+// EmailMessage is an email with both plain text and html bodies
+type EmailMessage struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// EmailSender delivers email messages
+//
+//go:generate mockgen -destination email_mock.go -package services github.com/WendelHime/hydroponics-metrics-collector/internal/services EmailSender
+type EmailSender interface {
+	Send(ctx context.Context, message EmailMessage) error
+}
+
+type smtpSender struct {
+	config SMTPConfig
+}
+
+// NewSMTPSender builds an email sender for the given SMTP server, TLS
+// defaults to StartTLS and plain connections must be asked with SMTPTLSNone
+func NewSMTPSender(config SMTPConfig) (EmailSender, error) {
+	switch config.TLS {
+	case "":
+		config.TLS = SMTPTLSStartTLS
+	case SMTPTLSNone, SMTPTLSStartTLS, SMTPTLS:
+	default:
+		return nil, fmt.Errorf("unknown smtp tls mode %q, expected %s, %s or %s", config.TLS, SMTPTLSNone, SMTPTLSStartTLS, SMTPTLS)
+	}
+	return &smtpSender{config: config}, nil
+}
+
+func (s *smtpSender) dial(ctx context.Context) (net.Conn, error) {
+	address := net.JoinHostPort(s.config.Host, strconv.Itoa(s.config.Port))
+	dialer := &net.Dialer{}
+	if s.config.TLS == SMTPTLS {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: s.config.Host}}
+		return tlsDialer.DialContext(ctx, "tcp", address)
+	}
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+func (s *smtpSender) Send(ctx context.Context, message EmailMessage) error {
+	body, err := buildMessage(s.config.From, message)
+	if err != nil {
+		return fmt.Errorf("failed to build message: %w", err)
+	}
+
+	conn, err := s.dial(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, s.config.Host)
+	if err != nil {
+		return fmt.Errorf("failed to start smtp session: %w", err)
+	}
+	defer client.Close()
+
+	if s.config.TLS == SMTPTLSStartTLS {
+		err = client.StartTLS(&tls.Config{ServerName: s.config.Host})
+		if err != nil {
+			return fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+
+	if len(s.config.Username) > 0 {
+		err = client.Auth(smtp.PlainAuth("", s.config.Username, s.config.Password, s.config.Host))
+		if err != nil {
+			return fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+
+	err = client.Mail(s.config.From)
+	if err != nil {
+		return fmt.Errorf("failed to set sender: %w", err)
+	}
+	err = client.Rcpt(message.To)
+	if err != nil {
+		return fmt.Errorf("failed to set recipient: %w", err)
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("failed to start message: %w", err)
+	}
+	_, err = writer.Write(body)
+	if err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	err = writer.Close()
+	if err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+
+	return client.Quit()
+}
+
+// buildMessage encodes the message as multipart/alternative, so clients
+// without html support fall back to the plain text body
+func buildMessage(from string, message EmailMessage) ([]byte, error) {
+	var buffer bytes.Buffer
+	parts := multipart.NewWriter(&buffer)
+
+	fmt.Fprintf(&buffer, "From: %s\r\n", from)
+	fmt.Fprintf(&buffer, "To: %s\r\n", message.To)
+	fmt.Fprintf(&buffer, "Subject: %s\r\n", mimeEncodeHeader(message.Subject))
+	fmt.Fprintf(&buffer, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buffer, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buffer, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+
+	bodies := []struct {
+		contentType string
+		content     string
+	}{
+		{contentType: "text/plain; charset=UTF-8", content: message.Text},
+		{contentType: "text/html; charset=UTF-8", content: message.HTML},
+	}
+	for _, body := range bodies {
+		part, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {body.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		encoder := quotedprintable.NewWriter(part)
+		_, err = encoder.Write([]byte(body.content))
+		if err != nil {
+			return nil, err
+		}
+		err = encoder.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := parts.Close()
+	if err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
+}
+
+func mimeEncodeHeader(value string) string {
+	return mime.QEncoding.Encode("UTF-8", value)
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// smtpSession is what the fake smtp server received
+type smtpSession struct {
+	from string
+	to   string
+	data string
+}
+
+// newFakeSMTPServer starts a minimal smtp server accepting a single message
+func newFakeSMTPServer(t *testing.T) (string, int, <-chan smtpSession) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		reader := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+		reply("220 localhost ESMTP")
+
+		var session smtpSession
+		for {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			command := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				session.from = strings.Trim(strings.TrimSpace(line)[len("MAIL FROM:"):], "<>")
+				reply("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				session.to = strings.Trim(strings.TrimSpace(line)[len("RCPT TO:"):], "<>")
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 End data with <CR><LF>.<CR><LF>")
+				var data strings.Builder
+				for {
+					line, err := reader.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				session.data = data.String()
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 Bye")
+				sessions <- session
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	address := listener.Addr().(*net.TCPAddr)
+	return address.IP.String(), address.Port, sessions
+}
+
+func TestSMTPSend(t *testing.T) {
+	host, port, sessions := newFakeSMTPServer(t)
+	sender, err := NewSMTPSender(SMTPConfig{Host: host, Port: port, From: "alerts@hydroponics.test", TLS: SMTPTLSNone})
+	assert.Nil(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = sender.Send(ctx, EmailMessage{
+		To:      "grower@test.com",
+		Subject: "Alert firing: ph",
+		Text:    "ph reached 8.1",
+		HTML:    "<p>ph reached <strong>8.1</strong></p>",
+	})
+	assert.Nil(t, err)
+
+	session := <-sessions
+	assert.Equal(t, "alerts@hydroponics.test", session.from)
+	assert.Equal(t, "grower@test.com", session.to)
+	assert.Contains(t, session.data, "Subject: Alert firing: ph")
+	assert.Contains(t, session.data, "Content-Type: multipart/alternative")
+	assert.Contains(t, session.data, "Content-Type: text/plain; charset=UTF-8")
+	assert.Contains(t, session.data, "ph reached 8.1")
+	assert.Contains(t, session.data, "Content-Type: text/html; charset=UTF-8")
+	assert.Contains(t, session.data, "<strong>8.1</strong>")
+}
+
+func TestSMTPSendConnectionRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	sender, err := NewSMTPSender(SMTPConfig{Host: "127.0.0.1", Port: port, From: "alerts@hydroponics.test"})
+	assert.Nil(t, err)
+	err = sender.Send(context.Background(), EmailMessage{To: "grower@test.com", Subject: "test"})
+	assert.Error(t, err)
+}
+
+func TestNewSMTPSenderTLS(t *testing.T) {
+	for _, mode := range []string{"", SMTPTLSNone, SMTPTLSStartTLS, SMTPTLS} {
+		_, err := NewSMTPSender(SMTPConfig{Host: "127.0.0.1", TLS: mode})
+		assert.Nil(t, err, mode)
+	}
+
+	// a typo must not silently send the credentials in plain text
+	_, err := NewSMTPSender(SMTPConfig{Host: "127.0.0.1", TLS: "startls"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalAuth(t *testing.T) {
+	ctx := context.Background()
+	auth := NewLocalAuth([]byte("secret"))
+	account := models.User{Name: "Random User", Email: "Random@test.com", Password: "UltraSecr3tPassword!"}
+
+	assert.Nil(t, auth.CreateAccount(ctx, account))
+	assert.ErrorIs(t, auth.CreateAccount(ctx, account), localErrs.AlreadyExistsErr)
+
+	user, err := auth.GetUser(ctx, "random@test.com")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, user.ID)
+	assert.True(t, user.EmailVerified)
+	assert.Empty(t, user.Password)
+
+	assert.Nil(t, auth.AssignRoleToUser(ctx, "roleID", user.ID))
+	user, err = auth.GetUserByID(ctx, user.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, "roleID", user.Role)
+
+	token, err := auth.SignIn(ctx, models.Credentials{Email: account.Email, Password: account.Password, Scope: LocalScopes})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, token.AccessToken)
+
+	_, err = auth.SignIn(ctx, models.Credentials{Email: account.Email, Password: "wrong"})
+	assert.ErrorIs(t, err, localErrs.ForbiddenErr)
+}
@@ -20,6 +20,7 @@ import (
 type UserService interface {
 	CreateAccount(ctx context.Context, account models.User) error
 	GetUser(ctx context.Context, email string) (models.User, error)
+	GetUserByID(ctx context.Context, userID string) (models.User, error)
 	AssignRoleToUser(ctx context.Context, roleID, userID string) error
 	GetRolePermissions(ctx context.Context, roleID string) (string, error)
 }
@@ -28,6 +29,7 @@ type UserService interface {
 type UserManager interface {
 	Create(ctx context.Context, u *management.User, opts ...management.RequestOption) error
 	ListByEmail(ctx context.Context, email string, opts ...management.RequestOption) (us []*management.User, err error)
+	Read(ctx context.Context, id string, opts ...management.RequestOption) (u *management.User, err error)
 }
 
 // RoleManager interface role management functionalities from oauth service
@@ -99,13 +101,31 @@ func (u *userService) GetUser(ctx context.Context, email string) (models.User, e
 		return models.User{}, localErrs.InternalServerErr.WithErr(err).WithMsg("failed retrieving users with provided email")
 	}
 	if len(users) > 0 {
-		return models.User{
-			ID:            users[0].GetID(),
-			Name:          users[0].GetName(),
-			Email:         users[0].GetEmail(),
-			Role:          users[0].GetUserMetadata()["role"].(string),
-			EmailVerified: users[0].GetEmailVerified(),
-		}, nil
+		return parseUser(users[0]), nil
 	}
 	return models.User{}, localErrs.NotFoundErr.WithMsg("user not found").WithDetails("email", email)
 }
+
+func (u *userService) GetUserByID(ctx context.Context, userID string) (models.User, error) {
+	user, err := u.userManager.Read(ctx, userID)
+	if err != nil {
+		var mngmtErr management.Error
+		if errors.As(err, &mngmtErr) && mngmtErr.Status() == 404 {
+			return models.User{}, localErrs.NotFoundErr.WithMsg("user not found").WithDetails("userID", userID)
+		}
+		log.Warn().Err(err).Msg("failed when retrieving user")
+		return models.User{}, localErrs.InternalServerErr.WithErr(err).WithMsg("failed retrieving user with provided ID")
+	}
+	return parseUser(user), nil
+}
+
+func parseUser(user *management.User) models.User {
+	role, _ := user.GetUserMetadata()["role"].(string)
+	return models.User{
+		ID:            user.GetID(),
+		Name:          user.GetName(),
+		Email:         user.GetEmail(),
+		Role:          role,
+		EmailVerified: user.GetEmailVerified(),
+	}
+}
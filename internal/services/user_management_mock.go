@@ -94,6 +94,21 @@ func (mr *MockUserServiceMockRecorder) GetUser(arg0, arg1 interface{}) *gomock.C
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUser", reflect.TypeOf((*MockUserService)(nil).GetUser), arg0, arg1)
 }
 
+// GetUserByID mocks base method.
+func (m *MockUserService) GetUserByID(arg0 context.Context, arg1 string) (models.User, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetUserByID", arg0, arg1)
+	ret0, _ := ret[0].(models.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetUserByID indicates an expected call of GetUserByID.
+func (mr *MockUserServiceMockRecorder) GetUserByID(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetUserByID", reflect.TypeOf((*MockUserService)(nil).GetUserByID), arg0, arg1)
+}
+
 // MockUserManager is a mock of UserManager interface.
 type MockUserManager struct {
 	ctrl     *gomock.Controller
@@ -156,6 +171,26 @@ func (mr *MockUserManagerMockRecorder) ListByEmail(arg0, arg1 interface{}, arg2
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListByEmail", reflect.TypeOf((*MockUserManager)(nil).ListByEmail), varargs...)
 }
 
+// Read mocks base method.
+func (m *MockUserManager) Read(arg0 context.Context, arg1 string, arg2 ...management.RequestOption) (*management.User, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1}
+	for _, a := range arg2 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Read", varargs...)
+	ret0, _ := ret[0].(*management.User)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Read indicates an expected call of Read.
+func (mr *MockUserManagerMockRecorder) Read(arg0, arg1 interface{}, arg2 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1}, arg2...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Read", reflect.TypeOf((*MockUserManager)(nil).Read), varargs...)
+}
+
 // MockRoleManager is a mock of RoleManager interface.
 type MockRoleManager struct {
 	ctrl     *gomock.Controller
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+)
+
+// Headers sent with every webhook request, receivers validate the signature by
+// computing the HMAC-SHA256 of "<timestamp>.<body>" with the webhook secret
+const (
+	WebhookSignatureHeader = "X-Webhook-Signature"
+	WebhookTimestampHeader = "X-Webhook-Timestamp"
+)
+
+// WebhookSender delivers signed payloads to the webhook receivers
+//
+//go:generate mockgen -destination webhook_mock.go -package services github.com/WendelHime/hydroponics-metrics-collector/internal/services WebhookSender
+type WebhookSender interface {
+	// Check fails with BadRequestErr unless every address of the url host
+	// is public, so webhooks can't reach the internal services
+	Check(ctx context.Context, url string) error
+	Send(ctx context.Context, url, secret string, payload []byte) (int, error)
+}
+
+type webhookSender struct {
+	client *http.Client
+}
+
+// NewWebhookSender builds a sender that posts the payloads with the given http
+// client, which should be built by NewWebhookClient
+func NewWebhookSender(client *http.Client) WebhookSender {
+	return &webhookSender{client: client}
+}
+
+// NewWebhookClient returns a client refusing to connect to non-public
+// addresses. The addresses are checked once resolved, so hosts resolving to
+// another address after Check, and redirects, can't reach the internal
+// services either
+func NewWebhookClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+				return fmt.Errorf("webhook address %s isn't public", host)
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would connect to the receiver in place of the dialer
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// sharedAddressSpace is used by carrier-grade NAT and some cloud networks
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// publicIP tells if ip is routable on the internet
+func publicIP(ip net.IP) bool {
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() && !ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() && !ip.IsMulticast() && !ip.IsUnspecified() && !sharedAddressSpace.Contains(ip)
+}
+
+func (s *webhookSender) Check(ctx context.Context, rawURL string) error {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Hostname()) == 0 {
+		return localErrs.BadRequestErr.WithMsg("invalid webhook url").WithDetails("url", rawURL)
+	}
+
+	host := parsed.Hostname()
+	var ips []net.IP
+	if ip := net.ParseIP(host); ip != nil {
+		ips = []net.IP{ip}
+	} else {
+		addresses, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return localErrs.BadRequestErr.WithMsg("failed to resolve webhook host").WithDetails("host", host).WithErr(err)
+		}
+		for _, address := range addresses {
+			ips = append(ips, address.IP)
+		}
+	}
+
+	for _, ip := range ips {
+		if !publicIP(ip) {
+			return localErrs.BadRequestErr.WithMsg("webhook host must resolve to public addresses").WithDetails("host", host)
+		}
+	}
+	return nil
+}
+
+// Sign returns the hex encoded HMAC-SHA256 signature for the payload
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *webhookSender) Send(ctx context.Context, url, secret string, payload []byte) (int, error) {
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(WebhookTimestampHeader, timestamp)
+	request.Header.Set(WebhookSignatureHeader, Sign(secret, timestamp, payload))
+
+	response, err := s.client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("receiver responded with status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+)
+
+func TestSendWebhook(t *testing.T) {
+	secret := "secret"
+	payload := []byte(`{"type":"device.added"}`)
+	var tests = []struct {
+		name           string
+		givenStatus    int
+		expectedStatus int
+		assert         func(t *testing.T, err error)
+	}{
+		{
+			name:           "receiver accepts signed payload",
+			givenStatus:    http.StatusNoContent,
+			expectedStatus: http.StatusNoContent,
+			assert: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:           "non 2xx responses should return an error",
+			givenStatus:    http.StatusBadGateway,
+			expectedStatus: http.StatusBadGateway,
+			assert: func(t *testing.T, err error) {
+				assert.Error(t, err)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				assert.Nil(t, err)
+				assert.Equal(t, payload, body)
+				assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+				timestamp := r.Header.Get(WebhookTimestampHeader)
+				assert.Equal(t, Sign(secret, timestamp, body), r.Header.Get(WebhookSignatureHeader))
+				w.WriteHeader(tt.givenStatus)
+			}))
+			defer receiver.Close()
+
+			statusCode, err := NewWebhookSender(receiver.Client()).Send(context.Background(), receiver.URL, secret, payload)
+			assert.Equal(t, tt.expectedStatus, statusCode)
+			tt.assert(t, err)
+		})
+	}
+}
+
+func TestCheckWebhook(t *testing.T) {
+	var tests = []struct {
+		name     string
+		givenURL string
+		assert   func(t *testing.T, err error)
+	}{
+		{
+			name:     "public address",
+			givenURL: "https://93.184.216.34/hook",
+			assert: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+		},
+		{
+			name:     "loopback host",
+			givenURL: "http://localhost:8080/hook",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+		{
+			name:     "private address",
+			givenURL: "https://10.0.0.2/hook",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+		{
+			name:     "link local metadata address",
+			givenURL: "http://169.254.169.254/computeMetadata/v1",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+		{
+			name:     "ipv6 loopback",
+			givenURL: "http://[::1]/hook",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+		{
+			name:     "unsupported scheme",
+			givenURL: "ftp://93.184.216.34/hook",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewWebhookSender(http.DefaultClient).Check(context.Background(), tt.givenURL)
+			tt.assert(t, err)
+		})
+	}
+}
+
+func TestWebhookClientRefusesInternalAddresses(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("internal receiver was reached")
+	}))
+	defer receiver.Close()
+
+	_, err := NewWebhookSender(NewWebhookClient(time.Second)).Send(context.Background(), receiver.URL, "secret", []byte("{}"))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), "isn't public")
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '1690000000.{}' | openssl dgst -sha256 -hmac secret
+	assert.Equal(t, "sha256=19e10d2de228f168abaf9e04414ee2538bcc7e2296b852d1bd58a94f6f0120e6", Sign("secret", "1690000000", []byte("{}")))
+}
@@ -3,6 +3,7 @@ package errors
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"net/http"
 
 	"github.com/go-chi/render"
@@ -21,19 +22,41 @@ func newError(statusCode int, statusDescription string) *Error {
 	return &Error{StatusCode: statusCode, StatusDescription: statusDescription, Details: make(map[string]any)}
 }
 
+// WithMsg returns a copy of e with message, the package errors are shared
+// and never modified
 func (e *Error) WithMsg(message string) *Error {
-	e.Msg = message
-	return e
+	c := e.clone()
+	c.Msg = message
+	return c
 }
 
+// WithDetails returns a copy of e with the detail key set to value
 func (e *Error) WithDetails(key string, value any) *Error {
-	e.Details[key] = value
-	return e
+	c := e.clone()
+	c.Details[key] = value
+	return c
 }
 
+// WithErr returns a copy of e caused by err
 func (e *Error) WithErr(err error) *Error {
-	e.Err = err
-	return e
+	c := e.clone()
+	c.Err = err
+	return c
+}
+
+func (e *Error) clone() *Error {
+	c := *e
+	c.Details = maps.Clone(e.Details)
+	if c.Details == nil {
+		c.Details = make(map[string]any)
+	}
+	return &c
+}
+
+// Is matches the copies of the package errors, which have one error per status code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.StatusCode == e.StatusCode
 }
 
 func (e *Error) Error() string {
@@ -57,6 +80,9 @@ func RenderErr(w http.ResponseWriter, r *http.Request, err error) {
 	render.Status(r, http.StatusInternalServerError)
 }
 
+// AcceptedErr when the request was accepted but its processing was deferred
+var AcceptedErr *Error = newError(202, "accepted")
+
 // InternalServerErr used for random/unexpected internal errors
 var InternalServerErr *Error = newError(500, "internal server error")
 
@@ -72,5 +98,23 @@ var BadRequestErr *Error = newError(400, "bad request")
 // ForbiddenErr used when the user is inactive or doesn't the expected permissions
 var ForbiddenErr *Error = newError(403, "forbidden")
 
+// ServiceUnavailableErr when the service can't handle the request for now
+var ServiceUnavailableErr *Error = newError(503, "service unavailable")
+
 // UnauthorizedErr used when the provided token is invalid
 var UnauthorizedErr *Error = newError(401, "unauthorized")
+
+// NotAcceptableErr when none of the accepted response formats can be produced
+var NotAcceptableErr *Error = newError(406, "not acceptable")
+
+// RequestEntityTooLargeErr when the request body exceeds the accepted size
+var RequestEntityTooLargeErr *Error = newError(413, "request entity too large")
+
+// UnsupportedMediaTypeErr when the request body format or encoding isn't accepted
+var UnsupportedMediaTypeErr *Error = newError(415, "unsupported media type")
+
+// UnprocessableEntityErr when the request is well formed but conflicts with a previous one
+var UnprocessableEntityErr *Error = newError(422, "unprocessable entity")
+
+// NotImplementedErr when the configured backend doesn't support the request
+var NotImplementedErr *Error = newError(501, "not implemented")
@@ -0,0 +1,35 @@
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithCopies(t *testing.T) {
+	err := BadRequestErr.WithMsg("invalid window").WithDetails("window", "2m").WithErr(fmt.Errorf("cause"))
+	assert.Equal(t, "invalid window", err.Msg)
+	assert.Equal(t, "2m", err.Details["window"])
+	assert.Empty(t, BadRequestErr.Msg)
+	assert.Empty(t, BadRequestErr.Details)
+	assert.Nil(t, BadRequestErr.Err)
+
+	assert.ErrorIs(t, err, BadRequestErr)
+	assert.ErrorIs(t, fmt.Errorf("wrapped: %w", err), BadRequestErr)
+	assert.False(t, errors.Is(err, NotFoundErr))
+
+	// details are safe to set from many goroutines
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ForbiddenErr.WithDetails("attempt", i)
+		}(i)
+	}
+	wg.Wait()
+	assert.Empty(t, ForbiddenErr.Details)
+}
@@ -0,0 +1,80 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+)
+
+// Operators supported by the alert rules
+const (
+	OperatorGreaterThan    = "gt"
+	OperatorGreaterOrEqual = "gte"
+	OperatorLessThan       = "lt"
+	OperatorLessOrEqual    = "lte"
+)
+
+// Alert statuses, rules are either inactive or firing while events are either firing or resolved
+const (
+	AlertStatusInactive = "inactive"
+	AlertStatusFiring   = "firing"
+	AlertStatusResolved = "resolved"
+)
+
+// AlertRule fires when the device Field compared with Threshold by Operator
+// stays true for at least ForSeconds
+type AlertRule struct {
+	ID            string    `json:"id" firestore:"id"`
+	UserID        string    `json:"-" firestore:"user_id"`
+	DeviceID      string    `json:"device_id" firestore:"device_id"`
+	Field         string    `json:"field" firestore:"field" validate:"required"`
+	Operator      string    `json:"operator" firestore:"operator" validate:"required,oneof=gt gte lt lte"`
+	Threshold     float64   `json:"threshold" firestore:"threshold"`
+	ForSeconds    int64     `json:"for_seconds" firestore:"for_seconds" validate:"gte=0"`
+	Status        string    `json:"status" firestore:"status"`
+	BreachedSince time.Time `json:"breached_since,omitempty" firestore:"breached_since,omitempty"`
+}
+
+func (a *AlertRule) Bind(r *http.Request) error {
+	err := validate.Struct(a)
+	if err != nil {
+		return localErrs.BadRequestErr.WithErr(err).WithMsg("failed to validate request")
+	}
+	return nil
+}
+
+// Breached checks if the value violates the rule threshold
+func (a AlertRule) Breached(value float64) bool {
+	switch a.Operator {
+	case OperatorGreaterThan:
+		return value > a.Threshold
+	case OperatorGreaterOrEqual:
+		return value >= a.Threshold
+	case OperatorLessThan:
+		return value < a.Threshold
+	case OperatorLessOrEqual:
+		return value <= a.Threshold
+	}
+	return false
+}
+
+// AlertEvent records a rule transition to firing or resolved
+type AlertEvent struct {
+	ID        string    `json:"id" firestore:"id"`
+	RuleID    string    `json:"rule_id" firestore:"rule_id"`
+	DeviceID  string    `json:"device_id" firestore:"device_id"`
+	Field     string    `json:"field" firestore:"field"`
+	Operator  string    `json:"operator" firestore:"operator"`
+	Threshold float64   `json:"threshold" firestore:"threshold"`
+	Value     float64   `json:"value" firestore:"value"`
+	Status    string    `json:"status" firestore:"status"`
+	Time      time.Time `json:"time" firestore:"time"`
+}
+
+// SilentDevice describes a device that stopped registering metrics
+type SilentDevice struct {
+	DeviceID string    `json:"device_id"`
+	Alias    string    `json:"alias"`
+	LastSeen time.Time `json:"last_seen"`
+}
@@ -0,0 +1,98 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+)
+
+// Hydroponic systems a device can be installed in
+const (
+	SystemNFT        = "nft"
+	SystemDWC        = "dwc"
+	SystemEbbAndFlow = "ebb_and_flow"
+	SystemDrip       = "drip"
+	SystemAeroponics = "aeroponics"
+	SystemWick       = "wick"
+	SystemKratky     = "kratky"
+	SystemOther      = "other"
+)
+
+// DeviceMetadata describes where and how a device is installed, probes are the
+// measurement fields the device reports
+type DeviceMetadata struct {
+	Name            string   `json:"name,omitempty" firestore:"name,omitempty" validate:"max=64"`
+	Location        string   `json:"location,omitempty" firestore:"location,omitempty" validate:"max=128"`
+	SystemType      string   `json:"system_type,omitempty" firestore:"system_type,omitempty" validate:"omitempty,oneof=nft dwc ebb_and_flow drip aeroponics wick kratky other"`
+	ReservoirLiters float64  `json:"reservoir_liters,omitempty" firestore:"reservoir_liters,omitempty" validate:"gte=0"`
+	Probes          []string `json:"probes,omitempty" firestore:"probes,omitempty" validate:"dive,oneof=temperature humidity ph tds ec water_temperature"`
+}
+
+// Device is a sensor bound to a user
+type Device struct {
+	ID string `json:"id" firestore:"id"`
+	DeviceMetadata
+	CreatedAt time.Time `json:"created_at" firestore:"created_at"`
+}
+
+func (Device) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// DeviceToken is the pre-shared token a device authenticates with on the
+// protocols without user sessions
+type DeviceToken struct {
+	DeviceID string `json:"device_id"`
+	Token    string `json:"token"`
+}
+
+func (DeviceToken) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// DeviceIDs lists the IDs of the devices
+func DeviceIDs(devices []Device) []string {
+	ids := make([]string, len(devices))
+	for i, device := range devices {
+		ids[i] = device.ID
+	}
+	return ids
+}
+
+// DeviceUpdate changes the device metadata, fields left null are kept as is
+type DeviceUpdate struct {
+	Name            *string   `json:"name" validate:"omitempty,max=64"`
+	Location        *string   `json:"location" validate:"omitempty,max=128"`
+	SystemType      *string   `json:"system_type" validate:"omitempty,oneof=nft dwc ebb_and_flow drip aeroponics wick kratky other"`
+	ReservoirLiters *float64  `json:"reservoir_liters" validate:"omitempty,gte=0"`
+	Probes          *[]string `json:"probes" validate:"omitempty,dive,oneof=temperature humidity ph tds ec water_temperature"`
+}
+
+func (d *DeviceUpdate) Bind(r *http.Request) error {
+	err := validate.Struct(d)
+	if err != nil {
+		return localErrs.BadRequestErr.WithErr(err).WithMsg("failed to validate request")
+	}
+	return nil
+}
+
+// Apply returns the device with the update fields set
+func (d DeviceUpdate) Apply(device Device) Device {
+	if d.Name != nil {
+		device.Name = *d.Name
+	}
+	if d.Location != nil {
+		device.Location = *d.Location
+	}
+	if d.SystemType != nil {
+		device.SystemType = *d.SystemType
+	}
+	if d.ReservoirLiters != nil {
+		device.ReservoirLiters = *d.ReservoirLiters
+	}
+	if d.Probes != nil {
+		device.Probes = *d.Probes
+	}
+	return device
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"testing"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceUpdateBind(t *testing.T) {
+	name := "lettuce"
+	systemType := "bucket"
+	reservoir := -1.0
+	probes := []string{"ph", "salinity"}
+	var tests = []struct {
+		name        string
+		assert      func(t *testing.T, err error)
+		givenUpdate *DeviceUpdate
+	}{
+		{
+			name: "bind with success",
+			assert: func(t *testing.T, err error) {
+				assert.Nil(t, err)
+			},
+			givenUpdate: &DeviceUpdate{Name: &name},
+		},
+		{
+			name: "bind fails if system type is unknown",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+			givenUpdate: &DeviceUpdate{SystemType: &systemType},
+		},
+		{
+			name: "bind fails if reservoir volume is negative",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+			givenUpdate: &DeviceUpdate{ReservoirLiters: &reservoir},
+		},
+		{
+			name: "bind fails if a probe is unknown",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+			givenUpdate: &DeviceUpdate{Probes: &probes},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.givenUpdate.Bind(nil)
+			tt.assert(t, err)
+		})
+	}
+}
+
+func TestDeviceUpdateApply(t *testing.T) {
+	name := "lettuce"
+	probes := []string{"ph"}
+	device := Device{ID: "device", DeviceMetadata: DeviceMetadata{Name: "old", Location: "greenhouse"}}
+
+	updated := DeviceUpdate{Name: &name, Probes: &probes}.Apply(device)
+	assert.Equal(t, Device{ID: "device", DeviceMetadata: DeviceMetadata{Name: "lettuce", Location: "greenhouse", Probes: []string{"ph"}}}, updated)
+}
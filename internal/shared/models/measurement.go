@@ -1,7 +1,20 @@
 package models
 
 import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
 	"time"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/go-playground/validator/v10"
+	"github.com/vmihailenco/msgpack/v5"
+	"github.com/vmihailenco/msgpack/v5/msgpcode"
 )
 
 // SensorRequest is used to represent metrics registered by any sensors connected to the raspberry
@@ -18,4 +31,280 @@ type SensorRequest struct {
 	WaterTemperature float64   `json:"water_temperature"`
 	Timestamp        float64   `json:"timestamp" validate:"required"`
 	Time             time.Time `json:"-"`
+	// missing flags the MeasurementFields the decoded payload didn't carry,
+	// readings built in code carry all of them
+	missing uint8
+}
+
+// validate is shared by the models, it caches the rules of each struct and is
+// safe for concurrent use
+var validate = validator.New()
+
+// maxSensorRequestAge is how old a measurement can be when it's registered
+const maxSensorRequestAge = 30
+
+// ValidateSensorRequests checks the metrics registered by the devices and sets
+// their Time from the unix Timestamp, whatever the protocol they arrived through
+func ValidateSensorRequests(metrics []SensorRequest) error {
+	err := validate.Var(metrics, "required")
+	if err != nil {
+		return localErrs.BadRequestErr.WithErr(err).WithMsg("failed to validate request")
+	}
+
+	for i := range metrics {
+		err = validateSensorRequest(&metrics[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ValidateEachSensorRequest checks the metrics like ValidateSensorRequests,
+// one by one, and returns the invalid ones sorted by position
+func ValidateEachSensorRequest(metrics []SensorRequest) []RejectedReading {
+	rejected := make([]RejectedReading, 0)
+	for i := range metrics {
+		err := validateSensorRequest(&metrics[i])
+		if err != nil {
+			rejected = append(rejected, NewRejectedReading(i, err))
+		}
+	}
+	return rejected
+}
+
+func validateSensorRequest(v *SensorRequest) error {
+	err := validate.Struct(v)
+	if err != nil {
+		return localErrs.BadRequestErr.WithErr(err).WithMsg("failed to validate request")
+	}
+
+	// parse timestamp
+	sec, dec := math.Modf(v.Timestamp)
+	v.Time = time.Unix(int64(sec), int64(dec*1e9))
+
+	// we only store dates from the last 30 days
+	if v.Time.Before(time.Now().AddDate(0, 0, -maxSensorRequestAge)) {
+		return localErrs.BadRequestErr.WithErr(fmt.Errorf("reading time %s", v.Time.Format(time.RFC3339))).WithMsg("timestamp before 30 days is not acceptable")
+	}
+	return nil
+}
+
+// RejectedReading tells why the reading at Index of a batch wasn't written
+type RejectedReading struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	Reason string `json:"reason"`
+}
+
+// NewRejectedReading describes err, the cause of localErrs errors is kept as
+// it isn't part of their message
+func NewRejectedReading(index int, err error) RejectedReading {
+	var apiErr *localErrs.Error
+	if !errors.As(err, &apiErr) {
+		return RejectedReading{Index: index, Status: localErrs.InternalServerErr.StatusCode, Reason: localErrs.InternalServerErr.StatusDescription}
+	}
+
+	reason := apiErr.Msg
+	if len(reason) == 0 {
+		reason = apiErr.StatusDescription
+	}
+	if apiErr.Err != nil {
+		reason += ": " + apiErr.Err.Error()
+	}
+	return RejectedReading{Index: index, Status: apiErr.StatusCode, Reason: reason}
+}
+
+// MeasurementFields are the numeric fields collected by the sensors
+var MeasurementFields = []string{"temperature", "humidity", "ph", "tds", "ec", "water_temperature"}
+
+// fieldBit returns the missing flag of one of the MeasurementFields
+func fieldBit(name string) uint8 {
+	for i, field := range MeasurementFields {
+		if field == name {
+			return 1 << i
+		}
+	}
+	return 0
+}
+
+// Field returns the value of one of the MeasurementFields, reporting false
+// when the field is unknown or the reading didn't carry it
+func (s SensorRequest) Field(name string) (float64, bool) {
+	if s.missing&fieldBit(name) != 0 {
+		return 0, false
+	}
+
+	switch name {
+	case "temperature":
+		return s.Temperature, true
+	case "humidity":
+		return s.Humidity, true
+	case "ph":
+		return s.PH, true
+	case "tds":
+		return s.TDS, true
+	case "ec":
+		return s.EC, true
+	case "water_temperature":
+		return s.WaterTemperature, true
+	}
+	return 0, false
+}
+
+// SetField sets the value of one of the MeasurementFields
+func (s *SensorRequest) SetField(name string, value float64) bool {
+	switch name {
+	case "temperature":
+		s.Temperature = value
+	case "humidity":
+		s.Humidity = value
+	case "ph":
+		s.PH = value
+	case "tds":
+		s.TDS = value
+	case "ec":
+		s.EC = value
+	case "water_temperature":
+		s.WaterTemperature = value
+	default:
+		return false
+	}
+	s.missing &^= fieldBit(name)
+	return true
+}
+
+// ClearFields resets every MeasurementFields, they're missing until set by SetField
+func (s *SensorRequest) ClearFields() {
+	for _, field := range MeasurementFields {
+		s.SetField(field, 0)
+	}
+	s.missing = 1<<len(MeasurementFields) - 1
+}
+
+// markMissing flags the MeasurementFields absent from the keys of a decoded
+// payload, foldCase matches them ignoring case like the json and cbor decoders
+func (s *SensorRequest) markMissing(keys []string, foldCase bool) {
+	s.missing = 0
+	for _, field := range MeasurementFields {
+		found := false
+		for _, key := range keys {
+			found = found || key == field || (foldCase && strings.EqualFold(key, field))
+		}
+		if !found {
+			s.missing |= fieldBit(field)
+		}
+	}
+}
+
+// plainSensorRequest is decoded without the custom decoders below
+type plainSensorRequest SensorRequest
+
+func (s *SensorRequest) UnmarshalJSON(data []byte) error {
+	var keys map[string]json.RawMessage
+	err := json.Unmarshal(data, &keys)
+	if err != nil {
+		return err
+	}
+	err = json.Unmarshal(data, (*plainSensorRequest)(s))
+	if err != nil {
+		return err
+	}
+	s.markMissing(presentKeys(keys, []byte("null")), true)
+	return nil
+}
+
+func (s *SensorRequest) UnmarshalCBOR(data []byte) error {
+	var keys map[string]cbor.RawMessage
+	err := cbor.Unmarshal(data, &keys)
+	if err != nil {
+		return err
+	}
+	err = cbor.Unmarshal(data, (*plainSensorRequest)(s))
+	if err != nil {
+		return err
+	}
+	s.markMissing(presentKeys(keys, []byte{0xf6}), true)
+	return nil
+}
+
+func (s *SensorRequest) DecodeMsgpack(decoder *msgpack.Decoder) error {
+	data, err := decoder.DecodeRaw()
+	if err != nil {
+		return err
+	}
+	var keys map[string]msgpack.RawMessage
+	err = msgpack.Unmarshal(data, &keys)
+	if err != nil {
+		return err
+	}
+	plain := msgpack.NewDecoder(bytes.NewReader(data))
+	plain.SetCustomStructTag("json")
+	err = plain.Decode((*plainSensorRequest)(s))
+	if err != nil {
+		return err
+	}
+	s.markMissing(presentKeys(keys, []byte{msgpcode.Nil}), false)
+	return nil
+}
+
+// presentKeys returns the keys of a decoded payload, skipping the ones set to
+// the encoded null, which some decoders leave empty
+func presentKeys[V ~[]byte](m map[string]V, null []byte) []string {
+	keys := make([]string, 0, len(m))
+	for key, value := range m {
+		if len(value) > 0 && !bytes.Equal(value, null) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Aggregation functions supported when downsampling measurements
+const (
+	AggregationMean  = "mean"
+	AggregationMin   = "min"
+	AggregationMax   = "max"
+	AggregationLast  = "last"
+	AggregationCount = "count"
+)
+
+// Aggregations lists every supported aggregation function
+var Aggregations = []string{AggregationMean, AggregationMin, AggregationMax, AggregationLast, AggregationCount}
+
+// MeasurementQuery filters the stored measurements of a single sensor, when
+// Aggregation is set the measurements are grouped in fixed windows of Window size
+type MeasurementQuery struct {
+	SensorID    string
+	From        time.Time
+	To          time.Time
+	Fields      []string
+	Aggregation string
+	Window      time.Duration
+	Limit       int
+}
+
+// Measurement is a stored sensor reading, only the requested fields are filled
+type Measurement struct {
+	SensorID      string             `json:"sensor_id"`
+	SensorVersion string             `json:"sensor_version"`
+	Alias         string             `json:"alias"`
+	Time          time.Time          `json:"time"`
+	Fields        map[string]float64 `json:"fields"`
+}
+
+// MeasurementSeries holds the measurements of a read, Aggregation and Window
+// are set when they were downsampled
+type MeasurementSeries struct {
+	Aggregation  string
+	Window       time.Duration
+	Measurements []Measurement
+}
+
+// LatestMeasurement holds the most recent reading of a device, Measurement is
+// nil when the device never registered metrics
+type LatestMeasurement struct {
+	DeviceID    string       `json:"device_id"`
+	Measurement *Measurement `json:"measurement"`
+	AgeSeconds  float64      `json:"age_seconds,omitempty"`
 }
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+)
+
+// RetentionPolicy keeps the user measurements for Days, measurements are kept
+// forever when Days is zero
+type RetentionPolicy struct {
+	UserID string `json:"-" firestore:"user_id"`
+	Days   int    `json:"days" firestore:"days" validate:"gte=0,lte=3650"`
+}
+
+func (p *RetentionPolicy) Bind(r *http.Request) error {
+	err := validate.Struct(p)
+	if err != nil {
+		return localErrs.BadRequestErr.WithErr(err).WithMsg("failed to validate request")
+	}
+	return nil
+}
+
+func (RetentionPolicy) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
+
+// Cutoff returns the time before which measurements expire, or the zero time
+// when measurements are kept forever
+func (p RetentionPolicy) Cutoff(now time.Time) time.Time {
+	if p.Days == 0 {
+		return time.Time{}
+	}
+	return now.UTC().AddDate(0, 0, -p.Days)
+}
+
+// DevicePurge counts the measurements of a device older than the retention cutoff
+type DevicePurge struct {
+	DeviceID string `json:"device_id"`
+	Points   int64  `json:"points"`
+}
+
+// RetentionReport describes what a purge of the user measurements would delete
+type RetentionReport struct {
+	UserID  string        `json:"user_id"`
+	Days    int           `json:"days"`
+	Cutoff  time.Time     `json:"cutoff,omitempty"`
+	Points  int64         `json:"points"`
+	Devices []DevicePurge `json:"devices"`
+}
+
+func (RetentionReport) Render(w http.ResponseWriter, r *http.Request) error {
+	return nil
+}
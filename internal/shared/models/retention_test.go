@@ -0,0 +1,15 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetentionPolicyCutoff(t *testing.T) {
+	now := time.Date(2023, 8, 31, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2023, 8, 1, 10, 0, 0, 0, time.UTC), RetentionPolicy{Days: 30}.Cutoff(now))
+	// measurements are kept forever
+	assert.True(t, RetentionPolicy{}.Cutoff(now).IsZero())
+}
@@ -4,8 +4,6 @@ import (
 	"net/http"
 
 	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
-
-	"github.com/go-playground/validator/v10"
 )
 
 // User account fields
@@ -19,7 +17,6 @@ type User struct {
 }
 
 func (u *User) Bind(r *http.Request) error {
-	validate := validator.New()
 	err := validate.Struct(u)
 	if err != nil {
 		return localErrs.BadRequestErr.WithErr(err).WithMsg("failed to validate request")
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"net/http"
+	"time"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+)
+
+// Domain events that can be delivered through webhooks
+const (
+	EventMetricsAccepted = "metrics.accepted"
+	EventDeviceAdded     = "device.added"
+	EventDeviceUpdated   = "device.updated"
+	EventDeviceRemoved   = "device.removed"
+	EventAccountCreated  = "account.created"
+	EventAlertFiring     = "alert.firing"
+	EventAlertResolved   = "alert.resolved"
+	EventDeviceSilent    = "device.silent"
+)
+
+// Event is something that happened in the service for a given user
+type Event struct {
+	ID     string    `json:"id"`
+	Type   string    `json:"type"`
+	UserID string    `json:"user_id"`
+	Time   time.Time `json:"time"`
+	Data   any       `json:"data"`
+}
+
+// Webhook is a user subscription that receives the events of the given types
+type Webhook struct {
+	ID                  string    `json:"id" firestore:"id"`
+	UserID              string    `json:"-" firestore:"user_id"`
+	URL                 string    `json:"url" firestore:"url" validate:"required,http_url"`
+	Events              []string  `json:"events" firestore:"events" validate:"required,min=1,dive,oneof=metrics.accepted device.added device.updated device.removed account.created alert.firing alert.resolved device.silent"`
+	Secret              string    `json:"secret,omitempty" firestore:"secret"`
+	Enabled             bool      `json:"enabled" firestore:"enabled"`
+	ConsecutiveFailures int       `json:"consecutive_failures" firestore:"consecutive_failures"`
+	CreatedAt           time.Time `json:"created_at" firestore:"created_at"`
+}
+
+func (w *Webhook) Bind(r *http.Request) error {
+	err := validate.Struct(w)
+	if err != nil {
+		return localErrs.BadRequestErr.WithErr(err).WithMsg("failed to validate request")
+	}
+	return nil
+}
+
+// WebhookDelivery logs the result of delivering an event to a webhook
+type WebhookDelivery struct {
+	ID         string    `json:"id" firestore:"id"`
+	WebhookID  string    `json:"webhook_id" firestore:"webhook_id"`
+	EventID    string    `json:"event_id" firestore:"event_id"`
+	EventType  string    `json:"event_type" firestore:"event_type"`
+	Attempts   int       `json:"attempts" firestore:"attempts"`
+	StatusCode int       `json:"status_code,omitempty" firestore:"status_code"`
+	Error      string    `json:"error,omitempty" firestore:"error"`
+	Success    bool      `json:"success" firestore:"success"`
+	Time       time.Time `json:"time" firestore:"time"`
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"time"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxAlertEvents caps the amount of alert events returned by a single query
+const MaxAlertEvents = 1000
+
+// AlertRepository contain functions for storing alert rules and their events,
+// both are kept as sub collections of the user devices document
+//
+//go:generate mockgen -destination alerts_mock.go -package storage github.com/WendelHime/hydroponics-metrics-collector/internal/storage AlertRepository
+type AlertRepository interface {
+	CreateRule(ctx context.Context, rule models.AlertRule) error
+	GetRules(ctx context.Context, userID string) ([]models.AlertRule, error)
+	DeleteRule(ctx context.Context, userID, ruleID string) error
+	// EvaluateRule reads the rule state, applies evaluate and stores the new
+	// state with the events it returned in a single transaction, evaluate may
+	// be called again when the transaction is retried
+	EvaluateRule(ctx context.Context, userID, ruleID string, evaluate RuleEvaluation) ([]models.AlertEvent, error)
+	AddEvent(ctx context.Context, userID string, event models.AlertEvent) error
+	GetEvents(ctx context.Context, userID string, from, to time.Time) ([]models.AlertEvent, error)
+}
+
+// RuleEvaluation updates the state of the rule, returning the events raised
+// and whether the state has changed
+type RuleEvaluation func(rule *models.AlertRule) ([]models.AlertEvent, bool)
+
+type alertRepository struct {
+	client *firestore.Client
+}
+
+func NewAlertRepository(client *firestore.Client) AlertRepository {
+	return &alertRepository{client: client}
+}
+
+func (a *alertRepository) rules(userID string) *firestore.CollectionRef {
+	return a.client.Collection("user_devices").Doc(userID).Collection("alert_rules")
+}
+
+func (a *alertRepository) events(userID string) *firestore.CollectionRef {
+	return a.client.Collection("user_devices").Doc(userID).Collection("alert_events")
+}
+
+func (a *alertRepository) CreateRule(ctx context.Context, rule models.AlertRule) error {
+	_, err := a.rules(rule.UserID).Doc(rule.ID).Create(ctx, rule)
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return localErrs.AlreadyExistsErr.WithMsg("alert rule already exists").WithErr(err)
+		}
+		return localErrs.InternalServerErr.WithMsg("failed to create alert rule").WithErr(err)
+	}
+
+	return nil
+}
+
+func (a *alertRepository) GetRules(ctx context.Context, userID string) ([]models.AlertRule, error) {
+	docs, err := a.rules(userID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve alert rules").WithErr(err)
+	}
+
+	rules := make([]models.AlertRule, len(docs))
+	for i, doc := range docs {
+		err = doc.DataTo(&rules[i])
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to parse alert rule struct").WithErr(err)
+		}
+	}
+
+	return rules, nil
+}
+
+func (a *alertRepository) DeleteRule(ctx context.Context, userID, ruleID string) error {
+	_, err := a.rules(userID).Doc(ruleID).Delete(ctx, firestore.Exists)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return localErrs.NotFoundErr.WithMsg("alert rule not found").WithErr(err)
+		}
+		return localErrs.InternalServerErr.WithMsg("failed to delete alert rule").WithErr(err)
+	}
+
+	return nil
+}
+
+func (a *alertRepository) EvaluateRule(ctx context.Context, userID, ruleID string, evaluate RuleEvaluation) ([]models.AlertEvent, error) {
+	var events []models.AlertEvent
+	err := a.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref := a.rules(userID).Doc(ruleID)
+		doc, err := tx.Get(ref)
+		if err != nil {
+			if status.Code(err) == codes.NotFound {
+				return localErrs.NotFoundErr.WithMsg("alert rule not found").WithErr(err)
+			}
+			return err
+		}
+
+		var rule models.AlertRule
+		err = doc.DataTo(&rule)
+		if err != nil {
+			return localErrs.InternalServerErr.WithMsg("failed to parse alert rule struct").WithErr(err)
+		}
+		rule.UserID = userID
+
+		var changed bool
+		events, changed = evaluate(&rule)
+		if changed {
+			err = tx.Update(ref, []firestore.Update{
+				{Path: "status", Value: rule.Status},
+				{Path: "breached_since", Value: rule.BreachedSince},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		for _, event := range events {
+			err = tx.Set(a.events(userID).Doc(event.ID), event)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, transactionErr(err, "failed to evaluate alert rule")
+	}
+
+	return events, nil
+}
+
+func (a *alertRepository) AddEvent(ctx context.Context, userID string, event models.AlertEvent) error {
+	_, err := a.events(userID).Doc(event.ID).Set(ctx, event)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to add alert event").WithErr(err)
+	}
+
+	return nil
+}
+
+func (a *alertRepository) GetEvents(ctx context.Context, userID string, from, to time.Time) ([]models.AlertEvent, error) {
+	docs := a.events(userID).
+		Where("time", ">=", from).
+		Where("time", "<", to).
+		OrderBy("time", firestore.Desc).
+		Limit(MaxAlertEvents).
+		Documents(ctx)
+	defer docs.Stop()
+
+	events := make([]models.AlertEvent, 0)
+	for {
+		doc, err := docs.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve alert events").WithErr(err)
+		}
+
+		var event models.AlertEvent
+		err = doc.DataTo(&event)
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to parse alert event struct").WithErr(err)
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,52 @@
+package batch
+
+import "sync"
+
+// DefaultInFlight is how many writes a stream or a subscription keeps waiting
+// for a flush at once
+const DefaultInFlight = 64
+
+// Pipeline lets a sequential caller, like a stream or a subscription, keep many
+// writes waiting for the Writer flushes instead of waiting a whole flush for
+// each one. The results are reported in the order the writes were started so
+// they can be acknowledged in order
+type Pipeline struct {
+	slots chan struct{}
+	// reported is closed once the result of the last started write was reported
+	reported chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewPipeline returns a pipeline running at most inFlight writes at once
+func NewPipeline(inFlight int) *Pipeline {
+	reported := make(chan struct{})
+	close(reported)
+	return &Pipeline{
+		slots:    make(chan struct{}, max(inFlight, 1)),
+		reported: reported,
+	}
+}
+
+// Go starts write in the background, blocking while the pipeline is full.
+// report is called with the write's error after the earlier writes were
+// reported, and never concurrently with another report. Go must not be called
+// concurrently
+func (p *Pipeline) Go(write func() error, report func(err error)) {
+	p.slots <- struct{}{}
+	previous, reported := p.reported, make(chan struct{})
+	p.reported = reported
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		err := write()
+		<-previous
+		report(err)
+		close(reported)
+		<-p.slots
+	}()
+}
+
+// Wait blocks until the results of every started write were reported
+func (p *Pipeline) Wait() {
+	p.wg.Wait()
+}
@@ -0,0 +1,108 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+func TestPipelineReportsInOrder(t *testing.T) {
+	pipeline := NewPipeline(4)
+	failed := errors.New("failed")
+	var reported []int
+	var errs []error
+	for i := 0; i < 4; i++ {
+		i := i
+		pipeline.Go(func() error {
+			// the later writes finish first
+			time.Sleep(time.Duration(4-i) * 5 * time.Millisecond)
+			if i == 2 {
+				return failed
+			}
+			return nil
+		}, func(err error) {
+			reported = append(reported, i)
+			errs = append(errs, err)
+		})
+	}
+	pipeline.Wait()
+
+	assert.Equal(t, []int{0, 1, 2, 3}, reported)
+	assert.Equal(t, []error{nil, nil, failed, nil}, errs)
+}
+
+func TestPipelineBlocksWhenFull(t *testing.T) {
+	pipeline := NewPipeline(2)
+	release := make(chan struct{})
+	var running atomic.Int32
+	for i := 0; i < 2; i++ {
+		pipeline.Go(func() error {
+			running.Add(1)
+			<-release
+			return nil
+		}, func(err error) {})
+	}
+
+	started := make(chan struct{})
+	go func() {
+		pipeline.Go(func() error { return nil }, func(err error) {})
+		close(started)
+	}()
+	assert.Eventually(t, func() bool { return running.Load() == 2 }, time.Second, time.Millisecond)
+	select {
+	case <-started:
+		t.Fatal("a third write started while two were in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	<-started
+	pipeline.Wait()
+}
+
+func TestPipelineThroughput(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	const messages = 200
+	config := Config{MaxPoints: 5000, MaxBytes: 1 << 20, MaxLatency: 20 * time.Millisecond, BufferBytes: 1 << 20}
+	var written atomic.Int32
+	mock := storage.NewMockMetricRepository(ctrl)
+	mock.EXPECT().WriteMeasurement(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, requests ...models.SensorRequest) error {
+		written.Add(int32(len(requests)))
+		return nil
+	}).AnyTimes()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	writer := NewWriter(mock, config)
+	go writer.Run(context.Background(), stop)
+
+	// a single producer, like a stream or a subscription, writing one message
+	// at a time would take messages * MaxLatency
+	start := time.Now()
+	pipeline := NewPipeline(DefaultInFlight)
+	acknowledged := 0
+	for i := 0; i < messages; i++ {
+		request := models.SensorRequest{SensorID: "sensor", PH: float64(i)}
+		pipeline.Go(func() error {
+			return writer.WriteMeasurement(context.Background(), request)
+		}, func(err error) {
+			assert.Nil(t, err)
+			acknowledged++
+		})
+	}
+	pipeline.Wait()
+
+	assert.Equal(t, messages, acknowledged)
+	assert.Equal(t, int32(messages), written.Load())
+	assert.Less(t, time.Since(start), messages*config.MaxLatency/10)
+}
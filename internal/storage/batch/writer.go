@@ -0,0 +1,215 @@
+// Package batch coalesces the measurements written by many requests in larger
+// writes to the metric store
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+// pointOverhead approximates the line protocol size of a point without its tags
+const pointOverhead = 160
+
+// Config controls when buffered measurements are flushed, a flush happens as
+// soon as MaxPoints or MaxBytes are buffered or MaxLatency has passed.
+// Writes block while BufferBytes are waiting to be flushed
+type Config struct {
+	MaxPoints   int
+	MaxBytes    int
+	MaxLatency  time.Duration
+	BufferBytes int
+}
+
+// DefaultConfig flushes every second or when a write reaches a typical influx
+// batch size
+var DefaultConfig = Config{
+	MaxPoints:   5000,
+	MaxBytes:    1 << 20,
+	MaxLatency:  time.Second,
+	BufferBytes: 16 << 20,
+}
+
+// write is a buffered WriteMeasurement call, done is closed once every one of
+// its measurements was written and err is set
+type write struct {
+	done chan struct{}
+	err  error
+}
+
+// fail keeps the most severe error of the batches of the write, a deferred
+// write only hides success
+func (w *write) fail(err error) {
+	if err == nil {
+		return
+	}
+	if w.err == nil || (errors.Is(w.err, localErrs.AcceptedErr) && !errors.Is(err, localErrs.AcceptedErr)) {
+		w.err = err
+	}
+}
+
+// Writer buffers measurements and writes them in batches to the wrapped
+// repository, reads are served by the wrapped repository
+type Writer struct {
+	storage.MetricRepository
+	config Config
+	flush  chan struct{}
+
+	mu      sync.Mutex
+	pending []models.SensorRequest
+	// writes holds the call which buffered each pending measurement
+	writes []*write
+	bytes  int
+	// drained is closed every time the pending measurements are taken
+	drained chan struct{}
+	// flushing serializes the writes so batches are written in order
+	flushing sync.Mutex
+}
+
+func NewWriter(next storage.MetricRepository, config Config) *Writer {
+	return &Writer{
+		MetricRepository: next,
+		config:           config,
+		flush:            make(chan struct{}, 1),
+		drained:          make(chan struct{}),
+	}
+}
+
+// pointBytes approximates the size of a measurement in line protocol
+func pointBytes(request models.SensorRequest) int {
+	return len(request.SensorID) + len(request.SensorVersion) + len(request.Alias) + pointOverhead
+}
+
+// WriteMeasurement buffers the measurements and waits for the flush writing
+// them, returning the error of their batches so nothing is acknowledged before
+// it's written. ServiceUnavailableErr is returned when the context is done
+// before the buffer has room or before the measurements are written
+func (w *Writer) WriteMeasurement(ctx context.Context, requests ...models.SensorRequest) error {
+	if len(requests) == 0 {
+		return nil
+	}
+	size := 0
+	for _, request := range requests {
+		size += pointBytes(request)
+	}
+
+	w.mu.Lock()
+	// a write larger than the buffer is accepted once the buffer is empty
+	for len(w.pending) > 0 && w.bytes+size > w.config.BufferBytes {
+		drained := w.drained
+		w.mu.Unlock()
+		w.requestFlush()
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			return localErrs.ServiceUnavailableErr.WithMsg("metrics buffer is full").WithErr(ctx.Err())
+		}
+		w.mu.Lock()
+	}
+
+	buffered := &write{done: make(chan struct{})}
+	w.pending = append(w.pending, requests...)
+	for range requests {
+		w.writes = append(w.writes, buffered)
+	}
+	w.bytes += size
+	full := len(w.pending) >= w.config.MaxPoints || w.bytes >= w.config.MaxBytes
+	w.mu.Unlock()
+
+	if full {
+		w.requestFlush()
+	}
+	select {
+	case <-buffered.done:
+		return buffered.err
+	case <-ctx.Done():
+		return localErrs.ServiceUnavailableErr.WithMsg("metrics weren't written yet").WithErr(ctx.Err())
+	}
+}
+
+func (w *Writer) requestFlush() {
+	select {
+	case w.flush <- struct{}{}:
+	default:
+	}
+}
+
+// Run flushes the buffer with ctx when it's full or every MaxLatency until
+// stop is closed, an ongoing flush isn't interrupted by stop. Flush must be
+// called afterwards to write the remaining measurements
+func (w *Writer) Run(ctx context.Context, stop <-chan struct{}) {
+	ticker := time.NewTicker(w.config.MaxLatency)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-w.flush:
+		case <-ticker.C:
+		}
+
+		err := w.Flush(ctx)
+		if err != nil {
+			log.Error().Err(err).Msg("failed to flush buffered metrics")
+		}
+	}
+}
+
+// Flush writes every buffered measurement in batches of at most MaxPoints or
+// MaxBytes, the error of each batch is returned to the writes waiting for it
+func (w *Writer) Flush(ctx context.Context) error {
+	w.flushing.Lock()
+	defer w.flushing.Unlock()
+
+	w.mu.Lock()
+	pending, writes := w.pending, w.writes
+	w.pending, w.writes = nil, nil
+	w.bytes = 0
+	close(w.drained)
+	w.drained = make(chan struct{})
+	w.mu.Unlock()
+
+	taken := writes
+	var errs []error
+	for len(pending) > 0 {
+		count, size := 0, 0
+		for count < len(pending) && count < w.config.MaxPoints && (count == 0 || size+pointBytes(pending[count]) <= w.config.MaxBytes) {
+			size += pointBytes(pending[count])
+			count++
+		}
+
+		err := w.MetricRepository.WriteMeasurement(ctx, pending[:count]...)
+		for _, write := range writes[:count] {
+			write.fail(err)
+		}
+		// deferred writes were already persisted somewhere else
+		if err != nil && !errors.Is(err, localErrs.AcceptedErr) {
+			errs = append(errs, err)
+		}
+		pending, writes = pending[count:], writes[count:]
+	}
+	// the measurements of a write are buffered next to each other
+	for i, write := range taken {
+		if i == 0 || taken[i-1] != write {
+			close(write.done)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// DeleteMeasurements flushes the buffer first, so buffered measurements in the
+// range are deleted as well
+func (w *Writer) DeleteMeasurements(ctx context.Context, query models.MeasurementQuery) error {
+	err := w.Flush(ctx)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to flush buffered metrics").WithErr(err)
+	}
+	return w.MetricRepository.DeleteMeasurements(ctx, query)
+}
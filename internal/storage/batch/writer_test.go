@@ -0,0 +1,205 @@
+package batch
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+// buffer starts a write and waits until its measurements are buffered, the
+// write's result is sent to the returned channel
+func buffer(t *testing.T, ctx context.Context, writer *Writer, requests ...models.SensorRequest) <-chan error {
+	writer.mu.Lock()
+	buffered := len(writer.pending) + len(requests)
+	writer.mu.Unlock()
+
+	result := make(chan error, 1)
+	go func() {
+		result <- writer.WriteMeasurement(ctx, requests...)
+	}()
+	assert.Eventually(t, func() bool {
+		writer.mu.Lock()
+		defer writer.mu.Unlock()
+		return len(writer.pending) == buffered
+	}, time.Second, time.Millisecond)
+	return result
+}
+
+func TestFlush(t *testing.T) {
+	first := models.SensorRequest{SensorID: "sensor", PH: 6.0}
+	second := models.SensorRequest{SensorID: "sensor", PH: 7.0}
+	third := models.SensorRequest{SensorID: "other", PH: 8.0}
+	var tests = []struct {
+		name   string
+		config Config
+		setup  func(mock *storage.MockMetricRepository)
+		assert func(t *testing.T, err, firstErr, secondErr error)
+	}{
+		{
+			name:   "writes from many requests are coalesced",
+			config: DefaultConfig,
+			setup: func(mock *storage.MockMetricRepository) {
+				mock.EXPECT().WriteMeasurement(gomock.Any(), first, second, third).Return(nil).Times(1)
+			},
+			assert: func(t *testing.T, err, firstErr, secondErr error) {
+				assert.Nil(t, err)
+				assert.Nil(t, firstErr)
+				assert.Nil(t, secondErr)
+			},
+		},
+		{
+			name:   "batches are split by points",
+			config: Config{MaxPoints: 2, MaxBytes: 1 << 20, MaxLatency: time.Second, BufferBytes: 1 << 20},
+			setup: func(mock *storage.MockMetricRepository) {
+				gomock.InOrder(
+					mock.EXPECT().WriteMeasurement(gomock.Any(), first, second).Return(nil).Times(1),
+					mock.EXPECT().WriteMeasurement(gomock.Any(), third).Return(nil).Times(1),
+				)
+			},
+			assert: func(t *testing.T, err, firstErr, secondErr error) {
+				assert.Nil(t, err)
+				assert.Nil(t, firstErr)
+				assert.Nil(t, secondErr)
+			},
+		},
+		{
+			name:   "batches are split by bytes",
+			config: Config{MaxPoints: 100, MaxBytes: 2*pointOverhead + 12, MaxLatency: time.Second, BufferBytes: 1 << 20},
+			setup: func(mock *storage.MockMetricRepository) {
+				gomock.InOrder(
+					mock.EXPECT().WriteMeasurement(gomock.Any(), first, second).Return(nil).Times(1),
+					mock.EXPECT().WriteMeasurement(gomock.Any(), third).Return(nil).Times(1),
+				)
+			},
+			assert: func(t *testing.T, err, firstErr, secondErr error) {
+				assert.Nil(t, err)
+				assert.Nil(t, firstErr)
+				assert.Nil(t, secondErr)
+			},
+		},
+		{
+			name:   "failed batches are returned to their writes only",
+			config: Config{MaxPoints: 2, MaxBytes: 1 << 20, MaxLatency: time.Second, BufferBytes: 1 << 20},
+			setup: func(mock *storage.MockMetricRepository) {
+				gomock.InOrder(
+					mock.EXPECT().WriteMeasurement(gomock.Any(), first, second).Return(localErrs.InternalServerErr).Times(1),
+					mock.EXPECT().WriteMeasurement(gomock.Any(), third).Return(nil).Times(1),
+				)
+			},
+			assert: func(t *testing.T, err, firstErr, secondErr error) {
+				assert.ErrorIs(t, err, localErrs.InternalServerErr)
+				assert.ErrorIs(t, firstErr, localErrs.InternalServerErr)
+				assert.Nil(t, secondErr)
+			},
+		},
+		{
+			name:   "a write fails when any of its batches fails",
+			config: Config{MaxPoints: 1, MaxBytes: 1 << 20, MaxLatency: time.Second, BufferBytes: 1 << 20},
+			setup: func(mock *storage.MockMetricRepository) {
+				gomock.InOrder(
+					mock.EXPECT().WriteMeasurement(gomock.Any(), first).Return(localErrs.AcceptedErr).Times(1),
+					mock.EXPECT().WriteMeasurement(gomock.Any(), second).Return(localErrs.InternalServerErr).Times(1),
+					mock.EXPECT().WriteMeasurement(gomock.Any(), third).Return(nil).Times(1),
+				)
+			},
+			assert: func(t *testing.T, err, firstErr, secondErr error) {
+				assert.ErrorIs(t, err, localErrs.InternalServerErr)
+				assert.ErrorIs(t, firstErr, localErrs.InternalServerErr)
+				assert.Nil(t, secondErr)
+			},
+		},
+		{
+			name:   "deferred writes aren't failures but are reported",
+			config: DefaultConfig,
+			setup: func(mock *storage.MockMetricRepository) {
+				mock.EXPECT().WriteMeasurement(gomock.Any(), first, second, third).Return(localErrs.AcceptedErr).Times(1)
+			},
+			assert: func(t *testing.T, err, firstErr, secondErr error) {
+				assert.Nil(t, err)
+				assert.ErrorIs(t, firstErr, localErrs.AcceptedErr)
+				assert.ErrorIs(t, secondErr, localErrs.AcceptedErr)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			ctx := context.Background()
+			mock := storage.NewMockMetricRepository(ctrl)
+			tt.setup(mock)
+			writer := NewWriter(mock, tt.config)
+			firstResult := buffer(t, ctx, writer, first, second)
+			secondResult := buffer(t, ctx, writer, third)
+
+			err := writer.Flush(ctx)
+			tt.assert(t, err, <-firstResult, <-secondResult)
+		})
+	}
+}
+
+func TestRunFlushesWhenFull(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	request := models.SensorRequest{SensorID: "sensor", PH: 6.0}
+	mock := storage.NewMockMetricRepository(ctrl)
+	mock.EXPECT().WriteMeasurement(gomock.Any(), request, request).Return(nil).Times(1)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	writer := NewWriter(mock, Config{MaxPoints: 2, MaxBytes: 1 << 20, MaxLatency: time.Hour, BufferBytes: 1 << 20})
+	go writer.Run(context.Background(), stop)
+
+	result := buffer(t, ctx, writer, request)
+	assert.Nil(t, writer.WriteMeasurement(ctx, request))
+	assert.Nil(t, <-result)
+}
+
+func TestRunStopDoesNotCancelFlush(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	request := models.SensorRequest{SensorID: "sensor", PH: 6.0}
+	stop := make(chan struct{})
+	mock := storage.NewMockMetricRepository(ctrl)
+	mock.EXPECT().WriteMeasurement(gomock.Any(), request).DoAndReturn(func(ctx context.Context, requests ...models.SensorRequest) error {
+		close(stop)
+		time.Sleep(10 * time.Millisecond)
+		return ctx.Err()
+	}).Times(1)
+
+	writer := NewWriter(mock, Config{MaxPoints: 1, MaxBytes: 1 << 20, MaxLatency: time.Hour, BufferBytes: 1 << 20})
+	done := make(chan struct{})
+	go func() {
+		writer.Run(context.Background(), stop)
+		close(done)
+	}()
+
+	assert.Nil(t, writer.WriteMeasurement(context.Background(), request))
+	<-done
+}
+
+func TestWriteMeasurementBackpressure(t *testing.T) {
+	request := models.SensorRequest{SensorID: "sensor", PH: 6.0}
+	writer := NewWriter(nil, Config{MaxPoints: 100, MaxBytes: 1 << 20, MaxLatency: time.Hour, BufferBytes: pointOverhead + 6})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	result := buffer(t, ctx, writer, request)
+	err := writer.WriteMeasurement(ctx, request)
+	assert.ErrorIs(t, err, localErrs.ServiceUnavailableErr)
+	// the buffered write isn't acknowledged before it's written either
+	assert.ErrorIs(t, <-result, localErrs.ServiceUnavailableErr)
+}
@@ -0,0 +1,16 @@
+package storage
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/InfluxCommunity/influxdb3-go/influx"
+)
+
+// isRejection tells if influx refused the request itself, unlike the server
+// errors and throttling retrying it can't succeed
+func isRejection(err error) bool {
+	var serverErr *influx.ServerError
+	return errors.As(err, &serverErr) && serverErr.StatusCode >= http.StatusBadRequest &&
+		serverErr.StatusCode < http.StatusInternalServerError && serverErr.StatusCode != http.StatusTooManyRequests
+}
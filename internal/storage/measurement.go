@@ -2,15 +2,29 @@ package storage
 
 import (
 	"context"
+	"fmt"
+	"strings"
 	"time"
 
+	"github.com/InfluxCommunity/influxdb3-go/influx"
+	"github.com/apache/arrow/go/v12/arrow"
+
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
 )
 
-// MetricRepository implement functions for persisting data
+// MetricRepository implement functions for persisting and retrieving data
 type MetricRepository interface {
 	WriteMeasurement(ctx context.Context, request ...models.SensorRequest) error
+	ReadMeasurements(ctx context.Context, query models.MeasurementQuery) ([]models.Measurement, error)
+	ReadLatestMeasurements(ctx context.Context, sensorIDs ...string) ([]models.Measurement, error)
+	StreamMeasurements(ctx context.Context, query models.MeasurementQuery, handle func(models.Measurement) error) error
+	// DeleteMeasurements deletes the measurements of query.SensorID in the [From, To) range
+	DeleteMeasurements(ctx context.Context, query models.MeasurementQuery) error
+	// SupportsDeletes tells if DeleteMeasurements is implemented by the store
+	SupportsDeletes() bool
+	// CountMeasurements counts the measurements of query.SensorID in the [From, To) range
+	CountMeasurements(ctx context.Context, query models.MeasurementQuery) (int64, error)
 }
 
 // SensorMeasurement represents the database data structure
@@ -38,13 +52,21 @@ type repository struct {
 //go:generate mockgen -destination measurement_mock.go -package storage github.com/WendelHime/hydroponics-metrics-collector/internal/storage InfluxClient,MetricRepository
 type InfluxClient interface {
 	WriteData(ctx context.Context, database string, points ...any) error
+	Query(ctx context.Context, database string, query string, queryParams ...string) (*influx.QueryIterator, error)
+}
+
+// rowIterator is the subset of the influx query iterator used to read rows
+type rowIterator interface {
+	Next() bool
+	Value() map[string]any
 }
 
 func NewRepository(database string, client InfluxClient) MetricRepository {
 	return &repository{database: database, cli: client}
 }
 
-func parseRequestToMeasurement(r models.SensorRequest) SensorMeasurement {
+// ParseRequestToMeasurement maps a sensor request to the stored data structure
+func ParseRequestToMeasurement(r models.SensorRequest) SensorMeasurement {
 	measurement := SensorMeasurement{
 		Table:            "metrics",
 		SensorID:         r.SensorID,
@@ -64,7 +86,7 @@ func parseRequestToMeasurement(r models.SensorRequest) SensorMeasurement {
 func parseRequestsToMeasurements(requests ...models.SensorRequest) []any {
 	measurements := make([]any, len(requests))
 	for i, r := range requests {
-		measurements[i] = parseRequestToMeasurement(r)
+		measurements[i] = ParseRequestToMeasurement(r)
 	}
 	return measurements
 }
@@ -72,9 +94,204 @@ func parseRequestsToMeasurements(requests ...models.SensorRequest) []any {
 func (r repository) WriteMeasurement(ctx context.Context, request ...models.SensorRequest) error {
 	measurements := parseRequestsToMeasurements(request...)
 	err := r.cli.WriteData(ctx, r.database, measurements...)
+	if isRejection(err) {
+		return errors.BadRequestErr.WithMsg("data rejected by the metric store").WithErr(err)
+	}
 	if err != nil {
 		return errors.InternalServerErr.WithMsg("failed to write data").WithErr(err)
 	}
 
 	return nil
 }
+
+func (r repository) ReadMeasurements(ctx context.Context, query models.MeasurementQuery) ([]models.Measurement, error) {
+	iterator, err := r.cli.Query(ctx, r.database, buildReadQuery(query))
+	if err != nil {
+		return nil, errors.InternalServerErr.WithMsg("failed to query data").WithErr(err)
+	}
+
+	return parseRowsToMeasurements(iterator, query.Fields)
+}
+
+// StreamMeasurements calls handle for every measurement as soon as it's read,
+// so large ranges don't need to fit in memory
+func (r repository) StreamMeasurements(ctx context.Context, query models.MeasurementQuery, handle func(models.Measurement) error) error {
+	iterator, err := r.cli.Query(ctx, r.database, buildReadQuery(query))
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to query data").WithErr(err)
+	}
+
+	return iterateMeasurements(iterator, query.Fields, handle)
+}
+
+func (r repository) ReadLatestMeasurements(ctx context.Context, sensorIDs ...string) ([]models.Measurement, error) {
+	if len(sensorIDs) == 0 {
+		return []models.Measurement{}, nil
+	}
+
+	iterator, err := r.cli.Query(ctx, r.database, buildLatestQuery(sensorIDs))
+	if err != nil {
+		return nil, errors.InternalServerErr.WithMsg("failed to query latest data").WithErr(err)
+	}
+
+	return parseRowsToMeasurements(iterator, models.MeasurementFields)
+}
+
+// DeleteMeasurements isn't supported by InfluxDB 3, which has no delete API,
+// data is only removed by the retention period of the database
+func (r repository) DeleteMeasurements(ctx context.Context, query models.MeasurementQuery) error {
+	return errors.NotImplementedErr.WithMsg("influx doesn't support deleting measurements")
+}
+
+func (r repository) SupportsDeletes() bool {
+	return false
+}
+
+func (r repository) CountMeasurements(ctx context.Context, query models.MeasurementQuery) (int64, error) {
+	iterator, err := r.cli.Query(ctx, r.database, buildCountQuery(query))
+	if err != nil {
+		return 0, errors.InternalServerErr.WithMsg("failed to count data").WithErr(err)
+	}
+
+	return parseCount(iterator)
+}
+
+// quote escapes a value so it can be used as a SQL string literal
+func quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", "''") + "'"
+}
+
+// aggregationFunctions maps the supported aggregations to their SQL functions
+var aggregationFunctions = map[string]string{
+	models.AggregationMean:  "avg(%s)",
+	models.AggregationMin:   "min(%s)",
+	models.AggregationMax:   "max(%s)",
+	models.AggregationLast:  "last_value(%s ORDER BY time)",
+	models.AggregationCount: "count(%s)",
+}
+
+func buildReadQuery(query models.MeasurementQuery) string {
+	columns := []string{"time", "sensor_id", "sensor_version", "alias"}
+	groupBy := ""
+	if len(query.Aggregation) > 0 {
+		columns[0] = fmt.Sprintf("date_bin(INTERVAL '%d seconds', time) AS time", int64(query.Window.Seconds()))
+		for _, field := range query.Fields {
+			columns = append(columns, fmt.Sprintf(aggregationFunctions[query.Aggregation], field)+" AS "+field)
+		}
+		groupBy = " GROUP BY 1, sensor_id, sensor_version, alias"
+	} else {
+		columns = append(columns, query.Fields...)
+	}
+
+	limit := ""
+	if query.Limit > 0 {
+		limit = fmt.Sprintf(" LIMIT %d", query.Limit)
+	}
+
+	return fmt.Sprintf(
+		"SELECT %s FROM metrics WHERE sensor_id = %s AND time >= %s AND time < %s%s ORDER BY time%s",
+		strings.Join(columns, ", "),
+		quote(query.SensorID),
+		quote(query.From.UTC().Format(time.RFC3339Nano)),
+		quote(query.To.UTC().Format(time.RFC3339Nano)),
+		groupBy,
+		limit,
+	)
+}
+
+func buildCountQuery(query models.MeasurementQuery) string {
+	return fmt.Sprintf(
+		"SELECT count(*) AS count FROM metrics WHERE sensor_id = %s AND time >= %s AND time < %s",
+		quote(query.SensorID),
+		quote(query.From.UTC().Format(time.RFC3339Nano)),
+		quote(query.To.UTC().Format(time.RFC3339Nano)),
+	)
+}
+
+// parseCount reads the count column of the single row returned by a count query
+func parseCount(iterator rowIterator) (int64, error) {
+	if !iterator.Next() {
+		return 0, nil
+	}
+	value := iterator.Value()["count"]
+	count, ok := value.(int64)
+	if !ok {
+		return 0, errors.InternalServerErr.WithMsg("unexpected count type").WithDetails("type", fmt.Sprintf("%T", value))
+	}
+	return count, nil
+}
+
+// latestLookback bounds the scan of the latest measurements query, readings
+// can't be registered once they're older than 30 days
+const latestLookback = "30 days"
+
+func buildLatestQuery(sensorIDs []string) string {
+	quoted := make([]string, len(sensorIDs))
+	for i, sensorID := range sensorIDs {
+		quoted[i] = quote(sensorID)
+	}
+
+	columns := strings.Join(append([]string{"time", "sensor_id", "sensor_version", "alias"}, models.MeasurementFields...), ", ")
+	return fmt.Sprintf(
+		"SELECT %s FROM (SELECT %s, row_number() OVER (PARTITION BY sensor_id ORDER BY time DESC) AS position FROM metrics WHERE sensor_id IN (%s) AND time >= now() - INTERVAL '%s') WHERE position = 1",
+		columns,
+		columns,
+		strings.Join(quoted, ", "),
+		latestLookback,
+	)
+}
+
+func iterateMeasurements(iterator rowIterator, fields []string, handle func(models.Measurement) error) error {
+	for iterator.Next() {
+		measurement, err := parseRowToMeasurement(iterator.Value(), fields)
+		if err != nil {
+			return err
+		}
+
+		err = handle(measurement)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func parseRowsToMeasurements(iterator rowIterator, fields []string) ([]models.Measurement, error) {
+	measurements := make([]models.Measurement, 0)
+	err := iterateMeasurements(iterator, fields, func(measurement models.Measurement) error {
+		measurements = append(measurements, measurement)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return measurements, nil
+}
+
+func parseRowToMeasurement(row map[string]any, fields []string) (models.Measurement, error) {
+	timestamp, ok := row["time"].(arrow.Timestamp)
+	if !ok {
+		return models.Measurement{}, errors.InternalServerErr.WithMsg("unexpected time column type").WithDetails("time", row["time"])
+	}
+
+	measurement := models.Measurement{
+		Time:   time.Unix(0, int64(timestamp)).UTC(),
+		Fields: make(map[string]float64, len(fields)),
+	}
+	measurement.SensorID, _ = row["sensor_id"].(string)
+	measurement.SensorVersion, _ = row["sensor_version"].(string)
+	measurement.Alias, _ = row["alias"].(string)
+
+	for _, field := range fields {
+		// null values are returned when the field wasn't written for this point
+		switch value := row[field].(type) {
+		case float64:
+			measurement.Fields[field] = value
+		case int64:
+			measurement.Fields[field] = float64(value)
+		case uint64:
+			measurement.Fields[field] = float64(value)
+		}
+	}
+	return measurement, nil
+}
@@ -8,6 +8,7 @@ import (
 	context "context"
 	reflect "reflect"
 
+	influx "github.com/InfluxCommunity/influxdb3-go/influx"
 	models "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
 	gomock "go.uber.org/mock/gomock"
 )
@@ -35,6 +36,26 @@ func (m *MockInfluxClient) EXPECT() *MockInfluxClientMockRecorder {
 	return m.recorder
 }
 
+// Query mocks base method.
+func (m *MockInfluxClient) Query(arg0 context.Context, arg1, arg2 string, arg3 ...string) (*influx.QueryIterator, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0, arg1, arg2}
+	for _, a := range arg3 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "Query", varargs...)
+	ret0, _ := ret[0].(*influx.QueryIterator)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Query indicates an expected call of Query.
+func (mr *MockInfluxClientMockRecorder) Query(arg0, arg1, arg2 interface{}, arg3 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0, arg1, arg2}, arg3...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Query", reflect.TypeOf((*MockInfluxClient)(nil).Query), varargs...)
+}
+
 // WriteData mocks base method.
 func (m *MockInfluxClient) WriteData(arg0 context.Context, arg1 string, arg2 ...interface{}) error {
 	m.ctrl.T.Helper()
@@ -77,6 +98,98 @@ func (m *MockMetricRepository) EXPECT() *MockMetricRepositoryMockRecorder {
 	return m.recorder
 }
 
+// CountMeasurements mocks base method.
+func (m *MockMetricRepository) CountMeasurements(arg0 context.Context, arg1 models.MeasurementQuery) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CountMeasurements", arg0, arg1)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CountMeasurements indicates an expected call of CountMeasurements.
+func (mr *MockMetricRepositoryMockRecorder) CountMeasurements(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CountMeasurements", reflect.TypeOf((*MockMetricRepository)(nil).CountMeasurements), arg0, arg1)
+}
+
+// DeleteMeasurements mocks base method.
+func (m *MockMetricRepository) DeleteMeasurements(arg0 context.Context, arg1 models.MeasurementQuery) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteMeasurements", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteMeasurements indicates an expected call of DeleteMeasurements.
+func (mr *MockMetricRepositoryMockRecorder) DeleteMeasurements(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteMeasurements", reflect.TypeOf((*MockMetricRepository)(nil).DeleteMeasurements), arg0, arg1)
+}
+
+// ReadLatestMeasurements mocks base method.
+func (m *MockMetricRepository) ReadLatestMeasurements(arg0 context.Context, arg1 ...string) ([]models.Measurement, error) {
+	m.ctrl.T.Helper()
+	varargs := []interface{}{arg0}
+	for _, a := range arg1 {
+		varargs = append(varargs, a)
+	}
+	ret := m.ctrl.Call(m, "ReadLatestMeasurements", varargs...)
+	ret0, _ := ret[0].([]models.Measurement)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadLatestMeasurements indicates an expected call of ReadLatestMeasurements.
+func (mr *MockMetricRepositoryMockRecorder) ReadLatestMeasurements(arg0 interface{}, arg1 ...interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	varargs := append([]interface{}{arg0}, arg1...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadLatestMeasurements", reflect.TypeOf((*MockMetricRepository)(nil).ReadLatestMeasurements), varargs...)
+}
+
+// ReadMeasurements mocks base method.
+func (m *MockMetricRepository) ReadMeasurements(arg0 context.Context, arg1 models.MeasurementQuery) ([]models.Measurement, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReadMeasurements", arg0, arg1)
+	ret0, _ := ret[0].([]models.Measurement)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ReadMeasurements indicates an expected call of ReadMeasurements.
+func (mr *MockMetricRepositoryMockRecorder) ReadMeasurements(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReadMeasurements", reflect.TypeOf((*MockMetricRepository)(nil).ReadMeasurements), arg0, arg1)
+}
+
+// StreamMeasurements mocks base method.
+func (m *MockMetricRepository) StreamMeasurements(arg0 context.Context, arg1 models.MeasurementQuery, arg2 func(models.Measurement) error) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "StreamMeasurements", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// StreamMeasurements indicates an expected call of StreamMeasurements.
+func (mr *MockMetricRepositoryMockRecorder) StreamMeasurements(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "StreamMeasurements", reflect.TypeOf((*MockMetricRepository)(nil).StreamMeasurements), arg0, arg1, arg2)
+}
+
+// SupportsDeletes mocks base method.
+func (m *MockMetricRepository) SupportsDeletes() bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SupportsDeletes")
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// SupportsDeletes indicates an expected call of SupportsDeletes.
+func (mr *MockMetricRepositoryMockRecorder) SupportsDeletes() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SupportsDeletes", reflect.TypeOf((*MockMetricRepository)(nil).SupportsDeletes))
+}
+
 // WriteMeasurement mocks base method.
 func (m *MockMetricRepository) WriteMeasurement(arg0 context.Context, arg1 ...models.SensorRequest) error {
 	m.ctrl.T.Helper()
@@ -6,6 +6,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/InfluxCommunity/influxdb3-go/influx"
+	"github.com/apache/arrow/go/v12/arrow"
+
 	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
 	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
 	"github.com/stretchr/testify/assert"
@@ -131,6 +134,32 @@ func TestWriteMeasurement(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Should return bad request when influx rejects the points",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+			},
+			metricRepository: func() MetricRepository {
+				db := "hydroponics"
+				mock := NewMockInfluxClient(ctrl)
+				mock.EXPECT().WriteData(gomock.Any(), db, gomock.Any()).Return(&influx.ServerError{StatusCode: 422, Message: "invalid field type"})
+				return NewRepository(db, mock)
+			},
+			givenRequests: []models.SensorRequest{{SensorID: "test", Time: now}},
+		},
+		{
+			name: "Should return internal server error when influx throttles the writes",
+			assert: func(t *testing.T, err error) {
+				assert.ErrorIs(t, err, localErrs.InternalServerErr)
+			},
+			metricRepository: func() MetricRepository {
+				db := "hydroponics"
+				mock := NewMockInfluxClient(ctrl)
+				mock.EXPECT().WriteData(gomock.Any(), db, gomock.Any()).Return(&influx.ServerError{StatusCode: 429})
+				return NewRepository(db, mock)
+			},
+			givenRequests: []models.SensorRequest{{SensorID: "test", Time: now}},
+		},
 	}
 	for _, tt := range tests {
 		tt := tt
@@ -140,3 +169,163 @@ func TestWriteMeasurement(t *testing.T) {
 		})
 	}
 }
+
+// sliceIterator feeds predefined rows as if they were returned by influx
+type sliceIterator struct {
+	rows  []map[string]any
+	index int
+}
+
+func (s *sliceIterator) Next() bool {
+	s.index++
+	return s.index <= len(s.rows)
+}
+
+func (s *sliceIterator) Value() map[string]any {
+	return s.rows[s.index-1]
+}
+
+func TestBuildReadQuery(t *testing.T) {
+	from := time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	query := buildReadQuery(models.MeasurementQuery{
+		SensorID: "sensor'1",
+		From:     from,
+		To:       to,
+		Fields:   []string{"ph", "ec"},
+	})
+	assert.Equal(t, "SELECT time, sensor_id, sensor_version, alias, ph, ec FROM metrics WHERE sensor_id = 'sensor''1' AND time >= '2023-08-01T00:00:00Z' AND time < '2023-08-01T01:00:00Z' ORDER BY time", query)
+
+	query = buildReadQuery(models.MeasurementQuery{
+		SensorID:    "sensor1",
+		From:        from,
+		To:          to,
+		Fields:      []string{"ph", "ec"},
+		Aggregation: models.AggregationLast,
+		Window:      15 * time.Minute,
+		Limit:       1000,
+	})
+	assert.Equal(t, "SELECT date_bin(INTERVAL '900 seconds', time) AS time, sensor_id, sensor_version, alias, last_value(ph ORDER BY time) AS ph, last_value(ec ORDER BY time) AS ec FROM metrics WHERE sensor_id = 'sensor1' AND time >= '2023-08-01T00:00:00Z' AND time < '2023-08-01T01:00:00Z' GROUP BY 1, sensor_id, sensor_version, alias ORDER BY time LIMIT 1000", query)
+}
+
+func TestBuildLatestQuery(t *testing.T) {
+	query := buildLatestQuery([]string{"sensor1", "sensor2"})
+	assert.Equal(t, "SELECT time, sensor_id, sensor_version, alias, temperature, humidity, ph, tds, ec, water_temperature FROM (SELECT time, sensor_id, sensor_version, alias, temperature, humidity, ph, tds, ec, water_temperature, row_number() OVER (PARTITION BY sensor_id ORDER BY time DESC) AS position FROM metrics WHERE sensor_id IN ('sensor1', 'sensor2') AND time >= now() - INTERVAL '30 days') WHERE position = 1", query)
+}
+
+func TestBuildCountQuery(t *testing.T) {
+	from := time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)
+	query := buildCountQuery(models.MeasurementQuery{SensorID: "sensor1", From: from, To: from.Add(time.Hour)})
+	assert.Equal(t, "SELECT count(*) AS count FROM metrics WHERE sensor_id = 'sensor1' AND time >= '2023-08-01T00:00:00Z' AND time < '2023-08-01T01:00:00Z'", query)
+}
+
+func TestParseCount(t *testing.T) {
+	count, err := parseCount(&sliceIterator{rows: []map[string]any{{"count": int64(42)}}})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(42), count)
+	count, err = parseCount(&sliceIterator{})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), count)
+	_, err = parseCount(&sliceIterator{rows: []map[string]any{{"count": 42.0}}})
+	assert.ErrorIs(t, err, localErrs.InternalServerErr)
+}
+
+func TestParseRowsToMeasurements(t *testing.T) {
+	now := time.Now().UTC()
+	var tests = []struct {
+		name      string
+		assert    func(t *testing.T, measurements []models.Measurement, err error)
+		givenRows []map[string]any
+	}{
+		{
+			name: "parse rows with success",
+			assert: func(t *testing.T, measurements []models.Measurement, err error) {
+				assert.Nil(t, err)
+				assert.Equal(t, []models.Measurement{
+					{
+						SensorID:      "test",
+						SensorVersion: "0.0.1",
+						Alias:         "test",
+						Time:          now,
+						Fields:        map[string]float64{"ph": 6.2},
+					},
+				}, measurements)
+			},
+			givenRows: []map[string]any{
+				{
+					"time":           arrow.Timestamp(now.UnixNano()),
+					"sensor_id":      "test",
+					"sensor_version": "0.0.1",
+					"alias":          "test",
+					"ph":             6.2,
+					"ec":             nil,
+				},
+			},
+		},
+		{
+			name: "counts are parsed as floats",
+			assert: func(t *testing.T, measurements []models.Measurement, err error) {
+				assert.Nil(t, err)
+				if assert.Len(t, measurements, 1) {
+					assert.Equal(t, map[string]float64{"ph": 90, "ec": 89}, measurements[0].Fields)
+				}
+			},
+			givenRows: []map[string]any{
+				{"time": arrow.Timestamp(now.UnixNano()), "ph": int64(90), "ec": uint64(89)},
+			},
+		},
+		{
+			name: "no rows should return an empty list",
+			assert: func(t *testing.T, measurements []models.Measurement, err error) {
+				assert.Nil(t, err)
+				assert.Empty(t, measurements)
+			},
+			givenRows: []map[string]any{},
+		},
+		{
+			name: "unexpected time type should return internal server error",
+			assert: func(t *testing.T, measurements []models.Measurement, err error) {
+				if assert.Error(t, err) {
+					assert.ErrorIs(t, err, localErrs.InternalServerErr)
+				}
+			},
+			givenRows: []map[string]any{{"time": "now"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			measurements, err := parseRowsToMeasurements(&sliceIterator{rows: tt.givenRows}, []string{"ph", "ec"})
+			tt.assert(t, measurements, err)
+		})
+	}
+}
+
+func TestReadMeasurements(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	db := "hydroponics"
+	mock := NewMockInfluxClient(ctrl)
+	mock.EXPECT().Query(gomock.Any(), db, gomock.Any()).Return(nil, errors.New("random error"))
+
+	_, err := NewRepository(db, mock).ReadMeasurements(context.Background(), models.MeasurementQuery{
+		SensorID: "test",
+		From:     time.Now().Add(-time.Hour),
+		To:       time.Now(),
+		Fields:   []string{"ph"},
+	})
+	if assert.Error(t, err) {
+		assert.ErrorIs(t, err, localErrs.InternalServerErr)
+	}
+}
+
+func TestDeleteMeasurements(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	repository := NewRepository("hydroponics", NewMockInfluxClient(ctrl))
+	assert.False(t, repository.SupportsDeletes())
+	err := repository.DeleteMeasurements(context.Background(), models.MeasurementQuery{SensorID: "sensor", From: time.Unix(0, 0), To: time.Now()})
+	assert.ErrorIs(t, err, localErrs.NotImplementedErr)
+}
@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+type alertRepository struct {
+	mu     sync.RWMutex
+	rules  map[string]map[string]models.AlertRule
+	events map[string]map[string]models.AlertEvent
+}
+
+func NewAlertRepository() storage.AlertRepository {
+	return &alertRepository{
+		rules:  make(map[string]map[string]models.AlertRule),
+		events: make(map[string]map[string]models.AlertEvent),
+	}
+}
+
+func (a *alertRepository) CreateRule(ctx context.Context, rule models.AlertRule) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rules, ok := a.rules[rule.UserID]
+	if !ok {
+		rules = make(map[string]models.AlertRule)
+		a.rules[rule.UserID] = rules
+	}
+	if _, ok := rules[rule.ID]; ok {
+		return localErrs.AlreadyExistsErr.WithMsg("alert rule already exists")
+	}
+	rules[rule.ID] = rule
+	return nil
+}
+
+func (a *alertRepository) GetRules(ctx context.Context, userID string) ([]models.AlertRule, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	rules := make([]models.AlertRule, 0, len(a.rules[userID]))
+	for _, rule := range a.rules[userID] {
+		rules = append(rules, rule)
+	}
+	// firestore returns documents ordered by their id
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].ID < rules[j].ID
+	})
+	return rules, nil
+}
+
+func (a *alertRepository) DeleteRule(ctx context.Context, userID, ruleID string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.rules[userID][ruleID]; !ok {
+		return localErrs.NotFoundErr.WithMsg("alert rule not found")
+	}
+	delete(a.rules[userID], ruleID)
+	return nil
+}
+
+func (a *alertRepository) EvaluateRule(ctx context.Context, userID, ruleID string, evaluate storage.RuleEvaluation) ([]models.AlertEvent, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	rule, ok := a.rules[userID][ruleID]
+	if !ok {
+		return nil, localErrs.NotFoundErr.WithMsg("alert rule not found")
+	}
+	events, changed := evaluate(&rule)
+	if changed {
+		a.rules[userID][ruleID] = rule
+	}
+	if len(events) > 0 && a.events[userID] == nil {
+		a.events[userID] = make(map[string]models.AlertEvent)
+	}
+	for _, event := range events {
+		a.events[userID][event.ID] = event
+	}
+	return events, nil
+}
+
+func (a *alertRepository) AddEvent(ctx context.Context, userID string, event models.AlertEvent) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	events, ok := a.events[userID]
+	if !ok {
+		events = make(map[string]models.AlertEvent)
+		a.events[userID] = events
+	}
+	events[event.ID] = event
+	return nil
+}
+
+func (a *alertRepository) GetEvents(ctx context.Context, userID string, from, to time.Time) ([]models.AlertEvent, error) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	events := make([]models.AlertEvent, 0)
+	for _, event := range a.events[userID] {
+		if event.Time.Before(from) || !event.Time.Before(to) {
+			continue
+		}
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Time.After(events[j].Time)
+	})
+	if len(events) > storage.MaxAlertEvents {
+		events = events[:storage.MaxAlertEvents]
+	}
+	return events, nil
+}
@@ -0,0 +1,11 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/storagetest"
+)
+
+func TestAlertRepository(t *testing.T) {
+	storagetest.RunAlertRepository(t, NewAlertRepository())
+}
@@ -0,0 +1,248 @@
+// Package memory contains in-memory implementations of the storage
+// repositories, used to run the service offline and in tests
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+type metricRepository struct {
+	mu sync.RWMutex
+	// measurements are kept sorted by time for every sensor
+	measurements map[string][]models.Measurement
+}
+
+func NewMetricRepository() storage.MetricRepository {
+	return &metricRepository{measurements: make(map[string][]models.Measurement)}
+}
+
+func requestToMeasurement(request models.SensorRequest) models.Measurement {
+	fields := make(map[string]float64, len(models.MeasurementFields))
+	for _, field := range models.MeasurementFields {
+		fields[field], _ = request.Field(field)
+	}
+
+	return models.Measurement{
+		SensorID:      request.SensorID,
+		SensorVersion: request.SensorVersion,
+		Alias:         request.Alias,
+		Time:          request.Time.UTC(),
+		Fields:        fields,
+	}
+}
+
+func (r *metricRepository) WriteMeasurement(ctx context.Context, requests ...models.SensorRequest) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, request := range requests {
+		measurement := requestToMeasurement(request)
+		measurements := r.measurements[measurement.SensorID]
+		position := sort.Search(len(measurements), func(i int) bool {
+			return !measurements[i].Time.Before(measurement.Time)
+		})
+
+		// points with the same sensor and time are overwritten, as in influx
+		if position < len(measurements) && measurements[position].Time.Equal(measurement.Time) {
+			measurements[position] = measurement
+			continue
+		}
+		r.measurements[measurement.SensorID] = slices.Insert(measurements, position, measurement)
+	}
+
+	return nil
+}
+
+func (r *metricRepository) ReadMeasurements(ctx context.Context, query models.MeasurementQuery) ([]models.Measurement, error) {
+	measurements := make([]models.Measurement, 0)
+	err := r.StreamMeasurements(ctx, query, func(measurement models.Measurement) error {
+		measurements = append(measurements, measurement)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return measurements, nil
+}
+
+func (r *metricRepository) StreamMeasurements(ctx context.Context, query models.MeasurementQuery, handle func(models.Measurement) error) error {
+	measurements := r.selectRange(query.SensorID, query.From, query.To)
+	if len(query.Aggregation) > 0 {
+		measurements = aggregate(measurements, query.Aggregation, query.Window)
+	}
+	if query.Limit > 0 && len(measurements) > query.Limit {
+		measurements = measurements[:query.Limit]
+	}
+
+	for _, measurement := range measurements {
+		err := handle(withFields(measurement, query.Fields))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *metricRepository) ReadLatestMeasurements(ctx context.Context, sensorIDs ...string) ([]models.Measurement, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	latest := make([]models.Measurement, 0, len(sensorIDs))
+	for _, sensorID := range sensorIDs {
+		measurements := r.measurements[sensorID]
+		if len(measurements) == 0 {
+			continue
+		}
+		latest = append(latest, withFields(measurements[len(measurements)-1], models.MeasurementFields))
+	}
+	return latest, nil
+}
+
+func (r *metricRepository) SupportsDeletes() bool {
+	return true
+}
+
+func (r *metricRepository) DeleteMeasurements(ctx context.Context, query models.MeasurementQuery) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	measurements := r.measurements[query.SensorID]
+	start, end := searchRange(measurements, query.From, query.To)
+	if start >= end {
+		return nil
+	}
+	r.measurements[query.SensorID] = slices.Delete(measurements, start, end)
+	if len(r.measurements[query.SensorID]) == 0 {
+		delete(r.measurements, query.SensorID)
+	}
+	return nil
+}
+
+func (r *metricRepository) CountMeasurements(ctx context.Context, query models.MeasurementQuery) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	start, end := searchRange(r.measurements[query.SensorID], query.From, query.To)
+	return int64(end - start), nil
+}
+
+// searchRange returns the positions delimiting the [from, to) range of time
+// sorted measurements
+func searchRange(measurements []models.Measurement, from, to time.Time) (int, int) {
+	start := sort.Search(len(measurements), func(i int) bool {
+		return !measurements[i].Time.Before(from)
+	})
+	end := sort.Search(len(measurements), func(i int) bool {
+		return !measurements[i].Time.Before(to)
+	})
+	return start, end
+}
+
+// selectRange copies the measurements of a sensor in the [from, to) range
+func (r *metricRepository) selectRange(sensorID string, from, to time.Time) []models.Measurement {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	measurements := r.measurements[sensorID]
+	start, end := searchRange(measurements, from, to)
+	if start >= end {
+		return nil
+	}
+	return slices.Clone(measurements[start:end])
+}
+
+// withFields copies a measurement keeping only the requested fields
+func withFields(measurement models.Measurement, fields []string) models.Measurement {
+	values := make(map[string]float64, len(fields))
+	for _, field := range fields {
+		if value, ok := measurement.Fields[field]; ok {
+			values[field] = value
+		}
+	}
+	measurement.Fields = values
+	return measurement
+}
+
+// bucketKey identifies an aggregation group, matching the influx GROUP BY
+type bucketKey struct {
+	start         time.Time
+	sensorVersion string
+	alias         string
+}
+
+// aggregate groups time sorted measurements in windows aligned to the unix
+// epoch, the same way date_bin does
+func aggregate(measurements []models.Measurement, aggregation string, window time.Duration) []models.Measurement {
+	if window <= 0 {
+		return measurements
+	}
+
+	buckets := make(map[bucketKey][]models.Measurement)
+	keys := make([]bucketKey, 0)
+	for _, measurement := range measurements {
+		nanos := measurement.Time.UnixNano()
+		key := bucketKey{
+			start:         time.Unix(0, nanos-nanos%int64(window)).UTC(),
+			sensorVersion: measurement.SensorVersion,
+			alias:         measurement.Alias,
+		}
+		if _, ok := buckets[key]; !ok {
+			keys = append(keys, key)
+		}
+		buckets[key] = append(buckets[key], measurement)
+	}
+
+	aggregated := make([]models.Measurement, 0, len(keys))
+	for _, key := range keys {
+		bucket := buckets[key]
+		fields := make(map[string]float64, len(models.MeasurementFields))
+		for _, field := range models.MeasurementFields {
+			fields[field] = aggregateField(bucket, field, aggregation)
+		}
+		aggregated = append(aggregated, models.Measurement{
+			SensorID:      bucket[0].SensorID,
+			SensorVersion: key.sensorVersion,
+			Alias:         key.alias,
+			Time:          key.start,
+			Fields:        fields,
+		})
+	}
+
+	sort.SliceStable(aggregated, func(i, j int) bool {
+		return aggregated[i].Time.Before(aggregated[j].Time)
+	})
+	return aggregated
+}
+
+func aggregateField(bucket []models.Measurement, field, aggregation string) float64 {
+	switch aggregation {
+	case models.AggregationCount:
+		return float64(len(bucket))
+	case models.AggregationLast:
+		return bucket[len(bucket)-1].Fields[field]
+	}
+
+	result := bucket[0].Fields[field]
+	for _, measurement := range bucket[1:] {
+		value := measurement.Fields[field]
+		switch aggregation {
+		case models.AggregationMin:
+			result = min(result, value)
+		case models.AggregationMax:
+			result = max(result, value)
+		case models.AggregationMean:
+			result += value
+		}
+	}
+	if aggregation == models.AggregationMean {
+		result /= float64(len(bucket))
+	}
+	return result
+}
@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+type retentionRepository struct {
+	mu       sync.RWMutex
+	policies map[string]models.RetentionPolicy
+}
+
+func NewRetentionRepository() storage.RetentionRepository {
+	return &retentionRepository{policies: make(map[string]models.RetentionPolicy)}
+}
+
+func (r *retentionRepository) GetRetentionPolicy(ctx context.Context, userID string) (models.RetentionPolicy, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	policy, ok := r.policies[userID]
+	if !ok {
+		return models.RetentionPolicy{}, localErrs.NotFoundErr.WithMsg("user without retention policy")
+	}
+	return policy, nil
+}
+
+func (r *retentionRepository) SetRetentionPolicy(ctx context.Context, policy models.RetentionPolicy) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.policies[policy.UserID] = policy
+	return nil
+}
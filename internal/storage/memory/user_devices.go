@@ -0,0 +1,158 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+type userDeviceRepository struct {
+	mu          sync.RWMutex
+	userDevices map[string][]models.Device
+	// owners maps every device to its ownership
+	owners map[string]storage.DeviceOwner
+	// silences keeps the last reading of the devices notified as silent
+	silences map[string]time.Time
+}
+
+func NewUserDeviceRepository() storage.UserDeviceRepository {
+	return &userDeviceRepository{
+		userDevices: make(map[string][]models.Device),
+		owners:      make(map[string]storage.DeviceOwner),
+		silences:    make(map[string]time.Time),
+	}
+}
+
+func (u *userDeviceRepository) GetDevicesFromUser(ctx context.Context, userID string) ([]models.Device, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	devices, ok := u.userDevices[userID]
+	if !ok {
+		return nil, localErrs.NotFoundErr.WithMsg("user without correlated devices")
+	}
+	return slices.Clone(devices), nil
+}
+
+func (u *userDeviceRepository) AddDeviceToUser(ctx context.Context, userID string, newDevice models.Device) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if _, ok := u.owners[newDevice.ID]; ok {
+		return localErrs.AlreadyExistsErr.WithMsg("device already has an owner").WithDetails("device", newDevice.ID)
+	}
+	u.owners[newDevice.ID] = storage.DeviceOwner{DeviceID: newDevice.ID, UserID: userID}
+	u.userDevices[userID] = append(u.userDevices[userID], newDevice)
+	return nil
+}
+
+func (u *userDeviceRepository) GetDeviceOwner(ctx context.Context, deviceID string) (string, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	owner, ok := u.owners[deviceID]
+	if !ok {
+		return "", localErrs.NotFoundErr.WithMsg("device without owner")
+	}
+	return owner.UserID, nil
+}
+
+func (u *userDeviceRepository) GetDeviceTokenNonce(ctx context.Context, deviceID string) (string, string, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	owner, ok := u.owners[deviceID]
+	if !ok {
+		return "", "", localErrs.NotFoundErr.WithMsg("device without owner")
+	}
+	return owner.UserID, owner.TokenNonce, nil
+}
+
+func (u *userDeviceRepository) SetDeviceTokenNonce(ctx context.Context, userID string, deviceID string, nonce string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	owner, ok := u.owners[deviceID]
+	if !ok || owner.UserID != userID {
+		return localErrs.NotFoundErr.WithMsg("device not bound to the user").WithDetails("device", deviceID)
+	}
+	owner.TokenNonce = nonce
+	u.owners[deviceID] = owner
+	return nil
+}
+
+// ownedDevice returns the position of the device among the user devices,
+// failing with NotFoundErr when the device isn't bound to the user
+func (u *userDeviceRepository) ownedDevice(userID string, deviceID string) (int, error) {
+	index := slices.IndexFunc(u.userDevices[userID], func(device models.Device) bool {
+		return device.ID == deviceID
+	})
+	if u.owners[deviceID].UserID != userID || index < 0 {
+		return 0, localErrs.NotFoundErr.WithMsg("device not bound to the user").WithDetails("device", deviceID)
+	}
+	return index, nil
+}
+
+func (u *userDeviceRepository) UpdateDevice(ctx context.Context, userID string, deviceID string, update models.DeviceUpdate) (models.Device, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	index, err := u.ownedDevice(userID, deviceID)
+	if err != nil {
+		return models.Device{}, err
+	}
+
+	devices := slices.Clone(u.userDevices[userID])
+	devices[index] = update.Apply(devices[index])
+	u.userDevices[userID] = devices
+	return devices[index], nil
+}
+
+func (u *userDeviceRepository) RemoveDeviceFromUser(ctx context.Context, userID string, deviceID string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	index, err := u.ownedDevice(userID, deviceID)
+	if err != nil {
+		return err
+	}
+	delete(u.owners, deviceID)
+	u.userDevices[userID] = slices.Delete(slices.Clone(u.userDevices[userID]), index, index+1)
+	return nil
+}
+
+func (u *userDeviceRepository) ListUserDevices(ctx context.Context, afterUserID string, limit int) ([]storage.UserDevices, error) {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	userDevices := make([]storage.UserDevices, 0, len(u.userDevices))
+	for userID, devices := range u.userDevices {
+		if userID > afterUserID {
+			userDevices = append(userDevices, storage.UserDevices{UserID: userID, Devices: slices.Clone(devices)})
+		}
+	}
+	sort.Slice(userDevices, func(i, j int) bool {
+		return userDevices[i].UserID < userDevices[j].UserID
+	})
+	if len(userDevices) > limit {
+		userDevices = userDevices[:limit]
+	}
+	return userDevices, nil
+}
+
+func (u *userDeviceRepository) ClaimSilenceNotification(ctx context.Context, deviceID string, lastSeen time.Time) (bool, error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if notified, ok := u.silences[deviceID]; ok && notified.Equal(lastSeen) {
+		return false, nil
+	}
+	u.silences[deviceID] = lastSeen
+	return true, nil
+}
@@ -0,0 +1,139 @@
+package memory
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"sync"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+type webhookRepository struct {
+	mu         sync.RWMutex
+	webhooks   map[string]models.Webhook
+	deliveries map[string][]models.WebhookDelivery
+}
+
+func NewWebhookRepository() storage.WebhookRepository {
+	return &webhookRepository{
+		webhooks:   make(map[string]models.Webhook),
+		deliveries: make(map[string][]models.WebhookDelivery),
+	}
+}
+
+func (w *webhookRepository) CreateWebhook(ctx context.Context, webhook models.Webhook) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.webhooks[webhook.ID]; ok {
+		return localErrs.AlreadyExistsErr.WithMsg("webhook already exists")
+	}
+	webhook.Events = slices.Clone(webhook.Events)
+	w.webhooks[webhook.ID] = webhook
+	return nil
+}
+
+func (w *webhookRepository) GetWebhook(ctx context.Context, webhookID string) (models.Webhook, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	webhook, ok := w.webhooks[webhookID]
+	if !ok {
+		return models.Webhook{}, localErrs.NotFoundErr.WithMsg("webhook not found")
+	}
+	webhook.Events = slices.Clone(webhook.Events)
+	return webhook, nil
+}
+
+func (w *webhookRepository) GetWebhooksFromUser(ctx context.Context, userID string) ([]models.Webhook, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	webhooks := make([]models.Webhook, 0)
+	for _, webhook := range w.webhooks {
+		if webhook.UserID != userID {
+			continue
+		}
+		webhook.Events = slices.Clone(webhook.Events)
+		webhooks = append(webhooks, webhook)
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks, nil
+}
+
+func (w *webhookRepository) DeleteWebhook(ctx context.Context, webhookID string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, ok := w.webhooks[webhookID]; !ok {
+		return localErrs.NotFoundErr.WithMsg("webhook not found")
+	}
+	delete(w.webhooks, webhookID)
+	delete(w.deliveries, webhookID)
+	return nil
+}
+
+// update applies change to a stored webhook, failing when it doesn't exist
+func (w *webhookRepository) update(webhookID, msg string, change func(webhook *models.Webhook)) (models.Webhook, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	webhook, ok := w.webhooks[webhookID]
+	if !ok {
+		return models.Webhook{}, localErrs.InternalServerErr.WithMsg(msg)
+	}
+	change(&webhook)
+	w.webhooks[webhookID] = webhook
+	return webhook, nil
+}
+
+func (w *webhookRepository) IncrementFailures(ctx context.Context, webhookID string) (int, error) {
+	webhook, err := w.update(webhookID, "failed to increment webhook failures", func(webhook *models.Webhook) {
+		webhook.ConsecutiveFailures++
+	})
+	return webhook.ConsecutiveFailures, err
+}
+
+func (w *webhookRepository) ResetFailures(ctx context.Context, webhookID string) error {
+	_, err := w.update(webhookID, "failed to reset webhook failures", func(webhook *models.Webhook) {
+		webhook.ConsecutiveFailures = 0
+	})
+	return err
+}
+
+func (w *webhookRepository) DisableWebhook(ctx context.Context, webhookID string) error {
+	_, err := w.update(webhookID, "failed to disable webhook", func(webhook *models.Webhook) {
+		webhook.Enabled = false
+	})
+	return err
+}
+
+func (w *webhookRepository) AddDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.deliveries[delivery.WebhookID] = append(w.deliveries[delivery.WebhookID], delivery)
+	return nil
+}
+
+func (w *webhookRepository) GetDeliveries(ctx context.Context, webhookID string) ([]models.WebhookDelivery, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	deliveries := slices.Clone(w.deliveries[webhookID])
+	if deliveries == nil {
+		deliveries = make([]models.WebhookDelivery, 0)
+	}
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].Time.After(deliveries[j].Time)
+	})
+	if len(deliveries) > storage.MaxWebhookDeliveries {
+		deliveries = deliveries[:storage.MaxWebhookDeliveries]
+	}
+	return deliveries, nil
+}
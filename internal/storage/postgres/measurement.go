@@ -0,0 +1,253 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+// metricColumns are the metrics table columns in COPY order
+var metricColumns = append([]string{"time", "sensor_id", "sensor_version", "alias"}, models.MeasurementFields...)
+
+// aggregationFunctions maps the supported aggregations to their SQL functions
+var aggregationFunctions = map[string]string{
+	models.AggregationMean:  "avg(%s)",
+	models.AggregationMin:   "min(%s)",
+	models.AggregationMax:   "max(%s)",
+	models.AggregationLast:  "(array_agg(%s ORDER BY time DESC))[1]",
+	models.AggregationCount: "count(%s)::double precision",
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewMetricRepository(pool *pgxpool.Pool) storage.MetricRepository {
+	return &repository{pool: pool}
+}
+
+func measurementToRow(m storage.SensorMeasurement) []any {
+	return []any{m.Timestamp, m.SensorID, m.SensorVersion, m.Alias, m.Temperature, m.Humidity, m.PH, m.TDS, m.EC, m.WaterTemperature}
+}
+
+// WriteMeasurement copies the measurements to a staging table and upserts
+// them, so points with the same sensor and time are overwritten as in influx.
+// The staging serial keeps the copy order, so the last of the points sharing
+// a sensor and time in a batch wins
+func (r *repository) WriteMeasurement(ctx context.Context, requests ...models.SensorRequest) error {
+	rows := make([][]any, len(requests))
+	for i, request := range requests {
+		rows[i] = measurementToRow(storage.ParseRequestToMeasurement(request))
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to write data").WithErr(err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "CREATE TEMPORARY TABLE metrics_staging (LIKE metrics INCLUDING DEFAULTS, staging_order BIGSERIAL) ON COMMIT DROP")
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to write data").WithErr(err)
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"metrics_staging"}, metricColumns, pgx.CopyFromRows(rows))
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to write data").WithErr(err)
+	}
+
+	_, err = tx.Exec(ctx, buildUpsertQuery())
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to write data").WithErr(err)
+	}
+
+	err = tx.Commit(ctx)
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to write data").WithErr(err)
+	}
+	return nil
+}
+
+func (r *repository) ReadMeasurements(ctx context.Context, query models.MeasurementQuery) ([]models.Measurement, error) {
+	measurements := make([]models.Measurement, 0)
+	err := r.StreamMeasurements(ctx, query, func(measurement models.Measurement) error {
+		measurements = append(measurements, measurement)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return measurements, nil
+}
+
+// StreamMeasurements calls handle for every measurement as soon as it's read,
+// so large ranges don't need to fit in memory
+func (r *repository) StreamMeasurements(ctx context.Context, query models.MeasurementQuery, handle func(models.Measurement) error) error {
+	statement, args, err := buildReadQuery(query)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.pool.Query(ctx, statement, args...)
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to query data").WithErr(err)
+	}
+	defer rows.Close()
+
+	return scanMeasurements(rows, query.Fields, handle)
+}
+
+func (r *repository) SupportsDeletes() bool {
+	return true
+}
+
+func (r *repository) DeleteMeasurements(ctx context.Context, query models.MeasurementQuery) error {
+	_, err := r.pool.Exec(ctx, "DELETE FROM metrics WHERE sensor_id = $1 AND time >= $2 AND time < $3", query.SensorID, query.From, query.To)
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to delete data").WithErr(err)
+	}
+	return nil
+}
+
+func (r *repository) CountMeasurements(ctx context.Context, query models.MeasurementQuery) (int64, error) {
+	var count int64
+	err := r.pool.QueryRow(ctx, "SELECT count(*) FROM metrics WHERE sensor_id = $1 AND time >= $2 AND time < $3", query.SensorID, query.From, query.To).Scan(&count)
+	if err != nil {
+		return 0, errors.InternalServerErr.WithMsg("failed to count data").WithErr(err)
+	}
+	return count, nil
+}
+
+func (r *repository) ReadLatestMeasurements(ctx context.Context, sensorIDs ...string) ([]models.Measurement, error) {
+	measurements := make([]models.Measurement, 0, len(sensorIDs))
+	if len(sensorIDs) == 0 {
+		return measurements, nil
+	}
+
+	rows, err := r.pool.Query(ctx, buildLatestQuery(), sensorIDs)
+	if err != nil {
+		return nil, errors.InternalServerErr.WithMsg("failed to query latest data").WithErr(err)
+	}
+	defer rows.Close()
+
+	err = scanMeasurements(rows, models.MeasurementFields, func(measurement models.Measurement) error {
+		measurements = append(measurements, measurement)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return measurements, nil
+}
+
+func buildUpsertQuery() string {
+	updates := make([]string, 0, len(metricColumns))
+	for _, column := range metricColumns[2:] {
+		updates = append(updates, fmt.Sprintf("%s = EXCLUDED.%s", column, column))
+	}
+
+	columns := strings.Join(metricColumns, ", ")
+	return fmt.Sprintf(
+		"INSERT INTO metrics (%s) SELECT DISTINCT ON (sensor_id, time) %s FROM metrics_staging "+
+			"ORDER BY sensor_id, time, staging_order DESC ON CONFLICT (sensor_id, time) DO UPDATE SET %s",
+		columns,
+		columns,
+		strings.Join(updates, ", "),
+	)
+}
+
+func buildReadQuery(query models.MeasurementQuery) (string, []any, error) {
+	for _, field := range query.Fields {
+		if !slices.Contains(models.MeasurementFields, field) {
+			return "", nil, errors.BadRequestErr.WithMsg("unknown field").WithDetails("field", field)
+		}
+	}
+
+	args := []any{query.SensorID, query.From, query.To}
+	columns := []string{"time", "sensor_id", "sensor_version", "alias"}
+	groupBy := ""
+	if len(query.Aggregation) > 0 {
+		function, ok := aggregationFunctions[query.Aggregation]
+		if !ok || query.Window <= 0 {
+			return "", nil, errors.BadRequestErr.WithMsg("invalid aggregation").WithDetails("aggregation", query.Aggregation)
+		}
+
+		// windows are aligned to the unix epoch, the same way influx date_bin does
+		args = append(args, query.Window.Seconds())
+		columns[0] = "to_timestamp(floor(extract(epoch FROM time)::double precision / $4::double precision) * $4::double precision) AS bucket"
+		for _, field := range query.Fields {
+			columns = append(columns, fmt.Sprintf(function, field))
+		}
+		groupBy = " GROUP BY bucket, sensor_id, sensor_version, alias ORDER BY bucket"
+	} else {
+		columns = append(columns, query.Fields...)
+		groupBy = " ORDER BY time"
+	}
+
+	limit := ""
+	if query.Limit > 0 {
+		limit = fmt.Sprintf(" LIMIT %d", query.Limit)
+	}
+
+	return fmt.Sprintf(
+		"SELECT %s FROM metrics WHERE sensor_id = $1 AND time >= $2 AND time < $3%s%s",
+		strings.Join(columns, ", "),
+		groupBy,
+		limit,
+	), args, nil
+}
+
+func buildLatestQuery() string {
+	return fmt.Sprintf(
+		"SELECT DISTINCT ON (sensor_id) %s FROM metrics WHERE sensor_id = ANY($1) ORDER BY sensor_id, time DESC",
+		strings.Join(metricColumns, ", "),
+	)
+}
+
+// scanMeasurements reads rows with the time, sensor_id, sensor_version and
+// alias columns followed by the fields
+func scanMeasurements(rows pgx.Rows, fields []string, handle func(models.Measurement) error) error {
+	for rows.Next() {
+		var measurement models.Measurement
+		var timestamp time.Time
+		values := make([]*float64, len(fields))
+		destinations := []any{&timestamp, &measurement.SensorID, &measurement.SensorVersion, &measurement.Alias}
+		for i := range values {
+			destinations = append(destinations, &values[i])
+		}
+
+		err := rows.Scan(destinations...)
+		if err != nil {
+			return errors.InternalServerErr.WithMsg("failed to parse row").WithErr(err)
+		}
+
+		measurement.Time = timestamp.UTC()
+		measurement.Fields = make(map[string]float64, len(fields))
+		for i, field := range fields {
+			// null values are returned when the field wasn't written for this point
+			if values[i] != nil {
+				measurement.Fields[field] = *values[i]
+			}
+		}
+
+		err = handle(measurement)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := rows.Err()
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to read rows").WithErr(err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildReadQuery(t *testing.T) {
+	from := time.Date(2023, 8, 1, 0, 0, 0, 0, time.UTC)
+	to := from.Add(time.Hour)
+	var tests = []struct {
+		name          string
+		query         models.MeasurementQuery
+		expected      string
+		expectedArgs  []any
+		expectedError bool
+	}{
+		{
+			name:         "raw measurements",
+			query:        models.MeasurementQuery{SensorID: "sensor", From: from, To: to, Fields: []string{"ph", "ec"}, Limit: 10},
+			expected:     "SELECT time, sensor_id, sensor_version, alias, ph, ec FROM metrics WHERE sensor_id = $1 AND time >= $2 AND time < $3 ORDER BY time LIMIT 10",
+			expectedArgs: []any{"sensor", from, to},
+		},
+		{
+			name:         "aggregated measurements",
+			query:        models.MeasurementQuery{SensorID: "sensor", From: from, To: to, Fields: []string{"ph"}, Aggregation: models.AggregationLast, Window: 5 * time.Minute},
+			expected:     "SELECT to_timestamp(floor(extract(epoch FROM time)::double precision / $4::double precision) * $4::double precision) AS bucket, sensor_id, sensor_version, alias, (array_agg(ph ORDER BY time DESC))[1] FROM metrics WHERE sensor_id = $1 AND time >= $2 AND time < $3 GROUP BY bucket, sensor_id, sensor_version, alias ORDER BY bucket",
+			expectedArgs: []any{"sensor", from, to, 300.0},
+		},
+		{
+			name:          "unknown fields are rejected",
+			query:         models.MeasurementQuery{SensorID: "sensor", From: from, To: to, Fields: []string{"ph; DROP TABLE metrics"}},
+			expectedError: true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			query, args, err := buildReadQuery(tt.query)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tt.expected, query)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
+
+func TestBuildUpsertQuery(t *testing.T) {
+	assert.Equal(t,
+		"INSERT INTO metrics (time, sensor_id, sensor_version, alias, temperature, humidity, ph, tds, ec, water_temperature) "+
+			"SELECT DISTINCT ON (sensor_id, time) time, sensor_id, sensor_version, alias, temperature, humidity, ph, tds, ec, water_temperature FROM metrics_staging "+
+			"ORDER BY sensor_id, time, staging_order DESC ON CONFLICT (sensor_id, time) DO UPDATE SET sensor_version = EXCLUDED.sensor_version, alias = EXCLUDED.alias, temperature = EXCLUDED.temperature, "+
+			"humidity = EXCLUDED.humidity, ph = EXCLUDED.ph, tds = EXCLUDED.tds, ec = EXCLUDED.ec, water_temperature = EXCLUDED.water_temperature",
+		buildUpsertQuery(),
+	)
+}
+
+// TestMetricRepository runs against the database in POSTGRES_TEST_DSN
+func TestMetricRepository(t *testing.T) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if len(dsn) == 0 {
+		t.Skip("POSTGRES_TEST_DSN isn't set")
+	}
+
+	pool, err := Open(context.Background(), dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	storagetest.RunMetricRepository(t, NewMetricRepository(pool))
+}
@@ -0,0 +1,69 @@
+// Package postgres contains a PostgreSQL implementation of the metric
+// repository, using TimescaleDB hypertables when the extension is available
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog/log"
+)
+
+const createMetricsTable = `CREATE TABLE IF NOT EXISTS metrics (
+	time TIMESTAMPTZ NOT NULL,
+	sensor_id TEXT NOT NULL,
+	sensor_version TEXT NOT NULL,
+	alias TEXT NOT NULL,
+	temperature DOUBLE PRECISION,
+	humidity DOUBLE PRECISION,
+	ph DOUBLE PRECISION,
+	tds DOUBLE PRECISION,
+	ec DOUBLE PRECISION,
+	water_temperature DOUBLE PRECISION,
+	PRIMARY KEY (sensor_id, time)
+)`
+
+// Open connects to the database at dsn and creates the metrics schema
+func Open(ctx context.Context, dsn string) (*pgxpool.Pool, error) {
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+
+	err = Migrate(ctx, pool)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return pool, nil
+}
+
+// Migrate creates the metrics table, converting it to a hypertable when
+// TimescaleDB is available
+func Migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	_, err := pool.Exec(ctx, createMetricsTable)
+	if err != nil {
+		return fmt.Errorf("failed to create metrics table: %w", err)
+	}
+
+	var timescale bool
+	err = pool.QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_available_extensions WHERE name = 'timescaledb')").Scan(&timescale)
+	if err != nil {
+		return fmt.Errorf("failed to check timescaledb availability: %w", err)
+	}
+	if !timescale {
+		log.Info().Msg("timescaledb isn't available, using a plain metrics table")
+		return nil
+	}
+
+	_, err = pool.Exec(ctx, "CREATE EXTENSION IF NOT EXISTS timescaledb")
+	if err != nil {
+		return fmt.Errorf("failed to create timescaledb extension: %w", err)
+	}
+	_, err = pool.Exec(ctx, "SELECT create_hypertable('metrics', 'time', if_not_exists => TRUE, migrate_data => TRUE)")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics hypertable: %w", err)
+	}
+	return nil
+}
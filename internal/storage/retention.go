@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RetentionRepository contain functions for storing the user retention policies
+//
+//go:generate mockgen -destination retention_mock.go -package storage github.com/WendelHime/hydroponics-metrics-collector/internal/storage RetentionRepository
+type RetentionRepository interface {
+	// GetRetentionPolicy fails with NotFoundErr when the user has no policy
+	GetRetentionPolicy(ctx context.Context, userID string) (models.RetentionPolicy, error)
+	SetRetentionPolicy(ctx context.Context, policy models.RetentionPolicy) error
+}
+
+type retentionRepository struct {
+	client *firestore.Client
+}
+
+func NewRetentionRepository(client *firestore.Client) RetentionRepository {
+	return &retentionRepository{client: client}
+}
+
+func (r *retentionRepository) GetRetentionPolicy(ctx context.Context, userID string) (models.RetentionPolicy, error) {
+	doc, err := r.client.Collection("retention_policies").Doc(userID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return models.RetentionPolicy{}, localErrs.NotFoundErr.WithMsg("user without retention policy").WithErr(err)
+		}
+		return models.RetentionPolicy{}, localErrs.InternalServerErr.WithMsg("failed to retrieve retention policy").WithErr(err)
+	}
+
+	var policy models.RetentionPolicy
+	err = doc.DataTo(&policy)
+	if err != nil {
+		return models.RetentionPolicy{}, localErrs.InternalServerErr.WithMsg("failed to parse retention policy struct").WithErr(err)
+	}
+
+	return policy, nil
+}
+
+func (r *retentionRepository) SetRetentionPolicy(ctx context.Context, policy models.RetentionPolicy) error {
+	_, err := r.client.Collection("retention_policies").Doc(policy.UserID).Set(ctx, policy)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to set retention policy").WithErr(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+type repository struct {
+	storage.MetricRepository
+	spool *Spool
+}
+
+// NewMetricRepository spools the measurements that next fails to write, reads
+// are always served by next
+func NewMetricRepository(next storage.MetricRepository, spool *Spool) storage.MetricRepository {
+	return &repository{MetricRepository: next, spool: spool}
+}
+
+// Retryable tells if a write failing with err may succeed later, the client
+// errors returned by the metric store reject the measurements themselves
+func Retryable(err error) bool {
+	var apiErr *localErrs.Error
+	if !errors.As(err, &apiErr) {
+		return true
+	}
+	return apiErr.StatusCode >= http.StatusInternalServerError || apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// WriteMeasurement returns AcceptedErr when the write failed but the
+// measurements were spooled, the original error is returned when it isn't
+// Retryable or the spool is full
+func (r *repository) WriteMeasurement(ctx context.Context, requests ...models.SensorRequest) error {
+	err := r.MetricRepository.WriteMeasurement(ctx, requests...)
+	if err == nil || !Retryable(err) {
+		return err
+	}
+
+	spoolErr := r.spool.Append(requests)
+	if spoolErr != nil {
+		log.Error().Err(spoolErr).AnErr("writeErr", err).Msg("failed to spool measurements")
+		return err
+	}
+
+	depth := r.spool.Depth()
+	log.Warn().Err(err).Int("batches", depth.Batches).Int64("bytes", depth.Bytes).Msg("measurements spooled after a failed write")
+	return localErrs.AcceptedErr.WithMsg("measurements spooled for a later write")
+}
+
+// DeleteMeasurements forgets the spooled measurements of the range first, so
+// they aren't written back by a later replay
+func (r *repository) DeleteMeasurements(ctx context.Context, query models.MeasurementQuery) error {
+	err := r.spool.Forget(query)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to forget spooled measurements").WithErr(err)
+	}
+	return r.MetricRepository.DeleteMeasurements(ctx, query)
+}
+
+// Run replays the spooled measurements to repository every interval until the
+// context is done, doubling the interval up to maxBackoff while writes fail
+func (s *Spool) Run(ctx context.Context, repository storage.MetricRepository, interval, maxBackoff time.Duration) {
+	write := func(ctx context.Context, batch []models.SensorRequest) error {
+		return repository.WriteMeasurement(ctx, batch...)
+	}
+
+	delay := interval
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		if s.Depth().Batches > 0 {
+			err := s.Replay(ctx, write)
+			depth := s.Depth()
+			if err != nil {
+				delay = min(delay*2, maxBackoff)
+				log.Warn().Err(err).Int("batches", depth.Batches).Int64("bytes", depth.Bytes).Dur("retryIn", delay).Msg("failed to replay spooled measurements")
+			} else {
+				delay = interval
+				log.Info().Int("batches", depth.Batches).Int64("bytes", depth.Bytes).Msg("replayed spooled measurements")
+			}
+		}
+		timer.Reset(delay)
+	}
+}
@@ -0,0 +1,107 @@
+package spool
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	gomock "go.uber.org/mock/gomock"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+func TestWriteMeasurement(t *testing.T) {
+	requests := []models.SensorRequest{{SensorID: "sensor", UserID: "user", PH: 6.0, Time: time.Now().UTC()}}
+	var tests = []struct {
+		name     string
+		maxBytes int64
+		setup    func(mock *storage.MockMetricRepository)
+		assert   func(t *testing.T, err error, depth Depth)
+	}{
+		{
+			name:     "successful writes aren't spooled",
+			maxBytes: 1 << 20,
+			setup: func(mock *storage.MockMetricRepository) {
+				mock.EXPECT().WriteMeasurement(gomock.Any(), requests).Return(nil).Times(1)
+			},
+			assert: func(t *testing.T, err error, depth Depth) {
+				assert.Nil(t, err)
+				assert.Equal(t, 0, depth.Batches)
+			},
+		},
+		{
+			name:     "failed writes are spooled and accepted",
+			maxBytes: 1 << 20,
+			setup: func(mock *storage.MockMetricRepository) {
+				mock.EXPECT().WriteMeasurement(gomock.Any(), requests).Return(localErrs.InternalServerErr).Times(1)
+			},
+			assert: func(t *testing.T, err error, depth Depth) {
+				assert.ErrorIs(t, err, localErrs.AcceptedErr)
+				assert.Equal(t, 1, depth.Batches)
+			},
+		},
+		{
+			name:     "rejected writes aren't spooled",
+			maxBytes: 1 << 20,
+			setup: func(mock *storage.MockMetricRepository) {
+				mock.EXPECT().WriteMeasurement(gomock.Any(), requests).Return(localErrs.BadRequestErr).Times(1)
+			},
+			assert: func(t *testing.T, err error, depth Depth) {
+				assert.ErrorIs(t, err, localErrs.BadRequestErr)
+				assert.Equal(t, 0, depth.Batches)
+			},
+		},
+		{
+			name:     "failed writes are returned when the spool is full",
+			maxBytes: 1,
+			setup: func(mock *storage.MockMetricRepository) {
+				mock.EXPECT().WriteMeasurement(gomock.Any(), requests).Return(localErrs.InternalServerErr).Times(1)
+			},
+			assert: func(t *testing.T, err error, depth Depth) {
+				assert.ErrorIs(t, err, localErrs.InternalServerErr)
+				assert.Equal(t, 0, depth.Batches)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			defer ctrl.Finish()
+
+			spool, err := Open(t.TempDir(), tt.maxBytes)
+			assert.Nil(t, err)
+			mock := storage.NewMockMetricRepository(ctrl)
+			tt.setup(mock)
+
+			err = NewMetricRepository(mock, spool).WriteMeasurement(context.Background(), requests...)
+			tt.assert(t, err, spool.Depth())
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	requests := []models.SensorRequest{{SensorID: "sensor", UserID: "user", PH: 6.0, Time: time.Now().UTC()}}
+	spool, err := Open(t.TempDir(), 1<<20)
+	assert.Nil(t, err)
+	assert.Nil(t, spool.Append(requests))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mock := storage.NewMockMetricRepository(ctrl)
+	gomock.InOrder(
+		mock.EXPECT().WriteMeasurement(gomock.Any(), requests).Return(localErrs.InternalServerErr).Times(1),
+		mock.EXPECT().WriteMeasurement(gomock.Any(), requests).Return(nil).Times(1),
+	)
+	go spool.Run(ctx, mock, time.Millisecond, 4*time.Millisecond)
+
+	assert.Eventually(t, func() bool {
+		return spool.Depth().Batches == 0
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,408 @@
+// Package spool keeps the measurements that couldn't be written to the metric
+// store in a segmented log on disk, so they can be replayed once the store is
+// reachable again
+package spool
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+// segmentBytes is the size after which the active segment is sealed
+const segmentBytes = 4 << 20
+
+// headerBytes prefixes every record with its payload length and checksum
+const headerBytes = 8
+
+const segmentSuffix = ".seg"
+
+// quarantineFile keeps the batches rejected by the metric store, in the same
+// format as the segments, so they can be inspected without blocking replays
+const quarantineFile = "quarantine.log"
+
+// ErrFull is returned when appending would exceed the spool size limit
+var ErrFull = errors.New("spool is full")
+
+// Depth describes the data waiting to be replayed and the batches quarantined
+// after being rejected
+type Depth struct {
+	Segments    int   `json:"segments"`
+	Batches     int   `json:"batches"`
+	Bytes       int64 `json:"bytes"`
+	Quarantined int   `json:"quarantined"`
+}
+
+// segment is a log file, sealed segments are never written again
+type segment struct {
+	sequence uint64
+	batches  int
+	bytes    int64
+}
+
+// Spool is a write-ahead log of measurement batches split in segment files,
+// every record is a length and crc32 header followed by the gob encoded batch
+type Spool struct {
+	dir      string
+	maxBytes int64
+
+	mu       sync.Mutex
+	segments []segment
+	active   *os.File
+	// replayed is the offset already written from the oldest segment
+	replayed   int64
+	depth      Depth
+	tombstones []tombstone
+	// replaying is held while a batch is written by Replay
+	replaying sync.Mutex
+}
+
+// Open loads the segments found in dir, dropping any partially written record
+// left by a crash, appends fail once maxBytes are waiting to be replayed
+func Open(dir string, maxBytes int64) (*Spool, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	s := &Spool{dir: dir, maxBytes: maxBytes}
+	for _, entry := range entries {
+		name, found := strings.CutSuffix(entry.Name(), segmentSuffix)
+		if !found {
+			continue
+		}
+		sequence, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+
+		seg, err := s.load(sequence)
+		if err != nil {
+			return nil, err
+		}
+		if seg.batches == 0 {
+			os.Remove(s.path(sequence))
+			continue
+		}
+		s.segments = append(s.segments, seg)
+		s.depth.Batches += seg.batches
+		s.depth.Bytes += seg.bytes
+	}
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].sequence < s.segments[j].sequence
+	})
+	s.depth.Segments = len(s.segments)
+
+	quarantined, err := s.loadFile(filepath.Join(dir, quarantineFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	s.depth.Quarantined = quarantined.batches
+
+	s.tombstones, err = loadTombstones(dir)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Spool) path(sequence uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016d%s", sequence, segmentSuffix))
+}
+
+// load counts the valid records of a segment and truncates the invalid tail
+func (s *Spool) load(sequence uint64) (segment, error) {
+	seg, err := s.loadFile(s.path(sequence))
+	seg.sequence = sequence
+	return seg, err
+}
+
+func (s *Spool) loadFile(path string) (segment, error) {
+	var seg segment
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return seg, fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		_, size, err := readRecord(reader)
+		if err != nil {
+			break
+		}
+		seg.batches++
+		seg.bytes += size
+	}
+
+	err = file.Truncate(seg.bytes)
+	if err != nil {
+		return seg, fmt.Errorf("failed to truncate spool segment: %w", err)
+	}
+	return seg, nil
+}
+
+// encodeRecord returns the batch with its record header
+func encodeRecord(batch []models.SensorRequest) ([]byte, error) {
+	var payload bytes.Buffer
+	err := gob.NewEncoder(&payload).Encode(batch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode batch: %w", err)
+	}
+
+	record := make([]byte, headerBytes+payload.Len())
+	binary.BigEndian.PutUint32(record[0:4], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload.Bytes()))
+	copy(record[headerBytes:], payload.Bytes())
+	return record, nil
+}
+
+// Append durably writes a batch to the active segment
+func (s *Spool) Append(batch []models.SensorRequest) error {
+	record, err := encodeRecord(batch)
+	if err != nil {
+		return err
+	}
+	size := int64(len(record))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.depth.Bytes+size > s.maxBytes {
+		return ErrFull
+	}
+
+	if s.active == nil || s.segments[len(s.segments)-1].bytes+size > segmentBytes {
+		err = s.rotate()
+		if err != nil {
+			return err
+		}
+	}
+
+	last := &s.segments[len(s.segments)-1]
+	_, err = s.active.Write(record)
+	if err == nil {
+		err = s.active.Sync()
+	}
+	if err != nil {
+		// dropping the partial record keeps the following ones readable
+		s.active.Truncate(last.bytes)
+		return fmt.Errorf("failed to write spool segment: %w", err)
+	}
+
+	last.batches++
+	last.bytes += size
+	s.depth.Batches++
+	s.depth.Bytes += size
+	return nil
+}
+
+// rotate seals the active segment and starts a new one, it must be called
+// with the lock held
+func (s *Spool) rotate() error {
+	s.seal()
+
+	var sequence uint64
+	if len(s.segments) > 0 {
+		sequence = s.segments[len(s.segments)-1].sequence + 1
+	}
+	file, err := os.OpenFile(s.path(sequence), os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to create spool segment: %w", err)
+	}
+
+	s.active = file
+	s.segments = append(s.segments, segment{sequence: sequence})
+	s.depth.Segments = len(s.segments)
+	return nil
+}
+
+// seal closes the active segment so it can be replayed, it must be called
+// with the lock held
+func (s *Spool) seal() {
+	if s.active != nil {
+		s.active.Close()
+		s.active = nil
+	}
+}
+
+// Depth returns the data waiting to be replayed
+func (s *Spool) Depth() Depth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.depth
+}
+
+// Replay calls write with every spooled batch from the oldest to the newest,
+// batches are removed once written and replaying stops at the first retryable
+// failure. Batches failing with any other error are moved to the quarantine
+// file so they don't block the following ones.
+// Batches may be written twice after a crash, which is harmless as points
+// with the same sensor and time are overwritten. Replay must not be called
+// concurrently
+func (s *Spool) Replay(ctx context.Context, write func(ctx context.Context, batch []models.SensorRequest) error) error {
+	for {
+		seg, offset, ok := s.oldest()
+		if !ok {
+			return nil
+		}
+
+		err := s.replaySegment(ctx, seg, offset, write)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// oldest returns the oldest segment and the offset to replay it from, sealing
+// the active segment when it's the only one left
+func (s *Spool) oldest() (segment, int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.segments) == 0 {
+		return segment{}, 0, false
+	}
+	if len(s.segments) == 1 {
+		s.seal()
+	}
+	return s.segments[0], s.replayed, true
+}
+
+func (s *Spool) replaySegment(ctx context.Context, seg segment, offset int64, write func(ctx context.Context, batch []models.SensorRequest) error) error {
+	file, err := os.Open(s.path(seg.sequence))
+	if err != nil {
+		return fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.Seek(offset, io.SeekStart)
+	if err != nil {
+		return fmt.Errorf("failed to seek spool segment: %w", err)
+	}
+
+	reader := bufio.NewReader(file)
+	for offset < seg.bytes {
+		batch, size, err := readRecord(reader)
+		if err != nil {
+			return fmt.Errorf("failed to read spool segment: %w", err)
+		}
+
+		s.replaying.Lock()
+		s.mu.Lock()
+		batch = s.filter(seg.sequence, offset, batch)
+		s.mu.Unlock()
+		err = nil
+		if len(batch) > 0 {
+			err = write(ctx, batch)
+		}
+		s.replaying.Unlock()
+		if err != nil && Retryable(err) {
+			return err
+		}
+		if err != nil {
+			quarantineErr := s.quarantine(batch)
+			if quarantineErr != nil {
+				return errors.Join(err, quarantineErr)
+			}
+			log.Error().Err(err).Int("measurements", len(batch)).Msg("quarantined spooled measurements rejected by the metric store")
+		}
+
+		offset += size
+		s.mu.Lock()
+		s.replayed = offset
+		s.depth.Batches--
+		s.depth.Bytes -= size
+		s.mu.Unlock()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.segments = s.segments[1:]
+	s.replayed = 0
+	s.depth.Segments = len(s.segments)
+	err = os.Remove(s.path(seg.sequence))
+	if err != nil {
+		return fmt.Errorf("failed to remove spool segment: %w", err)
+	}
+	return s.pruneTombstones(seg.sequence)
+}
+
+// quarantine durably appends a rejected batch to the quarantine file
+func (s *Spool) quarantine(batch []models.SensorRequest) error {
+	record, err := encodeRecord(batch)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filepath.Join(s.dir, quarantineFile), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open spool quarantine: %w", err)
+	}
+	defer file.Close()
+
+	_, err = file.Write(record)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write spool quarantine: %w", err)
+	}
+
+	s.mu.Lock()
+	s.depth.Quarantined++
+	s.mu.Unlock()
+	return nil
+}
+
+// readRecord decodes the next record, returning its size on disk
+func readRecord(reader io.Reader) ([]models.SensorRequest, int64, error) {
+	header := make([]byte, headerBytes)
+	_, err := io.ReadFull(reader, header)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	payload := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+	_, err = io.ReadFull(reader, payload)
+	if err != nil {
+		return nil, 0, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, 0, errors.New("spool record checksum mismatch")
+	}
+
+	var batch []models.SensorRequest
+	err = gob.NewDecoder(bytes.NewReader(payload)).Decode(&batch)
+	if err != nil {
+		return nil, 0, err
+	}
+	return batch, int64(len(payload) + headerBytes), nil
+}
+
+// Close releases the active segment, spooled batches are kept on disk
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seal()
+	return nil
+}
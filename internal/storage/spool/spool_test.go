@@ -0,0 +1,165 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+func TestSpool(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 8, 1, 10, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	spool, err := Open(dir, 1<<20)
+	assert.Nil(t, err)
+
+	first := []models.SensorRequest{{SensorID: "sensor", UserID: "user", PH: 6.0, Time: now}}
+	second := []models.SensorRequest{{SensorID: "sensor", UserID: "user", PH: 7.0, Time: now.Add(time.Minute)}}
+	assert.Nil(t, spool.Append(first))
+	assert.Nil(t, spool.Append(second))
+	assert.Equal(t, 2, spool.Depth().Batches)
+
+	// batches are kept after a failed replay
+	failure := errors.New("influx is down")
+	replayed := make([][]models.SensorRequest, 0)
+	err = spool.Replay(ctx, func(ctx context.Context, batch []models.SensorRequest) error {
+		if len(replayed) == 1 {
+			return failure
+		}
+		replayed = append(replayed, batch)
+		return nil
+	})
+	assert.ErrorIs(t, err, failure)
+	assert.Equal(t, [][]models.SensorRequest{first}, replayed)
+	assert.Equal(t, 1, spool.Depth().Batches)
+
+	// batches appended while replaying go to a new segment and survive a restart
+	assert.Nil(t, spool.Append(first))
+	assert.Nil(t, spool.Close())
+	spool, err = Open(dir, 1<<20)
+	assert.Nil(t, err)
+	assert.Equal(t, Depth{Segments: 2, Batches: 3, Bytes: spool.Depth().Bytes}, spool.Depth())
+
+	replayed = replayed[:0]
+	err = spool.Replay(ctx, func(ctx context.Context, batch []models.SensorRequest) error {
+		replayed = append(replayed, batch)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]models.SensorRequest{first, second, first}, replayed)
+	assert.Equal(t, Depth{}, spool.Depth())
+
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
+
+func TestReplayQuarantinesRejectedBatches(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	spool, err := Open(dir, 1<<20)
+	assert.Nil(t, err)
+
+	rejected := []models.SensorRequest{{SensorID: "sensor", PH: 6.0}}
+	valid := []models.SensorRequest{{SensorID: "sensor", PH: 7.0}}
+	assert.Nil(t, spool.Append(rejected))
+	assert.Nil(t, spool.Append(valid))
+
+	replayed := make([][]models.SensorRequest, 0)
+	err = spool.Replay(ctx, func(ctx context.Context, batch []models.SensorRequest) error {
+		if batch[0].PH == 6.0 {
+			return localErrs.BadRequestErr
+		}
+		replayed = append(replayed, batch)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]models.SensorRequest{valid}, replayed)
+	assert.Equal(t, Depth{Quarantined: 1}, spool.Depth())
+
+	// quarantined batches are kept on disk
+	assert.Nil(t, spool.Close())
+	spool, err = Open(dir, 1<<20)
+	assert.Nil(t, err)
+	assert.Equal(t, Depth{Quarantined: 1}, spool.Depth())
+}
+
+func TestSpoolIsFull(t *testing.T) {
+	spool, err := Open(t.TempDir(), 64)
+	assert.Nil(t, err)
+
+	err = spool.Append([]models.SensorRequest{{SensorID: "sensor", UserID: "user", SensorVersion: "v1", Alias: "reservoir"}})
+	assert.ErrorIs(t, err, ErrFull)
+	assert.Equal(t, Depth{}, spool.Depth())
+}
+
+func TestOpenDropsPartialRecords(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := Open(dir, 1<<20)
+	assert.Nil(t, err)
+	assert.Nil(t, spool.Append([]models.SensorRequest{{SensorID: "sensor", PH: 6.0}}))
+	size := spool.Depth().Bytes
+	assert.Nil(t, spool.Close())
+
+	// simulating a crash in the middle of a write
+	file, err := os.OpenFile(filepath.Join(dir, "0000000000000000.seg"), os.O_WRONLY|os.O_APPEND, 0)
+	assert.Nil(t, err)
+	_, err = file.Write([]byte{0, 0, 1, 0, 42})
+	assert.Nil(t, err)
+	assert.Nil(t, file.Close())
+
+	spool, err = Open(dir, 1<<20)
+	assert.Nil(t, err)
+	assert.Equal(t, Depth{Segments: 1, Batches: 1, Bytes: size}, spool.Depth())
+
+	assert.Nil(t, spool.Append([]models.SensorRequest{{SensorID: "sensor", PH: 7.0}}))
+	values := make([]float64, 0)
+	err = spool.Replay(context.Background(), func(ctx context.Context, batch []models.SensorRequest) error {
+		values = append(values, batch[0].PH)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []float64{6.0, 7.0}, values)
+}
+
+func TestForget(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 8, 1, 10, 0, 0, 0, time.UTC)
+	dir := t.TempDir()
+	spool, err := Open(dir, 1<<20)
+	assert.Nil(t, err)
+
+	deleted := models.SensorRequest{SensorID: "sensor", PH: 6.0, Time: now}
+	kept := models.SensorRequest{SensorID: "sensor", PH: 7.0, Time: now.Add(time.Hour)}
+	other := models.SensorRequest{SensorID: "other", PH: 8.0, Time: now}
+	assert.Nil(t, spool.Append([]models.SensorRequest{deleted, kept, other}))
+	assert.Nil(t, spool.Forget(models.MeasurementQuery{SensorID: "sensor", From: now, To: now.Add(time.Minute)}))
+	// measurements spooled after the delete are written
+	assert.Nil(t, spool.Append([]models.SensorRequest{deleted}))
+
+	// tombstones survive a restart
+	assert.Nil(t, spool.Close())
+	spool, err = Open(dir, 1<<20)
+	assert.Nil(t, err)
+
+	replayed := make([][]models.SensorRequest, 0)
+	err = spool.Replay(ctx, func(ctx context.Context, batch []models.SensorRequest) error {
+		replayed = append(replayed, batch)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, [][]models.SensorRequest{{kept, other}, {deleted}}, replayed)
+
+	// and are dropped with their segments
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	assert.Empty(t, entries)
+}
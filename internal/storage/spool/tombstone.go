@@ -0,0 +1,154 @@
+package spool
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+)
+
+// tombstonesFile keeps the deletes applied while measurements were spooled
+const tombstonesFile = "tombstones.gob"
+
+// tombstone drops the measurements of SensorID in the [From, To) range which
+// were spooled before the end of segment Sequence at Offset, so replays don't
+// write back deleted measurements
+type tombstone struct {
+	SensorID string
+	From     time.Time
+	To       time.Time
+	Sequence uint64
+	Offset   int64
+}
+
+// covers tells if the tombstone drops measurement, spooled in the batch at
+// offset of segment sequence
+func (t tombstone) covers(sequence uint64, offset int64, measurement models.SensorRequest) bool {
+	spooledBefore := sequence < t.Sequence || (sequence == t.Sequence && offset < t.Offset)
+	return spooledBefore && measurement.SensorID == t.SensorID && !measurement.Time.Before(t.From) && measurement.Time.Before(t.To)
+}
+
+// Forget drops the spooled measurements of query.SensorID in the [From, To)
+// range, it waits for the batch being replayed so it can't be written after
+// Forget returns
+func (s *Spool) Forget(query models.MeasurementQuery) error {
+	s.replaying.Lock()
+	defer s.replaying.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.segments) == 0 {
+		return nil
+	}
+	last := s.segments[len(s.segments)-1]
+	s.tombstones = append(s.tombstones, tombstone{
+		SensorID: query.SensorID,
+		From:     query.From,
+		To:       query.To,
+		Sequence: last.sequence,
+		Offset:   last.bytes,
+	})
+	return s.saveTombstones()
+}
+
+// filter removes the measurements covered by a tombstone from the batch at
+// offset of segment sequence, it must be called with the lock held
+func (s *Spool) filter(sequence uint64, offset int64, batch []models.SensorRequest) []models.SensorRequest {
+	if len(s.tombstones) == 0 {
+		return batch
+	}
+
+	kept := make([]models.SensorRequest, 0, len(batch))
+	for _, measurement := range batch {
+		dropped := false
+		for _, t := range s.tombstones {
+			if t.covers(sequence, offset, measurement) {
+				dropped = true
+				break
+			}
+		}
+		if !dropped {
+			kept = append(kept, measurement)
+		}
+	}
+	return kept
+}
+
+// pruneTombstones forgets the tombstones of the segments already replayed, it
+// must be called with the lock held
+func (s *Spool) pruneTombstones(replayed uint64) error {
+	kept := s.tombstones[:0]
+	for _, t := range s.tombstones {
+		if t.Sequence > replayed {
+			kept = append(kept, t)
+		}
+	}
+	if len(kept) == len(s.tombstones) {
+		return nil
+	}
+	s.tombstones = kept
+	return s.saveTombstones()
+}
+
+// saveTombstones atomically replaces the tombstones file, it must be called
+// with the lock held
+func (s *Spool) saveTombstones() error {
+	path := filepath.Join(s.dir, tombstonesFile)
+	if len(s.tombstones) == 0 {
+		err := os.Remove(path)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove spool tombstones: %w", err)
+		}
+		return nil
+	}
+
+	var payload bytes.Buffer
+	err := gob.NewEncoder(&payload).Encode(s.tombstones)
+	if err != nil {
+		return fmt.Errorf("failed to encode spool tombstones: %w", err)
+	}
+
+	file, err := os.CreateTemp(s.dir, tombstonesFile+".*")
+	if err != nil {
+		return fmt.Errorf("failed to write spool tombstones: %w", err)
+	}
+	defer os.Remove(file.Name())
+	_, err = file.Write(payload.Bytes())
+	if err == nil {
+		err = file.Sync()
+	}
+	closeErr := file.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write spool tombstones: %w", err)
+	}
+	return nil
+}
+
+// loadTombstones reads the tombstones saved in dir
+func loadTombstones(dir string) ([]tombstone, error) {
+	payload, err := os.ReadFile(filepath.Join(dir, tombstonesFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool tombstones: %w", err)
+	}
+
+	var tombstones []tombstone
+	err = gob.NewDecoder(bytes.NewReader(payload)).Decode(&tombstones)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode spool tombstones: %w", err)
+	}
+	return tombstones, nil
+}
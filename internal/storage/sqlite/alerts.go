@@ -0,0 +1,182 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+	"github.com/mattn/go-sqlite3"
+)
+
+type alertRepository struct {
+	db *sql.DB
+}
+
+func NewAlertRepository(db *sql.DB) storage.AlertRepository {
+	return &alertRepository{db: db}
+}
+
+// isConstraintErr checks if err was caused by a unique or primary key violation
+func isConstraintErr(err error) bool {
+	sqliteErr, ok := err.(sqlite3.Error)
+	return ok && sqliteErr.Code == sqlite3.ErrConstraint
+}
+
+func (a *alertRepository) CreateRule(ctx context.Context, rule models.AlertRule) error {
+	_, err := a.db.ExecContext(ctx,
+		"INSERT INTO alert_rules (id, user_id, device_id, field, operator, threshold, for_seconds, status, breached_since) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		rule.ID, rule.UserID, rule.DeviceID, rule.Field, rule.Operator, rule.Threshold, rule.ForSeconds, rule.Status, toNanos(rule.BreachedSince),
+	)
+	if err != nil {
+		if isConstraintErr(err) {
+			return localErrs.AlreadyExistsErr.WithMsg("alert rule already exists").WithErr(err)
+		}
+		return localErrs.InternalServerErr.WithMsg("failed to create alert rule").WithErr(err)
+	}
+
+	return nil
+}
+
+func (a *alertRepository) GetRules(ctx context.Context, userID string) ([]models.AlertRule, error) {
+	rows, err := a.db.QueryContext(ctx,
+		"SELECT id, user_id, device_id, field, operator, threshold, for_seconds, status, breached_since FROM alert_rules WHERE user_id = ? ORDER BY id",
+		userID,
+	)
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve alert rules").WithErr(err)
+	}
+	defer rows.Close()
+
+	rules := make([]models.AlertRule, 0)
+	for rows.Next() {
+		var rule models.AlertRule
+		var breachedSince sql.NullInt64
+		err = rows.Scan(&rule.ID, &rule.UserID, &rule.DeviceID, &rule.Field, &rule.Operator, &rule.Threshold, &rule.ForSeconds, &rule.Status, &breachedSince)
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to parse alert rule").WithErr(err)
+		}
+		rule.BreachedSince = fromNanos(breachedSince)
+		rules = append(rules, rule)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve alert rules").WithErr(err)
+	}
+
+	return rules, nil
+}
+
+func (a *alertRepository) DeleteRule(ctx context.Context, userID, ruleID string) error {
+	result, err := a.db.ExecContext(ctx, "DELETE FROM alert_rules WHERE user_id = ? AND id = ?", userID, ruleID)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to delete alert rule").WithErr(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to delete alert rule").WithErr(err)
+	}
+	if affected == 0 {
+		return localErrs.NotFoundErr.WithMsg("alert rule not found")
+	}
+	return nil
+}
+
+func (a *alertRepository) EvaluateRule(ctx context.Context, userID, ruleID string, evaluate storage.RuleEvaluation) ([]models.AlertEvent, error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to evaluate alert rule").WithErr(err)
+	}
+	defer tx.Rollback()
+
+	var rule models.AlertRule
+	var breachedSince sql.NullInt64
+	err = tx.QueryRowContext(ctx,
+		"SELECT id, user_id, device_id, field, operator, threshold, for_seconds, status, breached_since FROM alert_rules WHERE user_id = ? AND id = ?",
+		userID, ruleID,
+	).Scan(&rule.ID, &rule.UserID, &rule.DeviceID, &rule.Field, &rule.Operator, &rule.Threshold, &rule.ForSeconds, &rule.Status, &breachedSince)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, localErrs.NotFoundErr.WithMsg("alert rule not found")
+		}
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve alert rule").WithErr(err)
+	}
+	rule.BreachedSince = fromNanos(breachedSince)
+
+	events, changed := evaluate(&rule)
+	if changed {
+		_, err = tx.ExecContext(ctx,
+			"UPDATE alert_rules SET status = ?, breached_since = ? WHERE user_id = ? AND id = ?",
+			rule.Status, toNanos(rule.BreachedSince), userID, ruleID,
+		)
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to update alert rule state").WithErr(err)
+		}
+	}
+	for _, event := range events {
+		err = addEvent(ctx, tx, userID, event)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to evaluate alert rule").WithErr(err)
+	}
+	return events, nil
+}
+
+func (a *alertRepository) AddEvent(ctx context.Context, userID string, event models.AlertEvent) error {
+	return addEvent(ctx, a.db, userID, event)
+}
+
+// execer is implemented by both the database and its transactions
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func addEvent(ctx context.Context, db execer, userID string, event models.AlertEvent) error {
+	_, err := db.ExecContext(ctx,
+		"INSERT OR REPLACE INTO alert_events (id, user_id, rule_id, device_id, field, operator, threshold, value, status, time) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		event.ID, userID, event.RuleID, event.DeviceID, event.Field, event.Operator, event.Threshold, event.Value, event.Status, event.Time.UnixNano(),
+	)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to add alert event").WithErr(err)
+	}
+
+	return nil
+}
+
+func (a *alertRepository) GetEvents(ctx context.Context, userID string, from, to time.Time) ([]models.AlertEvent, error) {
+	rows, err := a.db.QueryContext(ctx,
+		"SELECT id, rule_id, device_id, field, operator, threshold, value, status, time FROM alert_events WHERE user_id = ? AND time >= ? AND time < ? ORDER BY time DESC LIMIT ?",
+		userID, from.UnixNano(), to.UnixNano(), storage.MaxAlertEvents,
+	)
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve alert events").WithErr(err)
+	}
+	defer rows.Close()
+
+	events := make([]models.AlertEvent, 0)
+	for rows.Next() {
+		var event models.AlertEvent
+		var nanos sql.NullInt64
+		err = rows.Scan(&event.ID, &event.RuleID, &event.DeviceID, &event.Field, &event.Operator, &event.Threshold, &event.Value, &event.Status, &nanos)
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to parse alert event").WithErr(err)
+		}
+		event.Time = fromNanos(nanos)
+		events = append(events, event)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve alert events").WithErr(err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,256 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+type metricRepository struct {
+	db *sql.DB
+}
+
+func NewMetricRepository(db *sql.DB) storage.MetricRepository {
+	return &metricRepository{db: db}
+}
+
+// aggregationFunctions maps the supported aggregations to their SQL
+// functions, last relies on sqlite filling bare columns from the max(time) row
+var aggregationFunctions = map[string]string{
+	models.AggregationMean:  "avg(%s)",
+	models.AggregationMin:   "min(%s)",
+	models.AggregationMax:   "max(%s)",
+	models.AggregationLast:  "%s",
+	models.AggregationCount: "count(%s)",
+}
+
+func (r *metricRepository) WriteMeasurement(ctx context.Context, requests ...models.SensorRequest) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to write data").WithErr(err)
+	}
+	defer tx.Rollback()
+
+	columns := append([]string{"sensor_id", "time", "sensor_version", "alias"}, models.MeasurementFields...)
+	statement, err := tx.PrepareContext(ctx, fmt.Sprintf(
+		"INSERT OR REPLACE INTO metrics (%s) VALUES (%s)",
+		strings.Join(columns, ", "),
+		placeholders(len(columns)),
+	))
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to write data").WithErr(err)
+	}
+	defer statement.Close()
+
+	for _, request := range requests {
+		values := []any{request.SensorID, request.Time.UnixNano(), request.SensorVersion, request.Alias}
+		for _, field := range models.MeasurementFields {
+			value, _ := request.Field(field)
+			values = append(values, value)
+		}
+
+		_, err = statement.ExecContext(ctx, values...)
+		if err != nil {
+			return errors.InternalServerErr.WithMsg("failed to write data").WithErr(err)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to write data").WithErr(err)
+	}
+	return nil
+}
+
+func (r *metricRepository) ReadMeasurements(ctx context.Context, query models.MeasurementQuery) ([]models.Measurement, error) {
+	measurements := make([]models.Measurement, 0)
+	err := r.StreamMeasurements(ctx, query, func(measurement models.Measurement) error {
+		measurements = append(measurements, measurement)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return measurements, nil
+}
+
+// StreamMeasurements calls handle for every measurement as soon as it's read,
+// so large ranges don't need to fit in memory
+func (r *metricRepository) StreamMeasurements(ctx context.Context, query models.MeasurementQuery, handle func(models.Measurement) error) error {
+	statement, args, err := buildReadQuery(query)
+	if err != nil {
+		return err
+	}
+
+	rows, err := r.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to query data").WithErr(err)
+	}
+	defer rows.Close()
+
+	err = scanMeasurements(rows, query.Fields, handle)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *metricRepository) SupportsDeletes() bool {
+	return true
+}
+
+func (r *metricRepository) DeleteMeasurements(ctx context.Context, query models.MeasurementQuery) error {
+	_, err := r.db.ExecContext(ctx, "DELETE FROM metrics WHERE sensor_id = ? AND time >= ? AND time < ?", query.SensorID, query.From.UnixNano(), query.To.UnixNano())
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to delete data").WithErr(err)
+	}
+	return nil
+}
+
+func (r *metricRepository) CountMeasurements(ctx context.Context, query models.MeasurementQuery) (int64, error) {
+	var count int64
+	err := r.db.QueryRowContext(ctx, "SELECT count(*) FROM metrics WHERE sensor_id = ? AND time >= ? AND time < ?", query.SensorID, query.From.UnixNano(), query.To.UnixNano()).Scan(&count)
+	if err != nil {
+		return 0, errors.InternalServerErr.WithMsg("failed to count data").WithErr(err)
+	}
+	return count, nil
+}
+
+func (r *metricRepository) ReadLatestMeasurements(ctx context.Context, sensorIDs ...string) ([]models.Measurement, error) {
+	measurements := make([]models.Measurement, 0, len(sensorIDs))
+	if len(sensorIDs) == 0 {
+		return measurements, nil
+	}
+
+	args := make([]any, len(sensorIDs))
+	for i, sensorID := range sensorIDs {
+		args[i] = sensorID
+	}
+	rows, err := r.db.QueryContext(ctx, fmt.Sprintf(
+		"SELECT max(time), sensor_id, sensor_version, alias, %s FROM metrics WHERE sensor_id IN (%s) GROUP BY sensor_id",
+		strings.Join(models.MeasurementFields, ", "),
+		placeholders(len(sensorIDs)),
+	), args...)
+	if err != nil {
+		return nil, errors.InternalServerErr.WithMsg("failed to query latest data").WithErr(err)
+	}
+	defer rows.Close()
+
+	err = scanMeasurements(rows, models.MeasurementFields, func(measurement models.Measurement) error {
+		measurements = append(measurements, measurement)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return measurements, nil
+}
+
+func buildReadQuery(query models.MeasurementQuery) (string, []any, error) {
+	for _, field := range query.Fields {
+		if !slices.Contains(models.MeasurementFields, field) {
+			return "", nil, errors.BadRequestErr.WithMsg("unknown field").WithDetails("field", field)
+		}
+	}
+
+	columns := []string{"time", "sensor_id", "sensor_version", "alias"}
+	args := make([]any, 0, 4)
+	groupBy := ""
+	if len(query.Aggregation) > 0 {
+		function, ok := aggregationFunctions[query.Aggregation]
+		if !ok || query.Window <= 0 {
+			return "", nil, errors.BadRequestErr.WithMsg("invalid aggregation").WithDetails("aggregation", query.Aggregation)
+		}
+
+		// windows are aligned to the unix epoch, the same way influx date_bin does
+		columns[0] = "(time / ?) * ? AS bucket"
+		args = append(args, query.Window.Nanoseconds(), query.Window.Nanoseconds())
+		if query.Aggregation == models.AggregationLast {
+			columns = append(columns, "max(time)")
+		}
+		for _, field := range query.Fields {
+			columns = append(columns, fmt.Sprintf(function, field))
+		}
+		groupBy = " GROUP BY bucket, sensor_version, alias"
+	} else {
+		columns = append(columns, query.Fields...)
+	}
+
+	orderBy := " ORDER BY time"
+	if len(groupBy) > 0 {
+		orderBy = " ORDER BY bucket"
+	}
+
+	limit := ""
+	if query.Limit > 0 {
+		limit = fmt.Sprintf(" LIMIT %d", query.Limit)
+	}
+
+	args = append(args, query.SensorID, query.From.UnixNano(), query.To.UnixNano())
+	return fmt.Sprintf(
+		"SELECT %s FROM metrics WHERE sensor_id = ? AND time >= ? AND time < ?%s%s%s",
+		strings.Join(columns, ", "),
+		groupBy,
+		orderBy,
+		limit,
+	), args, nil
+}
+
+// scanMeasurements reads rows with the time, sensor_id, sensor_version and
+// alias columns followed by the fields, extra columns are ignored
+func scanMeasurements(rows *sql.Rows, fields []string, handle func(models.Measurement) error) error {
+	columns, err := rows.Columns()
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to read columns").WithErr(err)
+	}
+	// the last aggregation selects max(time) before the fields
+	offset := len(columns) - len(fields)
+
+	for rows.Next() {
+		var nanos sql.NullInt64
+		var measurement models.Measurement
+		values := make([]sql.NullFloat64, len(fields))
+		destinations := make([]any, len(columns))
+		destinations[0] = &nanos
+		destinations[1] = &measurement.SensorID
+		destinations[2] = &measurement.SensorVersion
+		destinations[3] = &measurement.Alias
+		for i := 4; i < offset; i++ {
+			destinations[i] = new(any)
+		}
+		for i := range values {
+			destinations[offset+i] = &values[i]
+		}
+
+		err = rows.Scan(destinations...)
+		if err != nil {
+			return errors.InternalServerErr.WithMsg("failed to parse row").WithErr(err)
+		}
+
+		measurement.Time = fromNanos(nanos)
+		measurement.Fields = make(map[string]float64, len(fields))
+		for i, field := range fields {
+			// null values are returned when the field wasn't written for this point
+			if values[i].Valid {
+				measurement.Fields[field] = values[i].Float64
+			}
+		}
+
+		err = handle(measurement)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = rows.Err()
+	if err != nil {
+		return errors.InternalServerErr.WithMsg("failed to read rows").WithErr(err)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/storagetest"
+)
+
+func TestMetricRepository(t *testing.T) {
+	storagetest.RunMetricRepository(t, NewMetricRepository(newTestDB(t)))
+}
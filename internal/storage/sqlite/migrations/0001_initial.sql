@@ -0,0 +1,73 @@
+-- times are stored as unix nanoseconds
+CREATE TABLE metrics (
+    sensor_id TEXT NOT NULL,
+    time INTEGER NOT NULL,
+    sensor_version TEXT NOT NULL,
+    alias TEXT NOT NULL,
+    temperature REAL,
+    humidity REAL,
+    ph REAL,
+    tds REAL,
+    ec REAL,
+    water_temperature REAL,
+    PRIMARY KEY (sensor_id, time)
+) WITHOUT ROWID;
+
+CREATE TABLE user_devices (
+    user_id TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    UNIQUE (user_id, device_id)
+);
+
+CREATE TABLE alert_rules (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    field TEXT NOT NULL,
+    operator TEXT NOT NULL,
+    threshold REAL NOT NULL,
+    for_seconds INTEGER NOT NULL,
+    status TEXT NOT NULL,
+    breached_since INTEGER
+);
+CREATE INDEX alert_rules_user_id ON alert_rules (user_id);
+
+CREATE TABLE alert_events (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    rule_id TEXT NOT NULL,
+    device_id TEXT NOT NULL,
+    field TEXT NOT NULL,
+    operator TEXT NOT NULL,
+    threshold REAL NOT NULL,
+    value REAL NOT NULL,
+    status TEXT NOT NULL,
+    time INTEGER NOT NULL
+);
+CREATE INDEX alert_events_user_id_time ON alert_events (user_id, time);
+
+CREATE TABLE webhooks (
+    id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL,
+    url TEXT NOT NULL,
+    -- json encoded list of event types
+    events TEXT NOT NULL,
+    secret TEXT NOT NULL,
+    enabled INTEGER NOT NULL,
+    consecutive_failures INTEGER NOT NULL,
+    created_at INTEGER NOT NULL
+);
+CREATE INDEX webhooks_user_id ON webhooks (user_id);
+
+CREATE TABLE webhook_deliveries (
+    id TEXT PRIMARY KEY,
+    webhook_id TEXT NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    attempts INTEGER NOT NULL,
+    status_code INTEGER NOT NULL,
+    error TEXT NOT NULL,
+    success INTEGER NOT NULL,
+    time INTEGER NOT NULL
+);
+CREATE INDEX webhook_deliveries_webhook_id_time ON webhook_deliveries (webhook_id, time);
@@ -0,0 +1,10 @@
+-- every device has a single owner, devices bound to many users before this
+-- migration keep the first one
+CREATE TABLE devices (
+    device_id TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL
+);
+CREATE INDEX devices_user_id ON devices (user_id);
+
+INSERT OR IGNORE INTO devices (device_id, user_id)
+SELECT device_id, user_id FROM user_devices ORDER BY rowid;
@@ -0,0 +1,8 @@
+-- devices bound before this migration have no metadata nor creation time,
+-- probes are stored as a json encoded list
+ALTER TABLE user_devices ADD COLUMN name TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_devices ADD COLUMN location TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_devices ADD COLUMN system_type TEXT NOT NULL DEFAULT '';
+ALTER TABLE user_devices ADD COLUMN reservoir_liters REAL NOT NULL DEFAULT 0;
+ALTER TABLE user_devices ADD COLUMN probes TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE user_devices ADD COLUMN created_at INTEGER;
@@ -0,0 +1,4 @@
+CREATE TABLE retention_policies (
+    user_id TEXT PRIMARY KEY,
+    days INTEGER NOT NULL
+);
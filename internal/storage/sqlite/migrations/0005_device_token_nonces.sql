@@ -0,0 +1,3 @@
+-- device tokens are derived from a nonce stored with the ownership, so they
+-- are revoked when the device is unbound
+ALTER TABLE devices ADD COLUMN token_nonce TEXT NOT NULL DEFAULT '';
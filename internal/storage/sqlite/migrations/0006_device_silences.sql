@@ -0,0 +1,6 @@
+-- the last reading of the devices notified as silent, shared by every
+-- instance so each silence is only notified once
+CREATE TABLE device_silences (
+    device_id TEXT PRIMARY KEY,
+    last_seen INTEGER NOT NULL
+);
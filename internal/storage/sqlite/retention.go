@@ -0,0 +1,42 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+type retentionRepository struct {
+	db *sql.DB
+}
+
+func NewRetentionRepository(db *sql.DB) storage.RetentionRepository {
+	return &retentionRepository{db: db}
+}
+
+func (r *retentionRepository) GetRetentionPolicy(ctx context.Context, userID string) (models.RetentionPolicy, error) {
+	policy := models.RetentionPolicy{UserID: userID}
+	err := r.db.QueryRowContext(ctx, "SELECT days FROM retention_policies WHERE user_id = ?", userID).Scan(&policy.Days)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.RetentionPolicy{}, localErrs.NotFoundErr.WithMsg("user without retention policy")
+		}
+		return models.RetentionPolicy{}, localErrs.InternalServerErr.WithMsg("failed to retrieve retention policy").WithErr(err)
+	}
+	return policy, nil
+}
+
+func (r *retentionRepository) SetRetentionPolicy(ctx context.Context, policy models.RetentionPolicy) error {
+	_, err := r.db.ExecContext(ctx,
+		"INSERT INTO retention_policies (user_id, days) VALUES (?, ?) ON CONFLICT (user_id) DO UPDATE SET days = excluded.days",
+		policy.UserID, policy.Days,
+	)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to set retention policy").WithErr(err)
+	}
+	return nil
+}
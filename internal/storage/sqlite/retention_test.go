@@ -0,0 +1,11 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/storagetest"
+)
+
+func TestRetentionRepository(t *testing.T) {
+	storagetest.RunRetentionRepository(t, NewRetentionRepository(newTestDB(t)))
+}
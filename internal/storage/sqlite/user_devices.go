@@ -0,0 +1,272 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+type userDeviceRepository struct {
+	db *sql.DB
+}
+
+func NewUserDeviceRepository(db *sql.DB) storage.UserDeviceRepository {
+	return &userDeviceRepository{db: db}
+}
+
+const deviceColumns = "device_id, name, location, system_type, reservoir_liters, probes, created_at"
+
+func scanDevice(row rowScanner, dest ...any) (models.Device, error) {
+	var device models.Device
+	var probes string
+	var createdAt sql.NullInt64
+	err := row.Scan(append(dest, &device.ID, &device.Name, &device.Location, &device.SystemType, &device.ReservoirLiters, &probes, &createdAt)...)
+	if err != nil {
+		return models.Device{}, err
+	}
+
+	err = json.Unmarshal([]byte(probes), &device.Probes)
+	if err != nil {
+		return models.Device{}, err
+	}
+	device.CreatedAt = fromNanos(createdAt)
+	return device, nil
+}
+
+func (u *userDeviceRepository) GetDevicesFromUser(ctx context.Context, userID string) ([]models.Device, error) {
+	rows, err := u.db.QueryContext(ctx, "SELECT "+deviceColumns+" FROM user_devices WHERE user_id = ? ORDER BY rowid", userID)
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve user devices").WithErr(err)
+	}
+	defer rows.Close()
+
+	devices := make([]models.Device, 0)
+	for rows.Next() {
+		device, err := scanDevice(rows)
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to parse user devices").WithErr(err)
+		}
+		devices = append(devices, device)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve user devices").WithErr(err)
+	}
+
+	if len(devices) == 0 {
+		return nil, localErrs.NotFoundErr.WithMsg("user without correlated devices")
+	}
+	return devices, nil
+}
+
+// claimDevice registers the user as the device owner and binds the device to
+// the user, failing with AlreadyExistsErr when the device already has an owner
+func claimDevice(ctx context.Context, tx *sql.Tx, userID string, device models.Device) error {
+	result, err := tx.ExecContext(ctx, "INSERT INTO devices (device_id, user_id) VALUES (?, ?) ON CONFLICT DO NOTHING", device.ID, userID)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to claim device").WithErr(err)
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to claim device").WithErr(err)
+	}
+	if claimed == 0 {
+		return localErrs.AlreadyExistsErr.WithMsg("device already has an owner").WithDetails("device", device.ID)
+	}
+
+	probes, err := json.Marshal(device.Probes)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to encode device probes").WithErr(err)
+	}
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO user_devices (user_id, "+deviceColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		userID, device.ID, device.Name, device.Location, device.SystemType, device.ReservoirLiters, string(probes), toNanos(device.CreatedAt),
+	)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to bind device").WithErr(err)
+	}
+	return nil
+}
+
+func (u *userDeviceRepository) AddDeviceToUser(ctx context.Context, userID string, newDevice models.Device) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to add user device").WithErr(err)
+	}
+	defer tx.Rollback()
+
+	err = claimDevice(ctx, tx, userID, newDevice)
+	if err != nil {
+		return err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to add user device").WithErr(err)
+	}
+	return nil
+}
+
+func (u *userDeviceRepository) GetDeviceOwner(ctx context.Context, deviceID string) (string, error) {
+	var owner string
+	err := u.db.QueryRowContext(ctx, "SELECT user_id FROM devices WHERE device_id = ?", deviceID).Scan(&owner)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", localErrs.NotFoundErr.WithMsg("device without owner")
+		}
+		return "", localErrs.InternalServerErr.WithMsg("failed to retrieve device owner").WithErr(err)
+	}
+	return owner, nil
+}
+
+func (u *userDeviceRepository) GetDeviceTokenNonce(ctx context.Context, deviceID string) (string, string, error) {
+	var owner, nonce string
+	err := u.db.QueryRowContext(ctx, "SELECT user_id, token_nonce FROM devices WHERE device_id = ?", deviceID).Scan(&owner, &nonce)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", "", localErrs.NotFoundErr.WithMsg("device without owner")
+		}
+		return "", "", localErrs.InternalServerErr.WithMsg("failed to retrieve device owner").WithErr(err)
+	}
+	return owner, nonce, nil
+}
+
+func (u *userDeviceRepository) SetDeviceTokenNonce(ctx context.Context, userID string, deviceID string, nonce string) error {
+	result, err := u.db.ExecContext(ctx, "UPDATE devices SET token_nonce = ? WHERE device_id = ? AND user_id = ?", nonce, deviceID, userID)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to store device token nonce").WithErr(err)
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to store device token nonce").WithErr(err)
+	}
+	if updated == 0 {
+		return localErrs.NotFoundErr.WithMsg("device not bound to the user").WithDetails("device", deviceID)
+	}
+	return nil
+}
+
+func (u *userDeviceRepository) UpdateDevice(ctx context.Context, userID string, deviceID string, update models.DeviceUpdate) (models.Device, error) {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Device{}, localErrs.InternalServerErr.WithMsg("failed to update user device").WithErr(err)
+	}
+	defer tx.Rollback()
+
+	// only the device owner can update it
+	device, err := scanDevice(tx.QueryRowContext(ctx,
+		"SELECT "+deviceColumns+" FROM user_devices JOIN devices USING (user_id, device_id) WHERE user_id = ? AND device_id = ?",
+		userID, deviceID,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Device{}, localErrs.NotFoundErr.WithMsg("device not bound to the user").WithDetails("device", deviceID)
+		}
+		return models.Device{}, localErrs.InternalServerErr.WithMsg("failed to retrieve user device").WithErr(err)
+	}
+
+	device = update.Apply(device)
+	probes, err := json.Marshal(device.Probes)
+	if err != nil {
+		return models.Device{}, localErrs.InternalServerErr.WithMsg("failed to encode device probes").WithErr(err)
+	}
+	_, err = tx.ExecContext(ctx,
+		"UPDATE user_devices SET name = ?, location = ?, system_type = ?, reservoir_liters = ?, probes = ? WHERE user_id = ? AND device_id = ?",
+		device.Name, device.Location, device.SystemType, device.ReservoirLiters, string(probes), userID, deviceID,
+	)
+	if err != nil {
+		return models.Device{}, localErrs.InternalServerErr.WithMsg("failed to update user device").WithErr(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return models.Device{}, localErrs.InternalServerErr.WithMsg("failed to update user device").WithErr(err)
+	}
+	return device, nil
+}
+
+func (u *userDeviceRepository) RemoveDeviceFromUser(ctx context.Context, userID string, deviceID string) error {
+	tx, err := u.db.BeginTx(ctx, nil)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to remove user device").WithErr(err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, "DELETE FROM devices WHERE device_id = ? AND user_id = ?", deviceID, userID)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to remove user device").WithErr(err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to remove user device").WithErr(err)
+	}
+	if removed == 0 {
+		return localErrs.NotFoundErr.WithMsg("device not bound to the user").WithDetails("device", deviceID)
+	}
+
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_devices WHERE user_id = ? AND device_id = ?", userID, deviceID)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to remove user device").WithErr(err)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to remove user device").WithErr(err)
+	}
+	return nil
+}
+
+func (u *userDeviceRepository) ListUserDevices(ctx context.Context, afterUserID string, limit int) ([]storage.UserDevices, error) {
+	rows, err := u.db.QueryContext(ctx,
+		"SELECT user_id, "+deviceColumns+" FROM user_devices WHERE user_id IN (SELECT DISTINCT user_id FROM user_devices WHERE user_id > ? ORDER BY user_id LIMIT ?) ORDER BY user_id, rowid",
+		afterUserID, limit,
+	)
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to list user devices").WithErr(err)
+	}
+	defer rows.Close()
+
+	userDevices := make([]storage.UserDevices, 0)
+	for rows.Next() {
+		var userID string
+		device, err := scanDevice(rows, &userID)
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to parse user devices").WithErr(err)
+		}
+
+		if len(userDevices) == 0 || userDevices[len(userDevices)-1].UserID != userID {
+			userDevices = append(userDevices, storage.UserDevices{UserID: userID})
+		}
+		last := &userDevices[len(userDevices)-1]
+		last.Devices = append(last.Devices, device)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to list user devices").WithErr(err)
+	}
+
+	return userDevices, nil
+}
+
+// ClaimSilenceNotification only updates the stored reading when it differs,
+// so a single statement tells whether the silence was already notified
+func (u *userDeviceRepository) ClaimSilenceNotification(ctx context.Context, deviceID string, lastSeen time.Time) (bool, error) {
+	result, err := u.db.ExecContext(ctx,
+		"INSERT INTO device_silences (device_id, last_seen) VALUES (?, ?) ON CONFLICT (device_id) DO UPDATE SET last_seen = excluded.last_seen WHERE last_seen != excluded.last_seen",
+		deviceID, lastSeen.UnixNano(),
+	)
+	if err != nil {
+		return false, localErrs.InternalServerErr.WithMsg("failed to claim device silence notification").WithErr(err)
+	}
+	claimed, err := result.RowsAffected()
+	if err != nil {
+		return false, localErrs.InternalServerErr.WithMsg("failed to claim device silence notification").WithErr(err)
+	}
+	return claimed > 0, nil
+}
@@ -0,0 +1,11 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/storagetest"
+)
+
+func TestUserDeviceRepository(t *testing.T) {
+	storagetest.RunUserDeviceRepository(t, NewUserDeviceRepository(newTestDB(t)))
+}
@@ -0,0 +1,188 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+const webhookColumns = "id, user_id, url, events, secret, enabled, consecutive_failures, created_at"
+
+type webhookRepository struct {
+	db *sql.DB
+}
+
+func NewWebhookRepository(db *sql.DB) storage.WebhookRepository {
+	return &webhookRepository{db: db}
+}
+
+// rowScanner is implemented by both sql.Row and sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWebhook(row rowScanner) (models.Webhook, error) {
+	var webhook models.Webhook
+	var events string
+	var createdAt sql.NullInt64
+	err := row.Scan(&webhook.ID, &webhook.UserID, &webhook.URL, &events, &webhook.Secret, &webhook.Enabled, &webhook.ConsecutiveFailures, &createdAt)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+
+	err = json.Unmarshal([]byte(events), &webhook.Events)
+	if err != nil {
+		return models.Webhook{}, err
+	}
+	webhook.CreatedAt = fromNanos(createdAt)
+	return webhook, nil
+}
+
+func (w *webhookRepository) CreateWebhook(ctx context.Context, webhook models.Webhook) error {
+	events, err := json.Marshal(webhook.Events)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to encode webhook events").WithErr(err)
+	}
+
+	_, err = w.db.ExecContext(ctx,
+		"INSERT INTO webhooks ("+webhookColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		webhook.ID, webhook.UserID, webhook.URL, string(events), webhook.Secret, webhook.Enabled, webhook.ConsecutiveFailures, webhook.CreatedAt.UnixNano(),
+	)
+	if err != nil {
+		if isConstraintErr(err) {
+			return localErrs.AlreadyExistsErr.WithMsg("webhook already exists").WithErr(err)
+		}
+		return localErrs.InternalServerErr.WithMsg("failed to create webhook").WithErr(err)
+	}
+
+	return nil
+}
+
+func (w *webhookRepository) GetWebhook(ctx context.Context, webhookID string) (models.Webhook, error) {
+	webhook, err := scanWebhook(w.db.QueryRowContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", webhookID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.Webhook{}, localErrs.NotFoundErr.WithMsg("webhook not found").WithErr(err)
+		}
+		return models.Webhook{}, localErrs.InternalServerErr.WithMsg("failed to retrieve webhook").WithErr(err)
+	}
+
+	return webhook, nil
+}
+
+func (w *webhookRepository) GetWebhooksFromUser(ctx context.Context, userID string) ([]models.Webhook, error) {
+	rows, err := w.db.QueryContext(ctx, "SELECT "+webhookColumns+" FROM webhooks WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve webhooks").WithErr(err)
+	}
+	defer rows.Close()
+
+	webhooks := make([]models.Webhook, 0)
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to parse webhook").WithErr(err)
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve webhooks").WithErr(err)
+	}
+
+	return webhooks, nil
+}
+
+func (w *webhookRepository) DeleteWebhook(ctx context.Context, webhookID string) error {
+	result, err := w.db.ExecContext(ctx, "DELETE FROM webhooks WHERE id = ?", webhookID)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to delete webhook").WithErr(err)
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to delete webhook").WithErr(err)
+	}
+	if affected == 0 {
+		return localErrs.NotFoundErr.WithMsg("webhook not found")
+	}
+	return nil
+}
+
+// IncrementFailures atomically increments the consecutive failures, returning the new value
+func (w *webhookRepository) IncrementFailures(ctx context.Context, webhookID string) (int, error) {
+	var failures int
+	err := w.db.QueryRowContext(ctx,
+		"UPDATE webhooks SET consecutive_failures = consecutive_failures + 1 WHERE id = ? RETURNING consecutive_failures",
+		webhookID,
+	).Scan(&failures)
+	if err != nil {
+		return 0, localErrs.InternalServerErr.WithMsg("failed to increment webhook failures").WithErr(err)
+	}
+
+	return failures, nil
+}
+
+func (w *webhookRepository) ResetFailures(ctx context.Context, webhookID string) error {
+	_, err := w.db.ExecContext(ctx, "UPDATE webhooks SET consecutive_failures = 0 WHERE id = ?", webhookID)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to reset webhook failures").WithErr(err)
+	}
+
+	return nil
+}
+
+func (w *webhookRepository) DisableWebhook(ctx context.Context, webhookID string) error {
+	_, err := w.db.ExecContext(ctx, "UPDATE webhooks SET enabled = 0 WHERE id = ?", webhookID)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to disable webhook").WithErr(err)
+	}
+
+	return nil
+}
+
+func (w *webhookRepository) AddDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	_, err := w.db.ExecContext(ctx,
+		"INSERT OR REPLACE INTO webhook_deliveries (id, webhook_id, event_id, event_type, attempts, status_code, error, success, time) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		delivery.ID, delivery.WebhookID, delivery.EventID, delivery.EventType, delivery.Attempts, delivery.StatusCode, delivery.Error, delivery.Success, delivery.Time.UnixNano(),
+	)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to add webhook delivery").WithErr(err)
+	}
+
+	return nil
+}
+
+func (w *webhookRepository) GetDeliveries(ctx context.Context, webhookID string) ([]models.WebhookDelivery, error) {
+	rows, err := w.db.QueryContext(ctx,
+		"SELECT id, webhook_id, event_id, event_type, attempts, status_code, error, success, time FROM webhook_deliveries WHERE webhook_id = ? ORDER BY time DESC LIMIT ?",
+		webhookID, storage.MaxWebhookDeliveries,
+	)
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve webhook deliveries").WithErr(err)
+	}
+	defer rows.Close()
+
+	deliveries := make([]models.WebhookDelivery, 0)
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var nanos sql.NullInt64
+		err = rows.Scan(&delivery.ID, &delivery.WebhookID, &delivery.EventID, &delivery.EventType, &delivery.Attempts, &delivery.StatusCode, &delivery.Error, &delivery.Success, &nanos)
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to parse webhook delivery").WithErr(err)
+		}
+		delivery.Time = fromNanos(nanos)
+		deliveries = append(deliveries, delivery)
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve webhook deliveries").WithErr(err)
+	}
+
+	return deliveries, nil
+}
@@ -0,0 +1,11 @@
+package sqlite
+
+import (
+	"testing"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/storagetest"
+)
+
+func TestWebhookRepository(t *testing.T) {
+	storagetest.RunWebhookRepository(t, NewWebhookRepository(newTestDB(t)))
+}
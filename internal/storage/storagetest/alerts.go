@@ -0,0 +1,88 @@
+// Package storagetest contains the behaviour shared by every storage backend,
+// each backend runs these suites against its own repositories. IDs are random
+// so the suites can run against databases shared with other tests
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+// RunAlertRepository checks the rules, their evaluation and the events
+func RunAlertRepository(t *testing.T, repository storage.AlertRepository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+	rule := models.AlertRule{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		DeviceID:  uuid.NewString(),
+		Field:     "ph",
+		Operator:  models.OperatorGreaterThan,
+		Threshold: 7,
+		Status:    models.AlertStatusInactive,
+	}
+
+	assert.Nil(t, repository.CreateRule(ctx, rule))
+	assert.ErrorIs(t, repository.CreateRule(ctx, rule), localErrs.AlreadyExistsErr)
+
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	fired := models.AlertEvent{ID: uuid.NewString(), RuleID: rule.ID, Status: models.AlertStatusFiring, Time: now.Add(-time.Second)}
+	events, err := repository.EvaluateRule(ctx, userID, rule.ID, func(stored *models.AlertRule) ([]models.AlertEvent, bool) {
+		assert.Equal(t, rule, *stored)
+		stored.Status = models.AlertStatusFiring
+		stored.BreachedSince = fired.Time
+		return []models.AlertEvent{fired}, true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []models.AlertEvent{fired}, events)
+	rule.Status = models.AlertStatusFiring
+	rule.BreachedSince = fired.Time
+	rules, err := repository.GetRules(ctx, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.AlertRule{rule}, rules)
+
+	// nothing is written when the evaluation doesn't change the rule
+	events, err = repository.EvaluateRule(ctx, userID, rule.ID, func(stored *models.AlertRule) ([]models.AlertEvent, bool) {
+		assert.Equal(t, rule, *stored)
+		stored.Status = models.AlertStatusInactive
+		return nil, false
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+	rules, err = repository.GetRules(ctx, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.AlertRule{rule}, rules)
+
+	_, err = repository.EvaluateRule(ctx, userID, uuid.NewString(), func(stored *models.AlertRule) ([]models.AlertEvent, bool) {
+		return nil, true
+	})
+	assert.ErrorIs(t, err, localErrs.NotFoundErr)
+
+	// events are returned from the newest, only in the requested range
+	assert.Nil(t, repository.AddEvent(ctx, userID, models.AlertEvent{ID: uuid.NewString(), RuleID: rule.ID, Status: models.AlertStatusFiring, Time: now.Add(-time.Hour)}))
+	resolved := models.AlertEvent{ID: uuid.NewString(), RuleID: rule.ID, Status: models.AlertStatusResolved, Time: now}
+	assert.Nil(t, repository.AddEvent(ctx, userID, resolved))
+	events, err = repository.GetEvents(ctx, userID, now.Add(-time.Minute), now.Add(time.Minute))
+	assert.Nil(t, err)
+	if assert.Len(t, events, 2) {
+		assert.Equal(t, resolved.ID, events[0].ID)
+		assert.Equal(t, fired.ID, events[1].ID)
+	}
+	events, err = repository.GetEvents(ctx, uuid.NewString(), now.Add(-time.Minute), now.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.Empty(t, events)
+
+	assert.Nil(t, repository.DeleteRule(ctx, userID, rule.ID))
+	assert.ErrorIs(t, repository.DeleteRule(ctx, userID, rule.ID), localErrs.NotFoundErr)
+	rules, err = repository.GetRules(ctx, userID)
+	assert.Nil(t, err)
+	assert.Empty(t, rules)
+}
@@ -0,0 +1,187 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+// RunMetricRepository checks the reads, aggregations, overwrites and deletes,
+// deletes are skipped by the stores that don't support them
+func RunMetricRepository(t *testing.T, repository storage.MetricRepository) {
+	t.Run("read measurements", func(t *testing.T) {
+		testReadMeasurements(t, repository)
+	})
+	t.Run("write measurement overwrites same time", func(t *testing.T) {
+		testWriteMeasurementOverwritesSameTime(t, repository)
+	})
+	t.Run("delete measurements", func(t *testing.T) {
+		if !repository.SupportsDeletes() {
+			t.Skip("the store doesn't support deletes")
+		}
+		testDeleteMeasurements(t, repository)
+	})
+}
+
+// measurementsStart is a recent window boundary, the stores only look that
+// far back for the latest measurements
+func measurementsStart() time.Time {
+	return time.Now().UTC().Truncate(time.Hour).Add(-time.Hour)
+}
+
+func testReadMeasurements(t *testing.T, repository storage.MetricRepository) {
+	ctx := context.Background()
+	start := measurementsStart()
+	sensorID, otherID := uuid.NewString(), uuid.NewString()
+	err := repository.WriteMeasurement(ctx,
+		models.SensorRequest{SensorID: sensorID, SensorVersion: "v1", Alias: "reservoir", PH: 6.0, Time: start.Add(2 * time.Minute)},
+		models.SensorRequest{SensorID: sensorID, SensorVersion: "v1", Alias: "reservoir", PH: 5.0, Time: start},
+		models.SensorRequest{SensorID: sensorID, SensorVersion: "v1", Alias: "reservoir", PH: 7.0, Time: start.Add(6 * time.Minute)},
+		models.SensorRequest{SensorID: otherID, SensorVersion: "v1", Alias: "other", PH: 9.0, Time: start},
+	)
+	assert.Nil(t, err)
+
+	var tests = []struct {
+		name   string
+		query  models.MeasurementQuery
+		assert func(t *testing.T, measurements []models.Measurement)
+	}{
+		{
+			name:  "raw measurements are sorted by time and only have the requested fields",
+			query: models.MeasurementQuery{SensorID: sensorID, From: start, To: start.Add(time.Hour), Fields: []string{"ph"}},
+			assert: func(t *testing.T, measurements []models.Measurement) {
+				assert.Len(t, measurements, 3)
+				assert.Equal(t, start, measurements[0].Time)
+				assert.Equal(t, map[string]float64{"ph": 5.0}, measurements[0].Fields)
+				assert.Equal(t, "reservoir", measurements[0].Alias)
+				assert.Equal(t, 7.0, measurements[2].Fields["ph"])
+			},
+		},
+		{
+			name:  "range end is exclusive",
+			query: models.MeasurementQuery{SensorID: sensorID, From: start.Add(time.Minute), To: start.Add(6 * time.Minute), Fields: []string{"ph"}},
+			assert: func(t *testing.T, measurements []models.Measurement) {
+				assert.Len(t, measurements, 1)
+				assert.Equal(t, 6.0, measurements[0].Fields["ph"])
+			},
+		},
+		{
+			name:  "measurements are aggregated in windows",
+			query: models.MeasurementQuery{SensorID: sensorID, From: start, To: start.Add(time.Hour), Fields: []string{"ph"}, Aggregation: models.AggregationMean, Window: 5 * time.Minute},
+			assert: func(t *testing.T, measurements []models.Measurement) {
+				assert.Len(t, measurements, 2)
+				assert.Equal(t, start, measurements[0].Time)
+				assert.Equal(t, 5.5, measurements[0].Fields["ph"])
+				assert.Equal(t, start.Add(5*time.Minute), measurements[1].Time)
+				assert.Equal(t, 7.0, measurements[1].Fields["ph"])
+			},
+		},
+		{
+			name:  "last aggregation takes the values of the latest point in the window",
+			query: models.MeasurementQuery{SensorID: sensorID, From: start, To: start.Add(time.Hour), Fields: []string{"ph"}, Aggregation: models.AggregationLast, Window: 5 * time.Minute},
+			assert: func(t *testing.T, measurements []models.Measurement) {
+				assert.Len(t, measurements, 2)
+				assert.Equal(t, start, measurements[0].Time)
+				assert.Equal(t, 6.0, measurements[0].Fields["ph"])
+			},
+		},
+		{
+			name:  "count aggregation",
+			query: models.MeasurementQuery{SensorID: sensorID, From: start, To: start.Add(time.Hour), Fields: []string{"ph"}, Aggregation: models.AggregationCount, Window: time.Hour},
+			assert: func(t *testing.T, measurements []models.Measurement) {
+				assert.Len(t, measurements, 1)
+				assert.Equal(t, 3.0, measurements[0].Fields["ph"])
+			},
+		},
+		{
+			name:  "limit",
+			query: models.MeasurementQuery{SensorID: sensorID, From: start, To: start.Add(time.Hour), Fields: []string{"ph"}, Limit: 2},
+			assert: func(t *testing.T, measurements []models.Measurement) {
+				assert.Len(t, measurements, 2)
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			measurements, err := repository.ReadMeasurements(ctx, tt.query)
+			assert.Nil(t, err)
+			tt.assert(t, measurements)
+		})
+	}
+
+	latest, err := repository.ReadLatestMeasurements(ctx, sensorID, otherID, uuid.NewString())
+	assert.Nil(t, err)
+	assert.Len(t, latest, 2)
+	for _, measurement := range latest {
+		switch measurement.SensorID {
+		case sensorID:
+			assert.Equal(t, 7.0, measurement.Fields["ph"])
+		case otherID:
+			assert.Equal(t, 9.0, measurement.Fields["ph"])
+		}
+	}
+}
+
+func testWriteMeasurementOverwritesSameTime(t *testing.T, repository storage.MetricRepository) {
+	ctx := context.Background()
+	now := time.Now().UTC().Truncate(time.Microsecond)
+	sensorID := uuid.NewString()
+	assert.Nil(t, repository.WriteMeasurement(ctx, models.SensorRequest{SensorID: sensorID, PH: 5.0, Time: now}))
+	assert.Nil(t, repository.WriteMeasurement(ctx, models.SensorRequest{SensorID: sensorID, PH: 6.0, Time: now}))
+
+	latest, err := repository.ReadLatestMeasurements(ctx, sensorID)
+	assert.Nil(t, err)
+	if assert.Len(t, latest, 1) {
+		assert.Equal(t, 6.0, latest[0].Fields["ph"])
+		assert.Len(t, latest[0].Fields, len(models.MeasurementFields))
+	}
+
+	// the last point wins within a batch too
+	assert.Nil(t, repository.WriteMeasurement(ctx,
+		models.SensorRequest{SensorID: sensorID, PH: 7.0, Time: now},
+		models.SensorRequest{SensorID: sensorID, PH: 8.0, Time: now},
+	))
+	latest, err = repository.ReadLatestMeasurements(ctx, sensorID)
+	assert.Nil(t, err)
+	if assert.Len(t, latest, 1) {
+		assert.Equal(t, 8.0, latest[0].Fields["ph"])
+	}
+}
+
+func testDeleteMeasurements(t *testing.T, repository storage.MetricRepository) {
+	ctx := context.Background()
+	start := measurementsStart()
+	sensorID, otherID := uuid.NewString(), uuid.NewString()
+	assert.Nil(t, repository.WriteMeasurement(ctx,
+		models.SensorRequest{SensorID: sensorID, PH: 5.0, Time: start},
+		models.SensorRequest{SensorID: sensorID, PH: 6.0, Time: start.Add(time.Minute)},
+		models.SensorRequest{SensorID: sensorID, PH: 7.0, Time: start.Add(2 * time.Minute)},
+		models.SensorRequest{SensorID: otherID, PH: 8.0, Time: start},
+	))
+
+	count, err := repository.CountMeasurements(ctx, models.MeasurementQuery{SensorID: sensorID, From: start, To: start.Add(2 * time.Minute)})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), count)
+
+	// the range end is exclusive
+	assert.Nil(t, repository.DeleteMeasurements(ctx, models.MeasurementQuery{SensorID: sensorID, From: start, To: start.Add(2 * time.Minute)}))
+
+	measurements, err := repository.ReadMeasurements(ctx, models.MeasurementQuery{SensorID: sensorID, From: start, To: start.Add(time.Hour), Fields: []string{"ph"}})
+	assert.Nil(t, err)
+	if assert.Len(t, measurements, 1) {
+		assert.Equal(t, 7.0, measurements[0].Fields["ph"])
+	}
+	count, err = repository.CountMeasurements(ctx, models.MeasurementQuery{SensorID: sensorID, From: start, To: start.Add(time.Hour)})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), count)
+	latest, err := repository.ReadLatestMeasurements(ctx, otherID)
+	assert.Nil(t, err)
+	assert.Len(t, latest, 1)
+}
@@ -0,0 +1,28 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+// RunRetentionRepository checks that policies are created and replaced
+func RunRetentionRepository(t *testing.T, repository storage.RetentionRepository) {
+	ctx := context.Background()
+	userID := uuid.NewString()
+
+	_, err := repository.GetRetentionPolicy(ctx, userID)
+	assert.ErrorIs(t, err, localErrs.NotFoundErr)
+
+	assert.Nil(t, repository.SetRetentionPolicy(ctx, models.RetentionPolicy{UserID: userID, Days: 90}))
+	assert.Nil(t, repository.SetRetentionPolicy(ctx, models.RetentionPolicy{UserID: userID, Days: 30}))
+	policy, err := repository.GetRetentionPolicy(ctx, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, models.RetentionPolicy{UserID: userID, Days: 30}, policy)
+}
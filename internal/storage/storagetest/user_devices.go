@@ -0,0 +1,126 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+// RunUserDeviceRepository checks the device ownership, the listing of every
+// user devices and the silence notification claims
+func RunUserDeviceRepository(t *testing.T, repository storage.UserDeviceRepository) {
+	ctx := context.Background()
+	userID, otherUserID := uuid.NewString(), uuid.NewString()
+	sensor1 := models.Device{
+		ID:             uuid.NewString(),
+		DeviceMetadata: models.DeviceMetadata{Name: "lettuce", Probes: []string{"ph", "ec"}},
+		CreatedAt:      time.Now().UTC().Truncate(time.Microsecond),
+	}
+	sensor2 := models.Device{ID: uuid.NewString()}
+
+	_, err := repository.GetDevicesFromUser(ctx, userID)
+	assert.ErrorIs(t, err, localErrs.NotFoundErr)
+
+	assert.Nil(t, repository.AddDeviceToUser(ctx, userID, sensor1))
+	devices, err := repository.GetDevicesFromUser(ctx, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Device{sensor1}, devices)
+
+	assert.Nil(t, repository.AddDeviceToUser(ctx, userID, sensor2))
+	devices, err = repository.GetDevicesFromUser(ctx, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Device{sensor1, sensor2}, devices)
+
+	owner, err := repository.GetDeviceOwner(ctx, sensor2.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, userID, owner)
+	_, err = repository.GetDeviceOwner(ctx, uuid.NewString())
+	assert.ErrorIs(t, err, localErrs.NotFoundErr)
+
+	// devices can't be claimed twice
+	assert.ErrorIs(t, repository.AddDeviceToUser(ctx, otherUserID, sensor1), localErrs.AlreadyExistsErr)
+	assert.ErrorIs(t, repository.AddDeviceToUser(ctx, userID, sensor2), localErrs.AlreadyExistsErr)
+	_, err = repository.GetDevicesFromUser(ctx, otherUserID)
+	assert.ErrorIs(t, err, localErrs.NotFoundErr)
+
+	t.Run("list user devices", func(t *testing.T) {
+		testListUserDevices(t, repository, storage.UserDevices{UserID: userID, Devices: []models.Device{sensor1, sensor2}})
+	})
+
+	// a silence is only claimed once until the device is silent again
+	lastSeen := time.Now().UTC().Add(-time.Hour).Truncate(time.Microsecond)
+	for _, expected := range []bool{true, false} {
+		claimed, err := repository.ClaimSilenceNotification(ctx, sensor1.ID, lastSeen)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, claimed)
+	}
+	claimed, err := repository.ClaimSilenceNotification(ctx, sensor1.ID, lastSeen.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.True(t, claimed)
+
+	name := "basil"
+	_, err = repository.UpdateDevice(ctx, otherUserID, sensor2.ID, models.DeviceUpdate{Name: &name})
+	assert.ErrorIs(t, err, localErrs.NotFoundErr)
+	updated, err := repository.UpdateDevice(ctx, userID, sensor2.ID, models.DeviceUpdate{Name: &name})
+	assert.Nil(t, err)
+	sensor2.Name = name
+	assert.Equal(t, sensor2, updated)
+
+	assert.ErrorIs(t, repository.RemoveDeviceFromUser(ctx, otherUserID, sensor1.ID), localErrs.NotFoundErr)
+	assert.ErrorIs(t, repository.SetDeviceTokenNonce(ctx, otherUserID, sensor1.ID, "nonce"), localErrs.NotFoundErr)
+	assert.Nil(t, repository.SetDeviceTokenNonce(ctx, userID, sensor1.ID, "nonce"))
+	owner, nonce, err := repository.GetDeviceTokenNonce(ctx, sensor1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, userID, owner)
+	assert.Equal(t, "nonce", nonce)
+
+	assert.Nil(t, repository.RemoveDeviceFromUser(ctx, userID, sensor1.ID))
+	devices, err = repository.GetDevicesFromUser(ctx, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Device{sensor2}, devices)
+	_, err = repository.GetDeviceOwner(ctx, sensor1.ID)
+	assert.ErrorIs(t, err, localErrs.NotFoundErr)
+
+	// removed devices can be claimed again
+	assert.Nil(t, repository.AddDeviceToUser(ctx, otherUserID, sensor1))
+	// without the nonce of the previous owner
+	owner, nonce, err = repository.GetDeviceTokenNonce(ctx, sensor1.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, otherUserID, owner)
+	assert.Empty(t, nonce)
+}
+
+// testListUserDevices pages through every user, other tests may have added
+// users to the store so only the given one is checked
+func testListUserDevices(t *testing.T, repository storage.UserDeviceRepository, expected storage.UserDevices) {
+	ctx := context.Background()
+	var found []storage.UserDevices
+	err := storage.EachUserDevices(ctx, repository, func(page []storage.UserDevices) error {
+		for _, userDevices := range page {
+			if userDevices.UserID == expected.UserID {
+				found = append(found, userDevices)
+			}
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []storage.UserDevices{expected}, found)
+
+	// pages are ordered by user and start after the given one
+	page, err := repository.ListUserDevices(ctx, "", 1)
+	assert.Nil(t, err)
+	if assert.Len(t, page, 1) {
+		next, err := repository.ListUserDevices(ctx, page[0].UserID, storage.UserDevicesPageSize)
+		assert.Nil(t, err)
+		for _, userDevices := range next {
+			assert.Greater(t, userDevices.UserID, page[0].UserID)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+)
+
+// RunWebhookRepository checks the webhooks, their failures and deliveries
+func RunWebhookRepository(t *testing.T, repository storage.WebhookRepository) {
+	ctx := context.Background()
+	webhook := models.Webhook{
+		ID:      uuid.NewString(),
+		UserID:  uuid.NewString(),
+		URL:     "https://example.com/hook",
+		Events:  []string{models.EventDeviceAdded},
+		Enabled: true,
+	}
+
+	assert.Nil(t, repository.CreateWebhook(ctx, webhook))
+	assert.ErrorIs(t, repository.CreateWebhook(ctx, webhook), localErrs.AlreadyExistsErr)
+
+	failures, err := repository.IncrementFailures(ctx, webhook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, failures)
+	assert.Nil(t, repository.DisableWebhook(ctx, webhook.ID))
+
+	webhooks, err := repository.GetWebhooksFromUser(ctx, webhook.UserID)
+	assert.Nil(t, err)
+	if assert.Len(t, webhooks, 1) {
+		assert.Equal(t, webhook.ID, webhooks[0].ID)
+		assert.Equal(t, webhook.Events, webhooks[0].Events)
+		assert.False(t, webhooks[0].Enabled)
+		assert.Equal(t, 1, webhooks[0].ConsecutiveFailures)
+	}
+	stored, err := repository.GetWebhook(ctx, webhook.ID)
+	assert.Nil(t, err)
+	assert.Equal(t, webhook.URL, stored.URL)
+	assert.False(t, stored.Enabled)
+
+	// deliveries are returned from the newest
+	now := time.Now().UTC()
+	first := models.WebhookDelivery{ID: uuid.NewString(), WebhookID: webhook.ID, Attempts: 1, Time: now.Add(-time.Minute)}
+	second := models.WebhookDelivery{ID: uuid.NewString(), WebhookID: webhook.ID, Attempts: 1, Success: true, Time: now}
+	assert.Nil(t, repository.AddDelivery(ctx, first))
+	assert.Nil(t, repository.AddDelivery(ctx, second))
+	deliveries, err := repository.GetDeliveries(ctx, webhook.ID)
+	assert.Nil(t, err)
+	if assert.Len(t, deliveries, 2) {
+		assert.Equal(t, second.ID, deliveries[0].ID)
+		assert.True(t, deliveries[0].Success)
+		assert.Equal(t, first.ID, deliveries[1].ID)
+	}
+
+	assert.Nil(t, repository.DeleteWebhook(ctx, webhook.ID))
+	_, err = repository.GetWebhook(ctx, webhook.ID)
+	assert.ErrorIs(t, err, localErrs.NotFoundErr)
+}
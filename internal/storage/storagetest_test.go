@@ -0,0 +1,56 @@
+package storage_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"github.com/InfluxCommunity/influxdb3-go/influx"
+
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/storage/storagetest"
+)
+
+// newFirestoreClient connects to the emulator started by TestMain
+func newFirestoreClient(t *testing.T) *firestore.Client {
+	client, err := firestore.NewClient(context.Background(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestAlertRepository(t *testing.T) {
+	storagetest.RunAlertRepository(t, storage.NewAlertRepository(newFirestoreClient(t)))
+}
+
+func TestRetentionRepository(t *testing.T) {
+	storagetest.RunRetentionRepository(t, storage.NewRetentionRepository(newFirestoreClient(t)))
+}
+
+func TestUserDeviceRepository(t *testing.T) {
+	storagetest.RunUserDeviceRepository(t, storage.NewUserDeviceRepository(newFirestoreClient(t)))
+}
+
+func TestWebhookRepository(t *testing.T) {
+	storagetest.RunWebhookRepository(t, storage.NewWebhookRepository(newFirestoreClient(t)))
+}
+
+// TestMetricRepository runs against the influx database in
+// INFLUXDB_TEST_DATABASE of INFLUXDB_TEST_HOST
+func TestMetricRepository(t *testing.T) {
+	hostURL, database := os.Getenv("INFLUXDB_TEST_HOST"), os.Getenv("INFLUXDB_TEST_DATABASE")
+	if len(hostURL) == 0 || len(database) == 0 {
+		t.Skip("INFLUXDB_TEST_HOST or INFLUXDB_TEST_DATABASE isn't set")
+	}
+
+	client, err := influx.New(influx.Configs{HostURL: hostURL, AuthToken: os.Getenv("INFLUXDB_TEST_TOKEN")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	storagetest.RunMetricRepository(t, storage.NewRepository(database, client))
+}
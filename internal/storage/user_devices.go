@@ -2,26 +2,93 @@ package storage
 
 import (
 	"context"
+	"errors"
+	"slices"
+	"time"
 
 	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
 
 	"cloud.google.com/go/firestore"
+	"github.com/rs/zerolog/log"
+	"google.golang.org/api/iterator"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 type UserDevices struct {
-	UserID  string   `firestore:"user_id"`
-	Devices []string `firestore:"devices,omitempty"`
+	UserID  string          `firestore:"user_id"`
+	Devices []models.Device `firestore:"devices,omitempty"`
+}
+
+// DeviceOwner indexes the user owning each device, so a device can't be
+// bound to more than one user
+type DeviceOwner struct {
+	DeviceID string `firestore:"device_id"`
+	UserID   string `firestore:"user_id"`
+	// TokenNonce is the nonce the device token is derived from, empty until
+	// a token is issued
+	TokenNonce string `firestore:"token_nonce,omitempty"`
 }
 
 // UserDeviceRepository contain functions for storing and retrieving user devices
 //
 //go:generate mockgen -destination user_devices_mock.go -package storage github.com/WendelHime/hydroponics-metrics-collector/internal/storage UserDeviceRepository
 type UserDeviceRepository interface {
-	GetDevicesFromUser(ctx context.Context, userID string) ([]string, error)
-	AddDeviceToUser(ctx context.Context, userID, newDevice string, currentDevices []string) error
-	CreateUserDevice(ctx context.Context, userID, newDevice string) error
+	GetDevicesFromUser(ctx context.Context, userID string) ([]models.Device, error)
+	// AddDeviceToUser appends the device to the ones bound to the user,
+	// failing with AlreadyExistsErr when the device already has an owner
+	AddDeviceToUser(ctx context.Context, userID string, newDevice models.Device) error
+	// UpdateDevice applies the update to a device bound to the user
+	UpdateDevice(ctx context.Context, userID, deviceID string, update models.DeviceUpdate) (models.Device, error)
+	// ListUserDevices returns up to limit users with their devices, ordered by
+	// user ID and starting after afterUserID, see EachUserDevices
+	ListUserDevices(ctx context.Context, afterUserID string, limit int) ([]UserDevices, error)
+	// GetDeviceOwner returns the ID of the user owning the device
+	GetDeviceOwner(ctx context.Context, deviceID string) (string, error)
+	// RemoveDeviceFromUser unbinds the device, releasing its ownership
+	RemoveDeviceFromUser(ctx context.Context, userID, deviceID string) error
+	// SetDeviceTokenNonce stores the nonce of the device token along with the
+	// ownership, failing with NotFoundErr when the device isn't bound to the user
+	SetDeviceTokenNonce(ctx context.Context, userID, deviceID, nonce string) error
+	// GetDeviceTokenNonce returns the owner of the device and its token nonce,
+	// which is empty when no token was issued since the device was claimed
+	GetDeviceTokenNonce(ctx context.Context, deviceID string) (string, string, error)
+	// ClaimSilenceNotification records that the device silence since lastSeen
+	// is notified, returning false when it already was so the instances
+	// sharing the storage notify it once
+	ClaimSilenceNotification(ctx context.Context, deviceID string, lastSeen time.Time) (bool, error)
+}
+
+// UserDevicesPageSize is the amount of users read at once by EachUserDevices
+const UserDevicesPageSize = 100
+
+// EachUserDevices calls handle with every user devices, read in pages of
+// UserDevicesPageSize users
+func EachUserDevices(ctx context.Context, repository UserDeviceRepository, handle func(page []UserDevices) error) error {
+	afterUserID := ""
+	for {
+		page, err := repository.ListUserDevices(ctx, afterUserID, UserDevicesPageSize)
+		if err != nil {
+			return err
+		}
+		if len(page) > 0 {
+			err = handle(page)
+			if err != nil {
+				return err
+			}
+		}
+		if len(page) < UserDevicesPageSize {
+			return nil
+		}
+		afterUserID = page[len(page)-1].UserID
+	}
+}
+
+// DeviceSilence is the last reading of a device whose silence was notified
+type DeviceSilence struct {
+	DeviceID string    `firestore:"device_id"`
+	LastSeen time.Time `firestore:"last_seen"`
 }
 
 type userDeviceRepository struct {
@@ -32,7 +99,7 @@ func NewUserDeviceRepository(client *firestore.Client) UserDeviceRepository {
 	return &userDeviceRepository{client: client}
 }
 
-func (u *userDeviceRepository) GetDevicesFromUser(ctx context.Context, userID string) ([]string, error) {
+func (u *userDeviceRepository) GetDevicesFromUser(ctx context.Context, userID string) ([]models.Device, error) {
 	doc, err := u.client.Collection("user_devices").Doc(userID).Get(ctx)
 	if err != nil {
 		if status.Code(err) == codes.NotFound {
@@ -41,8 +108,7 @@ func (u *userDeviceRepository) GetDevicesFromUser(ctx context.Context, userID st
 		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve user devices").WithErr(err)
 	}
 
-	var userDevices UserDevices
-	err = doc.DataTo(&userDevices)
+	userDevices, err := parseUserDevices(doc)
 	if err != nil {
 		return nil, localErrs.InternalServerErr.WithMsg("failed to parse user devices struct").WithErr(err)
 	}
@@ -50,24 +116,411 @@ func (u *userDeviceRepository) GetDevicesFromUser(ctx context.Context, userID st
 	return userDevices.Devices, nil
 }
 
-func (u *userDeviceRepository) AddDeviceToUser(ctx context.Context, userID string, newDevice string, currentDevices []string) error {
-	_, err := u.client.Collection("user_devices").Doc(userID).Update(ctx, []firestore.Update{
-		{Path: "devices", Value: append(currentDevices, newDevice)},
+// parseUserDevices reads both the documents storing device records and the
+// ones written before devices had metadata, which store the device IDs
+func parseUserDevices(doc *firestore.DocumentSnapshot) (UserDevices, error) {
+	if ids, ok := legacyDevices(doc.Data()); ok {
+		userDevices := UserDevices{UserID: doc.Ref.ID, Devices: make([]models.Device, len(ids))}
+		if userID, ok := doc.Data()["user_id"].(string); ok {
+			userDevices.UserID = userID
+		}
+		for i, id := range ids {
+			userDevices.Devices[i] = models.Device{ID: id, CreatedAt: doc.CreateTime.UTC()}
+		}
+		return userDevices, nil
+	}
+
+	var userDevices UserDevices
+	err := doc.DataTo(&userDevices)
+	return userDevices, err
+}
+
+// legacyOwner finds the user bound to the device by the documents written
+// before device owners were indexed, which store the device IDs
+func legacyOwner(iter *firestore.DocumentIterator) (string, bool, error) {
+	defer iter.Stop()
+	doc, err := iter.Next()
+	if err == iterator.Done {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return doc.Ref.ID, true, nil
+}
+
+// legacyOwnerQuery matches the documents storing the device ID
+func (u *userDeviceRepository) legacyOwnerQuery(deviceID string) firestore.Query {
+	return u.client.Collection("user_devices").Where("devices", "array-contains", deviceID).Limit(1)
+}
+
+// claimDevice registers the user as the device owner, failing with
+// AlreadyExistsErr when the device already has an owner
+func (u *userDeviceRepository) claimDevice(tx *firestore.Transaction, userID string, device string) error {
+	ref := u.client.Collection("devices").Doc(device)
+	alreadyOwned := localErrs.AlreadyExistsErr.WithMsg("device already has an owner").WithDetails("device", device)
+	_, err := tx.Get(ref)
+	if err == nil {
+		return alreadyOwned
+	}
+	if status.Code(err) != codes.NotFound {
+		return err
+	}
+	_, found, err := legacyOwner(tx.Documents(u.legacyOwnerQuery(device)))
+	if err != nil {
+		return err
+	}
+	if found {
+		return alreadyOwned
+	}
+
+	return tx.Create(ref, DeviceOwner{DeviceID: device, UserID: userID})
+}
+
+// transactionErr keeps the errors returned by the repository as is
+func transactionErr(err error, msg string) error {
+	var localErr *localErrs.Error
+	if errors.As(err, &localErr) {
+		return err
+	}
+	return localErrs.InternalServerErr.WithMsg(msg).WithErr(err)
+}
+
+// AddDeviceToUser reads the user devices inside the transaction, so devices
+// bound concurrently aren't lost, and creates them for the first device
+func (u *userDeviceRepository) AddDeviceToUser(ctx context.Context, userID string, newDevice models.Device) error {
+	err := u.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref := u.client.Collection("user_devices").Doc(userID)
+		userDevices := UserDevices{UserID: userID}
+		doc, err := tx.Get(ref)
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			return err
+		default:
+			userDevices, err = parseUserDevices(doc)
+			if err != nil {
+				return err
+			}
+		}
+
+		// every read must happen before the owner is created
+		err = u.claimDevice(tx, userID, newDevice.ID)
+		if err != nil {
+			return err
+		}
+
+		userDevices.Devices = append(userDevices.Devices, newDevice)
+		return tx.Set(ref, userDevices)
 	})
+	if err != nil {
+		return transactionErr(err, "failed to add user device")
+	}
+
+	return nil
+}
+
+func (u *userDeviceRepository) GetDeviceOwner(ctx context.Context, deviceID string) (string, error) {
+	owner, err := u.deviceOwner(ctx, deviceID)
+	return owner.UserID, err
+}
+
+// deviceOwner reads the ownership of the device, falling back to the user
+// devices written before devices had owner documents
+func (u *userDeviceRepository) deviceOwner(ctx context.Context, deviceID string) (DeviceOwner, error) {
+	doc, err := u.client.Collection("devices").Doc(deviceID).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		owner, found, legacyErr := legacyOwner(u.legacyOwnerQuery(deviceID).Documents(ctx))
+		if legacyErr != nil {
+			return DeviceOwner{}, localErrs.InternalServerErr.WithMsg("failed to retrieve device owner").WithErr(legacyErr)
+		}
+		if !found {
+			return DeviceOwner{}, localErrs.NotFoundErr.WithMsg("device without owner").WithErr(err)
+		}
+		return DeviceOwner{DeviceID: deviceID, UserID: owner}, nil
+	}
+	if err != nil {
+		return DeviceOwner{}, localErrs.InternalServerErr.WithMsg("failed to retrieve device owner").WithErr(err)
+	}
 
+	var owner DeviceOwner
+	err = doc.DataTo(&owner)
 	if err != nil {
-		return localErrs.InternalServerErr.WithMsg("failed to add user device").WithErr(err)
+		return DeviceOwner{}, localErrs.InternalServerErr.WithMsg("failed to parse device owner struct").WithErr(err)
+	}
+
+	return owner, nil
+}
+
+func (u *userDeviceRepository) GetDeviceTokenNonce(ctx context.Context, deviceID string) (string, string, error) {
+	owner, err := u.deviceOwner(ctx, deviceID)
+	return owner.UserID, owner.TokenNonce, err
+}
+
+// SetDeviceTokenNonce also creates the owner document of the devices bound
+// before they existed
+func (u *userDeviceRepository) SetDeviceTokenNonce(ctx context.Context, userID string, deviceID string, nonce string) error {
+	err := u.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		_, _, err := u.ownedDevice(tx, userID, deviceID)
+		if err != nil {
+			return err
+		}
+
+		owner := DeviceOwner{DeviceID: deviceID, UserID: userID, TokenNonce: nonce}
+		return tx.Set(u.client.Collection("devices").Doc(deviceID), owner)
+	})
+	if err != nil {
+		return transactionErr(err, "failed to store device token nonce")
 	}
 
 	return nil
 }
 
-func (u *userDeviceRepository) CreateUserDevice(ctx context.Context, userID string, newDevice string) error {
-	userDevice := UserDevices{UserID: userID, Devices: []string{newDevice}}
-	_, err := u.client.Collection("user_devices").Doc(userID).Set(ctx, userDevice)
+// ownedDevice reads the user devices and the position of the device among
+// them, failing with NotFoundErr when the device isn't bound to the user
+func (u *userDeviceRepository) ownedDevice(tx *firestore.Transaction, userID string, deviceID string) (UserDevices, int, error) {
+	notBound := localErrs.NotFoundErr.WithMsg("device not bound to the user").WithDetails("device", deviceID)
+	var owner DeviceOwner
+	doc, err := tx.Get(u.client.Collection("devices").Doc(deviceID))
+	switch {
+	case status.Code(err) == codes.NotFound:
+		owner.UserID, _, err = legacyOwner(tx.Documents(u.legacyOwnerQuery(deviceID)))
+		if err != nil {
+			return UserDevices{}, 0, err
+		}
+	case err != nil:
+		return UserDevices{}, 0, err
+	default:
+		err = doc.DataTo(&owner)
+		if err != nil {
+			return UserDevices{}, 0, err
+		}
+	}
+	if owner.UserID != userID {
+		return UserDevices{}, 0, notBound
+	}
+
+	doc, err = tx.Get(u.client.Collection("user_devices").Doc(userID))
+	if err != nil {
+		return UserDevices{}, 0, err
+	}
+
+	userDevices, err := parseUserDevices(doc)
+	if err != nil {
+		return UserDevices{}, 0, err
+	}
+	index := slices.IndexFunc(userDevices.Devices, func(device models.Device) bool {
+		return device.ID == deviceID
+	})
+	if index < 0 {
+		return UserDevices{}, 0, notBound
+	}
+	return userDevices, index, nil
+}
+
+func (u *userDeviceRepository) UpdateDevice(ctx context.Context, userID string, deviceID string, update models.DeviceUpdate) (models.Device, error) {
+	var device models.Device
+	err := u.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		userDevices, index, err := u.ownedDevice(tx, userID, deviceID)
+		if err != nil {
+			return err
+		}
+
+		device = update.Apply(userDevices.Devices[index])
+		userDevices.Devices[index] = device
+		return tx.Update(u.client.Collection("user_devices").Doc(userID), []firestore.Update{
+			{Path: "devices", Value: userDevices.Devices},
+		})
+	})
+	if err != nil {
+		return models.Device{}, transactionErr(err, "failed to update user device")
+	}
+
+	return device, nil
+}
+
+func (u *userDeviceRepository) RemoveDeviceFromUser(ctx context.Context, userID string, deviceID string) error {
+	err := u.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		userDevices, index, err := u.ownedDevice(tx, userID, deviceID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Delete(u.client.Collection("devices").Doc(deviceID))
+		if err != nil {
+			return err
+		}
+		return tx.Update(u.client.Collection("user_devices").Doc(userID), []firestore.Update{
+			{Path: "devices", Value: slices.Delete(userDevices.Devices, index, index+1)},
+		})
+	})
 	if err != nil {
-		return localErrs.InternalServerErr.WithMsg("failed to create user device").WithErr(err)
+		return transactionErr(err, "failed to remove user device")
+	}
+
+	return nil
+}
+
+// legacyDevices returns the device IDs of the documents written before
+// devices had metadata, when devices were stored as a list of IDs
+func legacyDevices(data map[string]any) ([]string, bool) {
+	entries, ok := data["devices"].([]any)
+	if !ok || len(entries) == 0 {
+		return nil, false
+	}
+
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		id, ok := entry.(string)
+		if !ok {
+			return nil, false
+		}
+		ids[i] = id
+	}
+	return ids, true
+}
+
+// MigrateUserDevices converts the device IDs stored by older versions to
+// device records, created when their document was created. The repository
+// reads both shapes, so it's run once by the migrate command instead of when
+// the service starts
+func MigrateUserDevices(ctx context.Context, client *firestore.Client) error {
+	iter := client.Collection("user_devices").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return localErrs.InternalServerErr.WithMsg("failed to list user devices").WithErr(err)
+		}
+		if _, ok := legacyDevices(doc.Data()); !ok {
+			continue
+		}
+
+		err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+			doc, err := tx.Get(doc.Ref)
+			if err != nil {
+				return err
+			}
+			ids, ok := legacyDevices(doc.Data())
+			if !ok {
+				return nil
+			}
+
+			devices := make([]models.Device, len(ids))
+			for i, id := range ids {
+				devices[i] = models.Device{ID: id, CreatedAt: doc.CreateTime.UTC()}
+			}
+			return tx.Update(doc.Ref, []firestore.Update{{Path: "devices", Value: devices}})
+		})
+		if err != nil {
+			return localErrs.InternalServerErr.WithMsg("failed to migrate user devices").WithErr(err).WithDetails("userID", doc.Ref.ID)
+		}
 	}
 
 	return nil
 }
+
+// MigrateDeviceOwners indexes the owner of the devices bound before the
+// devices collection existed, a device bound to many users keeps the owner
+// found first. Until then the owners are looked up in the user devices
+func MigrateDeviceOwners(ctx context.Context, client *firestore.Client) error {
+	owners := make(map[string]string)
+	iter := client.Collection("devices").Documents(ctx)
+	defer iter.Stop()
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return localErrs.InternalServerErr.WithMsg("failed to list device owners").WithErr(err)
+		}
+
+		var owner DeviceOwner
+		err = doc.DataTo(&owner)
+		if err != nil {
+			return localErrs.InternalServerErr.WithMsg("failed to parse device owner struct").WithErr(err)
+		}
+		owners[owner.DeviceID] = owner.UserID
+	}
+
+	return EachUserDevices(ctx, NewUserDeviceRepository(client), func(userDevices []UserDevices) error {
+		for _, userDevice := range userDevices {
+			for _, device := range models.DeviceIDs(userDevice.Devices) {
+				if owner, ok := owners[device]; ok {
+					if owner != userDevice.UserID {
+						log.Warn().Str("device", device).Str("owner", owner).Str("userID", userDevice.UserID).Msg("device is bound to more than one user")
+					}
+					continue
+				}
+
+				_, err := client.Collection("devices").Doc(device).Create(ctx, DeviceOwner{DeviceID: device, UserID: userDevice.UserID})
+				if err != nil && status.Code(err) != codes.AlreadyExists {
+					return localErrs.InternalServerErr.WithMsg("failed to index device owner").WithErr(err)
+				}
+				owners[device] = userDevice.UserID
+			}
+		}
+		return nil
+	})
+}
+
+func (u *userDeviceRepository) ListUserDevices(ctx context.Context, afterUserID string, limit int) ([]UserDevices, error) {
+	query := u.client.Collection("user_devices").OrderBy(firestore.DocumentID, firestore.Asc).Limit(limit)
+	if len(afterUserID) > 0 {
+		query = query.StartAfter(afterUserID)
+	}
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	userDevices := make([]UserDevices, 0)
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to list user devices").WithErr(err)
+		}
+
+		userDevice, err := parseUserDevices(doc)
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to parse user devices struct").WithErr(err)
+		}
+		userDevices = append(userDevices, userDevice)
+	}
+
+	return userDevices, nil
+}
+
+func (u *userDeviceRepository) ClaimSilenceNotification(ctx context.Context, deviceID string, lastSeen time.Time) (bool, error) {
+	claimed := false
+	err := u.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		ref := u.client.Collection("device_silences").Doc(deviceID)
+		doc, err := tx.Get(ref)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		if err == nil {
+			var silence DeviceSilence
+			err = doc.DataTo(&silence)
+			if err != nil {
+				return localErrs.InternalServerErr.WithMsg("failed to parse device silence struct").WithErr(err)
+			}
+			if silence.LastSeen.Equal(lastSeen) {
+				claimed = false
+				return nil
+			}
+		}
+
+		claimed = true
+		return tx.Set(ref, DeviceSilence{DeviceID: deviceID, LastSeen: lastSeen})
+	})
+	if err != nil {
+		return false, transactionErr(err, "failed to claim device silence notification")
+	}
+	return claimed, nil
+}
@@ -7,7 +7,9 @@ package storage
 import (
 	context "context"
 	reflect "reflect"
+	time "time"
 
+	models "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
 	gomock "go.uber.org/mock/gomock"
 )
 
@@ -35,38 +37,70 @@ func (m *MockUserDeviceRepository) EXPECT() *MockUserDeviceRepositoryMockRecorde
 }
 
 // AddDeviceToUser mocks base method.
-func (m *MockUserDeviceRepository) AddDeviceToUser(arg0 context.Context, arg1, arg2 string, arg3 []string) error {
+func (m *MockUserDeviceRepository) AddDeviceToUser(arg0 context.Context, arg1 string, arg2 models.Device) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "AddDeviceToUser", arg0, arg1, arg2, arg3)
+	ret := m.ctrl.Call(m, "AddDeviceToUser", arg0, arg1, arg2)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // AddDeviceToUser indicates an expected call of AddDeviceToUser.
-func (mr *MockUserDeviceRepositoryMockRecorder) AddDeviceToUser(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+func (mr *MockUserDeviceRepositoryMockRecorder) AddDeviceToUser(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddDeviceToUser", reflect.TypeOf((*MockUserDeviceRepository)(nil).AddDeviceToUser), arg0, arg1, arg2, arg3)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AddDeviceToUser", reflect.TypeOf((*MockUserDeviceRepository)(nil).AddDeviceToUser), arg0, arg1, arg2)
 }
 
-// CreateUserDevice mocks base method.
-func (m *MockUserDeviceRepository) CreateUserDevice(arg0 context.Context, arg1, arg2 string) error {
+// ClaimSilenceNotification mocks base method.
+func (m *MockUserDeviceRepository) ClaimSilenceNotification(arg0 context.Context, arg1 string, arg2 time.Time) (bool, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateUserDevice", arg0, arg1, arg2)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "ClaimSilenceNotification", arg0, arg1, arg2)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
-// CreateUserDevice indicates an expected call of CreateUserDevice.
-func (mr *MockUserDeviceRepositoryMockRecorder) CreateUserDevice(arg0, arg1, arg2 interface{}) *gomock.Call {
+// ClaimSilenceNotification indicates an expected call of ClaimSilenceNotification.
+func (mr *MockUserDeviceRepositoryMockRecorder) ClaimSilenceNotification(arg0, arg1, arg2 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateUserDevice", reflect.TypeOf((*MockUserDeviceRepository)(nil).CreateUserDevice), arg0, arg1, arg2)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ClaimSilenceNotification", reflect.TypeOf((*MockUserDeviceRepository)(nil).ClaimSilenceNotification), arg0, arg1, arg2)
+}
+
+// GetDeviceOwner mocks base method.
+func (m *MockUserDeviceRepository) GetDeviceOwner(arg0 context.Context, arg1 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeviceOwner", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeviceOwner indicates an expected call of GetDeviceOwner.
+func (mr *MockUserDeviceRepositoryMockRecorder) GetDeviceOwner(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeviceOwner", reflect.TypeOf((*MockUserDeviceRepository)(nil).GetDeviceOwner), arg0, arg1)
+}
+
+// GetDeviceTokenNonce mocks base method.
+func (m *MockUserDeviceRepository) GetDeviceTokenNonce(arg0 context.Context, arg1 string) (string, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeviceTokenNonce", arg0, arg1)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// GetDeviceTokenNonce indicates an expected call of GetDeviceTokenNonce.
+func (mr *MockUserDeviceRepositoryMockRecorder) GetDeviceTokenNonce(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeviceTokenNonce", reflect.TypeOf((*MockUserDeviceRepository)(nil).GetDeviceTokenNonce), arg0, arg1)
 }
 
 // GetDevicesFromUser mocks base method.
-func (m *MockUserDeviceRepository) GetDevicesFromUser(arg0 context.Context, arg1 string) ([]string, error) {
+func (m *MockUserDeviceRepository) GetDevicesFromUser(arg0 context.Context, arg1 string) ([]models.Device, error) {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "GetDevicesFromUser", arg0, arg1)
-	ret0, _ := ret[0].([]string)
+	ret0, _ := ret[0].([]models.Device)
 	ret1, _ := ret[1].(error)
 	return ret0, ret1
 }
@@ -76,3 +110,61 @@ func (mr *MockUserDeviceRepositoryMockRecorder) GetDevicesFromUser(arg0, arg1 in
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDevicesFromUser", reflect.TypeOf((*MockUserDeviceRepository)(nil).GetDevicesFromUser), arg0, arg1)
 }
+
+// ListUserDevices mocks base method.
+func (m *MockUserDeviceRepository) ListUserDevices(arg0 context.Context, arg1 string, arg2 int) ([]UserDevices, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListUserDevices", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]UserDevices)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListUserDevices indicates an expected call of ListUserDevices.
+func (mr *MockUserDeviceRepositoryMockRecorder) ListUserDevices(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListUserDevices", reflect.TypeOf((*MockUserDeviceRepository)(nil).ListUserDevices), arg0, arg1, arg2)
+}
+
+// RemoveDeviceFromUser mocks base method.
+func (m *MockUserDeviceRepository) RemoveDeviceFromUser(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RemoveDeviceFromUser", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// RemoveDeviceFromUser indicates an expected call of RemoveDeviceFromUser.
+func (mr *MockUserDeviceRepositoryMockRecorder) RemoveDeviceFromUser(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RemoveDeviceFromUser", reflect.TypeOf((*MockUserDeviceRepository)(nil).RemoveDeviceFromUser), arg0, arg1, arg2)
+}
+
+// SetDeviceTokenNonce mocks base method.
+func (m *MockUserDeviceRepository) SetDeviceTokenNonce(arg0 context.Context, arg1, arg2, arg3 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SetDeviceTokenNonce", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// SetDeviceTokenNonce indicates an expected call of SetDeviceTokenNonce.
+func (mr *MockUserDeviceRepositoryMockRecorder) SetDeviceTokenNonce(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SetDeviceTokenNonce", reflect.TypeOf((*MockUserDeviceRepository)(nil).SetDeviceTokenNonce), arg0, arg1, arg2, arg3)
+}
+
+// UpdateDevice mocks base method.
+func (m *MockUserDeviceRepository) UpdateDevice(arg0 context.Context, arg1, arg2 string, arg3 models.DeviceUpdate) (models.Device, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateDevice", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(models.Device)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateDevice indicates an expected call of UpdateDevice.
+func (mr *MockUserDeviceRepositoryMockRecorder) UpdateDevice(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateDevice", reflect.TypeOf((*MockUserDeviceRepository)(nil).UpdateDevice), arg0, arg1, arg2, arg3)
+}
@@ -2,10 +2,14 @@ package storage
 
 import (
 	"context"
+	"fmt"
 	"testing"
+	"time"
 
 	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
 	"github.com/google/uuid"
+	gomock "go.uber.org/mock/gomock"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -17,13 +21,13 @@ func TestGetDevicesFromUser(t *testing.T) {
 
 	var tests = []struct {
 		name        string
-		assert      func(t *testing.T, devices []string, err error)
+		assert      func(t *testing.T, devices []models.Device, err error)
 		setup       func() UserDeviceRepository
 		givenUserID string
 	}{
 		{
 			name: "should return not found when user doesn't have a sensor",
-			assert: func(t *testing.T, devices []string, err error) {
+			assert: func(t *testing.T, devices []models.Device, err error) {
 				assert.Empty(t, devices)
 				if assert.Error(t, err) {
 					assert.ErrorIs(t, err, localErrs.NotFoundErr)
@@ -36,12 +40,12 @@ func TestGetDevicesFromUser(t *testing.T) {
 		},
 		{
 			name: "retrieve user devices with success",
-			assert: func(t *testing.T, devices []string, err error) {
+			assert: func(t *testing.T, devices []models.Device, err error) {
 				assert.Nil(t, err)
-				assert.Contains(t, devices, "sensorID")
+				assert.Contains(t, devices, models.Device{ID: "sensorID"})
 			},
 			setup: func() UserDeviceRepository {
-				cli.Collection("user_devices").Doc("userID").Set(ctx, UserDevices{UserID: "userID", Devices: []string{"sensorID"}})
+				cli.Collection("user_devices").Doc("userID").Set(ctx, UserDevices{UserID: "userID", Devices: []models.Device{{ID: "sensorID"}}})
 				return NewUserDeviceRepository(cli)
 			},
 			givenUserID: "userID",
@@ -65,10 +69,10 @@ func TestAddUserDevice(t *testing.T) {
 	var tests = []struct {
 		name                string
 		assert              func(t *testing.T, givenUserID string, err error)
-		setup               func(givenUserID string, givenCurrentDevices []string) UserDeviceRepository
+		setup               func(givenUserID string, givenCurrentDevices []models.Device) UserDeviceRepository
 		givenUserID         string
-		givenNewDevice      string
-		givenCurrentDevices []string
+		givenNewDevice      models.Device
+		givenCurrentDevices []models.Device
 	}{
 		{
 			name: "Add user device with success",
@@ -81,83 +85,220 @@ func TestAddUserDevice(t *testing.T) {
 				assert.Nil(t, err)
 
 				assert.Len(t, userDevices.Devices, 2)
-				assert.Contains(t, userDevices.Devices, "new_device")
+				assert.Contains(t, userDevices.Devices, models.Device{ID: "old_device"})
+				assert.Contains(t, userDevices.Devices, models.Device{ID: "new_device"})
 			},
-			setup: func(givenUserID string, givenCurrentDevices []string) UserDeviceRepository {
+			setup: func(givenUserID string, givenCurrentDevices []models.Device) UserDeviceRepository {
 				cli.Collection("user_devices").Doc(givenUserID).Set(ctx, UserDevices{
 					UserID:  givenUserID,
 					Devices: givenCurrentDevices,
 				})
 				return NewUserDeviceRepository(cli)
 			},
-			givenUserID:         "userID1",
-			givenNewDevice:      "new_device",
-			givenCurrentDevices: []string{"old_device"},
+			givenUserID:         uuid.NewString(),
+			givenNewDevice:      models.Device{ID: "new_device"},
+			givenCurrentDevices: []models.Device{{ID: "old_device"}},
 		},
 		{
-			name: "Add user device to unexistent account should succeed",
-			assert: func(t *testing.T, _ string, err error) {
-				if assert.Error(t, err) {
-					assert.ErrorIs(t, err, localErrs.InternalServerErr)
-				}
+			name: "Add the first user device with success",
+			assert: func(t *testing.T, givenUserID string, err error) {
+				assert.Nil(t, err)
+				doc, err := cli.Collection("user_devices").Doc(givenUserID).Get(ctx)
+				assert.Nil(t, err)
+				var userDevices UserDevices
+				err = doc.DataTo(&userDevices)
+				assert.Nil(t, err)
+
+				assert.Equal(t, givenUserID, userDevices.UserID)
+				assert.Len(t, userDevices.Devices, 1)
 			},
-			setup: func(_ string, _ []string) UserDeviceRepository {
+			setup: func(_ string, _ []models.Device) UserDeviceRepository {
 				return NewUserDeviceRepository(cli)
 			},
-			givenUserID:         "userID2",
-			givenNewDevice:      "new_device",
-			givenCurrentDevices: make([]string, 0),
+			givenUserID:    uuid.NewString(),
+			givenNewDevice: models.Device{ID: uuid.NewString(), DeviceMetadata: models.DeviceMetadata{Name: "lettuce", Probes: []string{"ph"}}},
 		},
 	}
 	for _, tt := range tests {
 		tt := tt
 		t.Run(tt.name, func(t *testing.T) {
 			repo := tt.setup(tt.givenUserID, tt.givenCurrentDevices)
-			err := repo.AddDeviceToUser(ctx, tt.givenUserID, tt.givenNewDevice, tt.givenCurrentDevices)
+			err := repo.AddDeviceToUser(ctx, tt.givenUserID, tt.givenNewDevice)
 			tt.assert(t, tt.givenUserID, err)
 		})
 	}
 }
 
-func TestCreateUserDevice(t *testing.T) {
+func TestListUserDevices(t *testing.T) {
 	ctx := context.Background()
 	cli := newFirestoreTestClient(ctx)
 	defer cli.Close()
 
-	var tests = []struct {
-		name           string
-		assert         func(t *testing.T, givenUserID string, givenNewDevice string, err error)
-		setup          func() UserDeviceRepository
-		givenUserID    string
-		givenNewDevice string
-	}{
-		{
-			name: "create user device with success",
-			assert: func(t *testing.T, givenUserID string, givenNewDevice string, err error) {
-				assert.Nil(t, err)
+	userID := uuid.NewString()
+	_, err := cli.Collection("user_devices").Doc(userID).Set(ctx, UserDevices{UserID: userID, Devices: []models.Device{{ID: "sensorID"}}})
+	assert.Nil(t, err)
 
-				doc, err := cli.Collection("user_devices").Doc(givenUserID).Get(ctx)
-				assert.Nil(t, err)
-				var userDevices UserDevices
-				err = doc.DataTo(&userDevices)
-				assert.Nil(t, err)
+	var userDevices []UserDevices
+	err = EachUserDevices(ctx, NewUserDeviceRepository(cli), func(page []UserDevices) error {
+		userDevices = append(userDevices, page...)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Contains(t, userDevices, UserDevices{UserID: userID, Devices: []models.Device{{ID: "sensorID"}}})
+}
 
-				assert.Len(t, userDevices.Devices, 1)
-				assert.Contains(t, userDevices.Devices, givenNewDevice)
-			},
-			setup: func() UserDeviceRepository {
-				return NewUserDeviceRepository(cli)
-			},
-			givenUserID:    uuid.NewString(),
-			givenNewDevice: uuid.NewString(),
-		},
+func TestEachUserDevices(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	full := make([]UserDevices, UserDevicesPageSize)
+	for i := range full {
+		full[i] = UserDevices{UserID: fmt.Sprintf("user%03d", i)}
 	}
-	for _, tt := range tests {
-		tt := tt
-		t.Run(tt.name, func(t *testing.T) {
-			repo := tt.setup()
-			err := repo.CreateUserDevice(ctx, tt.givenUserID, tt.givenNewDevice)
-			tt.assert(t, tt.givenUserID, tt.givenNewDevice, err)
-		})
+	last := []UserDevices{{UserID: "user999"}}
+	repository := NewMockUserDeviceRepository(ctrl)
+	gomock.InOrder(
+		repository.EXPECT().ListUserDevices(gomock.Any(), "", UserDevicesPageSize).Return(full, nil),
+		repository.EXPECT().ListUserDevices(gomock.Any(), full[len(full)-1].UserID, UserDevicesPageSize).Return(last, nil),
+	)
+
+	pages := 0
+	err := EachUserDevices(context.Background(), repository, func(page []UserDevices) error {
+		pages++
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, pages)
+}
+
+func TestClaimSilenceNotification(t *testing.T) {
+	ctx := context.Background()
+	cli := newFirestoreTestClient(ctx)
+	defer cli.Close()
+
+	repository := NewUserDeviceRepository(cli)
+	deviceID := uuid.NewString()
+	lastSeen := time.Now().UTC().Truncate(time.Microsecond)
+	for _, expected := range []bool{true, false} {
+		claimed, err := repository.ClaimSilenceNotification(ctx, deviceID, lastSeen)
+		assert.Nil(t, err)
+		assert.Equal(t, expected, claimed)
 	}
+	claimed, err := repository.ClaimSilenceNotification(ctx, deviceID, lastSeen.Add(time.Minute))
+	assert.Nil(t, err)
+	assert.True(t, claimed)
+}
+
+func TestDeviceOwner(t *testing.T) {
+	ctx := context.Background()
+	cli := newFirestoreTestClient(ctx)
+	defer cli.Close()
+
+	userID := uuid.NewString()
+	deviceID := uuid.NewString()
+	repository := NewUserDeviceRepository(cli)
+	assert.Nil(t, repository.AddDeviceToUser(ctx, userID, models.Device{ID: deviceID}))
+
+	owner, err := repository.GetDeviceOwner(ctx, deviceID)
+	assert.Nil(t, err)
+	assert.Equal(t, userID, owner)
+
+	err = repository.AddDeviceToUser(ctx, uuid.NewString(), models.Device{ID: deviceID})
+	if assert.Error(t, err) {
+		assert.ErrorIs(t, err, localErrs.AlreadyExistsErr)
+	}
+
+	_, err = repository.GetDeviceOwner(ctx, uuid.NewString())
+	if assert.Error(t, err) {
+		assert.ErrorIs(t, err, localErrs.NotFoundErr)
+	}
+}
+
+func TestMigrateDeviceOwners(t *testing.T) {
+	ctx := context.Background()
+	cli := newFirestoreTestClient(ctx)
+	defer cli.Close()
+
+	userID := uuid.NewString()
+	deviceID := uuid.NewString()
+	_, err := cli.Collection("user_devices").Doc(userID).Set(ctx, UserDevices{UserID: userID, Devices: []models.Device{{ID: deviceID}}})
+	assert.Nil(t, err)
+
+	assert.Nil(t, MigrateDeviceOwners(ctx, cli))
+	owner, err := NewUserDeviceRepository(cli).GetDeviceOwner(ctx, deviceID)
+	assert.Nil(t, err)
+	assert.Equal(t, userID, owner)
+}
+
+func TestUpdateDevice(t *testing.T) {
+	ctx := context.Background()
+	cli := newFirestoreTestClient(ctx)
+	defer cli.Close()
+
+	userID := uuid.NewString()
+	deviceID := uuid.NewString()
+	repository := NewUserDeviceRepository(cli)
+	assert.Nil(t, repository.AddDeviceToUser(ctx, userID, models.Device{ID: deviceID, DeviceMetadata: models.DeviceMetadata{Location: "greenhouse"}}))
+
+	name := "lettuce"
+	device, err := repository.UpdateDevice(ctx, userID, deviceID, models.DeviceUpdate{Name: &name})
+	assert.Nil(t, err)
+	assert.Equal(t, models.DeviceMetadata{Name: "lettuce", Location: "greenhouse"}, device.DeviceMetadata)
+
+	devices, err := repository.GetDevicesFromUser(ctx, userID)
+	assert.Nil(t, err)
+	assert.Equal(t, []models.Device{device}, devices)
+
+	_, err = repository.UpdateDevice(ctx, uuid.NewString(), deviceID, models.DeviceUpdate{Name: &name})
+	if assert.Error(t, err) {
+		assert.ErrorIs(t, err, localErrs.NotFoundErr)
+	}
+}
+
+func TestMigrateUserDevices(t *testing.T) {
+	ctx := context.Background()
+	cli := newFirestoreTestClient(ctx)
+	defer cli.Close()
+
+	userID := uuid.NewString()
+	deviceID := uuid.NewString()
+	_, err := cli.Collection("user_devices").Doc(userID).Set(ctx, map[string]any{"user_id": userID, "devices": []string{deviceID}})
+	assert.Nil(t, err)
+
+	assert.Nil(t, MigrateUserDevices(ctx, cli))
+	devices, err := NewUserDeviceRepository(cli).GetDevicesFromUser(ctx, userID)
+	assert.Nil(t, err)
+	if assert.Len(t, devices, 1) {
+		assert.Equal(t, deviceID, devices[0].ID)
+		assert.False(t, devices[0].CreatedAt.IsZero())
+	}
+}
+
+func TestLegacyUserDevices(t *testing.T) {
+	ctx := context.Background()
+	cli := newFirestoreTestClient(ctx)
+	defer cli.Close()
+
+	// documents written before the migration are read as is
+	userID := uuid.NewString()
+	deviceID := uuid.NewString()
+	_, err := cli.Collection("user_devices").Doc(userID).Set(ctx, map[string]any{"user_id": userID, "devices": []string{deviceID}})
+	assert.Nil(t, err)
+
+	repository := NewUserDeviceRepository(cli)
+	devices, err := repository.GetDevicesFromUser(ctx, userID)
+	assert.Nil(t, err)
+	if assert.Len(t, devices, 1) {
+		assert.Equal(t, deviceID, devices[0].ID)
+	}
+	owner, err := repository.GetDeviceOwner(ctx, deviceID)
+	assert.Nil(t, err)
+	assert.Equal(t, userID, owner)
+
+	err = repository.AddDeviceToUser(ctx, uuid.NewString(), models.Device{ID: deviceID})
+	assert.ErrorIs(t, err, localErrs.AlreadyExistsErr)
+
+	assert.Nil(t, repository.RemoveDeviceFromUser(ctx, userID, deviceID))
+	_, err = repository.GetDeviceOwner(ctx, deviceID)
+	assert.ErrorIs(t, err, localErrs.NotFoundErr)
 }
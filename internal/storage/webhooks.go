@@ -0,0 +1,174 @@
+package storage
+
+import (
+	"context"
+
+	localErrs "github.com/WendelHime/hydroponics-metrics-collector/internal/shared/errors"
+	"github.com/WendelHime/hydroponics-metrics-collector/internal/shared/models"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// MaxWebhookDeliveries caps the amount of deliveries returned by a single query
+const MaxWebhookDeliveries = 100
+
+// WebhookRepository contain functions for storing webhooks and their delivery log
+//
+//go:generate mockgen -destination webhooks_mock.go -package storage github.com/WendelHime/hydroponics-metrics-collector/internal/storage WebhookRepository
+type WebhookRepository interface {
+	CreateWebhook(ctx context.Context, webhook models.Webhook) error
+	GetWebhook(ctx context.Context, webhookID string) (models.Webhook, error)
+	GetWebhooksFromUser(ctx context.Context, userID string) ([]models.Webhook, error)
+	DeleteWebhook(ctx context.Context, webhookID string) error
+	IncrementFailures(ctx context.Context, webhookID string) (int, error)
+	ResetFailures(ctx context.Context, webhookID string) error
+	DisableWebhook(ctx context.Context, webhookID string) error
+	AddDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+	GetDeliveries(ctx context.Context, webhookID string) ([]models.WebhookDelivery, error)
+}
+
+type webhookRepository struct {
+	client *firestore.Client
+}
+
+func NewWebhookRepository(client *firestore.Client) WebhookRepository {
+	return &webhookRepository{client: client}
+}
+
+func (w *webhookRepository) CreateWebhook(ctx context.Context, webhook models.Webhook) error {
+	_, err := w.client.Collection("webhooks").Doc(webhook.ID).Create(ctx, webhook)
+	if err != nil {
+		if status.Code(err) == codes.AlreadyExists {
+			return localErrs.AlreadyExistsErr.WithMsg("webhook already exists").WithErr(err)
+		}
+		return localErrs.InternalServerErr.WithMsg("failed to create webhook").WithErr(err)
+	}
+
+	return nil
+}
+
+func (w *webhookRepository) GetWebhook(ctx context.Context, webhookID string) (models.Webhook, error) {
+	doc, err := w.client.Collection("webhooks").Doc(webhookID).Get(ctx)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return models.Webhook{}, localErrs.NotFoundErr.WithMsg("webhook not found").WithErr(err)
+		}
+		return models.Webhook{}, localErrs.InternalServerErr.WithMsg("failed to retrieve webhook").WithErr(err)
+	}
+
+	var webhook models.Webhook
+	err = doc.DataTo(&webhook)
+	if err != nil {
+		return models.Webhook{}, localErrs.InternalServerErr.WithMsg("failed to parse webhook struct").WithErr(err)
+	}
+
+	return webhook, nil
+}
+
+func (w *webhookRepository) GetWebhooksFromUser(ctx context.Context, userID string) ([]models.Webhook, error) {
+	docs, err := w.client.Collection("webhooks").Where("user_id", "==", userID).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve webhooks").WithErr(err)
+	}
+
+	webhooks := make([]models.Webhook, len(docs))
+	for i, doc := range docs {
+		err = doc.DataTo(&webhooks[i])
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to parse webhook struct").WithErr(err)
+		}
+	}
+
+	return webhooks, nil
+}
+
+func (w *webhookRepository) DeleteWebhook(ctx context.Context, webhookID string) error {
+	_, err := w.client.Collection("webhooks").Doc(webhookID).Delete(ctx, firestore.Exists)
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return localErrs.NotFoundErr.WithMsg("webhook not found").WithErr(err)
+		}
+		return localErrs.InternalServerErr.WithMsg("failed to delete webhook").WithErr(err)
+	}
+
+	return nil
+}
+
+// IncrementFailures atomically increments the consecutive failures, returning the new value
+func (w *webhookRepository) IncrementFailures(ctx context.Context, webhookID string) (int, error) {
+	ref := w.client.Collection("webhooks").Doc(webhookID)
+	var failures int
+	err := w.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		doc, err := tx.Get(ref)
+		if err != nil {
+			return err
+		}
+
+		var webhook models.Webhook
+		err = doc.DataTo(&webhook)
+		if err != nil {
+			return err
+		}
+
+		failures = webhook.ConsecutiveFailures + 1
+		return tx.Update(ref, []firestore.Update{{Path: "consecutive_failures", Value: failures}})
+	})
+	if err != nil {
+		return 0, localErrs.InternalServerErr.WithMsg("failed to increment webhook failures").WithErr(err)
+	}
+
+	return failures, nil
+}
+
+func (w *webhookRepository) ResetFailures(ctx context.Context, webhookID string) error {
+	_, err := w.client.Collection("webhooks").Doc(webhookID).Update(ctx, []firestore.Update{
+		{Path: "consecutive_failures", Value: 0},
+	})
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to reset webhook failures").WithErr(err)
+	}
+
+	return nil
+}
+
+func (w *webhookRepository) DisableWebhook(ctx context.Context, webhookID string) error {
+	_, err := w.client.Collection("webhooks").Doc(webhookID).Update(ctx, []firestore.Update{
+		{Path: "enabled", Value: false},
+	})
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to disable webhook").WithErr(err)
+	}
+
+	return nil
+}
+
+func (w *webhookRepository) AddDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	_, err := w.client.Collection("webhooks").Doc(delivery.WebhookID).Collection("deliveries").Doc(delivery.ID).Set(ctx, delivery)
+	if err != nil {
+		return localErrs.InternalServerErr.WithMsg("failed to add webhook delivery").WithErr(err)
+	}
+
+	return nil
+}
+
+func (w *webhookRepository) GetDeliveries(ctx context.Context, webhookID string) ([]models.WebhookDelivery, error) {
+	docs, err := w.client.Collection("webhooks").Doc(webhookID).Collection("deliveries").
+		OrderBy("time", firestore.Desc).
+		Limit(MaxWebhookDeliveries).
+		Documents(ctx).GetAll()
+	if err != nil {
+		return nil, localErrs.InternalServerErr.WithMsg("failed to retrieve webhook deliveries").WithErr(err)
+	}
+
+	deliveries := make([]models.WebhookDelivery, len(docs))
+	for i, doc := range docs {
+		err = doc.DataTo(&deliveries[i])
+		if err != nil {
+			return nil, localErrs.InternalServerErr.WithMsg("failed to parse webhook delivery struct").WithErr(err)
+		}
+	}
+
+	return deliveries, nil
+}